@@ -0,0 +1,68 @@
+package bot
+
+import "sync"
+
+// storyActors runs every operation on a tracked story, fetching, sending,
+// editing or deleting its messages and saving or removing it, on the
+// goroutine of that story's actor, one at a time and in the order they were
+// sent. The poll, cleanup and the other cycles only send operations to the
+// actors, so a story is never edited after its messages were deleted nor
+// saved back after its removal, while different stories are handled
+// concurrently.
+//
+// An actor is started by the first operation for its story and exits once it
+// has no operations left, so idle stories cost nothing.
+type storyActors struct {
+	mutex  sync.Mutex
+	actors map[int64]*storyActor
+}
+
+type storyActor struct {
+	inbox chan func()
+	// pending counts the operations sent to the actor and not done yet.
+	pending int
+}
+
+// do runs op on the actor of the story with the given ID and returns once op
+// has returned. An operation may send operations to another story's actor,
+// as taking over a merged story does, but only an untracked story's actor
+// does so, and only to tracked stories, so actors never wait on each other
+// in a cycle.
+func (a *storyActors) do(id int64, op func()) {
+	a.mutex.Lock()
+	if a.actors == nil {
+		a.actors = make(map[int64]*storyActor)
+	}
+	actor, ok := a.actors[id]
+	if !ok {
+		actor = &storyActor{inbox: make(chan func())}
+		a.actors[id] = actor
+		go a.run(id, actor)
+	}
+	actor.pending++
+	a.mutex.Unlock()
+
+	done := make(chan struct{})
+	actor.inbox <- func() {
+		defer close(done)
+		op()
+	}
+	<-done
+}
+
+func (a *storyActors) run(id int64, actor *storyActor) {
+	for op := range actor.inbox {
+		op()
+
+		a.mutex.Lock()
+		actor.pending--
+		idle := actor.pending == 0
+		if idle {
+			delete(a.actors, id)
+		}
+		a.mutex.Unlock()
+		if idle {
+			return
+		}
+	}
+}
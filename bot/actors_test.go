@@ -0,0 +1,84 @@
+package bot
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// TestCleanupAndPollDoNotRace runs cleanup's delete and poll's edit of the
+// same expired story at once, many times over, as run under go test -race.
+func TestCleanupAndPollDoNotRace(t *testing.T) {
+	hnServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Let either side get ahead
+		time.Sleep(time.Duration(rand.Intn(3)) * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":1,"type":"story","by":"pg","title":"Race","url":"https://example.com/race","score":42,"descendants":7}`)
+	}))
+	defer hnServer.Close()
+
+	for i := 0; i < 10; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			b, tg := newTestBot(t, nil, map[string]string{"SCORE_THRESHOLD": "40"})
+			b.hn.BaseURL = hnServer.URL + "/v0"
+
+			story := &storage.Story{ID: 1, Title: "Race", URL: "https://example.com/race", Type: "story",
+				Score: 10, State: storage.StateExpiring, MissedPolls: DefaultCleanupAfterPolls}
+			story.SetMessage("-100123", 5)
+			b.storage.Lock()
+			b.storage.Stories[story.ID] = story
+			b.storage.Unlock()
+			b.setFrontPage(nil)
+
+			poll := func() {
+				b.actors.do(story.ID, func() { b.processStory(diffFrontPage(nil, []int64{story.ID}), story.ID, false) })
+			}
+			cleanup := func() {
+				if err := b.cleanup(); err != nil {
+					t.Error(err)
+				}
+			}
+			first, second := poll, cleanup
+			if i%2 == 1 {
+				first, second = cleanup, poll
+			}
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				first()
+			}()
+			go func() {
+				defer wg.Done()
+				time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+				second()
+			}()
+			wg.Wait()
+
+			deleted := false
+			for _, call := range tg.called("") {
+				if call.req["message_id"] != float64(5) {
+					continue
+				}
+				switch {
+				case call.method == "deleteMessage":
+					deleted = true
+				case deleted:
+					t.Errorf("%s of message 5 after it was deleted", call.method)
+				}
+			}
+
+			b.storage.RLock()
+			defer b.storage.RUnlock()
+			if stored := b.storage.Stories[story.ID]; deleted && stored != nil && stored.Messages["-100123"].MessageID == 5 {
+				t.Errorf("deleted story saved back in state %s with message 5", stored.State)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package bot
+
+import (
+	"html"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+func (b *Bot) registerAnnounce() {
+	b.handleCommand("announce", b.announceCommand)
+}
+
+// announceCommand posts "/announce [--pin] <text>" from the admin chat to the
+// main chat as the bot. The text is sent as written, without markup, and
+// pinned with --pin. Without ADMIN_CHAT_ID the command is ignored.
+func (b *Bot) announceCommand(msg *telegram.Message, args string) {
+	config := b.cfg()
+	if !config.isAdminChat(msg.Chat) {
+		return
+	}
+
+	lang := b.chatLanguage(msg.Chat)
+	text, pin := args, false
+	if rest, ok := strings.CutPrefix(args, "--pin"); ok && (rest == "" || unicode.IsSpace(rune(rest[0]))) {
+		text, pin = strings.TrimSpace(rest), true
+	}
+	if text == "" {
+		b.reply(msg, tr(lang, "announce_usage"), nil)
+		return
+	}
+
+	sent, err := b.tg.SendMessage(telegram.SendMessageRequest{
+		ChatID:    config.ChatID,
+		Text:      html.EscapeString(text),
+		ParseMode: "HTML",
+	})
+	if err != nil {
+		b.count(storage.Counters{APIErrors: 1})
+		log.Printf("Error posting announcement to %s: %v", config.ChatID, err)
+		b.reply(msg, tr(lang, "announce_failed", html.EscapeString(err.Error())), nil)
+		return
+	}
+	log.Printf("Posted announcement from %s to %s as message %d", userName(msg.From), config.ChatID, sent.MessageID)
+
+	if pin {
+		err := b.tg.Call("pinChatMessage", telegram.PinChatMessageRequest{
+			ChatID:              config.ChatID,
+			MessageID:           sent.MessageID,
+			DisableNotification: true,
+		}, nil)
+		if err != nil {
+			b.count(storage.Counters{APIErrors: 1})
+			log.Printf("Error pinning announcement %d in %s: %v", sent.MessageID, config.ChatID, err)
+			b.reply(msg, tr(lang, "announce_unpinned", html.EscapeString(err.Error())), nil)
+			return
+		}
+	}
+	b.reply(msg, tr(lang, "announce_posted", html.EscapeString(config.ChatID)), nil)
+}
+
+// userName is how a user is named in logs: @username, or the first name.
+func userName(user *telegram.User) string {
+	switch {
+	case user == nil:
+		return "an anonymous admin"
+	case user.Username != "":
+		return "@" + user.Username
+	}
+	return user.FirstName
+}
@@ -0,0 +1,299 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+var (
+	errAlreadyPosted = errors.New("story is already posted")
+	errNotAStory     = errors.New("item is not a story")
+
+	// errSendUnconfirmed is returned for sends held back because an earlier
+	// send of the story to the chat may have gone through.
+	errSendUnconfirmed = errors.New("an earlier send of the story is unconfirmed")
+)
+
+// runAPI serves the HTTP API used by external automation to trigger polls,
+// cleanups and manual posting decisions.
+func (b *Bot) runAPI(ctx context.Context) {
+	config := b.cfg()
+	if config.APIAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/poll", b.apiHandler(b.apiPoll))
+	mux.HandleFunc("/api/cleanup", b.apiHandler(b.apiCleanup))
+	mux.HandleFunc("/api/post/", b.apiHandler(b.apiPost))
+	mux.HandleFunc("/api/suppress/", b.apiHandler(b.apiSuppress))
+	mux.HandleFunc("/api/stats", b.apiHandler(b.apiStats))
+	mux.HandleFunc("/api/snapshots", b.apiHandler(b.apiSnapshots))
+	mux.HandleFunc("/api/queue", b.apiHandler(b.apiQueue))
+	mux.HandleFunc("/api/queue/flush", b.apiHandler(b.apiQueueFlush))
+	mux.HandleFunc("/api/queue/flush/", b.apiHandler(b.apiQueueFlush))
+	mux.HandleFunc("/api/queue/move/", b.apiHandler(b.apiQueueMove))
+	mux.HandleFunc("/api/queue/drop/", b.apiHandler(b.apiQueueDrop))
+
+	server := &http.Server{
+		Addr:              config.APIAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		server.Shutdown(context.Background())
+	}()
+
+	log.Printf("HTTP API listening on %s", config.APIAddr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		b.event(EventWarning, "HTTP API stopped: %v", err)
+	}
+}
+
+// apiHandler wraps an endpoint with method and bearer token checks and
+// writes its result as JSON.
+func (b *Bot) apiHandler(endpoint func(r *http.Request) (any, int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAPIResponse(w, http.StatusMethodNotAllowed, nil, errors.New("method not allowed"))
+			return
+		}
+
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(b.cfg().APIToken)) != 1 {
+			writeAPIResponse(w, http.StatusUnauthorized, nil, errors.New("invalid or missing token"))
+			return
+		}
+
+		result, status, err := endpoint(r)
+		log.Printf("API %s %s: %d", r.Method, r.URL.Path, status)
+		writeAPIResponse(w, status, result, err)
+	}
+}
+
+func writeAPIResponse(w http.ResponseWriter, status int, result any, err error) {
+	response := map[string]any{"ok": err == nil}
+	if err != nil {
+		response["error"] = err.Error()
+	} else if result != nil {
+		response["result"] = result
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+func storyIDFromPath(r *http.Request, prefix string) (int64, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, prefix), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid story id in %s", r.URL.Path)
+	}
+	return id, nil
+}
+
+func (b *Bot) apiPoll(r *http.Request) (any, int, error) {
+	b.PollAndCleanup()
+	return b.stateCounts(), http.StatusOK, nil
+}
+
+func (b *Bot) apiCleanup(r *http.Request) (any, int, error) {
+	b.cleanupNow()
+	return b.stateCounts(), http.StatusOK, nil
+}
+
+func (b *Bot) apiStats(r *http.Request) (any, int, error) {
+	return map[string]any{
+		"states":      b.stateCounts(),
+		"metrics":     b.storage.MetricsSnapshot(),
+		"requests":    b.outbound.hostCounters(),
+		"memory":      b.memoryStats(),
+		"degradation": b.degradeStatus(),
+	}, http.StatusOK, nil
+}
+
+// apiSnapshots returns the front page snapshots of the last ?since=, which
+// takes the values of digest export --since and defaults to a day.
+func (b *Bot) apiSnapshots(r *http.Request) (any, int, error) {
+	since := sinceFlag(24 * time.Hour)
+	if value := r.URL.Query().Get("since"); value != "" {
+		if err := since.Set(value); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	snapshots := b.storage.SnapshotsSince(b.clock.Now().Add(-time.Duration(since)))
+	if snapshots == nil {
+		snapshots = []storage.Snapshot{}
+	}
+	return snapshots, http.StatusOK, nil
+}
+
+func (b *Bot) apiQueue(r *http.Request) (any, int, error) {
+	return b.Outbox(), http.StatusOK, nil
+}
+
+// apiQueueFlush flushes the whole queue, or with an id in the path only that
+// story, see FlushOutbox.
+func (b *Bot) apiQueueFlush(r *http.Request) (any, int, error) {
+	var id int64
+	if r.URL.Path != "/api/queue/flush" {
+		var err error
+		if id, err = storyIDFromPath(r, "/api/queue/flush/"); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+	}
+	flushed, err := b.FlushOutbox(id)
+	switch {
+	case errors.Is(err, errNotInOutbox):
+		return nil, http.StatusNotFound, err
+	case err != nil:
+		return nil, http.StatusBadGateway, err
+	}
+	return map[string]int{"flushed": flushed}, http.StatusOK, nil
+}
+
+// apiQueueMove moves a queued story to ?position=.
+func (b *Bot) apiQueueMove(r *http.Request) (any, int, error) {
+	id, err := storyIDFromPath(r, "/api/queue/move/")
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	position, err := strconv.Atoi(r.URL.Query().Get("position"))
+	if err != nil || position < 1 {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid position %q", r.URL.Query().Get("position"))
+	}
+	if err := b.MoveInOutbox(id, position); err != nil {
+		return nil, http.StatusConflict, err
+	}
+	return b.Outbox(), http.StatusOK, nil
+}
+
+func (b *Bot) apiQueueDrop(r *http.Request) (any, int, error) {
+	id, err := storyIDFromPath(r, "/api/queue/drop/")
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err = b.DropFromOutbox(id)
+	switch {
+	case errors.Is(err, errNotInOutbox):
+		return nil, http.StatusNotFound, err
+	case err != nil:
+		return nil, http.StatusConflict, err
+	}
+	return nil, http.StatusOK, nil
+}
+
+func (b *Bot) apiPost(r *http.Request) (any, int, error) {
+	id, err := storyIDFromPath(r, "/api/post/")
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	story, err := b.Post(id)
+	switch {
+	case errors.Is(err, errAlreadyPosted), errors.Is(err, errSendUnconfirmed):
+		return nil, http.StatusConflict, err
+	case errors.Is(err, errNotAStory):
+		return nil, http.StatusUnprocessableEntity, err
+	case err != nil:
+		return nil, http.StatusBadGateway, err
+	}
+	return story.Messages, http.StatusOK, nil
+}
+
+func (b *Bot) apiSuppress(r *http.Request) (any, int, error) {
+	id, err := storyIDFromPath(r, "/api/suppress/")
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err := b.Suppress(id); err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+	return nil, http.StatusOK, nil
+}
+
+// Post posts a story to the main chat regardless of thresholds. A
+// suppressed story is posted again.
+func (b *Bot) Post(id int64) (story *storage.Story, err error) {
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	b.actors.do(id, func() { story, err = b.post(id) })
+	return story, err
+}
+
+// post implements Post on the story's actor.
+func (b *Bot) post(id int64) (*storage.Story, error) {
+	story, err := b.getStoryDetails(id)
+	if err != nil {
+		return nil, err
+	}
+	if story.Type != "story" {
+		return nil, errNotAStory
+	}
+	if stored, exists := b.getStoredStory(id); exists {
+		story.CarryOver(stored, b.clock.Now())
+	}
+
+	chatID := b.cfg().ChatID
+	if _, sent := story.Messages[chatID]; sent {
+		return nil, errAlreadyPosted
+	}
+	if story.URL == "" {
+		story.URL = hn.ItemURL(id)
+	}
+	if err := b.sendMessage(story, chatID); err != nil {
+		return nil, err
+	}
+	log.Printf("Posted story on request: %d - %s", story.ID, story.Title)
+	return story, nil
+}
+
+// Suppress removes a story's messages and keeps it from being posted while
+// it is tracked. Messages Telegram refuses to delete stay in their chats.
+func (b *Bot) Suppress(id int64) (err error) {
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	b.actors.do(id, func() { err = b.suppress(id) })
+	return err
+}
+
+// suppress implements Suppress on the story's actor.
+func (b *Bot) suppress(id int64) error {
+	story, exists := b.getStoredStory(id)
+	if !exists {
+		story = &storage.Story{ID: id}
+	}
+
+	for chatID, msg := range story.Messages {
+		err := b.tg.DeleteMessage(chatID, msg.MessageID)
+		if err != nil && !errors.Is(err, telegram.ErrCannotDelete) {
+			b.count(storage.Counters{APIErrors: 1})
+			return fmt.Errorf("chat %s: %w", chatID, err)
+		}
+		if err == nil {
+			b.count(storage.Counters{Deleted: 1})
+		}
+		delete(story.Messages, chatID)
+	}
+
+	if err := b.transition(story, storage.StateSuppressed); err != nil {
+		return err
+	}
+	return b.saveStory(story)
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/fetch"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/summarize"
+)
+
+const (
+	// ArticleCacheDir is the directory in the state directory the extracted
+	// text of articles is cached in, for ArticleCacheTTL.
+	ArticleCacheDir = "articles"
+	ArticleCacheTTL = 7 * 24 * time.Hour
+
+	// ArticleFetchTimeout bounds downloading an article.
+	ArticleFetchTimeout = 15 * time.Second
+)
+
+// articleCache downloads articles and extracts their text once per canonical
+// URL, see storage.URLKey, keeping the text on disk. Enrichers that need the
+// text of the same article, retries and restarts reuse it.
+type articleCache struct {
+	dir     string
+	fetcher *fetch.Fetcher
+
+	mutex    sync.Mutex
+	inflight map[string]*articleFetch
+}
+
+// articleFetch is a download in progress that other callers wait for.
+type articleFetch struct {
+	done chan struct{}
+	text string
+	err  error
+}
+
+func newArticleCache(dir string, fetcher *fetch.Fetcher) *articleCache {
+	return &articleCache{dir: dir, fetcher: fetcher, inflight: make(map[string]*articleFetch)}
+}
+
+// text returns the text of the article at rawURL, or "" when it is not an
+// HTML page, is too large or robots.txt disallows fetching it.
+func (c *articleCache) text(ctx context.Context, rawURL string) (string, error) {
+	path := filepath.Join(c.dir, storage.URLKey(rawURL)+".txt")
+	if data, err := os.ReadFile(path); err == nil {
+		return string(data), nil
+	}
+
+	c.mutex.Lock()
+	fetch, ok := c.inflight[path]
+	if !ok {
+		fetch = &articleFetch{done: make(chan struct{})}
+		c.inflight[path] = fetch
+	}
+	c.mutex.Unlock()
+	if ok {
+		select {
+		case <-fetch.done:
+			return fetch.text, fetch.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	fetch.text, fetch.err = c.fetch(ctx, rawURL)
+	if fetch.err == nil {
+		if err := writeFileAtomic(path, []byte(fetch.text)); err != nil {
+			log.Printf("Error caching article %s: %v", rawURL, err)
+		}
+	}
+	c.mutex.Lock()
+	delete(c.inflight, path)
+	c.mutex.Unlock()
+	close(fetch.done)
+	return fetch.text, fetch.err
+}
+
+// fetch downloads the page at rawURL and extracts its text.
+func (c *articleCache) fetch(ctx context.Context, rawURL string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, ArticleFetchTimeout)
+	defer cancel()
+
+	resp, err := c.fetcher.Page(ctx, rawURL, "text/html", "application/xhtml+xml")
+	if errors.Is(err, fetch.ErrContentType) || errors.Is(err, fetch.ErrTooLarge) || errors.Is(err, fetch.ErrDisallowed) {
+		log.Printf("Not extracting article %s: %v", rawURL, err)
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch article: %w", err)
+	}
+	return summarize.ExtractText(string(resp.Body)), nil
+}
+
+// prune removes the cached articles last written before now minus
+// ArticleCacheTTL and returns how many it removed.
+func (c *articleCache) prune(now time.Time) (int, error) {
+	entries, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list article cache: %w", err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < ArticleCacheTTL {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err != nil {
+			return removed, fmt.Errorf("failed to remove cached article: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// writeFileAtomic writes data to path through a temporary file, so readers
+// never see a partly written file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+const DefaultAuditFile = "audit.jsonl"
+
+// auditedMethods are the Bot API methods that change what a chat shows.
+var auditedMethods = map[string]bool{
+	"sendMessage":            true,
+	"sendPhoto":              true,
+	"editMessageText":        true,
+	"editMessageReplyMarkup": true,
+	"editMessageCaption":     true,
+	"editMessageMedia":       true,
+	"deleteMessage":          true,
+	"pinChatMessage":         true,
+}
+
+// AuditEntry is one Telegram mutation as written to the audit log.
+type AuditEntry struct {
+	Time        time.Time `json:"time"`
+	Method      string    `json:"method"`
+	ChatID      string    `json:"chat_id"`
+	MessageID   int64     `json:"message_id,omitempty"`
+	PayloadHash string    `json:"payload_sha256"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// auditLog appends an AuditEntry for every send, edit and delete to a file
+// that is never rewritten.
+type auditLog struct {
+	mutex sync.Mutex
+	file  *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &auditLog{file: file}, nil
+}
+
+// onCall is the telegram.Client OnCall hook.
+func (b *Bot) onCall(method string, req []byte, result json.RawMessage, err error) {
+	b.record(method, req, result, err)
+	b.observeCall(err)
+}
+
+// record writes a call to the audit log.
+func (b *Bot) record(method string, req []byte, result json.RawMessage, err error) {
+	if b.audit == nil || !auditedMethods[method] {
+		return
+	}
+
+	var target struct {
+		ChatID    string `json:"chat_id"`
+		MessageID int64  `json:"message_id"`
+	}
+	json.Unmarshal(req, &target)
+	if target.MessageID == 0 && result != nil {
+		json.Unmarshal(result, &target) // the sent message
+	}
+
+	sum := sha256.Sum256(req)
+	entry := AuditEntry{
+		Time:        b.clock.Now().UTC(),
+		Method:      method,
+		ChatID:      target.ChatID,
+		MessageID:   target.MessageID,
+		PayloadHash: hex.EncodeToString(sum[:]),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	b.audit.mutex.Lock()
+	defer b.audit.mutex.Unlock()
+	if _, err := b.audit.file.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
+
+func (a *auditLog) Close() error {
+	return a.file.Close()
+}
+
+// RunAudit implements `audit`, which prints the audit log entries matching
+// the given filters. Of opts, only WithClock applies.
+func RunAudit(args []string, out io.Writer, opts ...Option) error {
+	clock := newOptions(opts).clock
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	path := flags.String("path", config.AuditPath, "audit log to read")
+	chatID := flags.String("chat", "", "only entries for this chat ID")
+	messageID := flags.Int64("message", 0, "only entries for this message ID")
+	method := flags.String("method", "", "only sendMessage, editMessageText or deleteMessage")
+	since := flags.Duration("since", 0, "only entries from the last duration, e.g. 24h")
+	failed := flags.Bool("failed", false, "only failed calls")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer file.Close()
+
+	var cutoff time.Time
+	if *since > 0 {
+		cutoff = clock.Now().Add(-*since)
+	}
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("%s line %d: %w", *path, line, err)
+		}
+		if (*chatID != "" && entry.ChatID != *chatID) ||
+			(*messageID != 0 && entry.MessageID != *messageID) ||
+			(*method != "" && entry.Method != *method) ||
+			entry.Time.Before(cutoff) ||
+			(*failed && entry.Error == "") {
+			continue
+		}
+
+		status := "ok"
+		if entry.Error != "" {
+			status = entry.Error
+		}
+		fmt.Fprintf(out, "%s  %-15s  %-20s  %10d  %.12s  %s\n",
+			entry.Time.Format(time.RFC3339), entry.Method, entry.ChatID, entry.MessageID, entry.PayloadHash, status)
+	}
+	return scanner.Err()
+}
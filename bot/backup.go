@@ -0,0 +1,299 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+const (
+	DefaultBackupInterval = time.Hour
+	DefaultBackupRegion   = "us-east-1"
+	DefaultBackupKey      = "stories.json"
+)
+
+// BackupConfig describes an S3-compatible bucket (AWS S3, GCS interoperability
+// mode, Cloudflare R2, MinIO, ...) that storage snapshots are copied to.
+type BackupConfig struct {
+	Endpoint  string   `json:"endpoint,omitempty" yaml:"endpoint,omitempty" toml:"endpoint,omitempty"`
+	Bucket    string   `json:"bucket,omitempty" yaml:"bucket,omitempty" toml:"bucket,omitempty"`
+	Region    string   `json:"region,omitempty" yaml:"region,omitempty" toml:"region,omitempty"`
+	Key       string   `json:"key,omitempty" yaml:"key,omitempty" toml:"key,omitempty"`
+	AccessKey string   `json:"access_key,omitempty" yaml:"access_key,omitempty" toml:"access_key,omitempty"`
+	SecretKey string   `json:"secret_key,omitempty" yaml:"secret_key,omitempty" toml:"secret_key,omitempty"`
+	Interval  Duration `json:"interval,omitempty" yaml:"interval,omitempty" toml:"interval,omitempty"`
+}
+
+// merge overrides fields with the ones set in other.
+func (c *BackupConfig) merge(other BackupConfig) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.Endpoint, other.Endpoint},
+		{&c.Bucket, other.Bucket},
+		{&c.Region, other.Region},
+		{&c.Key, other.Key},
+		{&c.AccessKey, other.AccessKey},
+		{&c.SecretKey, other.SecretKey},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if other.Interval != 0 {
+		c.Interval = other.Interval
+	}
+}
+
+func (c *BackupConfig) applyEnv() error {
+	accessKey, err := secretEnv("BACKUP_S3_ACCESS_KEY")
+	if err != nil {
+		return err
+	}
+	secretKey, err := secretEnv("BACKUP_S3_SECRET_KEY")
+	if err != nil {
+		return err
+	}
+	c.merge(BackupConfig{
+		Endpoint:  os.Getenv("BACKUP_S3_ENDPOINT"),
+		Bucket:    os.Getenv("BACKUP_S3_BUCKET"),
+		Region:    os.Getenv("BACKUP_S3_REGION"),
+		Key:       os.Getenv("BACKUP_S3_KEY"),
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+
+	if interval := os.Getenv("BACKUP_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("invalid BACKUP_INTERVAL %q: %w", interval, err)
+		}
+		c.Interval = Duration(d)
+	}
+	return nil
+}
+
+func (c BackupConfig) enabled() bool {
+	return c.Bucket != ""
+}
+
+func (c BackupConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	if c.Endpoint == "" || c.AccessKey == "" || c.SecretKey == "" {
+		return fmt.Errorf("backup requires endpoint, access key and secret key when a bucket is set")
+	}
+	if _, err := url.Parse(c.Endpoint); err != nil {
+		return fmt.Errorf("invalid backup endpoint: %w", err)
+	}
+	if time.Duration(c.Interval) < time.Minute {
+		return fmt.Errorf("backup interval must be at least 1m, got %v", time.Duration(c.Interval))
+	}
+	return nil
+}
+
+var errBackupNotFound = errors.New("backup object not found")
+
+// s3Client is a minimal S3 client supporting single-object PUT and GET with
+// AWS Signature Version 4, enough to store one storage snapshot.
+type s3Client struct {
+	config     BackupConfig
+	httpClient *http.Client
+}
+
+func (c *s3Client) objectURL() string {
+	return strings.TrimRight(c.config.Endpoint, "/") + "/" + s3EscapePath(c.config.Bucket+"/"+c.config.Key)
+}
+
+func (c *s3Client) put(body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, c.objectURL(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create backup request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	c.sign(req, body, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("backup upload failed with status %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+func (c *s3Client) get() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, c.objectURL(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create restore request: %w", err)
+	}
+	c.sign(req, nil, time.Now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errBackupNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("backup download failed with status %d: %s", resp.StatusCode, msg)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+func (c *s3Client) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + c.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.config.SecretKey), date)
+	key = hmacSHA256(key, c.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.config.AccessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath percent-encodes every path segment as required by SigV4.
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		var sb strings.Builder
+		for _, b := range []byte(segment) {
+			if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') ||
+				b == '-' || b == '_' || b == '.' || b == '~' {
+				sb.WriteByte(b)
+			} else {
+				fmt.Fprintf(&sb, "%%%02X", b)
+			}
+		}
+		segments[i] = sb.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+func (b *Bot) backupClient() *s3Client {
+	return &s3Client{config: b.cfg().Backup, httpClient: b.httpClient}
+}
+
+// restoreBackup loads the latest snapshot into a freshly created storage,
+// e.g. on a new host with ephemeral disk, and reports whether it did.
+func restoreBackup(config Config, httpClient *http.Client, store *storage.Store) (bool, error) {
+	if !config.Backup.enabled() {
+		return false, nil
+	}
+
+	client := &s3Client{config: config.Backup, httpClient: httpClient}
+	data, err := client.get()
+	if errors.Is(err, errBackupNotFound) {
+		log.Printf("No backup found in bucket %s, starting with empty storage", config.Backup.Bucket)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := store.Restore(data); err != nil {
+		return false, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	if err := store.Save(); err != nil {
+		return false, fmt.Errorf("failed to save restored data: %w", err)
+	}
+	log.Printf("Restored storage from backup s3://%s/%s (%d bytes)", config.Backup.Bucket, config.Backup.Key, len(data))
+	return true, nil
+}
+
+func (b *Bot) backup() error {
+	data, err := b.storage.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot storage: %w", err)
+	}
+	return b.backupClient().put(data)
+}
+
+func (b *Bot) runBackups(ctx context.Context) {
+	config := b.cfg().Backup
+	if !config.enabled() {
+		return
+	}
+
+	ticker := b.clock.NewTicker(time.Duration(config.Interval))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		if err := b.backup(); err != nil {
+			b.event(EventWarning, "Storage backup failed: %v", err)
+		} else {
+			log.Printf("Uploaded storage backup to s3://%s/%s", config.Bucket, config.Key)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// The bench data stands for a bot that has run for a while: a full front
+// page, the stories still tracked from earlier polls, the history kept for
+// digests and a week of hourly snapshots.
+const (
+	BenchTrackedStories = 300
+	BenchHistoryStories = 2000
+	BenchSnapshots      = 7 * 24
+)
+
+// benchmark is one step of the poll cycle's decision path with its
+// performance budget per operation: a full front page, or a single save.
+// The same operations run as Go benchmarks in bench_test.go.
+type benchmark struct {
+	name   string
+	budget time.Duration
+	op     func(data *benchData) error
+}
+
+// benchmarks is the performance budget of the poll cycle. A poll of
+// BATCH_SIZE stories spends most of its time waiting for the HN API and
+// Telegram; the budgets keep the bot's own work far below that, and leave
+// headroom for slower CI machines.
+var benchmarks = []benchmark{
+	{"PollDiff", 200 * time.Microsecond, benchDiff},
+	{"PollFilters", time.Millisecond, benchFilters},
+	{"PollRender", 2 * time.Millisecond, benchRender},
+	{"StorageSave", 250 * time.Millisecond, benchStorageSave},
+}
+
+// benchData is what the benchmarks run on.
+type benchData struct {
+	config   Config
+	previous map[int64]int
+	current  []int64
+	stories  []*storage.Story
+	store    *storage.Store
+}
+
+// benchResult is how long a benchmark took for n operations and what it
+// allocated meanwhile.
+type benchResult struct {
+	n       int
+	elapsed time.Duration
+	bytes   uint64
+	allocs  uint64
+}
+
+// perOp returns the average time of one operation.
+func (r benchResult) perOp() time.Duration {
+	if r.n == 0 {
+		return 0
+	}
+	return r.elapsed / time.Duration(r.n)
+}
+
+// String formats the result like `go test -bench -benchmem`.
+func (r benchResult) String() string {
+	n := uint64(max(r.n, 1))
+	return fmt.Sprintf("%8d\t%10d ns/op\t%8d B/op\t%8d allocs/op", r.n, r.perOp().Nanoseconds(), r.bytes/n, r.allocs/n)
+}
+
+// benchtime is how long to run each benchmark: for a duration, or n times.
+type benchtime struct {
+	d time.Duration
+	n int
+}
+
+// parseBenchtime parses a duration like 2s, or a count like 100x, as
+// `go test -benchtime` does.
+func parseBenchtime(s string) (benchtime, error) {
+	if count, ok := strings.CutSuffix(s, "x"); ok {
+		n, err := strconv.Atoi(count)
+		if err != nil || n <= 0 {
+			return benchtime{}, fmt.Errorf("invalid benchtime %q: count must be a positive number", s)
+		}
+		return benchtime{n: n}, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return benchtime{}, fmt.Errorf("invalid benchtime %q: must be a positive duration or a count like 100x", s)
+	}
+	return benchtime{d: d}, nil
+}
+
+// measure runs op once to warm up, then in doubling batches until the
+// benchtime is spent, and returns the time and allocations of the timed runs.
+func measure(op func() error, bt benchtime) (benchResult, error) {
+	if err := op(); err != nil {
+		return benchResult{}, err
+	}
+
+	var result benchResult
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for batch := 1; ; batch *= 2 {
+		if bt.n > 0 {
+			batch = bt.n
+		}
+		for i := 0; i < batch; i++ {
+			if err := op(); err != nil {
+				return benchResult{}, err
+			}
+		}
+		result.n += batch
+		result.elapsed = time.Since(start)
+		if bt.n > 0 || result.elapsed >= bt.d {
+			break
+		}
+	}
+	runtime.ReadMemStats(&after)
+	result.bytes = after.TotalAlloc - before.TotalAlloc
+	result.allocs = after.Mallocs - before.Mallocs
+	return result, nil
+}
+
+// RunBench implements `bench`, which runs the benchmarks of the poll cycle
+// and compares them with their budget. The results are printed in the
+// format of `go test -bench -benchmem`, for benchstat, and it fails when a
+// benchmark is over budget, so it can gate CI. Storage is saved once per
+// processed story, so its budget is for a single save.
+func RunBench(args []string, out io.Writer) error {
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	// Nothing is sent, the key only has to pass validation
+	if config.BotKey == "" {
+		config.BotKey = "bench"
+	}
+	if err := config.validate(); err != nil {
+		return err
+	}
+	// The store is written to a temporary file, never to the shared server
+	if config.StorageBackend == storage.BackendRedis {
+		return fmt.Errorf("bench measures the file backends, set STORAGE_BACKEND to %s or %s", storage.BackendJSON, storage.BackendSQLite)
+	}
+
+	flags := flag.NewFlagSet("bench", flag.ContinueOnError)
+	fixtures := flags.String("fixtures", "", "directory written by `fixtures capture` to take the front page from, instead of generated stories")
+	benchtime := flags.String("benchtime", "1s", "run each benchmark for this long, or N times with Nx")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	bt, err := parseBenchtime(*benchtime)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "tg_hacker_news-bench")
+	if err != nil {
+		return fmt.Errorf("failed to create bench directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, err := newBenchData(config, *fixtures, filepath.Join(dir, "bench"))
+	if err != nil {
+		return err
+	}
+	defer data.store.Close()
+
+	over := 0
+	for _, bench := range benchmarks {
+		result, err := measure(func() error { return bench.op(data) }, bt)
+		if err != nil {
+			return fmt.Errorf("benchmark %s failed: %w", bench.name, err)
+		}
+		status := "ok"
+		if result.perOp() > bench.budget {
+			status = "OVER BUDGET"
+			over++
+		}
+		fmt.Fprintf(out, "Benchmark%s\t%s\t# budget %v %s\n", bench.name, result, bench.budget, status)
+	}
+	if over > 0 {
+		return fmt.Errorf("%d of %d benchmarks over budget", over, len(benchmarks))
+	}
+	return nil
+}
+
+// newBenchData generates the bench data, with the front page from a fixtures
+// directory when one is given. The store is created at path with the
+// configured backend.
+func newBenchData(config Config, fixtures, path string) (*benchData, error) {
+	// A fixed seed keeps runs comparable
+	random := rand.New(rand.NewSource(1))
+	data := &benchData{config: config, previous: make(map[int64]int)}
+
+	if fixtures != "" {
+		stories, err := readFixtureStories(fixtures)
+		if err != nil {
+			return nil, err
+		}
+		data.stories = stories
+	} else {
+		for i := 0; i < config.BatchSize; i++ {
+			data.stories = append(data.stories, benchStory(random, int64(40000000+i), config.ChatID))
+		}
+	}
+	for i, story := range data.stories {
+		story.Rank = i + 1
+		data.current = append(data.current, story.ID)
+		// Most stories stay on the list and move by a few places
+		if i%5 != 0 {
+			data.previous[story.ID] = max(1, i+1+random.Intn(7)-3)
+		}
+	}
+
+	store, err := storage.Open(storage.Options{Backend: config.StorageBackend, Path: path})
+	if err != nil {
+		return nil, err
+	}
+	data.store = store
+	now := time.Now()
+	for _, story := range data.stories {
+		store.Stories[story.ID] = story
+	}
+	for i := 0; i < BenchTrackedStories; i++ {
+		story := benchStory(random, int64(39000000+i), config.ChatID)
+		story.LastSave = now.Add(-time.Duration(i) * time.Minute)
+		store.Stories[story.ID] = story
+	}
+	for i := 0; i < BenchHistoryStories; i++ {
+		story := benchStory(random, int64(30000000+i), config.ChatID)
+		store.RememberHistory(story.Posted("A summary of the article in a sentence or two."))
+	}
+	for i := 0; i < BenchSnapshots; i++ {
+		snapshot := storage.Snapshot{Time: now.Add(-time.Duration(BenchSnapshots-i) * time.Hour)}
+		for rank, story := range data.stories {
+			snapshot.Stories = append(snapshot.Stories, storage.SnapshotStory{ID: story.ID, Rank: rank + 1, Score: story.Score, Comments: story.Descendants})
+		}
+		store.Snapshots = append(store.Snapshots, snapshot)
+	}
+	return data, nil
+}
+
+var benchWords = []string{"Rust", "compiler", "database", "show", "HN", "open", "source", "why", "the", "of",
+	"a", "new", "Linux", "kernel", "startup", "AI", "model", "release", "guide", "history"}
+
+var benchDomains = []string{"github.com", "nytimes.com", "arxiv.org", "blog.example.com", "lwn.net", "youtube.com"}
+
+// benchStory generates a story posted to chatID.
+func benchStory(random *rand.Rand, id int64, chatID string) *storage.Story {
+	title := ""
+	for i := 0; i < 6+random.Intn(8); i++ {
+		if i > 0 {
+			title += " "
+		}
+		title += benchWords[random.Intn(len(benchWords))]
+	}
+	story := &storage.Story{
+		ID:          id,
+		URL:         "https://" + benchDomains[random.Intn(len(benchDomains))] + "/" + strconv.FormatInt(id, 36),
+		Title:       title,
+		By:          "user" + strconv.Itoa(random.Intn(1000)),
+		Descendants: int64(random.Intn(500)),
+		Score:       int64(random.Intn(1000)),
+		Type:        "story",
+		State:       storage.StateUpdating,
+		FirstSeen:   time.Now().Add(-time.Duration(random.Intn(24)) * time.Hour),
+		Enrichments: map[string]string{"summary": "📝 A summary of the article in a sentence or two."},
+	}
+	story.SetMessage(chatID, id)
+	return story
+}
+
+// readFixtureStories reads the front page captured by `fixtures capture`.
+func readFixtureStories(dir string) ([]*storage.Story, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "topstories.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures: %w", err)
+	}
+	var ids []int64
+	if err := json.Unmarshal(data, &ids); err != nil {
+		return nil, fmt.Errorf("failed to decode fixtures: %w", err)
+	}
+
+	var stories []*storage.Story
+	for _, id := range ids {
+		data, err := os.ReadFile(filepath.Join(dir, "item", strconv.FormatInt(id, 10)+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fixtures: %w", err)
+		}
+		var item hn.Item
+		if err := json.Unmarshal(data, &item); err != nil || item.ID == 0 {
+			continue
+		}
+		stories = append(stories, &storage.Story{
+			ID:          item.ID,
+			URL:         item.URL,
+			Title:       item.Title,
+			By:          item.By,
+			Descendants: item.Descendants,
+			Score:       item.Score,
+			Type:        item.Type,
+		})
+	}
+	if len(stories) == 0 {
+		return nil, errors.New("no stories in fixtures")
+	}
+	return stories, nil
+}
+
+func benchDiff(data *benchData) error {
+	diffFrontPage(data.previous, data.current)
+	return nil
+}
+
+func benchFilters(data *benchData) error {
+	now := time.Now()
+	for _, story := range data.stories {
+		data.config.destinations(story, now)
+	}
+	return nil
+}
+
+func benchRender(data *benchData) error {
+	for _, story := range data.stories {
+		messageText(story, data.config, data.config.ChatID, storage.ChatSettings{})
+	}
+	return nil
+}
+
+func benchStorageSave(data *benchData) error {
+	return data.store.Save()
+}
@@ -0,0 +1,71 @@
+package bot
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// runBenchmark runs op on the data of the bench subcommand, with the default
+// configuration.
+func runBenchmark(b *testing.B, op func(data *benchData) error) {
+	b.Setenv("CONFIG_PATH", "")
+	b.Setenv("BOT_KEY", "bench")
+	b.Setenv("CHAT_ID", "-100123")
+	config, err := readConfig()
+	if err != nil {
+		b.Fatal(err)
+	}
+	data, err := newBenchData(config, "", filepath.Join(b.TempDir(), "bench"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer data.store.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := op(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPollDiff(b *testing.B)    { runBenchmark(b, benchDiff) }
+func BenchmarkPollFilters(b *testing.B) { runBenchmark(b, benchFilters) }
+func BenchmarkPollRender(b *testing.B)  { runBenchmark(b, benchRender) }
+func BenchmarkStorageSave(b *testing.B) { runBenchmark(b, benchStorageSave) }
+
+func TestParseBenchtime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want benchtime
+		err  bool
+	}{
+		{in: "1s", want: benchtime{d: time.Second}},
+		{in: "500ms", want: benchtime{d: 500 * time.Millisecond}},
+		{in: "100x", want: benchtime{n: 100}},
+		{in: "0x", err: true},
+		{in: "x", err: true},
+		{in: "-1s", err: true},
+		{in: "soon", err: true},
+	}
+	for _, tt := range tests {
+		got, err := parseBenchtime(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseBenchtime(%q) = %+v, %v, want %+v, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestMeasureRunsCount(t *testing.T) {
+	calls := 0
+	result, err := measure(func() error { calls++; return nil }, benchtime{n: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One more call warms up
+	if result.n != 7 || calls != 8 {
+		t.Errorf("measure ran %d timed and %d calls, want 7 and 8", result.n, calls)
+	}
+}
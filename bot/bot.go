@@ -0,0 +1,1319 @@
+package bot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/cassette"
+	"github.com/daoleno/tg_hacker_news/fetch"
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	DefaultBatchSize       = 30
+	MaxBatchSize           = 500
+	NumCommentsThreshold   = 5
+	ScoreThreshold         = 50
+	DefaultTimeout         = 9 * time.Minute
+	Hot                    = "🔥"
+	DefaultCleanupInterval = 24 * time.Hour
+	MinCleanupInterval     = time.Hour
+	DefaultPollInterval    = 5 * time.Minute
+	MinPollInterval        = 30 * time.Second
+)
+
+// Bot posts Hacker News front-page stories to Telegram and keeps the
+// messages up to date until the stories drop off.
+type Bot struct {
+	config     configHolder
+	storage    *storage.Store
+	httpClient *http.Client
+	hn         *hn.Client
+	tg         *telegram.Client
+	cassette   *cassette.Transport
+	outbound   *outboundTransport
+	dns        *dialer
+	audit      *auditLog
+
+	// frontPage holds the story IDs from the most recent successful poll,
+	// of the top list and the feeds. feedLists holds the list of each feed
+	// and feeds the feeds each story is on.
+	frontPage      map[int64]bool
+	feedLists      map[string][]int64
+	feeds          map[int64][]string
+	frontPageMutex sync.RWMutex
+
+	filters []Filter
+	sinks   []Sink
+	bus     EventBus
+	clock   Clock
+
+	hooks    []TransitionHook
+	events   *eventLog
+	registry commandRegistry
+	searches searchStore
+	radar    radarState
+	spacing  postSpacing
+	budget   budgetState
+	degrade  degradation
+
+	// fetcher fetches for the enrichers, and articles caches the extracted
+	// text of the articles stories link to.
+	fetcher  *fetch.Fetcher
+	articles *articleCache
+
+	// enrichQueue holds freshly posted stories waiting for enrichment, and
+	// stories whose discussion summary is due for a refresh.
+	enrichQueue chan enrichJob
+
+	// storyEvents holds story events waiting to be sent to the webhooks and
+	// the event bus.
+	storyEvents chan StoryEvent
+
+	// cycleMutex keeps polls and cleanups from running concurrently.
+	cycleMutex sync.Mutex
+	actors     storyActors
+
+	// maintenance is set while a maintenance window is in effect, as of the
+	// last poll.
+	maintenance bool
+
+	// reconciling is set until the first poll after starting from corrupted
+	// storage, which marks the front page as seen instead of posting it.
+	reconciling atomic.Bool
+	reconciled  atomic.Int64
+
+	// leaseLost is set when the bot stopped because another replica took
+	// over the failover lease.
+	leaseLost atomic.Bool
+
+	// chatIDs maps the chats configured by username to their numeric IDs,
+	// see resolveChats. It is only changed before the bot runs.
+	chatIDs map[string]string
+}
+
+// New returns a bot ready to run. Unless WithStorage is given, it opens the
+// configured storage and restores it from a backup when the data file does
+// not exist yet.
+func New(opts ...Option) (*Bot, error) {
+	o := newOptions(opts)
+
+	if o.config == nil {
+		config, err := LoadConfig()
+		if err != nil {
+			return nil, err
+		}
+		o.config = &config
+	}
+	config := *o.config
+	if err := o.faults.validate(); err != nil {
+		return nil, err
+	}
+
+	transport, dns := config.Network.transport(config.CacheSize)
+	httpClient := &http.Client{Timeout: DefaultTimeout, Transport: transport}
+
+	// With a cassette, every HN, Telegram and backup request is recorded or
+	// answered from the recording
+	var tape *cassette.Transport
+	switch config.CassetteMode {
+	case cassette.ModeRecord:
+		var err error
+		if tape, err = cassette.Record(config.CassettePath, httpClient.Transport); err != nil {
+			return nil, err
+		}
+		log.Printf("Recording HTTP interactions to %s", config.CassettePath)
+	case cassette.ModeReplay:
+		var err error
+		if tape, err = cassette.Replay(config.CassettePath); err != nil {
+			return nil, err
+		}
+		log.Printf("Replaying HTTP interactions from %s, no requests leave the bot", config.CassettePath)
+	}
+	if tape != nil {
+		httpClient.Transport = tape
+	}
+	outbound := newOutboundTransport(httpClient.Transport, config.CacheSize)
+	httpClient.Transport = outbound
+
+	var audit *auditLog
+	if config.AuditLog {
+		var err error
+		if audit, err = openAuditLog(config.AuditPath); err != nil {
+			if tape != nil {
+				tape.Close()
+			}
+			return nil, err
+		}
+	}
+
+	store := o.store
+	reconciling := false
+	if store == nil {
+		var err error
+		if store, reconciling, err = openStorage(config, httpClient, o.clock); err != nil {
+			if tape != nil {
+				tape.Close()
+			}
+			if audit != nil {
+				audit.Close()
+			}
+			return nil, err
+		}
+	}
+	store.Migrate(config.ChatID)
+	if o.faults.enabled() {
+		log.Printf("Warning: injecting faults at the rates %s", o.faults)
+		outbound.inject = o.faults.inject
+		store.InjectSaveFaults(o.faults.saveFault)
+	}
+
+	bot := &Bot{
+		config:     configHolder{config: config},
+		storage:    store,
+		httpClient: httpClient,
+		hn:         hn.NewClient(httpClient),
+		tg:         telegram.NewClient(config.BotKey, httpClient),
+		cassette:   tape,
+		outbound:   outbound,
+		audit:      audit,
+		filters:    o.filters,
+		sinks:      o.sinks,
+		clock:      o.clock,
+		events:     newEventLog(),
+
+		enrichQueue: make(chan enrichJob, EnrichQueueSize),
+		storyEvents: make(chan StoryEvent, StoryEventQueueSize),
+	}
+	bot.reconciling.Store(reconciling)
+	bot.useResolvedChats()
+	if config.TelegramAPIURL != "" {
+		bot.tg.BaseURL = strings.TrimSuffix(config.TelegramAPIURL, "/") + "/"
+	}
+	bot.bus = o.bus
+	if bot.bus == nil {
+		bot.bus = newEventBus(config, httpClient)
+	}
+	bot.dns = dns
+	bot.fetcher = fetch.New(httpClient, func() string { return bot.cfg().UserAgent })
+	bot.fetcher.MaxRobots = config.CacheSize
+	bot.articles = newArticleCache(config.statePath(ArticleCacheDir), bot.fetcher)
+	outbound.config = bot.cfg
+	outbound.spend = bot.spendBudget
+	outbound.classify(UpstreamHN, bot.hn.BaseURL, bot.hn.AlgoliaURL)
+	outbound.classify(UpstreamTelegram, bot.tg.BaseURL)
+	outbound.classify(UpstreamEnrichment, GitHubAPIURL, WaybackAPIURL, config.Summary.withDefaults().URL)
+	bot.tg.OnRateLimit = bot.rateLimited
+	bot.tg.OnCall = bot.onCall
+	bot.tg.UseEntities = func() bool { return bot.cfg().MessageFormat == FormatEntities }
+	bot.hn.OnAnomaly = bot.anomaly
+	bot.OnTransition(logTransition)
+	bot.OnTransition(bot.storyTransition)
+	bot.registerSearch()
+	bot.registerStats()
+	bot.registerStatus()
+	bot.registerDomain()
+	bot.registerWhy()
+	bot.registerAnnounce()
+	bot.registerQueue()
+	bot.registerModeration()
+	bot.registerSettings()
+	bot.registerSuggest()
+	return bot, nil
+}
+
+// openStorage opens and loads the configured storage, restoring it from a
+// backup when the data file does not exist yet or is corrupted. It reports
+// whether the storage may be missing posted stories, because it was
+// recovered from a local backup or not at all, in which case the bot
+// reconciles with the front page before posting anything.
+func openStorage(config Config, httpClient *http.Client, clock Clock) (*storage.Store, bool, error) {
+	exists, err := backendExists(config.StorageBackend, config.backendPath(config.StorageBackend))
+	if err != nil && config.StorageBackend == storage.BackendRedis {
+		// Starting empty would re-post every story
+		return nil, false, err
+	}
+	isNew := err == nil && !exists
+
+	store, err := storage.Open(config.storageOptions())
+	if err != nil {
+		return nil, false, err
+	}
+	if config.FailoverLease > 0 {
+		if err := acquireLease(config, store, clock.Now()); err != nil {
+			store.Close()
+			return nil, false, err
+		}
+	}
+
+	// Load existing data if file exists. Key problems are fatal, since starting
+	// empty would re-post every story.
+	corrupt := false
+	if err := store.Load(); errors.Is(err, storage.ErrKey) {
+		store.Close()
+		return nil, false, err
+	} else if errors.Is(err, storage.ErrCorrupt) {
+		log.Printf("Warning: failed to load existing data: %v", err)
+		corrupt = true
+	} else if err != nil {
+		log.Printf("Warning: failed to load existing data: %v", err)
+	}
+
+	if isNew || corrupt {
+		restored, err := restoreBackup(config, httpClient, store)
+		if err != nil {
+			log.Printf("Warning: failed to restore backup: %v", err)
+		}
+		if corrupt && !restored {
+			log.Printf("Starting in reconcile-only mode, the first poll marks the front page as seen instead of posting it")
+			return store, true, nil
+		}
+	}
+	if backup := store.RecoveredFrom(); backup != "" {
+		log.Printf("Starting in reconcile-only mode, stories posted since %s was written are not posted again", backup)
+		return store, true, nil
+	}
+	return store, false, nil
+}
+
+func (b *Bot) cfg() Config {
+	return b.config.get()
+}
+
+func (b *Bot) getTopStories() ([]int64, error) {
+	return b.hn.TopStories(b.cfg().BatchSize)
+}
+
+// errItemGone is returned by getStoryDetails for items that were deleted or
+// that HN returns as null.
+var errItemGone = errors.New("item is deleted or null")
+
+// getStoryDetails fetches the current version of a story from HN, with its
+// best comment when best comment buttons are enabled.
+func (b *Bot) getStoryDetails(id int64) (*storage.Story, error) {
+	item, err := b.hn.Item(id)
+	if errors.Is(err, hn.ErrNullItem) {
+		return nil, errItemGone
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get story details: %w", err)
+	}
+	if item.Deleted {
+		return nil, errItemGone
+	}
+	story := &storage.Story{
+		ID:          item.ID,
+		URL:         item.URL,
+		Title:       item.Title,
+		By:          item.By,
+		Descendants: item.Descendants,
+		Score:       item.Score,
+		Type:        item.Type,
+		Feeds:       b.storyFeeds(item.ID),
+	}
+
+	if b.cfg().BestCommentButton && item.Type == "story" {
+		// A failed lookup keeps the stored best comment
+		if story.BestComment, err = b.hn.TopComment(item); err != nil {
+			log.Printf("Error getting best comment for story %d: %v", id, err)
+		}
+	}
+	return story, nil
+}
+
+// destinations returns every chat the story qualifies for at now: the main
+// chat by the thresholds in effect, plus each matching route. The thresholds
+// of an experiment variant take precedence over threshold_schedule.
+func (c *Config) destinations(story *storage.Story, now time.Time) []string {
+	score, comments := c.storyThresholds(story, now)
+	return filter.Destinations(story, c.ChatID, score, comments, c.Routes)
+}
+
+// storyThresholds returns the main chat's thresholds for the story at now.
+// With TopPerHour set there are none, the hourly limit picks the stories.
+func (c *Config) storyThresholds(story *storage.Story, now time.Time) (score, comments int64) {
+	if c.TopPerHour > 0 {
+		return 0, 0
+	}
+	score, comments = c.thresholds(now)
+	if _, v := c.variant(story.ID); v != nil {
+		if v.ScoreThreshold != nil {
+			score = *v.ScoreThreshold
+		}
+		if v.CommentsThreshold != nil {
+			comments = *v.CommentsThreshold
+		}
+	}
+	return score, comments
+}
+
+// destinations returns the chats the story currently qualifies for, or none
+// when one of the bot's filters rejects it. The /settings of the chats
+// apply.
+func (b *Bot) destinations(config *Config, story *storage.Story) []string {
+	for _, accept := range b.storyFilters(config) {
+		if !accept(story) {
+			return nil
+		}
+	}
+	now := b.clock.Now()
+	return b.applySettings(config, story, config.destinations(story, now), now)
+}
+
+// qualifies reports whether the story currently qualifies for chatID.
+func (b *Bot) qualifies(config *Config, story *storage.Story, chatID string) bool {
+	return slices.Contains(b.destinations(config, story), chatID)
+}
+
+func (b *Bot) replyMarkup(s *storage.Story, chatID string) *telegram.InlineKeyboardMarkup {
+	config := b.cfg()
+	lang := config.language(chatID)
+	hotScore, hotComments := config.hotThresholds(chatID)
+
+	var scoreSuffix, commentSuffix string
+	if hotScore > 0 && s.Score > hotScore {
+		scoreSuffix = " " + Hot
+	}
+	if hotComments > 0 && s.Descendants > hotComments {
+		commentSuffix = " " + Hot
+	}
+
+	link, original := config.links(s.URL)
+	keyboard := [][]telegram.InlineKeyboardButton{
+		{
+			{
+				Text: tr(lang, "score_button", s.Score, scoreSuffix),
+				URL:  link,
+			},
+			{
+				Text: tr(lang, "comments_button", s.Descendants, commentSuffix),
+				URL:  hn.ItemURL(s.ID),
+			},
+		},
+	}
+	var extra []telegram.InlineKeyboardButton
+	if original != "" {
+		extra = append(extra, telegram.InlineKeyboardButton{
+			Text: tr(lang, "original_button"),
+			URL:  original,
+		})
+	}
+	if s.RepostOf != 0 {
+		extra = append(extra, telegram.InlineKeyboardButton{
+			Text: tr(lang, "previous_discussion_button"),
+			URL:  hn.ItemURL(s.RepostOf),
+		})
+	}
+	if config.BestCommentButton && s.BestComment != 0 {
+		extra = append(extra, telegram.InlineKeyboardButton{
+			Text: tr(lang, "best_comment_button"),
+			URL:  hn.ItemURL(s.BestComment),
+		})
+	}
+	if len(extra) > 0 {
+		keyboard = append(keyboard, extra)
+	}
+	return &telegram.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// messageText is the text of the story's message in chatID, preceded by a
+// line of tags when any apply and followed by hashtags when the chat's
+// settings turn them on.
+func messageText(s *storage.Story, config Config, chatID string, settings storage.ChatSettings) string {
+	lang := config.language(chatID)
+
+	var tags []string
+	if s.CommunityPick {
+		tags = append(tags, tr(lang, "tag_community_pick"))
+	}
+	if s.SecondChance {
+		tags = append(tags, tr(lang, "tag_second_chance"))
+	}
+	if filter.IsDiscussionHeavy(s, config.DiscussionRatio) {
+		tags = append(tags, tr(lang, "tag_discussion_heavy"))
+	}
+	if s.RepostOf != 0 {
+		tags = append(tags, tr(lang, "tag_repost"))
+	}
+
+	text, ok := config.renderTemplate(s, messageData{
+		Title:    html.EscapeString(s.Title),
+		URL:      config.linkURL(s.URL),
+		HNURL:    hn.ItemURL(s.ID),
+		Score:    s.Score,
+		Comments: s.Descendants,
+		Tags:     html.EscapeString(strings.Join(tags, " · ")),
+
+		Enrichments: config.enrichmentLines(s),
+		Developing:  developingLines(s, lang),
+	})
+	if !ok {
+		text = fmt.Sprintf("<b>%s</b>  %s", html.EscapeString(s.Title), config.linkURL(s.URL))
+		if len(tags) > 0 {
+			text = "<i>" + strings.Join(tags, " · ") + "</i>\n" + text
+		}
+		if lines := config.enrichmentLines(s); lines != "" {
+			text += "\n" + lines
+		}
+		if lines := developingLines(s, lang); lines != "" {
+			text += "\n\n" + lines
+		}
+	}
+	if tags := hashtags(s); settings.Hashtags && tags != "" {
+		text += "\n" + tags
+	}
+	return config.withFooter(text, chatID)
+}
+
+func (b *Bot) saveStory(story *storage.Story) error {
+	b.storage.Lock()
+	story.LastSave = b.clock.Now()
+	if story.FirstSeen.IsZero() {
+		story.FirstSeen = story.LastSave
+	}
+	b.storage.Stories[story.ID] = story
+	b.storage.Unlock()
+	return b.storage.Save()
+}
+
+func (b *Bot) getStoredStory(id int64) (*storage.Story, bool) {
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+
+	story, exists := b.storage.Stories[id]
+	if !exists {
+		return nil, false
+	}
+
+	// Hand out a copy so callers can update messages without holding the lock
+	return story.Clone(), true
+}
+
+// sendMessage posts the story to chatID. New and candidate stories become
+// posted.
+func (b *Bot) sendMessage(story *storage.Story, chatID string) error {
+	config := b.cfg()
+	settings := b.storage.Settings(chatID)
+	text := messageText(story, config, chatID, settings)
+	card := config.wantsCard(story)
+	if card {
+		text = cardCaption(story, config, chatID, settings, text)
+	}
+	req := telegram.SendMessageRequest{
+		ChatID:              chatID,
+		Text:                text,
+		ParseMode:           "HTML",
+		ReplyMarkup:         b.replyMarkup(story, chatID),
+		DisableNotification: true,
+		ReplyParameters:     b.replyTarget(story, chatID),
+	}
+
+	// The idempotency key is saved before sending, so that a crash or a lost
+	// response never leads to a second message in the chat
+	claim, claimed := b.storage.ClaimSend(story.ID, chatID, b.clock.Now())
+	if !claimed {
+		if claim.MessageID == 0 {
+			return errSendUnconfirmed
+		}
+		return b.adoptMessage(story, chatID, claim.MessageID)
+	}
+	if err := b.storage.Save(); err != nil {
+		b.storage.ReleaseSend(story.ID, chatID)
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+
+	var msg *telegram.Message
+	var err error
+	if card {
+		msg, err = b.sendCard(&config, story, req)
+	} else {
+		msg, err = b.tg.SendMessage(req)
+	}
+	if err != nil {
+		b.count(storage.Counters{APIErrors: 1})
+		var apiErr *telegram.APIError
+		if errors.As(err, &apiErr) {
+			// Telegram answered, so nothing was sent
+			b.storage.ReleaseSend(story.ID, chatID)
+		} else {
+			b.event(EventWarning, "Sending story %d to %s may have failed, not retrying for %v: %v",
+				story.ID, chatID, storage.UnconfirmedSendTTL, err)
+		}
+		return err
+	}
+
+	b.storage.ConfirmSend(story.ID, chatID, msg.MessageID)
+	b.count(storage.Counters{Posted: 1})
+	b.markPosted(chatID)
+	b.countVariantPost(&config, story)
+	first := len(story.Messages) == 0
+	if first {
+		b.countHit(&config, story)
+	}
+	if first && config.RepostDays > 0 {
+		b.storage.RememberPosted(story, b.clock.Now())
+	}
+	story.SetMessage(chatID, msg.MessageID)
+	sent := story.Messages[chatID]
+	sent.TextHash = textHash(text)
+	sent.Card = card
+	story.Messages[chatID] = sent
+	if story.State.Postable() {
+		if err := b.transition(story, storage.StatePosted); err != nil {
+			return err
+		}
+	}
+	if err := b.saveStory(story); err != nil {
+		return err
+	}
+	if first {
+		b.enrichLater(story)
+	}
+	return nil
+}
+
+// adoptMessage records a message sent by an earlier send of the story to
+// chatID whose story was not saved.
+func (b *Bot) adoptMessage(story *storage.Story, chatID string, messageID int64) error {
+	log.Printf("Story %d was already sent to %s as message %d", story.ID, chatID, messageID)
+	story.SetMessage(chatID, messageID)
+	if story.State.Postable() {
+		if err := b.transition(story, storage.StatePosted); err != nil {
+			return err
+		}
+	}
+	return b.saveStory(story)
+}
+
+// editMessage refreshes the story's message in every chat it was posted to,
+// skipping chats whose message already shows the current values.
+func (b *Bot) editMessage(story *storage.Story, previous *storage.Story) error {
+	var errs []error
+	if err := b.transition(story, storage.StateUpdating); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Chats the story no longer qualifies for keep their last posted values
+	config := b.cfg()
+	edited := false
+	for chatID, msg := range story.Messages {
+		if !b.qualifies(&config, story, chatID) || !story.NeedsEdit(previous, msg) {
+			continue
+		}
+
+		milestone := config.crossedMilestone(msg, story.Descendants)
+		msg, err := b.editChatMessage(&config, story, chatID, msg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("chat %s: %w", chatID, err))
+			continue
+		}
+
+		if milestone > 0 {
+			if err := b.sendMilestone(story, chatID, msg.MessageID, milestone); err != nil {
+				errs = append(errs, fmt.Errorf("chat %s: milestone reply: %w", chatID, err))
+			} else {
+				msg.Milestone = milestone
+			}
+		}
+		story.Messages[chatID] = msg
+		edited = true
+	}
+	if edited {
+		b.publishStory(StoryUpdated, story)
+	}
+
+	if err := b.saveStory(story); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// editChatMessage edits the story's message msg in chatID to show the current
+// values and returns it updated. When the text stays the same, only the
+// buttons are replaced with editMessageReplyMarkup. Cards are drawn again
+// when the score or the comments changed.
+func (b *Bot) editChatMessage(config *Config, story *storage.Story, chatID string, msg storage.ChatMessage) (storage.ChatMessage, error) {
+	settings := b.storage.Settings(chatID)
+	text := messageText(story, *config, chatID, settings)
+	if msg.Card {
+		text = cardCaption(story, *config, chatID, settings, text)
+	}
+	hash := textHash(text)
+
+	var err error
+	switch {
+	case msg.Card && (msg.TextHash != hash || msg.LastSentScore != story.Score || msg.LastSentComments != story.Descendants):
+		err = b.editCard(config, story, chatID, msg.MessageID, text)
+	case msg.TextHash == hash:
+		err = b.tg.Call("editMessageReplyMarkup", telegram.EditMessageReplyMarkupRequest{
+			ChatID:      chatID,
+			MessageID:   msg.MessageID,
+			ReplyMarkup: b.replyMarkup(story, chatID),
+		}, nil)
+	default:
+		err = b.tg.Call("editMessageText", telegram.EditMessageTextRequest{
+			ChatID:      chatID,
+			MessageID:   msg.MessageID,
+			Text:        text,
+			ParseMode:   "HTML",
+			ReplyMarkup: b.replyMarkup(story, chatID),
+		}, nil)
+	}
+	if err != nil && !telegram.IsNotModified(err) {
+		b.count(storage.Counters{APIErrors: 1})
+		return msg, err
+	}
+	b.count(storage.Counters{Edited: 1})
+
+	msg.LastSentScore = story.Score
+	msg.LastSentComments = story.Descendants
+	msg.TextHash = hash
+	return msg, nil
+}
+
+// textHash identifies a message text in storage.ChatMessage.TextHash.
+func textHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:8])
+}
+
+// sendMilestone replies to the story's message in chatID that the discussion
+// has reached milestone comments.
+func (b *Bot) sendMilestone(story *storage.Story, chatID string, messageID, milestone int64) error {
+	config := b.cfg()
+	req := telegram.SendMessageRequest{
+		ChatID:              chatID,
+		Text:                tr(config.language(chatID), "comment_milestone", hn.ItemURL(story.ID), milestone),
+		ParseMode:           "HTML",
+		DisableNotification: true,
+		ReplyParameters:     &telegram.ReplyParameters{MessageID: messageID},
+	}
+	if err := b.tg.Call("sendMessage", req, nil); err != nil {
+		return err
+	}
+	log.Printf("Story %d passed %d comments, replied in %s", story.ID, milestone, chatID)
+	return nil
+}
+
+// deleteMessage removes the story's message from every chat. The story stops
+// being tracked once no messages are left; failed chats are kept for a retry.
+// Messages Telegram refuses to delete are left in place and the story ends up
+// archived instead of deleted.
+func (b *Bot) deleteMessage(story *storage.Story) error {
+	b.storage.RLock()
+	messages := maps.Clone(story.Messages)
+	b.storage.RUnlock()
+
+	var errs []error
+	archived := false
+	for chatID, msg := range messages {
+		err := b.tg.DeleteMessage(chatID, msg.MessageID)
+		if errors.Is(err, telegram.ErrCannotDelete) {
+			archived = true
+		} else if err != nil {
+			b.count(storage.Counters{APIErrors: 1})
+			errs = append(errs, fmt.Errorf("chat %s: %w", chatID, err))
+			continue
+		} else {
+			b.count(storage.Counters{Deleted: 1})
+		}
+
+		b.storage.Lock()
+		delete(story.Messages, chatID)
+		b.storage.Unlock()
+		b.storage.ReleaseSend(story.ID, chatID)
+	}
+
+	final := storage.StateDeleted
+	if archived {
+		final = storage.StateArchived
+	}
+
+	b.storage.Lock()
+	if len(story.Messages) == 0 {
+		if err := b.transition(story, final); err != nil {
+			errs = append(errs, err)
+		}
+		b.storage.RememberDropped(story, b.clock.Now())
+		if len(messages) > 0 {
+			b.storage.RememberDomain(storyDomain(story.URL), story)
+			b.storage.RememberHistory(story.Posted(storySummary(story)))
+		}
+		delete(b.storage.Stories, story.ID)
+	}
+	b.storage.Unlock()
+
+	if err := b.storage.Save(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (b *Bot) poll() error {
+	topStories, err := b.getTopStories()
+	if err != nil {
+		b.count(storage.Counters{APIErrors: 1})
+		return fmt.Errorf("failed to get top stories: %w", err)
+	}
+	config := b.cfg()
+	listed := append(slices.Clip(topStories), b.pollFeeds(&config, topStories)...)
+	diff := diffFrontPage(b.previousRanks(), topStories)
+	b.setFrontPage(listed)
+	if err := b.countMissedPolls(diff); err != nil {
+		log.Printf("Error saving missed poll counts: %v", err)
+	}
+
+	frozen := b.overTrackingCap(topStories)
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, 3) // Reduce concurrency to avoid rate limits
+
+	for _, storyID := range listed {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			b.actors.do(id, func() { b.processStory(diff, id, frozen[id]) })
+		}(storyID)
+	}
+
+	wg.Wait()
+	logFrontPage(diff)
+	b.snapshot(topStories)
+	b.releaseQueued(listed)
+	return nil
+}
+
+// overTrackingCap returns the posted stories on the front page beyond the
+// first MaxTrackedStories by rank. Their messages are not edited this poll.
+func (b *Bot) overTrackingCap(topStories []int64) map[int64]bool {
+	limit := b.cfg().MaxTrackedStories
+	if limit == 0 {
+		return nil
+	}
+
+	frozen := make(map[int64]bool)
+	tracked := 0
+	b.storage.RLock()
+	for _, id := range topStories {
+		story, exists := b.storage.Stories[id]
+		if !exists || len(story.Messages) == 0 {
+			continue
+		}
+		if tracked++; tracked > limit {
+			frozen[id] = true
+		}
+	}
+	b.storage.RUnlock()
+
+	if len(frozen) > 0 {
+		log.Printf("Tracking %d posted stories, not editing the %d ranked below MAX_TRACKED_STORIES=%d", tracked, len(frozen), limit)
+	}
+	return frozen
+}
+
+// processStory fetches the latest version of a story on the top list or a
+// feed and moves it forward in its lifecycle: new and candidate stories are posted once
+// they qualify, posted ones get their messages updated unless they are dormant
+// or frozen by the tracking cap. Its rank comes from diff, to which a change of
+// its score is added. It runs on the story's actor.
+func (b *Bot) processStory(diff *FrontPageDiff, id int64, frozen bool) {
+	rank := diff.Ranks[id]
+	storedStory, exists := b.getStoredStory(id)
+
+	story, err := b.getStoryDetails(id)
+	if errors.Is(err, errItemGone) {
+		if exists {
+			b.removeGone(id)
+		}
+		return
+	}
+	if err != nil {
+		b.count(storage.Counters{APIErrors: 1})
+		log.Printf("Error getting story details for %d: %v", id, err)
+		return
+	}
+	if !exists {
+		storedStory, exists = b.takeMerged(story)
+	}
+	story.Rank = rank
+	if exists {
+		story.CarryOver(storedStory, b.clock.Now())
+		if story.Score != storedStory.Score {
+			diff.scoreChanged(id, storedStory.Score, story.Score)
+		}
+	} else {
+		if dropped, ok := b.storage.TakeDropped(id); ok {
+			story.ReturnFrom(dropped, b.clock.Now())
+		}
+		if rank > 0 {
+			story.RankedAt = b.clock.Now()
+		}
+	}
+
+	config := b.cfg()
+	if !exists && config.RepostDays > 0 {
+		if previous, ok := b.storage.PreviousPost(story.URL, id, config.repostWindow(), b.clock.Now()); ok {
+			story.RepostOf = previous
+			log.Printf("Story %d links to the same page as story %d, marking it as a repost", id, previous)
+		}
+	}
+	chats := b.destinations(&config, story)
+	b.shadow(&config, story, chats)
+	if config.inMaintenance(b.clock.Now()) {
+		// Keep the latest values so the messages catch up once the window
+		// ends
+		b.holdForMaintenance(story)
+		return
+	}
+
+	switch story.State {
+	case storage.StateSuppressed:
+		if err := b.saveStory(story); err != nil {
+			log.Printf("Error saving suppressed story %d: %v", id, err)
+		}
+		return
+	case "", storage.StateCandidate:
+		if len(chats) == 0 {
+			b.countRejection(&config, story)
+			if err := b.transition(story, storage.StateCandidate); err != nil {
+				log.Printf("Error tracking candidate story %d: %v", id, err)
+				return
+			}
+			if err := b.saveStory(story); err != nil {
+				log.Printf("Error saving candidate story %d: %v", id, err)
+			}
+			return
+		}
+		if b.markSeen(story) {
+			return
+		}
+		if b.skipDuplicate(&config, story) || b.combineGroup(&config, story) {
+			if err := b.transition(story, storage.StateCandidate); err != nil {
+				log.Printf("Error tracking held back story %d: %v", id, err)
+				return
+			}
+			if err := b.saveStory(story); err != nil {
+				log.Printf("Error saving held back story %d: %v", id, err)
+			}
+			return
+		}
+
+		if config.Moderation.enabled() {
+			b.requestReview(story, chats)
+			return
+		}
+		if reason := config.queueReason(b.clock.Now()); reason != "" {
+			b.queue(story, reason)
+			return
+		}
+		b.sendToChats(story, chats)
+	case storage.StatePending:
+		b.checkReview(story, chats)
+	case storage.StateQueued:
+		// Posted by releaseQueued once the poll is done.
+		b.queue(story, "")
+	default:
+		if config.isDormant(story, rank) {
+			if story.State != storage.StateDormant {
+				log.Printf("Story %d is at rank %d with %d points for %d polls, no longer editing it", id, rank, story.Score, story.StalePolls)
+			}
+			if err := b.transition(story, storage.StateDormant); err != nil {
+				log.Printf("Error tracking dormant story %d: %v", id, err)
+			}
+			if err := b.saveStory(story); err != nil {
+				log.Printf("Error saving dormant story %d: %v", id, err)
+			}
+			return
+		}
+		if frozen || b.degraded(DegradeNoEdits) {
+			// Keep the latest values so the message catches up once the
+			// story ranks within the cap again, or edits resume
+			if err := b.transition(story, storage.StateUpdating); err != nil {
+				log.Printf("Error tracking story %d: %v", id, err)
+			}
+			if err := b.saveStory(story); err != nil {
+				log.Printf("Error saving story %d: %v", id, err)
+			}
+			return
+		}
+		b.refreshDiscussionLater(&config, story)
+		if err := b.editMessage(story, storedStory); err != nil {
+			log.Printf("Error editing message for story %d: %v", id, err)
+		} else {
+			log.Printf("Updated story: %d - %s", story.ID, story.Title)
+		}
+		b.sendToChats(story, chats)
+	}
+
+	// Add delay between requests to avoid rate limiting
+	b.clock.Sleep(200 * time.Millisecond)
+}
+
+// sendToChats posts the story to each of chats it has no message in yet,
+// skipping chats that got a story less than PostGap ago and, with TopPerHour
+// set, the main chat once its hour is full.
+func (b *Bot) sendToChats(story *storage.Story, chats []string) {
+	config := b.cfg()
+	for _, chatID := range chats {
+		if _, sent := story.Messages[chatID]; sent || b.spaced(&config, chatID) || b.hourFull(&config, chatID) {
+			continue
+		}
+		err := b.sendMessage(story, chatID)
+		if errors.Is(err, errSendUnconfirmed) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error sending message for story %d to %s: %v", story.ID, chatID, err)
+		} else {
+			log.Printf("Sent new story to %s: %d - %s", chatID, story.ID, story.Title)
+		}
+	}
+}
+
+func (b *Bot) setFrontPage(ids []int64) {
+	frontPage := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		frontPage[id] = true
+	}
+
+	b.frontPageMutex.Lock()
+	b.frontPage = frontPage
+	b.frontPageMutex.Unlock()
+}
+
+func (b *Bot) onFrontPage(id int64) bool {
+	b.frontPageMutex.RLock()
+	defer b.frontPageMutex.RUnlock()
+	return b.frontPage[id]
+}
+
+func (b *Bot) countMissedPolls(diff *FrontPageDiff) error {
+	b.storage.Lock()
+	for _, story := range b.storage.Stories {
+		if _, ranked := diff.Ranks[story.ID]; !ranked {
+			story.Rank = 0
+		}
+		if b.onFrontPage(story.ID) {
+			story.MissedPolls = 0
+			continue
+		}
+
+		story.MissedPolls++
+		if story.State == storage.StatePosted || story.State == storage.StateUpdating || story.State == storage.StateDormant {
+			if err := b.transition(story, storage.StateExpiring); err != nil {
+				log.Printf("Error expiring story %d: %v", story.ID, err)
+			}
+		}
+	}
+	b.storage.Unlock()
+	return b.storage.Save()
+}
+
+// isExpired reports whether a story's messages should be removed. With
+// CleanupAfterPolls set, stories expire after being absent from the top list
+// and the feeds for that many consecutive polls; otherwise they expire
+// CleanupInterval after their last save. Stories still listed never expire.
+func isExpired(s *storage.Story, config Config, onFrontPage bool, now time.Time) bool {
+	if onFrontPage {
+		return false
+	}
+	// Community picks may never make the front page
+	if config.CleanupAfterPolls > 0 && !s.CommunityPick {
+		return s.MissedPolls >= config.CleanupAfterPolls
+	}
+	return now.Sub(s.LastSave) > time.Duration(config.CleanupInterval)
+}
+
+func (b *Bot) cleanup() error {
+	config := b.cfg()
+	b.storage.PruneDropped(b.clock.Now())
+	b.storage.PruneHistory(b.clock.Now())
+	b.storage.PruneSent(b.clock.Now())
+	b.storage.CompactSnapshots(b.clock.Now())
+	b.pruneSuggestions()
+	if config.RepostDays > 0 {
+		b.storage.PrunePosted(config.repostWindow(), b.clock.Now())
+	}
+	if removed, err := b.articles.prune(b.clock.Now()); err != nil {
+		log.Printf("Error pruning article cache: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d cached articles", removed)
+	}
+	if config.inMaintenance(b.clock.Now()) {
+		return nil
+	}
+
+	b.storage.RLock()
+	var oldStories []*storage.Story
+	for _, story := range b.storage.Stories {
+		if isExpired(story, config, b.onFrontPage(story.ID), b.clock.Now()) {
+			oldStories = append(oldStories, story)
+		}
+	}
+	b.storage.RUnlock()
+
+	var wg sync.WaitGroup
+	var deleted, archived, failed atomic.Int64
+	semaphore := make(chan struct{}, 5)
+
+	for _, story := range oldStories {
+		wg.Add(1)
+		go func(s *storage.Story) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+			b.actors.do(s.ID, func() {
+				if !b.tracked(s) {
+					return // removed meanwhile
+				}
+
+				if s.State == storage.StatePending {
+					b.closeReview(s, tr(config.language(config.AdminChatID), "review_dropped"))
+				}
+				if s.State == storage.StateCandidate || s.State == storage.StatePending || s.State == storage.StateQueued || s.State == storage.StateSuppressed {
+					b.forget(s)
+					return
+				}
+
+				if err := b.deleteMessage(s); err != nil {
+					log.Printf("Error deleting message for story %d: %v", s.ID, err)
+					failed.Add(1)
+					return
+				}
+
+				log.Printf("Deleted old story: %d", s.ID)
+				if b.storyState(s) == storage.StateArchived {
+					archived.Add(1)
+				} else {
+					deleted.Add(1)
+				}
+			})
+		}(story)
+	}
+
+	wg.Wait()
+
+	if deleted.Load()+archived.Load()+failed.Load() > 0 {
+		b.event(EventInfo, "Cleanup: %d deleted, %d archived, %d failed", deleted.Load(), archived.Load(), failed.Load())
+	}
+	return nil
+}
+
+// tracked reports whether story is still the stored version of its story.
+func (b *Bot) tracked(story *storage.Story) bool {
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+	return b.storage.Stories[story.ID] == story
+}
+
+func (b *Bot) storyState(story *storage.Story) storage.State {
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+	return story.State
+}
+
+// forget stops tracking a story without messages that left the front page:
+// a candidate that was never posted or a suppressed story.
+func (b *Bot) forget(story *storage.Story) {
+	b.storage.Lock()
+	b.storage.RememberDropped(story, b.clock.Now())
+	if err := b.transition(story, storage.StateDeleted); err != nil {
+		log.Printf("Error forgetting story %d: %v", story.ID, err)
+	}
+	delete(b.storage.Stories, story.ID)
+	b.storage.Unlock()
+
+	if err := b.storage.Save(); err != nil {
+		log.Printf("Error saving storage: %v", err)
+	}
+}
+
+// removeGone stops tracking a story whose item was deleted or became null,
+// deleting its messages.
+func (b *Bot) removeGone(id int64) {
+	b.storage.Lock()
+	story, ok := b.storage.Stories[id]
+	posted := ok && len(story.Messages) > 0
+	var err error
+	if posted {
+		err = b.transition(story, storage.StateExpiring)
+	}
+	b.storage.Unlock()
+	if !ok {
+		return
+	}
+	if err != nil {
+		log.Printf("Error removing deleted story %d: %v", id, err)
+		return
+	}
+
+	if !posted {
+		b.forget(story)
+		return
+	}
+	if b.inMaintenance() {
+		log.Printf("Story %d was deleted on HN, removing its messages after the maintenance window", id)
+		return
+	}
+	if err := b.deleteMessage(story); err != nil {
+		log.Printf("Error deleting message for deleted story %d: %v", id, err)
+		return
+	}
+	log.Printf("Story %d was deleted on HN, removed its messages", id)
+}
+
+// PollAndCleanup runs one poll followed by cleanup. Cleanup is skipped when
+// the poll fails, since membership counts are only updated by a good poll.
+// With CLEANUP_SCHEDULE set, cleanup only runs on that schedule instead.
+func (b *Bot) PollAndCleanup() {
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	ended := b.checkMaintenance()
+	if err := b.poll(); err != nil {
+		b.event(EventWarning, "Poll failed: %v", err)
+		return
+	}
+	b.finishReconcile()
+	if resumed := b.editsResumed(); ended || resumed {
+		b.reconcile()
+	}
+	if b.cfg().CleanupSchedule == "" {
+		if err := b.cleanup(); err != nil {
+			log.Printf("Cleanup error: %v", err)
+		}
+	}
+	log.Printf("Story states: %s", formatStateCounts(b.stateCounts()))
+}
+
+// cleanupNow runs a cleanup outside of a poll.
+func (b *Bot) cleanupNow() {
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	if err := b.cleanup(); err != nil {
+		log.Printf("Cleanup error: %v", err)
+	}
+}
+
+// Run polls the front page every PollInterval and runs the background jobs
+// until ctx is cancelled or the failover lease is lost. It returns once the
+// current poll and the jobs have finished; an in-flight getUpdates long poll
+// is not waited for.
+func (b *Bot) Run(ctx context.Context) {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	interval := time.Duration(b.cfg().PollInterval)
+	pollTicker := b.clock.NewTicker(interval)
+	defer func() { pollTicker.Stop() }()
+
+	var wg sync.WaitGroup
+	start := func(job func(context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			job(ctx)
+		}()
+	}
+
+	start(b.runEventLog)
+	start(func(ctx context.Context) { b.runLease(ctx, stop) })
+	for _, sent := range b.storage.UnconfirmedSends() {
+		b.event(EventWarning, "Story %d may have been sent to %s before a restart, not retrying until %s",
+			sent.StoryID, sent.ChatID, sent.Claimed.Add(storage.UnconfirmedSendTTL).Format(time.RFC3339))
+	}
+	start(b.runBackups)
+	start(b.runOnThisDay)
+	start(b.runScoreboard)
+	start(b.runMemberCounts)
+	start(b.runGrowthReport)
+	start(b.runHeartbeat)
+	start(b.runDigestEmail)
+	start(b.runStoryEvents)
+	start(func(ctx context.Context) {
+		b.runScheduled(ctx, "cleanup", func(config Config) string { return config.CleanupSchedule }, b.cleanupNow)
+	})
+	start(b.runRadar)
+	start(b.runAPI)
+	start(b.runEnrichment)
+	if config := b.cfg(); config.EnableCommands || config.Experiment != nil || config.Moderation.enabled() {
+		go b.runUpdates(ctx)
+	}
+
+	if config := b.cfg(); config.CleanupAfterPolls > 0 {
+		b.event(EventInfo, "Bot started. Polling every %v, removing stories absent for %d polls", interval, config.CleanupAfterPolls)
+	} else {
+		b.event(EventInfo, "Bot started. Polling every %v, removing stories older than %v", interval, time.Duration(config.CleanupInterval))
+	}
+
+	b.PollAndCleanup()
+	skipped := 0
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-pollTicker.C():
+			pollTicker = b.retick(pollTicker, &interval)
+			b.updateDegradation()
+			if b.degraded(DegradePaused) {
+				continue
+			}
+			if b.slowPolling() && skipped < BudgetSlowPolls-1 {
+				skipped++
+				continue
+			}
+			skipped = 0
+			b.PollAndCleanup()
+		}
+	}
+}
+
+// retick replaces ticker with one for the current poll interval when the
+// config changed it, updating interval.
+func (b *Bot) retick(ticker Ticker, interval *time.Duration) Ticker {
+	next := time.Duration(b.cfg().PollInterval)
+	if next == *interval {
+		return ticker
+	}
+	ticker.Stop()
+	*interval = next
+	return b.clock.NewTicker(next)
+}
+
+// Close saves the storage, gives up the failover lease and closes the
+// storage backend and cassette.
+func (b *Bot) Close() error {
+	if b.cassette != nil {
+		defer b.cassette.Close()
+	}
+	if b.audit != nil {
+		defer b.audit.Close()
+	}
+	if b.bus != nil {
+		defer b.bus.Close()
+	}
+	if err := b.storage.Save(); err != nil {
+		return err
+	}
+	b.releaseLease()
+	return b.storage.Close()
+}
@@ -0,0 +1,96 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTelegram answers every Bot API call with success, a message for sends
+// and edits, and records the methods called with their requests in order.
+type fakeTelegram struct {
+	mutex sync.Mutex
+	calls []fakeCall
+}
+
+type fakeCall struct {
+	method string
+	req    map[string]any
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var req map[string]any
+	json.Unmarshal(body, &req)
+	method := filepath.Base(r.URL.Path)
+	f.mutex.Lock()
+	f.calls = append(f.calls, fakeCall{method, req})
+	messageID := int64(len(f.calls)) + 100
+	f.mutex.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasPrefix(method, "send") || strings.HasPrefix(method, "edit") {
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"chat":{"id":-100123}}}`, messageID)
+		return
+	}
+	io.WriteString(w, `{"ok":true,"result":true}`)
+}
+
+// called returns the calls of methods starting with prefix, in order.
+func (f *fakeTelegram) called(prefix string) []fakeCall {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	var calls []fakeCall
+	for _, call := range f.calls {
+		if strings.HasPrefix(call.method, prefix) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// newTestBot returns a bot talking to a fake Telegram, with its state in a
+// temporary directory and the environment in env.
+func newTestBot(t *testing.T, clock Clock, env map[string]string) (*Bot, *fakeTelegram) {
+	t.Helper()
+	tg := &fakeTelegram{}
+	server := httptest.NewServer(tg)
+	t.Cleanup(server.Close)
+
+	t.Setenv("CONFIG_PATH", "")
+	t.Setenv("BOT_KEY", "test")
+	t.Setenv("CHAT_ID", "-100123")
+	t.Setenv("STATE_DIR", t.TempDir())
+	t.Setenv("TELEGRAM_API_URL", server.URL+"/")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(WithConfig(config), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b, tg
+}
+
+// waitFor fails the test unless cond holds within a few seconds of real time,
+// for the goroutines driven by the fake clock to catch up.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
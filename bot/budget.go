@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Upstreams that outbound requests are counted and budgeted under.
+const (
+	UpstreamHN         = "hn"
+	UpstreamTelegram   = "telegram"
+	UpstreamEnrichment = "enrichment"
+	UpstreamOther      = "other"
+)
+
+const (
+	// BudgetLowRatio is the share of a daily request budget after which
+	// the bot degrades to save requests.
+	BudgetLowRatio = 0.9
+
+	// BudgetSlowPolls is how many poll intervals one poll takes while the
+	// HN or Telegram budget is low.
+	BudgetSlowPolls = 3
+)
+
+// ErrBudgetExhausted is returned for requests to an upstream that has used
+// up its daily budget.
+var ErrBudgetExhausted = errors.New("daily request budget exhausted")
+
+var budgetUpstreams = []string{UpstreamHN, UpstreamTelegram, UpstreamEnrichment, UpstreamOther}
+
+func validateBudgets(budgets map[string]int64) error {
+	for upstream, limit := range budgets {
+		found := false
+		for _, known := range budgetUpstreams {
+			found = found || upstream == known
+		}
+		if !found {
+			return fmt.Errorf("unknown request budget upstream %q, expected one of %s", upstream, strings.Join(budgetUpstreams, ", "))
+		}
+		if limit < 1 {
+			return fmt.Errorf("request budget for %s must be at least 1, got %d", upstream, limit)
+		}
+	}
+	return nil
+}
+
+// parseBudgets parses "hn=50000,telegram=20000".
+func parseBudgets(value string) (map[string]int64, error) {
+	budgets := make(map[string]int64)
+	for _, item := range splitList(value) {
+		upstream, limit, ok := strings.Cut(item, "=")
+		n, err := strconv.ParseInt(strings.TrimSpace(limit), 10, 64)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("request budget %q must look like hn=50000", item)
+		}
+		budgets[strings.TrimSpace(upstream)] = n
+	}
+	return budgets, nil
+}
+
+// budgetState remembers which budget warnings were sent today, so each is
+// sent once per upstream and day.
+type budgetState struct {
+	mutex  sync.Mutex
+	warned map[string]string
+}
+
+// spendBudget is the outboundTransport hook counting a request to upstream.
+// It refuses the request once the upstream's daily budget is used up.
+func (b *Bot) spendBudget(upstream string) error {
+	config := b.cfg()
+	now := b.clock.Now()
+	limit := config.RequestBudgets[upstream]
+	if limit > 0 && b.storage.Requests(upstream, now) >= limit {
+		b.warnBudget(upstream, "exhausted", "Request budget for %s exhausted: %d requests today, refusing more until midnight UTC", upstream, limit)
+		return fmt.Errorf("%w for %s (%d requests)", ErrBudgetExhausted, upstream, limit)
+	}
+
+	n := b.storage.CountRequest(upstream, now)
+	if limit > 0 && float64(n) >= float64(limit)*BudgetLowRatio {
+		b.warnBudget(upstream, "low", "Request budget for %s is running low: %d of %d requests today, degrading", upstream, n, limit)
+	}
+	return nil
+}
+
+// budgetLow reports whether upstream has used BudgetLowRatio of its daily
+// budget.
+func (b *Bot) budgetLow(upstream string) bool {
+	limit := b.cfg().RequestBudgets[upstream]
+	return limit > 0 && float64(b.storage.Requests(upstream, b.clock.Now())) >= float64(limit)*BudgetLowRatio
+}
+
+// slowPolling reports whether polls should be spread out to save the HN or
+// Telegram budget, or because Telegram errors spiked.
+func (b *Bot) slowPolling() bool {
+	return b.budgetLow(UpstreamHN) || b.budgetLow(UpstreamTelegram) || b.degraded(DegradeSlowPolling)
+}
+
+// warnBudget sends an admin event once per upstream, level and UTC day.
+func (b *Bot) warnBudget(upstream, level string, format string, args ...any) {
+	key := upstream + "/" + level
+	date := b.clock.Now().UTC().Format(time.DateOnly)
+
+	b.budget.mutex.Lock()
+	if b.budget.warned == nil {
+		b.budget.warned = make(map[string]string)
+	}
+	if b.budget.warned[key] == date {
+		b.budget.mutex.Unlock()
+		return
+	}
+	b.budget.warned[key] = date
+	b.budget.mutex.Unlock()
+	b.event(EventWarning, format, args...)
+}
+
+// budgetLines formats today's requests per upstream with their budgets.
+func (b *Bot) budgetLines() []string {
+	config := b.cfg()
+	requests := b.storage.MetricsSnapshot().RequestsToday(b.clock.Now())
+	upstreams := make([]string, 0, len(requests))
+	for upstream := range requests {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Strings(upstreams)
+
+	var lines []string
+	for _, upstream := range upstreams {
+		if limit := config.RequestBudgets[upstream]; limit > 0 {
+			lines = append(lines, fmt.Sprintf("%s=%d/%d", upstream, requests[upstream], limit))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s=%d", upstream, requests[upstream]))
+		}
+	}
+	return lines
+}
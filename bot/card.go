@@ -0,0 +1,387 @@
+package bot
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	// CardWidth and CardHeight are the size of cards without a template,
+	// the size link previews use.
+	CardWidth  = 1200
+	CardHeight = 630
+
+	// MaxCaptionLength is how many UTF-16 code units Telegram allows in the
+	// caption of a photo.
+	MaxCaptionLength = 1024
+
+	cardPadding = 72
+)
+
+// CardConfig turns on preview cards, images of the title, domain and score
+// that big stories are posted with instead of a text message.
+type CardConfig struct {
+	ScoreThreshold int64  `json:"score_threshold,omitempty" yaml:"score_threshold,omitempty" toml:"score_threshold,omitempty"`
+	Template       string `json:"template,omitempty" yaml:"template,omitempty" toml:"template,omitempty"`
+	Font           string `json:"font,omitempty" yaml:"font,omitempty" toml:"font,omitempty"`
+	Brand          string `json:"brand,omitempty" yaml:"brand,omitempty" toml:"brand,omitempty"`
+	TextColor      string `json:"text_color,omitempty" yaml:"text_color,omitempty" toml:"text_color,omitempty"`
+	AccentColor    string `json:"accent_color,omitempty" yaml:"accent_color,omitempty" toml:"accent_color,omitempty"`
+}
+
+func (c CardConfig) String() string {
+	if c.ScoreThreshold == 0 {
+		return "off"
+	}
+	return fmt.Sprintf("score_threshold=%d template=%q font=%q brand=%q text_color=%s accent_color=%s",
+		c.ScoreThreshold, c.Template, c.Font, c.Brand, c.TextColor, c.AccentColor)
+}
+
+// merge overrides fields with the ones set in other.
+func (c *CardConfig) merge(other CardConfig) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.Template, other.Template},
+		{&c.Font, other.Font},
+		{&c.Brand, other.Brand},
+		{&c.TextColor, other.TextColor},
+		{&c.AccentColor, other.AccentColor},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if other.ScoreThreshold != 0 {
+		c.ScoreThreshold = other.ScoreThreshold
+	}
+}
+
+func (c *CardConfig) applyEnv() error {
+	if threshold := os.Getenv("CARD_SCORE_THRESHOLD"); threshold != "" {
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid CARD_SCORE_THRESHOLD %q: %w", threshold, err)
+		}
+		c.ScoreThreshold = n
+	}
+	c.merge(CardConfig{
+		Template:    os.Getenv("CARD_TEMPLATE"),
+		Font:        os.Getenv("CARD_FONT"),
+		Brand:       os.Getenv("CARD_BRAND"),
+		TextColor:   os.Getenv("CARD_TEXT_COLOR"),
+		AccentColor: os.Getenv("CARD_ACCENT_COLOR"),
+	})
+	return nil
+}
+
+// cardRenderer draws cards with the loaded template and fonts.
+type cardRenderer struct {
+	background image.Image
+	regular    *opentype.Font
+	bold       *opentype.Font
+	brand      string
+	text       color.NRGBA
+	accent     color.NRGBA
+}
+
+// renderer validates the config and loads the template and font, or returns
+// nil when cards are off.
+func (c CardConfig) renderer() (*cardRenderer, error) {
+	if c.ScoreThreshold < 0 {
+		return nil, fmt.Errorf("card score threshold must not be negative, got %d", c.ScoreThreshold)
+	}
+	if c.ScoreThreshold == 0 {
+		return nil, nil
+	}
+
+	r := &cardRenderer{
+		background: image.NewUniform(color.NRGBA{0xf6, 0xf6, 0xef, 0xff}),
+		brand:      "Hacker News",
+		text:       color.NRGBA{0x00, 0x00, 0x00, 0xff},
+		accent:     color.NRGBA{0xff, 0x66, 0x00, 0xff},
+	}
+	if c.Brand != "" {
+		r.brand = c.Brand
+	}
+	for _, field := range []struct {
+		name  string
+		value string
+		dst   *color.NRGBA
+	}{
+		{"text", c.TextColor, &r.text},
+		{"accent", c.AccentColor, &r.accent},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if _, err := fmt.Sscanf(field.value, "#%02x%02x%02x", &field.dst.R, &field.dst.G, &field.dst.B); err != nil || len(field.value) != 7 {
+			return nil, fmt.Errorf("invalid card %s color %q, expected #rrggbb", field.name, field.value)
+		}
+	}
+
+	if c.Template != "" {
+		data, err := os.ReadFile(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read card template: %w", err)
+		}
+		if r.background, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("failed to decode card template %s: %w", c.Template, err)
+		}
+	}
+
+	var err error
+	if c.Font != "" {
+		data, err := os.ReadFile(c.Font)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read card font: %w", err)
+		}
+		if r.regular, err = parseFont(data); err != nil {
+			return nil, fmt.Errorf("failed to parse card font %s: %w", c.Font, err)
+		}
+		r.bold = r.regular
+		return r, nil
+	}
+	if r.regular, err = opentype.Parse(goregular.TTF); err != nil {
+		return nil, err
+	}
+	if r.bold, err = opentype.Parse(gobold.TTF); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseFont parses a TrueType or OpenType font, or the first font of a
+// collection, as CJK fonts often come in.
+func parseFont(data []byte) (*opentype.Font, error) {
+	f, err := opentype.Parse(data)
+	if err == nil {
+		return f, nil
+	}
+	collection, collectionErr := opentype.ParseCollection(data)
+	if collectionErr != nil || collection.NumFonts() == 0 {
+		return nil, err
+	}
+	return collection.Font(0)
+}
+
+// render draws the card of the story and encodes it as PNG. Templates set the
+// size of the card; without one it is CardWidth by CardHeight with a bar in
+// the accent color on top.
+func (r *cardRenderer) render(story *storage.Story, lang string) ([]byte, error) {
+	bounds := image.Rect(0, 0, CardWidth, CardHeight)
+	if _, uniform := r.background.(*image.Uniform); !uniform {
+		bounds = r.background.Bounds().Sub(r.background.Bounds().Min)
+	}
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, bounds, r.background, r.background.Bounds().Min, draw.Src)
+	if _, uniform := r.background.(*image.Uniform); uniform {
+		draw.Draw(canvas, image.Rect(0, 0, bounds.Dx(), 12), image.NewUniform(r.accent), image.Point{}, draw.Src)
+	}
+
+	faces := make(map[*opentype.Font]map[float64]font.Face)
+	face := func(f *opentype.Font, size float64) (font.Face, error) {
+		if faces[f] == nil {
+			faces[f] = make(map[float64]font.Face)
+		}
+		if face, ok := faces[f][size]; ok {
+			return face, nil
+		}
+		face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+		if err != nil {
+			return nil, fmt.Errorf("failed to load font face: %w", err)
+		}
+		faces[f][size] = face
+		return face, nil
+	}
+	defer func() {
+		for _, sizes := range faces {
+			for _, face := range sizes {
+				face.Close()
+			}
+		}
+	}()
+	write := func(f *opentype.Font, size float64, c color.Color, x, y int, text string) error {
+		face, err := face(f, size)
+		if err != nil {
+			return err
+		}
+		drawer := font.Drawer{Dst: canvas, Src: image.NewUniform(c), Face: face, Dot: fixed.P(x, y)}
+		drawer.DrawString(text)
+		return nil
+	}
+
+	// The brand on top, the score and domain at the bottom and the title in
+	// as many lines as fit in between
+	width, height := bounds.Dx(), bounds.Dy()
+	muted := r.text
+	muted.A = 0xa0
+	scoreY := height - cardPadding
+	domainY := scoreY - 60
+	titleY := cardPadding + 36 + 104
+	const titleSize, titleLineHeight = 64, 80
+
+	if err := write(r.bold, 36, r.accent, cardPadding, cardPadding+36, r.brand); err != nil {
+		return nil, err
+	}
+	titleFace, err := face(r.bold, titleSize)
+	if err != nil {
+		return nil, err
+	}
+	maxLines := max(1, (domainY-50-titleY)/titleLineHeight+1)
+	for i, line := range wrapText(titleFace, story.Title, fixed.I(width-2*cardPadding), maxLines) {
+		if err := write(r.bold, titleSize, r.text, cardPadding, titleY+i*titleLineHeight, line); err != nil {
+			return nil, err
+		}
+	}
+	domain := storyDomain(story.URL)
+	if domain == "" {
+		domain = storyDomain(hn.ItemURL(story.ID))
+	}
+	if err := write(r.regular, 36, muted, cardPadding, domainY, domain); err != nil {
+		return nil, err
+	}
+	if err := write(r.bold, 40, r.accent, cardPadding, scoreY, tr(lang, "card_score", story.Score, story.Descendants)); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, fmt.Errorf("failed to encode card: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// wrapText breaks text into lines of at most width, breaking words that are
+// wider than a line, such as in titles without spaces, anywhere. Lines beyond
+// maxLines are cut with an ellipsis.
+func wrapText(face font.Face, text string, width fixed.Int26_6, maxLines int) []string {
+	fits := func(s string) bool { return font.MeasureString(face, s) <= width }
+
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && fits(line+" "+word) {
+			line += " " + word
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+		for _, r := range word {
+			if line != "" && !fits(line+string(r)) {
+				lines = append(lines, line)
+				line = ""
+			}
+			line += string(r)
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		for len(last) > 0 && !fits(string(last)+"…") {
+			last = last[:len(last)-1]
+		}
+		lines[maxLines-1] = strings.TrimRight(string(last), " ") + "…"
+	}
+	return lines
+}
+
+// wantsCard reports whether the story is posted with a card.
+func (c *Config) wantsCard(story *storage.Story) bool {
+	return c.card != nil && story.Score >= c.Card.ScoreThreshold
+}
+
+// cardCaption returns text when it fits in a caption. Otherwise the caption
+// leaves out the enrichments, which are what makes messages long, or is just
+// the linked title.
+func cardCaption(story *storage.Story, config Config, chatID string, settings storage.ChatSettings, text string) string {
+	if captionFits(text) {
+		return text
+	}
+	short := story.Clone()
+	short.Enrichments = nil
+	if text := messageText(short, config, chatID, settings); captionFits(text) {
+		return text
+	}
+	return fmt.Sprintf("<b>%s</b>  %s", html.EscapeString(story.Title), config.linkURL(story.URL))
+}
+
+func captionFits(text string) bool {
+	plain, _ := telegram.ParseHTML(text)
+	return len(utf16.Encode([]rune(plain))) <= MaxCaptionLength
+}
+
+// sendCard posts req as a photo of the story's card with the text as its
+// caption.
+func (b *Bot) sendCard(config *Config, story *storage.Story, req telegram.SendMessageRequest) (*telegram.Message, error) {
+	card, err := config.card.render(story, config.language(req.ChatID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to render card: %w", err)
+	}
+	return b.tg.SendPhoto(telegram.SendPhotoRequest{
+		ChatID:              req.ChatID,
+		Caption:             req.Text,
+		ParseMode:           req.ParseMode,
+		ReplyMarkup:         req.ReplyMarkup,
+		DisableNotification: req.DisableNotification,
+		ReplyParameters:     req.ReplyParameters,
+	}, card)
+}
+
+// editCard replaces the card and the caption of the story's photo message. With
+// cards turned off since, only the caption is edited.
+func (b *Bot) editCard(config *Config, story *storage.Story, chatID string, messageID int64, caption string) error {
+	if config.card == nil {
+		return b.tg.Call("editMessageCaption", telegram.EditMessageCaptionRequest{
+			ChatID:      chatID,
+			MessageID:   messageID,
+			Caption:     caption,
+			ParseMode:   "HTML",
+			ReplyMarkup: b.replyMarkup(story, chatID),
+		}, nil)
+	}
+
+	card, err := config.card.render(story, config.language(chatID))
+	if err != nil {
+		return fmt.Errorf("failed to render card: %w", err)
+	}
+	req := telegram.EditMessageMediaRequest{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Media: telegram.InputMediaPhoto{
+			Type:      "photo",
+			Media:     "attach://card",
+			Caption:   caption,
+			ParseMode: "HTML",
+		},
+		ReplyMarkup: b.replyMarkup(story, chatID),
+	}
+	return b.tg.Upload("editMessageMedia", req, []telegram.InputFile{{Field: "card", Name: "card.png", Data: card}}, nil)
+}
@@ -0,0 +1,210 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// normalizeChatID turns the forms a chat can be configured in, a numeric ID,
+// "@username" or a t.me link, into a chat_id for the Bot API. Links to
+// private chats ("t.me/c/1234567890/5") become their numeric ID. Usernames
+// that Telegram can't have, such as "@@channel", are rejected here rather
+// than by getChat at startup.
+func normalizeChatID(chatID string) (string, error) {
+	chatID = strings.TrimSpace(chatID)
+	if chatID == "" {
+		return chatID, nil
+	}
+	if username, ok := strings.CutPrefix(chatID, "@"); ok {
+		return usernameChatID(chatID, username)
+	}
+	if _, err := strconv.ParseInt(chatID, 10, 64); err == nil {
+		return chatID, nil
+	}
+
+	link := strings.TrimPrefix(strings.TrimPrefix(chatID, "https://"), "http://")
+	path, ok := strings.CutPrefix(link, "t.me/")
+	if !ok {
+		path, ok = strings.CutPrefix(link, "telegram.me/")
+	}
+	if !ok {
+		// A bare username
+		return usernameChatID(chatID, chatID)
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case parts[0] == "" || strings.HasPrefix(parts[0], "+") || parts[0] == "joinchat":
+		return "", fmt.Errorf("chat %q is not a public chat link, use the chat's numeric ID or @username", chatID)
+	case parts[0] == "c" && len(parts) > 1:
+		if _, err := strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return "", fmt.Errorf("invalid private chat link %q", chatID)
+		}
+		return "-100" + parts[1], nil
+	case parts[0] == "s" && len(parts) > 1:
+		return usernameChatID(chatID, parts[1])
+	}
+	return usernameChatID(chatID, parts[0])
+}
+
+// usernamePattern matches the usernames Telegram allows: letters, digits and
+// underscores, starting with a letter. Auctioned usernames can be 4
+// characters long, others are at least 5.
+var usernamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{3,31}$`)
+
+// usernameChatID returns the chat_id of username, taken from the configured
+// chatID, or an error if it is not a valid username.
+func usernameChatID(chatID, username string) (string, error) {
+	if !usernamePattern.MatchString(username) {
+		return "", fmt.Errorf("chat %q is not a valid username: expected a single @ followed by 4 to 32 letters, digits and underscores, starting with a letter", chatID)
+	}
+	return "@" + username, nil
+}
+
+// mapChats replaces every configured chat ID with f of it, including the
+// keys of the per-chat settings.
+func (c *Config) mapChats(f func(string) string) {
+	mapID := func(chatID string) string {
+		if chatID == "" {
+			return ""
+		}
+		return f(chatID)
+	}
+	mapRoutes := func(routes []filter.Route) []filter.Route {
+		if routes == nil {
+			return nil
+		}
+		mapped := make([]filter.Route, len(routes))
+		for i, route := range routes {
+			route.ChatID = mapID(route.ChatID)
+			mapped[i] = route
+		}
+		return mapped
+	}
+
+	c.ChatID = mapID(c.ChatID)
+	c.AdminChatID = mapID(c.AdminChatID)
+	c.RadarChatID = mapID(c.RadarChatID)
+	c.SuggestChatID = mapID(c.SuggestChatID)
+	c.Routes = mapRoutes(c.Routes)
+	if c.Shadow != nil {
+		shadow := *c.Shadow
+		shadow.Routes = mapRoutes(shadow.Routes)
+		c.Shadow = &shadow
+	}
+	c.ChatHot = mapKeys(c.ChatHot, f)
+	c.ChatLanguages = mapKeys(c.ChatLanguages, f)
+	c.ChatFooters = mapKeys(c.ChatFooters, f)
+}
+
+func mapKeys[V any](m map[string]V, f func(string) string) map[string]V {
+	if m == nil {
+		return nil
+	}
+	mapped := make(map[string]V, len(m))
+	for key, value := range m {
+		mapped[f(key)] = value
+	}
+	return mapped
+}
+
+// normalizeChats normalizes every configured chat ID, see normalizeChatID.
+func (c *Config) normalizeChats() error {
+	var err error
+	c.mapChats(func(chatID string) string {
+		normalized, normalizeErr := normalizeChatID(chatID)
+		if normalizeErr != nil {
+			err = errors.Join(err, normalizeErr)
+			return chatID
+		}
+		return normalized
+	})
+	return err
+}
+
+// useResolvedChats replaces the chats configured by username with the
+// numeric IDs they resolved to on earlier runs, see resolveChats.
+func (b *Bot) useResolvedChats() {
+	config := b.cfg()
+	b.chatIDs = make(map[string]string)
+	config.mapChats(func(chatID string) string {
+		if id, ok := b.storage.ResolvedChat(chatID); ok && strings.HasPrefix(chatID, "@") {
+			b.chatIDs[chatID] = strconv.FormatInt(id, 10)
+		}
+		return b.resolvedChat(chatID)
+	})
+	b.config.set(config)
+}
+
+// resolveChats replaces the chats configured by username with their numeric
+// IDs, which keep working when a chat changes its username. The IDs are
+// remembered in the storage, so that a username that stops resolving, or
+// starts resolving to another chat, is reported instead of followed.
+func (b *Bot) resolveChats() {
+	for username, chatID := range b.chatIDs {
+		b.checkResolvedChat(username, chatID)
+	}
+
+	config := b.cfg()
+	config.mapChats(func(chatID string) string {
+		if _, ok := b.chatIDs[chatID]; !ok && strings.HasPrefix(chatID, "@") {
+			if id, ok := b.resolveChat(chatID); ok {
+				b.chatIDs[chatID] = strconv.FormatInt(id, 10)
+			}
+		}
+		return b.resolvedChat(chatID)
+	})
+	b.config.set(config)
+
+	for username, chatID := range b.chatIDs {
+		if n := b.storage.RenameChat(username, chatID); n > 0 {
+			log.Printf("Moved the messages of %d stories from %s to chat %s", n, username, chatID)
+		}
+	}
+	if err := b.storage.Save(); err != nil {
+		log.Printf("Error saving resolved chats: %v", err)
+	}
+}
+
+// resolveChat looks up and remembers the numeric ID of the chat with
+// username. Errors are left to checkChat.
+func (b *Bot) resolveChat(username string) (int64, bool) {
+	var chat telegram.Chat
+	if err := b.tg.Call("getChat", telegram.GetChatRequest{ChatID: username}, &chat); err != nil {
+		return 0, false
+	}
+	b.storage.SetResolvedChat(username, chat.ID)
+	log.Printf("Resolved chat %s to id %d", username, chat.ID)
+	return chat.ID, true
+}
+
+// checkResolvedChat warns when username no longer resolves to chatID, the
+// chat it resolved to before, which the bot keeps posting to.
+func (b *Bot) checkResolvedChat(username, chatID string) {
+	var chat telegram.Chat
+	err := b.tg.Call("getChat", telegram.GetChatRequest{ChatID: username}, &chat)
+	switch {
+	case err != nil:
+		b.event(EventWarning, "Chat %s no longer resolves (%v), still posting to chat %s it resolved to before; set its numeric ID in the config",
+			username, err, chatID)
+	case strconv.FormatInt(chat.ID, 10) != chatID:
+		b.event(EventWarning, "Chat %s now resolves to %q (id %d) instead of chat %s, still posting to %s; set the numeric ID of the chat you mean in the config",
+			username, chatTitle(&chat), chat.ID, chatID, chatID)
+	}
+}
+
+// resolvedChat returns the numeric ID chatID, a username, was resolved to,
+// or chatID itself.
+func (b *Bot) resolvedChat(chatID string) string {
+	if resolved, ok := b.chatIDs[chatID]; ok {
+		return resolved
+	}
+	return chatID
+}
@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// fakeClock is a Clock that only moves when Advance is called.
+type fakeClock struct {
+	mutex  sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	return c.add(d, 0)
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{c.add(d, d)}
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	<-c.NewTimer(d).C()
+}
+
+func (c *fakeClock) add(d, period time.Duration) *fakeTimer {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	timer := &fakeTimer{clock: c, at: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward by d and fires the timers and tickers that
+// became due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = c.now.Add(d)
+	active := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.stopped {
+			continue
+		}
+		if !timer.at.After(c.now) {
+			select {
+			case timer.c <- c.now:
+			default:
+			}
+			if timer.period == 0 {
+				timer.stopped = true
+				continue
+			}
+			for !timer.at.After(c.now) {
+				timer.at = timer.at.Add(timer.period)
+			}
+		}
+		active = append(active, timer)
+	}
+	c.timers = active
+}
+
+// waiting returns the number of timers and tickers that have not fired or
+// been stopped.
+func (c *fakeClock) waiting() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n := 0
+	for _, timer := range c.timers {
+		if !timer.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	period  time.Duration
+	stopped bool
+	c       chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	active := !t.stopped
+	t.stopped = true
+	return active
+}
+
+type fakeTicker struct{ *fakeTimer }
+
+func (t fakeTicker) Stop() { t.fakeTimer.Stop() }
+
+func TestScheduledCleanupFollowsClock(t *testing.T) {
+	clock := newFakeClock(time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC))
+	b, tg := newTestBot(t, clock, map[string]string{"CLEANUP_SCHEDULE": "0 * * * *"})
+
+	story := &storage.Story{ID: 1, Title: "Gone", State: storage.StateExpiring, MissedPolls: DefaultCleanupAfterPolls}
+	story.SetMessage("-100123", 5)
+	b.storage.Lock()
+	b.storage.Stories[story.ID] = story
+	b.storage.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.runScheduled(ctx, "cleanup", func(config Config) string { return config.CleanupSchedule }, b.cleanupNow)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Nothing is due before 11:00, however long the test takes
+	waitFor(t, "the schedule to wait", func() bool { return clock.waiting() > 0 })
+	clock.Advance(29 * time.Minute)
+	waitFor(t, "the schedule to wait again", func() bool { return clock.waiting() > 0 })
+	if calls := tg.called("deleteMessage"); len(calls) > 0 {
+		t.Fatalf("cleanup ran at %s, before it was due", clock.Now())
+	}
+
+	clock.Advance(time.Minute)
+	waitFor(t, "the message to be deleted", func() bool { return len(tg.called("deleteMessage")) == 1 })
+	if call := tg.called("deleteMessage")[0]; call.req["chat_id"] != "-100123" || call.req["message_id"] != float64(5) {
+		t.Errorf("deleteMessage(%v), want chat -100123, message 5", call.req)
+	}
+	waitFor(t, "the story to be forgotten", func() bool {
+		b.storage.RLock()
+		defer b.storage.RUnlock()
+		return b.storage.Stories[story.ID] == nil
+	})
+}
+
+func TestWithNilClockKeepsRealClock(t *testing.T) {
+	if o := newOptions([]Option{WithClock(nil)}); o.clock == nil {
+		t.Fatal("WithClock(nil) removed the clock")
+	}
+}
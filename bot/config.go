@@ -0,0 +1,2027 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/daoleno/tg_hacker_news/cassette"
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigReloadDebounce      = 500 * time.Millisecond
+	DefaultCassetteFile       = "cassette.jsonl"
+	DefaultCleanupAfterPolls  = 12
+	DefaultLocalBackups       = 3
+	DefaultCacheSize          = 1000
+	DefaultDormantAfterPolls  = 3
+	DefaultHotThreshold       = 100
+	DefaultOnThisDaySchedule  = "0 12 * * *"
+	DefaultScoreboardSchedule = "0 12 1 * *"
+	DefaultGrowthSchedule     = "0 9 * * 1"
+	DefaultDegradeErrorRate   = 0.5
+)
+
+// Message formats: Telegram HTML, or plain text with entities converted from
+// the HTML by the bot, which Telegram cannot reject for bad markup.
+const (
+	FormatHTML     = "html"
+	FormatEntities = "entities"
+)
+
+// What happens to a story whose title is nearly the same as the title of a
+// story posted within DuplicateTitleWindow: it is not posted, or it is posted
+// as a reply to the earlier story's message.
+const (
+	DuplicateSkip  = "skip"
+	DuplicateReply = "reply"
+
+	DuplicateTitleWindow       = 48 * time.Hour
+	DefaultDuplicateSimilarity = 0.8
+)
+
+// How stories covering the same ongoing event as a story posted within
+// StoryGroupWindow are grouped: posted as replies to the first story's
+// message, or added as links to it, which makes it a developing story. Stories
+// cover the same event when their titles share StoryGroupTerms significant
+// words.
+const (
+	GroupReply   = "reply"
+	GroupCombine = "combine"
+
+	StoryGroupWindow = 24 * time.Hour
+	StoryGroupTerms  = 2
+)
+
+type Config struct {
+	BotKey              string
+	ChatID              string
+	AdminChatID         string
+	StateDir            string
+	DataPath            string
+	StorageBackend      string
+	DualWrite           string
+	DualWritePath       string
+	RedisURL            string
+	StorageKey          string
+	LocalBackups        int
+	FailoverLease       Duration
+	ReplicaID           string
+	ConfigPath          string
+	ScoreThreshold      int64
+	CommentsThreshold   int64
+	HotScore            int64
+	HotComments         int64
+	ChatHot             map[string]HotThresholds
+	ThresholdSchedule   []ThresholdWindow
+	DiscussionRatio     float64
+	Routes              []filter.Route
+	Feeds               []FeedConfig
+	URLRewrites         []URLRewrite
+	ReaderMirrors       map[string]string
+	Shadow              *ShadowConfig
+	Experiment          *Experiment
+	Language            string
+	ChatLanguages       map[string]string
+	Footer              string
+	ChatFooters         map[string]string
+	MessageFormat       string
+	UserAgent           string
+	HNRequestInterval   Duration
+	RequestBudgets      map[string]int64
+	DegradeErrorRate    float64
+	CacheSize           int
+	Timezone            string
+	OnThisDaySchedule   string
+	ScoreboardSchedule  string
+	GrowthSchedule      string
+	HeartbeatSchedule   string
+	CleanupSchedule     string
+	PostingWindow       string
+	MaintenanceWindows  []string
+	PostGap             Duration
+	TopPerHour          int
+	APIAddr             string
+	TelegramAPIURL      string
+	APIToken            string
+	WebhookURLs         []string
+	WebhookSecret       string
+	EventBus            string
+	EventBusURL         string
+	EventBusTopic       string
+	PollInterval        Duration
+	CleanupInterval     Duration
+	BatchSize           int
+	CleanupAfterPolls   int
+	MaxTrackedStories   int
+	DormantRank         int
+	DormantAfterPolls   int
+	RepostDays          int
+	DuplicateTitles     string
+	DuplicateSimilarity float64
+	StoryGroups         string
+	EnableCommands      bool
+	BestCommentButton   bool
+	CassetteMode        string
+	CassettePath        string
+	AuditLog            bool
+	AuditPath           string
+	OnThisDay           bool
+	Scoreboard          bool
+	GrowthReport        bool
+	RadarChatID         string
+	RadarKeywords       []string
+	SuggestChatID       string
+	SuggestVotes        int
+	Enrichers           []string
+	PluginDir           string
+	Plugins             map[string]json.RawMessage
+	CommentMilestones   []int64
+	RadarScoreThreshold int64
+	Backup              BackupConfig
+	Moderation          ModerationConfig
+	Network             NetworkConfig
+	Summary             SummaryConfig
+	DigestEmail         DigestEmailConfig
+	Card                CardConfig
+
+	// loc is the loaded Timezone, set by validate.
+	loc *time.Location
+
+	// postingWindow is the parsed PostingWindow, set by validate.
+	postingWindow *PostingWindow
+
+	// maintenance are the parsed MaintenanceWindows, set by validate.
+	maintenance []MaintenanceWindow
+
+	// plugins are the plugins in PluginDir configured with Plugins, set by
+	// validate.
+	plugins []*loadedPlugin
+
+	// card draws the cards of Card, set by validate unless cards are off.
+	card *cardRenderer
+}
+
+// FileConfig is the on-disk representation of the optional configuration
+// file. Pointer fields distinguish "unset" from an explicit zero.
+type FileConfig struct {
+	BotKey              string   `json:"bot_key,omitempty" yaml:"bot_key,omitempty" toml:"bot_key,omitempty"`
+	ChatID              string   `json:"chat_id,omitempty" yaml:"chat_id,omitempty" toml:"chat_id,omitempty"`
+	AdminChatID         string   `json:"admin_chat_id,omitempty" yaml:"admin_chat_id,omitempty" toml:"admin_chat_id,omitempty"`
+	StateDir            string   `json:"state_dir,omitempty" yaml:"state_dir,omitempty" toml:"state_dir,omitempty"`
+	DataPath            string   `json:"data_path,omitempty" yaml:"data_path,omitempty" toml:"data_path,omitempty"`
+	StorageBackend      string   `json:"storage_backend,omitempty" yaml:"storage_backend,omitempty" toml:"storage_backend,omitempty"`
+	DualWrite           string   `json:"storage_dual_write,omitempty" yaml:"storage_dual_write,omitempty" toml:"storage_dual_write,omitempty"`
+	DualWritePath       string   `json:"storage_dual_write_path,omitempty" yaml:"storage_dual_write_path,omitempty" toml:"storage_dual_write_path,omitempty"`
+	RedisURL            string   `json:"redis_url,omitempty" yaml:"redis_url,omitempty" toml:"redis_url,omitempty"`
+	LocalBackups        *int     `json:"local_backups,omitempty" yaml:"local_backups,omitempty" toml:"local_backups,omitempty"`
+	ScoreThreshold      *int64   `json:"score_threshold,omitempty" yaml:"score_threshold,omitempty" toml:"score_threshold,omitempty"`
+	CommentsThreshold   *int64   `json:"comments_threshold,omitempty" yaml:"comments_threshold,omitempty" toml:"comments_threshold,omitempty"`
+	HotScore            *int64   `json:"hot_score_threshold,omitempty" yaml:"hot_score_threshold,omitempty" toml:"hot_score_threshold,omitempty"`
+	HotComments         *int64   `json:"hot_comments_threshold,omitempty" yaml:"hot_comments_threshold,omitempty" toml:"hot_comments_threshold,omitempty"`
+	DiscussionRatio     *float64 `json:"discussion_ratio,omitempty" yaml:"discussion_ratio,omitempty" toml:"discussion_ratio,omitempty"`
+	CleanupAfterPolls   *int     `json:"cleanup_after_polls,omitempty" yaml:"cleanup_after_polls,omitempty" toml:"cleanup_after_polls,omitempty"`
+	MaxTrackedStories   *int     `json:"max_tracked_stories,omitempty" yaml:"max_tracked_stories,omitempty" toml:"max_tracked_stories,omitempty"`
+	DormantRank         *int     `json:"dormant_rank,omitempty" yaml:"dormant_rank,omitempty" toml:"dormant_rank,omitempty"`
+	DormantAfterPolls   *int     `json:"dormant_after_polls,omitempty" yaml:"dormant_after_polls,omitempty" toml:"dormant_after_polls,omitempty"`
+	RepostDays          *int     `json:"repost_days,omitempty" yaml:"repost_days,omitempty" toml:"repost_days,omitempty"`
+	DuplicateTitles     string   `json:"duplicate_titles,omitempty" yaml:"duplicate_titles,omitempty" toml:"duplicate_titles,omitempty"`
+	DuplicateSimilarity *float64 `json:"duplicate_similarity,omitempty" yaml:"duplicate_similarity,omitempty" toml:"duplicate_similarity,omitempty"`
+	StoryGroups         string   `json:"story_groups,omitempty" yaml:"story_groups,omitempty" toml:"story_groups,omitempty"`
+	EnableCommands      *bool    `json:"enable_commands,omitempty" yaml:"enable_commands,omitempty" toml:"enable_commands,omitempty"`
+	BestCommentButton   *bool    `json:"best_comment_button,omitempty" yaml:"best_comment_button,omitempty" toml:"best_comment_button,omitempty"`
+	CassetteMode        string   `json:"cassette_mode,omitempty" yaml:"cassette_mode,omitempty" toml:"cassette_mode,omitempty"`
+	CassettePath        string   `json:"cassette_path,omitempty" yaml:"cassette_path,omitempty" toml:"cassette_path,omitempty"`
+	AuditLog            *bool    `json:"audit_log,omitempty" yaml:"audit_log,omitempty" toml:"audit_log,omitempty"`
+	AuditPath           string   `json:"audit_path,omitempty" yaml:"audit_path,omitempty" toml:"audit_path,omitempty"`
+	OnThisDay           *bool    `json:"on_this_day,omitempty" yaml:"on_this_day,omitempty" toml:"on_this_day,omitempty"`
+	Scoreboard          *bool    `json:"scoreboard,omitempty" yaml:"scoreboard,omitempty" toml:"scoreboard,omitempty"`
+	GrowthReport        *bool    `json:"growth_report,omitempty" yaml:"growth_report,omitempty" toml:"growth_report,omitempty"`
+	RadarChatID         string   `json:"radar_chat_id,omitempty" yaml:"radar_chat_id,omitempty" toml:"radar_chat_id,omitempty"`
+	RadarKeywords       []string `json:"radar_keywords,omitempty" yaml:"radar_keywords,omitempty" toml:"radar_keywords,omitempty"`
+	SuggestChatID       string   `json:"suggest_chat_id,omitempty" yaml:"suggest_chat_id,omitempty" toml:"suggest_chat_id,omitempty"`
+	SuggestVotes        *int     `json:"suggest_votes,omitempty" yaml:"suggest_votes,omitempty" toml:"suggest_votes,omitempty"`
+	Enrichers           []string `json:"enrichers,omitempty" yaml:"enrichers,omitempty" toml:"enrichers,omitempty"`
+	CommentMilestones   []int64  `json:"comment_milestones,omitempty" yaml:"comment_milestones,omitempty" toml:"comment_milestones,omitempty"`
+	RadarScoreThreshold *int64   `json:"radar_score_threshold,omitempty" yaml:"radar_score_threshold,omitempty" toml:"radar_score_threshold,omitempty"`
+
+	PluginDir string                  `json:"plugin_dir,omitempty" yaml:"plugin_dir,omitempty" toml:"plugin_dir,omitempty"`
+	Plugins   map[string]PluginConfig `json:"plugins,omitempty" yaml:"plugins,omitempty" toml:"plugins,omitempty"`
+
+	ChatHot           map[string]HotThresholds `json:"chat_hot_thresholds,omitempty" yaml:"chat_hot_thresholds,omitempty" toml:"chat_hot_thresholds,omitempty"`
+	ThresholdSchedule []ThresholdWindow        `json:"threshold_schedule,omitempty" yaml:"threshold_schedule,omitempty" toml:"threshold_schedule,omitempty"`
+	Routes            []filter.Route           `json:"routes,omitempty" yaml:"routes,omitempty" toml:"routes,omitempty"`
+	Chats             []ChatConfig             `json:"chats,omitempty" yaml:"chats,omitempty" toml:"chats,omitempty"`
+	Feeds             []FeedConfig             `json:"feeds,omitempty" yaml:"feeds,omitempty" toml:"feeds,omitempty"`
+	URLRewrites       []URLRewrite             `json:"url_rewrites,omitempty" yaml:"url_rewrites,omitempty" toml:"url_rewrites,omitempty"`
+	ReaderMirrors     map[string]string        `json:"reader_mirrors,omitempty" yaml:"reader_mirrors,omitempty" toml:"reader_mirrors,omitempty"`
+	Shadow            *ShadowConfig            `json:"shadow,omitempty" yaml:"shadow,omitempty" toml:"shadow,omitempty"`
+	Experiment        *Experiment              `json:"experiment,omitempty" yaml:"experiment,omitempty" toml:"experiment,omitempty"`
+
+	Language      string            `json:"language,omitempty" yaml:"language,omitempty" toml:"language,omitempty"`
+	ChatLanguages map[string]string `json:"chat_languages,omitempty" yaml:"chat_languages,omitempty" toml:"chat_languages,omitempty"`
+
+	Footer        *string           `json:"footer,omitempty" yaml:"footer,omitempty" toml:"footer,omitempty"`
+	ChatFooters   map[string]string `json:"chat_footers,omitempty" yaml:"chat_footers,omitempty" toml:"chat_footers,omitempty"`
+	MessageFormat string            `json:"message_format,omitempty" yaml:"message_format,omitempty" toml:"message_format,omitempty"`
+
+	UserAgent         string           `json:"user_agent,omitempty" yaml:"user_agent,omitempty" toml:"user_agent,omitempty"`
+	HNRequestInterval *Duration        `json:"hn_request_interval,omitempty" yaml:"hn_request_interval,omitempty" toml:"hn_request_interval,omitempty"`
+	RequestBudgets    map[string]int64 `json:"request_budgets,omitempty" yaml:"request_budgets,omitempty" toml:"request_budgets,omitempty"`
+	DegradeErrorRate  *float64         `json:"degrade_error_rate,omitempty" yaml:"degrade_error_rate,omitempty" toml:"degrade_error_rate,omitempty"`
+	CacheSize         *int             `json:"cache_size,omitempty" yaml:"cache_size,omitempty" toml:"cache_size,omitempty"`
+
+	Timezone           string    `json:"timezone,omitempty" yaml:"timezone,omitempty" toml:"timezone,omitempty"`
+	OnThisDaySchedule  *string   `json:"on_this_day_schedule,omitempty" yaml:"on_this_day_schedule,omitempty" toml:"on_this_day_schedule,omitempty"`
+	ScoreboardSchedule *string   `json:"scoreboard_schedule,omitempty" yaml:"scoreboard_schedule,omitempty" toml:"scoreboard_schedule,omitempty"`
+	GrowthSchedule     *string   `json:"growth_schedule,omitempty" yaml:"growth_schedule,omitempty" toml:"growth_schedule,omitempty"`
+	HeartbeatSchedule  *string   `json:"heartbeat_schedule,omitempty" yaml:"heartbeat_schedule,omitempty" toml:"heartbeat_schedule,omitempty"`
+	CleanupSchedule    *string   `json:"cleanup_schedule,omitempty" yaml:"cleanup_schedule,omitempty" toml:"cleanup_schedule,omitempty"`
+	PollInterval       *Duration `json:"poll_interval,omitempty" yaml:"poll_interval,omitempty" toml:"poll_interval,omitempty"`
+	CleanupInterval    *Duration `json:"cleanup_interval,omitempty" yaml:"cleanup_interval,omitempty" toml:"cleanup_interval,omitempty"`
+	BatchSize          *int      `json:"batch_size,omitempty" yaml:"batch_size,omitempty" toml:"batch_size,omitempty"`
+	PostingWindow      *string   `json:"posting_window,omitempty" yaml:"posting_window,omitempty" toml:"posting_window,omitempty"`
+	MaintenanceWindows []string  `json:"maintenance_windows,omitempty" yaml:"maintenance_windows,omitempty" toml:"maintenance_windows,omitempty"`
+	FailoverLease      *Duration `json:"failover_lease,omitempty" yaml:"failover_lease,omitempty" toml:"failover_lease,omitempty"`
+	ReplicaID          string    `json:"replica_id,omitempty" yaml:"replica_id,omitempty" toml:"replica_id,omitempty"`
+	PostGap            *Duration `json:"post_gap,omitempty" yaml:"post_gap,omitempty" toml:"post_gap,omitempty"`
+	TopPerHour         *int      `json:"top_per_hour,omitempty" yaml:"top_per_hour,omitempty" toml:"top_per_hour,omitempty"`
+	APIAddr            string    `json:"api_addr,omitempty" yaml:"api_addr,omitempty" toml:"api_addr,omitempty"`
+	TelegramAPIURL     string    `json:"telegram_api_url,omitempty" yaml:"telegram_api_url,omitempty" toml:"telegram_api_url,omitempty"`
+	APIToken           string    `json:"api_token,omitempty" yaml:"api_token,omitempty" toml:"api_token,omitempty"`
+	WebhookURLs        []string  `json:"webhook_urls,omitempty" yaml:"webhook_urls,omitempty" toml:"webhook_urls,omitempty"`
+	WebhookSecret      string    `json:"webhook_secret,omitempty" yaml:"webhook_secret,omitempty" toml:"webhook_secret,omitempty"`
+	EventBus           string    `json:"event_bus,omitempty" yaml:"event_bus,omitempty" toml:"event_bus,omitempty"`
+	EventBusURL        string    `json:"event_bus_url,omitempty" yaml:"event_bus_url,omitempty" toml:"event_bus_url,omitempty"`
+	EventBusTopic      string    `json:"event_bus_topic,omitempty" yaml:"event_bus_topic,omitempty" toml:"event_bus_topic,omitempty"`
+
+	Backup     *BackupConfig     `json:"backup,omitempty" yaml:"backup,omitempty" toml:"backup,omitempty"`
+	Moderation *ModerationConfig `json:"moderation,omitempty" yaml:"moderation,omitempty" toml:"moderation,omitempty"`
+	Network    *NetworkConfig    `json:"network,omitempty" yaml:"network,omitempty" toml:"network,omitempty"`
+	Summary    *SummaryConfig    `json:"summary,omitempty" yaml:"summary,omitempty" toml:"summary,omitempty"`
+
+	DigestEmail *DigestEmailConfig `json:"digest_email,omitempty" yaml:"digest_email,omitempty" toml:"digest_email,omitempty"`
+	Card        *CardConfig        `json:"card,omitempty" yaml:"card,omitempty" toml:"card,omitempty"`
+}
+
+// HotThresholds overrides the 🔥 thresholds for one chat. Unset fields fall
+// back to the global thresholds.
+type HotThresholds struct {
+	Score    *int64 `json:"score,omitempty" yaml:"score,omitempty" toml:"score,omitempty"`
+	Comments *int64 `json:"comments,omitempty" yaml:"comments,omitempty" toml:"comments,omitempty"`
+}
+
+func (h HotThresholds) String() string {
+	format := func(v *int64) string {
+		if v == nil {
+			return "default"
+		}
+		return strconv.FormatInt(*v, 10)
+	}
+	return fmt.Sprintf("score=%s comments=%s", format(h.Score), format(h.Comments))
+}
+
+// hotThresholds returns the score and comment counts above which values are
+// marked 🔥 in chatID. A threshold of 0 disables the mark.
+func (c *Config) hotThresholds(chatID string) (score, comments int64) {
+	score, comments = c.HotScore, c.HotComments
+	if override, ok := c.ChatHot[chatID]; ok {
+		if override.Score != nil {
+			score = *override.Score
+		}
+		if override.Comments != nil {
+			comments = *override.Comments
+		}
+	}
+	return score, comments
+}
+
+// ChatConfig is a chat that gets every story passing its thresholds besides
+// the main chat, with its own formatting. It is shorthand for a route without
+// a match and the chat's entries in chat_languages, chat_footers and
+// chat_hot_thresholds.
+type ChatConfig struct {
+	ChatID            string         `json:"chat_id" yaml:"chat_id" toml:"chat_id"`
+	ScoreThreshold    int64          `json:"score_threshold" yaml:"score_threshold" toml:"score_threshold"`
+	CommentsThreshold int64          `json:"comments_threshold" yaml:"comments_threshold" toml:"comments_threshold"`
+	Language          string         `json:"language,omitempty" yaml:"language,omitempty" toml:"language,omitempty"`
+	Footer            *string        `json:"footer,omitempty" yaml:"footer,omitempty" toml:"footer,omitempty"`
+	HotThresholds     *HotThresholds `json:"hot_thresholds,omitempty" yaml:"hot_thresholds,omitempty" toml:"hot_thresholds,omitempty"`
+}
+
+// addChats adds the chats of the config file as routes and per-chat
+// settings, which take precedence over the maps they are added to.
+func (c *Config) addChats(chats []ChatConfig) error {
+	for _, chat := range chats {
+		if chat.ChatID == "" {
+			return fmt.Errorf("chats: every entry needs a chat_id")
+		}
+		c.Routes = append(c.Routes, filter.Route{
+			ChatID:            chat.ChatID,
+			ScoreThreshold:    chat.ScoreThreshold,
+			CommentsThreshold: chat.CommentsThreshold,
+		})
+		if chat.Language != "" {
+			if c.ChatLanguages == nil {
+				c.ChatLanguages = make(map[string]string)
+			}
+			c.ChatLanguages[chat.ChatID] = chat.Language
+		}
+		if chat.Footer != nil {
+			if c.ChatFooters == nil {
+				c.ChatFooters = make(map[string]string)
+			}
+			c.ChatFooters[chat.ChatID] = *chat.Footer
+		}
+		if chat.HotThresholds != nil {
+			if c.ChatHot == nil {
+				c.ChatHot = make(map[string]HotThresholds)
+			}
+			c.ChatHot[chat.ChatID] = *chat.HotThresholds
+		}
+	}
+	return nil
+}
+
+// ThresholdWindow overrides the posting thresholds of the main chat while
+// When, a cron expression evaluated in the configured time zone, matches the
+// current minute. Unset fields fall back to the global thresholds.
+type ThresholdWindow struct {
+	When              string `json:"when" yaml:"when" toml:"when"`
+	ScoreThreshold    *int64 `json:"score_threshold,omitempty" yaml:"score_threshold,omitempty" toml:"score_threshold,omitempty"`
+	CommentsThreshold *int64 `json:"comments_threshold,omitempty" yaml:"comments_threshold,omitempty" toml:"comments_threshold,omitempty"`
+
+	schedule *Schedule
+}
+
+func (w ThresholdWindow) String() string {
+	return fmt.Sprintf("%q %s", w.When, HotThresholds{Score: w.ScoreThreshold, Comments: w.CommentsThreshold})
+}
+
+// thresholds returns the main chat's posting thresholds at now: those of the
+// first matching window in threshold_schedule, or the global ones.
+func (c *Config) thresholds(now time.Time) (score, comments int64) {
+	score, comments = c.ScoreThreshold, c.CommentsThreshold
+	for _, window := range c.ThresholdSchedule {
+		if window.schedule == nil || !window.schedule.Matches(now) {
+			continue
+		}
+		if window.ScoreThreshold != nil {
+			score = *window.ScoreThreshold
+		}
+		if window.CommentsThreshold != nil {
+			comments = *window.CommentsThreshold
+		}
+		break
+	}
+	return score, comments
+}
+
+// repostWindow is how long posted links are remembered, zero when repost
+// detection is off.
+func (c *Config) repostWindow() time.Duration {
+	return time.Duration(c.RepostDays) * 24 * time.Hour
+}
+
+// isDormant reports whether a posted story at rank is not worth editing: it
+// ranks below DormantRank and its score has not changed for
+// DormantAfterPolls polls. It wakes up as soon as either stops being true.
+func (c *Config) isDormant(story *storage.Story, rank int) bool {
+	return c.DormantRank > 0 && rank > c.DormantRank && story.StalePolls >= c.DormantAfterPolls
+}
+
+// withFooter appends the footer configured for chatID to an HTML message
+// text. The footer is plain text and escaped here.
+func (c *Config) withFooter(text, chatID string) string {
+	footer, ok := c.ChatFooters[chatID]
+	if !ok {
+		footer = c.Footer
+	}
+	if footer = strings.TrimSpace(footer); footer == "" {
+		return text
+	}
+	return text + "\n\n" + html.EscapeString(footer)
+}
+
+// crossedMilestone returns the highest comment milestone that comments has
+// reached since msg was last updated and that was not announced yet, or 0.
+func (c *Config) crossedMilestone(msg storage.ChatMessage, comments int64) int64 {
+	var crossed int64
+	for _, milestone := range c.CommentMilestones {
+		if milestone > msg.LastSentComments && milestone > msg.Milestone && milestone <= comments {
+			crossed = milestone
+		}
+	}
+	return crossed
+}
+
+// Duration is a time.Duration written as a string such as "90m" in the
+// config file.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"5m\": %w", err)
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+// UnmarshalYAML only takes a string, as a plain number would be taken for
+// nanoseconds.
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind != yaml.ScalarNode || node.ShortTag() != "!!str" {
+		return fmt.Errorf("line %d: duration must be a string like \"5m\"", node.Line)
+	}
+	return d.UnmarshalText([]byte(node.Value))
+}
+
+// UnmarshalText parses the duration, for TOML config files.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// PluginConfig is the config of one plugin in the config file, handed to the
+// plugin as JSON whatever the format of the file.
+type PluginConfig json.RawMessage
+
+func (p *PluginConfig) UnmarshalJSON(data []byte) error {
+	*p = append((*p)[:0], data...)
+	return nil
+}
+
+func (p *PluginConfig) UnmarshalYAML(node *yaml.Node) error {
+	var value any
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	return p.UnmarshalTOML(value)
+}
+
+func (p *PluginConfig) UnmarshalTOML(value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to convert plugin config to JSON: %w", err)
+	}
+	*p = data
+	return nil
+}
+
+// LoadConfig reads the config from the environment and the optional config
+// file and validates it.
+func LoadConfig() (Config, error) {
+	config, err := readConfig()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// readConfig assembles the config from defaults, the config file and the
+// environment without validating it, for subcommands that don't talk to
+// Telegram.
+func readConfig() (Config, error) {
+	config := Config{
+		ChatID:              "@hacker_news_wooo",
+		StorageBackend:      storage.BackendJSON,
+		LocalBackups:        DefaultLocalBackups,
+		ReplicaID:           defaultReplicaID(),
+		CacheSize:           DefaultCacheSize,
+		MessageFormat:       FormatHTML,
+		DuplicateSimilarity: DefaultDuplicateSimilarity,
+		DegradeErrorRate:    DefaultDegradeErrorRate,
+		UserAgent:           DefaultUserAgent,
+		ConfigPath:          os.Getenv("CONFIG_PATH"),
+		ScoreThreshold:      ScoreThreshold,
+		CommentsThreshold:   NumCommentsThreshold,
+		Language:            DefaultLanguage,
+		Timezone:            "UTC",
+		OnThisDaySchedule:   DefaultOnThisDaySchedule,
+		ScoreboardSchedule:  DefaultScoreboardSchedule,
+		GrowthSchedule:      DefaultGrowthSchedule,
+		HotScore:            DefaultHotThreshold,
+		HotComments:         DefaultHotThreshold,
+		PollInterval:        Duration(DefaultPollInterval),
+		CleanupInterval:     Duration(DefaultCleanupInterval),
+		BatchSize:           DefaultBatchSize,
+		CleanupAfterPolls:   DefaultCleanupAfterPolls,
+		DormantAfterPolls:   DefaultDormantAfterPolls,
+		RadarScoreThreshold: DefaultRadarScore,
+		EventBusTopic:       DefaultEventBusTopic,
+		Backup: BackupConfig{
+			Region:   DefaultBackupRegion,
+			Key:      DefaultBackupKey,
+			Interval: Duration(DefaultBackupInterval),
+		},
+		Moderation: ModerationConfig{
+			Timeout:   Duration(DefaultModerationTimeout),
+			OnTimeout: ModerationExpire,
+		},
+		DigestEmail: DigestEmailConfig{
+			Schedule: DefaultDigestEmailSchedule,
+			Period:   Duration(DefaultDigestEmailPeriod),
+		},
+	}
+
+	if config.ConfigPath != "" {
+		if err := config.applyFile(config.ConfigPath); err != nil {
+			return Config{}, err
+		}
+	}
+
+	// Environment variables take precedence over the config file
+	botKey, err := secretEnv("BOT_KEY")
+	if err != nil {
+		return Config{}, err
+	}
+	if botKey != "" {
+		config.BotKey = botKey
+	}
+	if chatID := os.Getenv("CHAT_ID"); chatID != "" {
+		config.ChatID = chatID
+	}
+	if adminChatID := os.Getenv("ADMIN_CHAT_ID"); adminChatID != "" {
+		config.AdminChatID = adminChatID
+	}
+	if stateDir := os.Getenv("STATE_DIR"); stateDir != "" {
+		config.StateDir = stateDir
+	}
+	if dataPath := os.Getenv("DATA_PATH"); dataPath != "" {
+		config.DataPath = dataPath
+	}
+	if backend := os.Getenv("STORAGE_BACKEND"); backend != "" {
+		config.StorageBackend = backend
+	}
+	if dualWrite := os.Getenv("STORAGE_DUAL_WRITE"); dualWrite != "" {
+		config.DualWrite = dualWrite
+	}
+	if dualWritePath := os.Getenv("STORAGE_DUAL_WRITE_PATH"); dualWritePath != "" {
+		config.DualWritePath = dualWritePath
+	}
+	redisURL, err := secretEnv("REDIS_URL")
+	if err != nil {
+		return Config{}, err
+	}
+	if redisURL != "" {
+		config.RedisURL = redisURL
+	}
+	if backups := os.Getenv("LOCAL_BACKUPS"); backups != "" {
+		n, err := strconv.Atoi(backups)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid LOCAL_BACKUPS %q: %w", backups, err)
+		}
+		config.LocalBackups = n
+	}
+	if lease := os.Getenv("FAILOVER_LEASE"); lease != "" {
+		d, err := time.ParseDuration(lease)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid FAILOVER_LEASE %q: %w", lease, err)
+		}
+		config.FailoverLease = Duration(d)
+	}
+	if replicaID := os.Getenv("REPLICA_ID"); replicaID != "" {
+		config.ReplicaID = replicaID
+	}
+	if interval := os.Getenv("POLL_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid POLL_INTERVAL %q: %w", interval, err)
+		}
+		config.PollInterval = Duration(d)
+	}
+	if interval := os.Getenv("CLEANUP_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CLEANUP_INTERVAL %q: %w", interval, err)
+		}
+		config.CleanupInterval = Duration(d)
+	}
+	if size := os.Getenv("BATCH_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid BATCH_SIZE %q: %w", size, err)
+		}
+		config.BatchSize = n
+	}
+	if polls := os.Getenv("CLEANUP_AFTER_POLLS"); polls != "" {
+		n, err := strconv.Atoi(polls)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CLEANUP_AFTER_POLLS %q: %w", polls, err)
+		}
+		config.CleanupAfterPolls = n
+	}
+	if limit := os.Getenv("MAX_TRACKED_STORIES"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid MAX_TRACKED_STORIES %q: %w", limit, err)
+		}
+		config.MaxTrackedStories = n
+	}
+	if rank := os.Getenv("DORMANT_RANK"); rank != "" {
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid DORMANT_RANK %q: %w", rank, err)
+		}
+		config.DormantRank = n
+	}
+	if polls := os.Getenv("DORMANT_AFTER_POLLS"); polls != "" {
+		n, err := strconv.Atoi(polls)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid DORMANT_AFTER_POLLS %q: %w", polls, err)
+		}
+		config.DormantAfterPolls = n
+	}
+	if days := os.Getenv("REPOST_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid REPOST_DAYS %q: %w", days, err)
+		}
+		config.RepostDays = n
+	}
+	if threshold := os.Getenv("SCORE_THRESHOLD"); threshold != "" {
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SCORE_THRESHOLD %q: %w", threshold, err)
+		}
+		config.ScoreThreshold = n
+	}
+	if threshold := os.Getenv("COMMENTS_THRESHOLD"); threshold != "" {
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid COMMENTS_THRESHOLD %q: %w", threshold, err)
+		}
+		config.CommentsThreshold = n
+	}
+	if threshold := os.Getenv("HOT_SCORE_THRESHOLD"); threshold != "" {
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid HOT_SCORE_THRESHOLD %q: %w", threshold, err)
+		}
+		config.HotScore = n
+	}
+	if threshold := os.Getenv("HOT_COMMENTS_THRESHOLD"); threshold != "" {
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid HOT_COMMENTS_THRESHOLD %q: %w", threshold, err)
+		}
+		config.HotComments = n
+	}
+	if apiURL := os.Getenv("TELEGRAM_API_URL"); apiURL != "" {
+		config.TelegramAPIURL = apiURL
+	}
+	if apiAddr := os.Getenv("API_ADDR"); apiAddr != "" {
+		config.APIAddr = apiAddr
+	}
+	apiToken, err := secretEnv("API_TOKEN")
+	if err != nil {
+		return Config{}, err
+	}
+	if apiToken != "" {
+		config.APIToken = apiToken
+	}
+	if urls := os.Getenv("WEBHOOK_URLS"); urls != "" {
+		config.WebhookURLs = splitList(urls)
+	}
+	secret, err := secretEnv("WEBHOOK_SECRET")
+	if err != nil {
+		return Config{}, err
+	}
+	if secret != "" {
+		config.WebhookSecret = secret
+	}
+	if bus := os.Getenv("EVENT_BUS"); bus != "" {
+		config.EventBus = bus
+	}
+	if busURL := os.Getenv("EVENT_BUS_URL"); busURL != "" {
+		config.EventBusURL = busURL
+	}
+	if topic := os.Getenv("EVENT_BUS_TOPIC"); topic != "" {
+		config.EventBusTopic = topic
+	}
+	if timezone := os.Getenv("TIMEZONE"); timezone != "" {
+		config.Timezone = timezone
+	}
+	if schedule, ok := os.LookupEnv("ON_THIS_DAY_SCHEDULE"); ok {
+		config.OnThisDaySchedule = schedule
+	}
+	if schedule, ok := os.LookupEnv("SCOREBOARD_SCHEDULE"); ok {
+		config.ScoreboardSchedule = schedule
+	}
+	if schedule, ok := os.LookupEnv("GROWTH_SCHEDULE"); ok {
+		config.GrowthSchedule = schedule
+	}
+	if schedule, ok := os.LookupEnv("HEARTBEAT_SCHEDULE"); ok {
+		config.HeartbeatSchedule = schedule
+	}
+	if schedule, ok := os.LookupEnv("CLEANUP_SCHEDULE"); ok {
+		config.CleanupSchedule = schedule
+	}
+	if window := os.Getenv("POSTING_WINDOW"); window != "" {
+		config.PostingWindow = window
+	}
+	if windows := os.Getenv("MAINTENANCE_WINDOWS"); windows != "" {
+		config.MaintenanceWindows = splitList(windows)
+	}
+	if gap := os.Getenv("POST_GAP"); gap != "" {
+		d, err := time.ParseDuration(gap)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid POST_GAP %q: %w", gap, err)
+		}
+		config.PostGap = Duration(d)
+	}
+	if top := os.Getenv("TOP_PER_HOUR"); top != "" {
+		n, err := strconv.Atoi(top)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid TOP_PER_HOUR %q: %w", top, err)
+		}
+		config.TopPerHour = n
+	}
+	if footer, ok := os.LookupEnv("MESSAGE_FOOTER"); ok {
+		config.Footer = footer
+	}
+	if format := os.Getenv("MESSAGE_FORMAT"); format != "" {
+		config.MessageFormat = format
+	}
+	if userAgent := os.Getenv("USER_AGENT"); userAgent != "" {
+		config.UserAgent = userAgent
+	}
+	if interval := os.Getenv("HN_REQUEST_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid HN_REQUEST_INTERVAL %q: %w", interval, err)
+		}
+		config.HNRequestInterval = Duration(d)
+	}
+	if size := os.Getenv("CACHE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid CACHE_SIZE %q: %w", size, err)
+		}
+		config.CacheSize = n
+	}
+	if budgets := os.Getenv("REQUEST_BUDGETS"); budgets != "" {
+		parsed, err := parseBudgets(budgets)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid REQUEST_BUDGETS: %w", err)
+		}
+		config.RequestBudgets = parsed
+	}
+	if rate := os.Getenv("DEGRADE_ERROR_RATE"); rate != "" {
+		f, err := strconv.ParseFloat(rate, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid DEGRADE_ERROR_RATE %q: %w", rate, err)
+		}
+		config.DegradeErrorRate = f
+	}
+	if lang := os.Getenv("BOT_LANGUAGE"); lang != "" {
+		config.Language = lang
+	}
+	if ratio := os.Getenv("DISCUSSION_RATIO"); ratio != "" {
+		f, err := strconv.ParseFloat(ratio, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid DISCUSSION_RATIO %q: %w", ratio, err)
+		}
+		config.DiscussionRatio = f
+	}
+	if mode := os.Getenv("DUPLICATE_TITLES"); mode != "" {
+		config.DuplicateTitles = mode
+	}
+	if groups := os.Getenv("STORY_GROUPS"); groups != "" {
+		config.StoryGroups = groups
+	}
+	if similarity := os.Getenv("DUPLICATE_SIMILARITY"); similarity != "" {
+		f, err := strconv.ParseFloat(similarity, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid DUPLICATE_SIMILARITY %q: %w", similarity, err)
+		}
+		config.DuplicateSimilarity = f
+	}
+	if mode := os.Getenv("CASSETTE_MODE"); mode != "" {
+		config.CassetteMode = mode
+	}
+	if path := os.Getenv("CASSETTE_PATH"); path != "" {
+		config.CassettePath = path
+	}
+	if audit := os.Getenv("AUDIT_LOG"); audit != "" {
+		b, err := strconv.ParseBool(audit)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid AUDIT_LOG %q: %w", audit, err)
+		}
+		config.AuditLog = b
+	}
+	if path := os.Getenv("AUDIT_PATH"); path != "" {
+		config.AuditPath = path
+	}
+	if enable := os.Getenv("ENABLE_COMMANDS"); enable != "" {
+		b, err := strconv.ParseBool(enable)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ENABLE_COMMANDS %q: %w", enable, err)
+		}
+		config.EnableCommands = b
+	}
+	if best := os.Getenv("BEST_COMMENT_BUTTON"); best != "" {
+		b, err := strconv.ParseBool(best)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid BEST_COMMENT_BUTTON %q: %w", best, err)
+		}
+		config.BestCommentButton = b
+	}
+	if onThisDay := os.Getenv("ON_THIS_DAY"); onThisDay != "" {
+		b, err := strconv.ParseBool(onThisDay)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid ON_THIS_DAY %q: %w", onThisDay, err)
+		}
+		config.OnThisDay = b
+	}
+	if scoreboard := os.Getenv("SCOREBOARD"); scoreboard != "" {
+		b, err := strconv.ParseBool(scoreboard)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SCOREBOARD %q: %w", scoreboard, err)
+		}
+		config.Scoreboard = b
+	}
+	if growth := os.Getenv("GROWTH_REPORT"); growth != "" {
+		b, err := strconv.ParseBool(growth)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid GROWTH_REPORT %q: %w", growth, err)
+		}
+		config.GrowthReport = b
+	}
+	if radarChatID := os.Getenv("RADAR_CHAT_ID"); radarChatID != "" {
+		config.RadarChatID = radarChatID
+	}
+	if keywords := os.Getenv("RADAR_KEYWORDS"); keywords != "" {
+		config.RadarKeywords = splitList(keywords)
+	}
+	if suggestChatID := os.Getenv("SUGGEST_CHAT_ID"); suggestChatID != "" {
+		config.SuggestChatID = suggestChatID
+	}
+	if votes := os.Getenv("SUGGEST_VOTES"); votes != "" {
+		n, err := strconv.Atoi(votes)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid SUGGEST_VOTES %q: %w", votes, err)
+		}
+		config.SuggestVotes = n
+	}
+	if enrichers := os.Getenv("ENRICHERS"); enrichers != "" {
+		config.Enrichers = splitList(enrichers)
+	}
+	if dir := os.Getenv("PLUGIN_DIR"); dir != "" {
+		config.PluginDir = dir
+	}
+	if threshold := os.Getenv("RADAR_SCORE_THRESHOLD"); threshold != "" {
+		n, err := strconv.ParseInt(threshold, 10, 64)
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid RADAR_SCORE_THRESHOLD %q: %w", threshold, err)
+		}
+		config.RadarScoreThreshold = n
+	}
+	if milestones := os.Getenv("COMMENT_MILESTONES"); milestones != "" {
+		config.CommentMilestones = nil
+		for _, item := range splitList(milestones) {
+			n, err := strconv.ParseInt(item, 10, 64)
+			if err != nil {
+				return Config{}, fmt.Errorf("invalid COMMENT_MILESTONES %q: %w", milestones, err)
+			}
+			config.CommentMilestones = append(config.CommentMilestones, n)
+		}
+	}
+	if err := config.Backup.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := config.Network.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := config.Summary.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := config.DigestEmail.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := config.Card.applyEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := config.Moderation.applyEnv(); err != nil {
+		return Config{}, err
+	}
+
+	storageKey, err := loadStorageKey()
+	if err != nil {
+		return Config{}, err
+	}
+	config.StorageKey = storageKey
+
+	if config.DataPath == "" {
+		config.DataPath = storage.DefaultFile(config.StorageBackend)
+	}
+	if config.DualWrite != "" && config.DualWrite != storage.BackendRedis && config.DualWritePath == "" {
+		config.DualWritePath = storage.DefaultFile(config.DualWrite)
+	}
+
+	// Relative paths live inside the state directory when one is set
+	config.DataPath = config.resolveStatePath(config.DataPath)
+	if config.DualWritePath != "" {
+		config.DualWritePath = config.resolveStatePath(config.DualWritePath)
+	}
+	if config.CassetteMode != "" {
+		if config.CassettePath == "" {
+			config.CassettePath = DefaultCassetteFile
+		}
+		config.CassettePath = config.resolveStatePath(config.CassettePath)
+	}
+	if config.AuditPath == "" {
+		config.AuditPath = DefaultAuditFile
+	}
+	config.AuditPath = config.resolveStatePath(config.AuditPath)
+	return config, nil
+}
+
+// loadStorageKey reads the storage key from STORAGE_KEY or the file named by
+// STORAGE_KEY_FILE. The key is 32 random bytes, base64 encoded.
+func loadStorageKey() (string, error) {
+	return secretEnv("STORAGE_KEY")
+}
+
+// secretEnv returns the environment variable name or, when it is unset, the
+// contents of the file named by name_FILE, such as a mounted Docker or
+// Kubernetes secret, without surrounding whitespace. This keeps secrets out
+// of the environment, where ps and orchestration manifests show them.
+func secretEnv(name string) (string, error) {
+	if value := os.Getenv(name); value != "" {
+		return value, nil
+	}
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s_FILE: %w", name, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// storageOptions describes the configured storage.
+func (c *Config) storageOptions() storage.Options {
+	return storage.Options{
+		Backend:       c.StorageBackend,
+		Path:          c.backendPath(c.StorageBackend),
+		DualWrite:     c.DualWrite,
+		DualWritePath: c.backendPath(c.DualWrite),
+		Key:           c.StorageKey,
+		Backups:       c.LocalBackups,
+	}
+}
+
+func (c *Config) resolveStatePath(path string) string {
+	if c.StateDir != "" && !filepath.IsAbs(path) {
+		return filepath.Join(c.StateDir, path)
+	}
+	return path
+}
+
+// decodeConfigFile decodes a config file into fc by its extension: YAML for
+// .yaml and .yml, TOML for .toml and JSON otherwise. Unknown keys are an
+// error in every format.
+func decodeConfigFile(path string, data []byte, fc *FileConfig) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(fc); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	case ".toml":
+		meta, err := toml.Decode(string(data), fc)
+		if err != nil {
+			return err
+		}
+		for _, key := range meta.Undecoded() {
+			// The keys of a plugin's config are checked against its schema
+			if len(key) > 2 && key[0] == "plugins" {
+				continue
+			}
+			return fmt.Errorf("unknown key %s", key)
+		}
+		return nil
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		return decoder.Decode(fc)
+	}
+}
+
+func (c *Config) applyFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+
+	var fc FileConfig
+	if err := decodeConfigFile(path, data, &fc); err != nil {
+		return fmt.Errorf("failed to decode config file %s: %w", path, err)
+	}
+
+	if fc.BotKey != "" {
+		c.BotKey = fc.BotKey
+	}
+	if fc.ChatID != "" {
+		c.ChatID = fc.ChatID
+	}
+	if fc.AdminChatID != "" {
+		c.AdminChatID = fc.AdminChatID
+	}
+	if fc.StateDir != "" {
+		c.StateDir = fc.StateDir
+	}
+	if fc.DataPath != "" {
+		c.DataPath = fc.DataPath
+	}
+	if fc.StorageBackend != "" {
+		c.StorageBackend = fc.StorageBackend
+	}
+	if fc.RedisURL != "" {
+		c.RedisURL = fc.RedisURL
+	}
+	if fc.DualWrite != "" {
+		c.DualWrite = fc.DualWrite
+	}
+	if fc.DualWritePath != "" {
+		c.DualWritePath = fc.DualWritePath
+	}
+	if fc.LocalBackups != nil {
+		c.LocalBackups = *fc.LocalBackups
+	}
+	if fc.FailoverLease != nil {
+		c.FailoverLease = *fc.FailoverLease
+	}
+	if fc.ReplicaID != "" {
+		c.ReplicaID = fc.ReplicaID
+	}
+	if fc.ScoreThreshold != nil {
+		c.ScoreThreshold = *fc.ScoreThreshold
+	}
+	if fc.CommentsThreshold != nil {
+		c.CommentsThreshold = *fc.CommentsThreshold
+	}
+	if fc.HotScore != nil {
+		c.HotScore = *fc.HotScore
+	}
+	if fc.HotComments != nil {
+		c.HotComments = *fc.HotComments
+	}
+	if fc.ChatHot != nil {
+		c.ChatHot = fc.ChatHot
+	}
+	if fc.ThresholdSchedule != nil {
+		c.ThresholdSchedule = fc.ThresholdSchedule
+	}
+	if fc.DiscussionRatio != nil {
+		c.DiscussionRatio = *fc.DiscussionRatio
+	}
+	if fc.Routes != nil {
+		c.Routes = fc.Routes
+	}
+	if fc.URLRewrites != nil {
+		c.URLRewrites = fc.URLRewrites
+	}
+	if fc.ReaderMirrors != nil {
+		c.ReaderMirrors = fc.ReaderMirrors
+	}
+	if fc.Shadow != nil {
+		c.Shadow = fc.Shadow
+	}
+	if fc.Experiment != nil {
+		c.Experiment = fc.Experiment
+	}
+	if fc.Language != "" {
+		c.Language = fc.Language
+	}
+	if fc.ChatLanguages != nil {
+		c.ChatLanguages = fc.ChatLanguages
+	}
+	if fc.Footer != nil {
+		c.Footer = *fc.Footer
+	}
+	if fc.ChatFooters != nil {
+		c.ChatFooters = fc.ChatFooters
+	}
+	if fc.MessageFormat != "" {
+		c.MessageFormat = fc.MessageFormat
+	}
+	if fc.UserAgent != "" {
+		c.UserAgent = fc.UserAgent
+	}
+	if fc.HNRequestInterval != nil {
+		c.HNRequestInterval = *fc.HNRequestInterval
+	}
+	if fc.RequestBudgets != nil {
+		c.RequestBudgets = fc.RequestBudgets
+	}
+	if fc.DegradeErrorRate != nil {
+		c.DegradeErrorRate = *fc.DegradeErrorRate
+	}
+	if fc.CacheSize != nil {
+		c.CacheSize = *fc.CacheSize
+	}
+	if fc.APIAddr != "" {
+		c.APIAddr = fc.APIAddr
+	}
+	if fc.TelegramAPIURL != "" {
+		c.TelegramAPIURL = fc.TelegramAPIURL
+	}
+	if fc.APIToken != "" {
+		c.APIToken = fc.APIToken
+	}
+	if fc.WebhookURLs != nil {
+		c.WebhookURLs = fc.WebhookURLs
+	}
+	if fc.WebhookSecret != "" {
+		c.WebhookSecret = fc.WebhookSecret
+	}
+	if fc.EventBus != "" {
+		c.EventBus = fc.EventBus
+	}
+	if fc.EventBusURL != "" {
+		c.EventBusURL = fc.EventBusURL
+	}
+	if fc.EventBusTopic != "" {
+		c.EventBusTopic = fc.EventBusTopic
+	}
+	if fc.Timezone != "" {
+		c.Timezone = fc.Timezone
+	}
+	if fc.OnThisDaySchedule != nil {
+		c.OnThisDaySchedule = *fc.OnThisDaySchedule
+	}
+	if fc.ScoreboardSchedule != nil {
+		c.ScoreboardSchedule = *fc.ScoreboardSchedule
+	}
+	if fc.GrowthSchedule != nil {
+		c.GrowthSchedule = *fc.GrowthSchedule
+	}
+	if fc.HeartbeatSchedule != nil {
+		c.HeartbeatSchedule = *fc.HeartbeatSchedule
+	}
+	if fc.PostingWindow != nil {
+		c.PostingWindow = *fc.PostingWindow
+	}
+	if fc.MaintenanceWindows != nil {
+		c.MaintenanceWindows = fc.MaintenanceWindows
+	}
+	if fc.PostGap != nil {
+		c.PostGap = *fc.PostGap
+	}
+	if fc.TopPerHour != nil {
+		c.TopPerHour = *fc.TopPerHour
+	}
+	if fc.CleanupSchedule != nil {
+		c.CleanupSchedule = *fc.CleanupSchedule
+	}
+	if fc.PollInterval != nil {
+		c.PollInterval = *fc.PollInterval
+	}
+	if fc.CleanupInterval != nil {
+		c.CleanupInterval = *fc.CleanupInterval
+	}
+	if fc.BatchSize != nil {
+		c.BatchSize = *fc.BatchSize
+	}
+	if fc.CleanupAfterPolls != nil {
+		c.CleanupAfterPolls = *fc.CleanupAfterPolls
+	}
+	if fc.MaxTrackedStories != nil {
+		c.MaxTrackedStories = *fc.MaxTrackedStories
+	}
+	if fc.DormantRank != nil {
+		c.DormantRank = *fc.DormantRank
+	}
+	if fc.DormantAfterPolls != nil {
+		c.DormantAfterPolls = *fc.DormantAfterPolls
+	}
+	if fc.RepostDays != nil {
+		c.RepostDays = *fc.RepostDays
+	}
+	if fc.DuplicateTitles != "" {
+		c.DuplicateTitles = fc.DuplicateTitles
+	}
+	if fc.DuplicateSimilarity != nil {
+		c.DuplicateSimilarity = *fc.DuplicateSimilarity
+	}
+	if fc.StoryGroups != "" {
+		c.StoryGroups = fc.StoryGroups
+	}
+	if fc.CassetteMode != "" {
+		c.CassetteMode = fc.CassetteMode
+	}
+	if fc.CassettePath != "" {
+		c.CassettePath = fc.CassettePath
+	}
+	if fc.AuditLog != nil {
+		c.AuditLog = *fc.AuditLog
+	}
+	if fc.AuditPath != "" {
+		c.AuditPath = fc.AuditPath
+	}
+	if fc.EnableCommands != nil {
+		c.EnableCommands = *fc.EnableCommands
+	}
+	if fc.BestCommentButton != nil {
+		c.BestCommentButton = *fc.BestCommentButton
+	}
+	if fc.OnThisDay != nil {
+		c.OnThisDay = *fc.OnThisDay
+	}
+	if fc.Scoreboard != nil {
+		c.Scoreboard = *fc.Scoreboard
+	}
+	if fc.GrowthReport != nil {
+		c.GrowthReport = *fc.GrowthReport
+	}
+	if fc.RadarChatID != "" {
+		c.RadarChatID = fc.RadarChatID
+	}
+	if fc.RadarKeywords != nil {
+		c.RadarKeywords = fc.RadarKeywords
+	}
+	if fc.SuggestChatID != "" {
+		c.SuggestChatID = fc.SuggestChatID
+	}
+	if fc.SuggestVotes != nil {
+		c.SuggestVotes = *fc.SuggestVotes
+	}
+	if fc.Enrichers != nil {
+		c.Enrichers = fc.Enrichers
+	}
+	if fc.PluginDir != "" {
+		c.PluginDir = fc.PluginDir
+	}
+	if fc.Plugins != nil {
+		c.Plugins = make(map[string]json.RawMessage, len(fc.Plugins))
+		for name, config := range fc.Plugins {
+			c.Plugins[name] = json.RawMessage(config)
+		}
+	}
+	if fc.CommentMilestones != nil {
+		c.CommentMilestones = fc.CommentMilestones
+	}
+	if fc.RadarScoreThreshold != nil {
+		c.RadarScoreThreshold = *fc.RadarScoreThreshold
+	}
+	if fc.Backup != nil {
+		c.Backup.merge(*fc.Backup)
+	}
+	if fc.Moderation != nil {
+		c.Moderation.merge(*fc.Moderation)
+	}
+	if fc.Network != nil {
+		c.Network.merge(*fc.Network)
+	}
+	if fc.Summary != nil {
+		c.Summary.merge(*fc.Summary)
+	}
+	if fc.DigestEmail != nil {
+		c.DigestEmail.merge(*fc.DigestEmail)
+	}
+	if fc.Card != nil {
+		c.Card.merge(*fc.Card)
+	}
+	if err := c.addChats(fc.Chats); err != nil {
+		return err
+	}
+	return c.addFeeds(fc.Feeds)
+}
+
+func (c *Config) validate() error {
+	if c.BotKey == "" {
+		return fmt.Errorf("BOT_KEY environment variable (or BOT_KEY_FILE, or bot_key in the config file) is required")
+	}
+	if err := c.normalizeChats(); err != nil {
+		return err
+	}
+	if c.ScoreThreshold < 0 {
+		return fmt.Errorf("score_threshold must not be negative, got %d", c.ScoreThreshold)
+	}
+	if c.CommentsThreshold < 0 {
+		return fmt.Errorf("comments_threshold must not be negative, got %d", c.CommentsThreshold)
+	}
+	if c.HotScore < 0 || c.HotComments < 0 {
+		return fmt.Errorf("hot thresholds must not be negative, use 0 to disable the mark")
+	}
+	for chatID, hot := range c.ChatHot {
+		if (hot.Score != nil && *hot.Score < 0) || (hot.Comments != nil && *hot.Comments < 0) {
+			return fmt.Errorf("hot thresholds for chat %s must not be negative, use 0 to disable the mark", chatID)
+		}
+	}
+	if c.DiscussionRatio < 0 {
+		return fmt.Errorf("discussion_ratio must not be negative, got %g", c.DiscussionRatio)
+	}
+	if c.TelegramAPIURL != "" {
+		if u, err := url.Parse(c.TelegramAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid TELEGRAM_API_URL %q: expected an http(s) URL", c.TelegramAPIURL)
+		}
+	}
+	switch c.CassetteMode {
+	case "", cassette.ModeRecord, cassette.ModeReplay:
+	default:
+		return fmt.Errorf("invalid CASSETTE_MODE %q (expected %s or %s)", c.CassetteMode, cassette.ModeRecord, cassette.ModeReplay)
+	}
+	if err := validateWebhookURLs(c.WebhookURLs); err != nil {
+		return err
+	}
+	if err := validateEventBus(c.EventBus, c.EventBusURL); err != nil {
+		return err
+	}
+	if c.EventBus != "" && c.EventBusTopic == "" {
+		return fmt.Errorf("event_bus_topic must not be empty")
+	}
+	if c.APIAddr != "" && c.APIToken == "" {
+		return fmt.Errorf("API_TOKEN (or api_token in the config file) is required when the HTTP API is enabled")
+	}
+	if err := c.validateSchedules(); err != nil {
+		return err
+	}
+	if c.UserAgent == "" {
+		return fmt.Errorf("user_agent must not be empty")
+	}
+	if c.HNRequestInterval < 0 {
+		return fmt.Errorf("hn_request_interval must not be negative, got %v", time.Duration(c.HNRequestInterval))
+	}
+	if err := validateBudgets(c.RequestBudgets); err != nil {
+		return err
+	}
+	if c.DegradeErrorRate < 0 || c.DegradeErrorRate > 1 {
+		return fmt.Errorf("degrade_error_rate must be between 0 and 1, got %g", c.DegradeErrorRate)
+	}
+	if c.CacheSize <= 0 {
+		return fmt.Errorf("cache_size must be positive, got %d", c.CacheSize)
+	}
+	if c.MessageFormat != FormatHTML && c.MessageFormat != FormatEntities {
+		return fmt.Errorf("message_format must be %q or %q, got %q", FormatHTML, FormatEntities, c.MessageFormat)
+	}
+	if err := validLanguage(c.Language); err != nil {
+		return err
+	}
+	for chatID, lang := range c.ChatLanguages {
+		if err := validLanguage(lang); err != nil {
+			return fmt.Errorf("chat %s: %w", chatID, err)
+		}
+	}
+	for i := range c.Routes {
+		if err := c.Routes[i].Compile(); err != nil {
+			return err
+		}
+	}
+	for i := range c.URLRewrites {
+		if err := c.URLRewrites[i].compile(); err != nil {
+			return err
+		}
+	}
+	if err := validateReaderMirrors(c.ReaderMirrors); err != nil {
+		return err
+	}
+	if c.Shadow != nil {
+		if err := c.Shadow.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Experiment != nil {
+		if err := c.Experiment.validate(); err != nil {
+			return err
+		}
+	}
+	if time.Duration(c.PollInterval) < MinPollInterval {
+		return fmt.Errorf("poll_interval must be at least %v, got %v", MinPollInterval, time.Duration(c.PollInterval))
+	}
+	if time.Duration(c.CleanupInterval) < MinCleanupInterval {
+		return fmt.Errorf("cleanup_interval must be at least %v, got %v", MinCleanupInterval, time.Duration(c.CleanupInterval))
+	}
+	if c.BatchSize < 1 || c.BatchSize > MaxBatchSize {
+		return fmt.Errorf("batch_size must be between 1 and %d, got %d", MaxBatchSize, c.BatchSize)
+	}
+	if c.CleanupAfterPolls < 0 {
+		return fmt.Errorf("cleanup_after_polls must not be negative, got %d", c.CleanupAfterPolls)
+	}
+	if c.MaxTrackedStories < 0 {
+		return fmt.Errorf("max_tracked_stories must not be negative, got %d", c.MaxTrackedStories)
+	}
+	if c.DormantRank < 0 {
+		return fmt.Errorf("dormant_rank must not be negative, got %d", c.DormantRank)
+	}
+	if c.DormantAfterPolls < 1 {
+		return fmt.Errorf("dormant_after_polls must be at least 1, got %d", c.DormantAfterPolls)
+	}
+	if c.PostGap < 0 {
+		return fmt.Errorf("post_gap must not be negative, got %v", time.Duration(c.PostGap))
+	}
+	if c.TopPerHour < 0 {
+		return fmt.Errorf("top_per_hour must not be negative, got %d", c.TopPerHour)
+	}
+	if c.RepostDays < 0 {
+		return fmt.Errorf("repost_days must not be negative, got %d", c.RepostDays)
+	}
+	if c.DuplicateTitles != "" && c.DuplicateTitles != DuplicateSkip && c.DuplicateTitles != DuplicateReply {
+		return fmt.Errorf("duplicate_titles must be %q or %q, got %q", DuplicateSkip, DuplicateReply, c.DuplicateTitles)
+	}
+	if c.DuplicateSimilarity <= 0 || c.DuplicateSimilarity > 1 {
+		return fmt.Errorf("duplicate_similarity must be above 0 and at most 1, got %g", c.DuplicateSimilarity)
+	}
+	if c.StoryGroups != "" && c.StoryGroups != GroupReply && c.StoryGroups != GroupCombine {
+		return fmt.Errorf("story_groups must be %q or %q, got %q", GroupReply, GroupCombine, c.StoryGroups)
+	}
+	for _, milestone := range c.CommentMilestones {
+		if milestone <= 0 {
+			return fmt.Errorf("comment_milestones must be positive, got %d", milestone)
+		}
+	}
+	slices.Sort(c.CommentMilestones)
+	if err := c.loadPlugins(); err != nil {
+		return err
+	}
+	if err := c.validateEnrichers(); err != nil {
+		return err
+	}
+	if err := c.Summary.validate(c.Enrichers); err != nil {
+		return err
+	}
+	card, err := c.Card.renderer()
+	if err != nil {
+		return err
+	}
+	c.card = card
+	if c.RadarChatID != "" && len(c.RadarKeywords) == 0 {
+		return fmt.Errorf("radar_chat_id is set but radar_keywords is empty")
+	}
+	if c.SuggestChatID != "" && !c.EnableCommands {
+		return fmt.Errorf("suggest_chat_id is set but enable_commands is off")
+	}
+	if c.SuggestVotes < 0 {
+		return fmt.Errorf("suggest_votes must not be negative, got %d", c.SuggestVotes)
+	}
+	if c.RadarScoreThreshold < 0 {
+		return fmt.Errorf("radar_score_threshold must not be negative, got %d", c.RadarScoreThreshold)
+	}
+	if err := c.Network.validate(); err != nil {
+		return err
+	}
+	if err := c.Moderation.validate(c.AdminChatID); err != nil {
+		return err
+	}
+	if c.GrowthReport && c.AdminChatID == "" {
+		return fmt.Errorf("growth_report requires admin_chat_id")
+	}
+	if err := c.Backup.validate(); err != nil {
+		return err
+	}
+	if err := c.DigestEmail.validate(); err != nil {
+		return err
+	}
+	if err := c.validateStorage(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *Config) validateStorage() error {
+	for _, kind := range []string{c.StorageBackend, c.DualWrite} {
+		switch kind {
+		case "", storage.BackendJSON, storage.BackendSQLite:
+		case storage.BackendRedis:
+			if c.RedisURL == "" {
+				return fmt.Errorf("the %s storage backend requires redis_url", storage.BackendRedis)
+			}
+			if err := storage.ValidateRedisURL(c.RedisURL); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown storage backend %q (expected %s, %s or %s)", kind, storage.BackendJSON, storage.BackendSQLite, storage.BackendRedis)
+		}
+	}
+	if c.DualWrite == c.StorageBackend {
+		return fmt.Errorf("storage_dual_write must name a different backend than storage_backend")
+	}
+	if c.DualWrite != "" && c.DualWrite != storage.BackendRedis && c.DualWritePath == c.DataPath {
+		return fmt.Errorf("storage_dual_write_path must differ from data_path")
+	}
+	if c.LocalBackups < 0 {
+		return fmt.Errorf("local_backups must not be negative, got %d", c.LocalBackups)
+	}
+	if lease := time.Duration(c.FailoverLease); lease != 0 {
+		if lease < MinFailoverLease {
+			return fmt.Errorf("failover_lease must be 0 or at least %v, got %v", MinFailoverLease, lease)
+		}
+		if c.StorageBackend != storage.BackendSQLite && c.StorageBackend != storage.BackendRedis {
+			return fmt.Errorf("failover_lease needs the %s or %s storage backend shared by the replicas", storage.BackendSQLite, storage.BackendRedis)
+		}
+		if c.ReplicaID == "" {
+			return fmt.Errorf("replica_id is required with failover_lease")
+		}
+	}
+
+	if c.StorageKey != "" {
+		for _, kind := range []string{c.StorageBackend, c.DualWrite} {
+			if kind == storage.BackendSQLite {
+				return fmt.Errorf("storage encryption is only supported by the %s and %s backends", storage.BackendJSON, storage.BackendRedis)
+			}
+		}
+		if _, err := storage.NewCipher(c.StorageKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stateDir returns the directory all mutable files are written to: STATE_DIR
+// when set, otherwise the directory of the data file.
+func (c *Config) stateDir() string {
+	if c.StateDir != "" {
+		return c.StateDir
+	}
+	return filepath.Dir(c.DataPath)
+}
+
+// statePath returns the path of a file kept in the state directory.
+func (c *Config) statePath(name string) string {
+	return filepath.Join(c.stateDir(), name)
+}
+
+// CheckStateDir makes sure the state directory exists and is writable, which
+// is the only requirement on a read-only root filesystem.
+func (c *Config) CheckStateDir() error {
+	dir := c.stateDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("cannot create state directory %s: %w", dir, err)
+	}
+
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("state directory %s is not writable, mount a writable volume there or set STATE_DIR: %w", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// validateSchedules loads the time zone and checks every cron expression,
+// compiling the threshold windows, the posting window and the maintenance
+// windows.
+func (c *Config) validateSchedules() error {
+	loc, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %w", c.Timezone, err)
+	}
+	c.loc = loc
+
+	for name, expr := range map[string]string{
+		"on_this_day_schedule":  c.OnThisDaySchedule,
+		"scoreboard_schedule":   c.ScoreboardSchedule,
+		"growth_schedule":       c.GrowthSchedule,
+		"heartbeat_schedule":    c.HeartbeatSchedule,
+		"digest_email.schedule": c.DigestEmail.Schedule,
+		"cleanup_schedule":      c.CleanupSchedule,
+	} {
+		if expr == "" {
+			continue
+		}
+		if _, err := ParseSchedule(expr, loc); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	c.postingWindow = nil
+	if c.PostingWindow != "" {
+		if c.postingWindow, err = ParsePostingWindow(c.PostingWindow); err != nil {
+			return err
+		}
+	}
+	c.maintenance = nil
+	for _, window := range c.MaintenanceWindows {
+		parsed, err := ParseMaintenanceWindow(window, loc)
+		if err != nil {
+			return err
+		}
+		c.maintenance = append(c.maintenance, parsed)
+	}
+
+	if err := compileWindows(c.ThresholdSchedule, loc); err != nil {
+		return fmt.Errorf("threshold_schedule: %w", err)
+	}
+	if c.Shadow != nil {
+		if err := compileWindows(c.Shadow.ThresholdSchedule, loc); err != nil {
+			return fmt.Errorf("shadow threshold_schedule: %w", err)
+		}
+	}
+	return nil
+}
+
+func compileWindows(windows []ThresholdWindow, loc *time.Location) error {
+	for i := range windows {
+		window := &windows[i]
+		schedule, err := ParseSchedule(window.When, loc)
+		if err != nil {
+			return err
+		}
+		if (window.ScoreThreshold != nil && *window.ScoreThreshold < 0) || (window.CommentsThreshold != nil && *window.CommentsThreshold < 0) {
+			return fmt.Errorf("thresholds for %q must not be negative", window.When)
+		}
+		window.schedule = schedule
+	}
+	return nil
+}
+
+// location is the time zone schedules are evaluated in.
+func (c *Config) location() *time.Location {
+	if c.loc == nil {
+		return time.UTC
+	}
+	return c.loc
+}
+
+// diffConfig describes every field that differs between two configs.
+func diffConfig(old, new Config) []string {
+	var changes []string
+	add := func(name string, from, to any) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s: %v -> %v", name, from, to))
+		}
+	}
+
+	if old.BotKey != new.BotKey {
+		changes = append(changes, "bot_key: <redacted> -> <redacted>")
+	}
+	add("chat_id", old.ChatID, new.ChatID)
+	add("admin_chat_id", old.AdminChatID, new.AdminChatID)
+	add("state_dir", old.StateDir, new.StateDir)
+	add("data_path", old.DataPath, new.DataPath)
+	add("storage_backend", old.StorageBackend, new.StorageBackend)
+	add("storage_dual_write", old.DualWrite, new.DualWrite)
+	add("storage_dual_write_path", old.DualWritePath, new.DualWritePath)
+	add("redis_url", redactURL(old.RedisURL), redactURL(new.RedisURL))
+	add("local_backups", old.LocalBackups, new.LocalBackups)
+	add("failover_lease", time.Duration(old.FailoverLease), time.Duration(new.FailoverLease))
+	add("replica_id", old.ReplicaID, new.ReplicaID)
+	if old.StorageKey != new.StorageKey {
+		changes = append(changes, "storage_key: <redacted> -> <redacted>")
+	}
+	add("score_threshold", old.ScoreThreshold, new.ScoreThreshold)
+	add("comments_threshold", old.CommentsThreshold, new.CommentsThreshold)
+	add("hot_score_threshold", old.HotScore, new.HotScore)
+	add("hot_comments_threshold", old.HotComments, new.HotComments)
+	add("chat_hot_thresholds", fmt.Sprint(old.ChatHot), fmt.Sprint(new.ChatHot))
+	add("threshold_schedule", fmt.Sprint(old.ThresholdSchedule), fmt.Sprint(new.ThresholdSchedule))
+	add("discussion_ratio", old.DiscussionRatio, new.DiscussionRatio)
+	add("routes", fmt.Sprint(old.Routes), fmt.Sprint(new.Routes))
+	add("feeds", fmt.Sprint(old.Feeds), fmt.Sprint(new.Feeds))
+	add("url_rewrites", fmt.Sprint(old.URLRewrites), fmt.Sprint(new.URLRewrites))
+	add("reader_mirrors", fmt.Sprint(old.ReaderMirrors), fmt.Sprint(new.ReaderMirrors))
+	add("shadow", old.Shadow.String(), new.Shadow.String())
+	add("experiment", old.Experiment.String(), new.Experiment.String())
+	add("language", old.Language, new.Language)
+	add("timezone", old.Timezone, new.Timezone)
+	add("api_addr", old.APIAddr, new.APIAddr)
+	add("telegram_api_url", old.TelegramAPIURL, new.TelegramAPIURL)
+	if old.APIToken != new.APIToken {
+		changes = append(changes, "api_token: <redacted> -> <redacted>")
+	}
+	add("webhook_urls", strings.Join(old.WebhookURLs, ","), strings.Join(new.WebhookURLs, ","))
+	if old.WebhookSecret != new.WebhookSecret {
+		changes = append(changes, "webhook_secret: <redacted> -> <redacted>")
+	}
+	add("event_bus", old.EventBus, new.EventBus)
+	add("event_bus_url", redactURL(old.EventBusURL), redactURL(new.EventBusURL))
+	add("event_bus_topic", old.EventBusTopic, new.EventBusTopic)
+	add("on_this_day_schedule", old.OnThisDaySchedule, new.OnThisDaySchedule)
+	add("scoreboard_schedule", old.ScoreboardSchedule, new.ScoreboardSchedule)
+	add("growth_schedule", old.GrowthSchedule, new.GrowthSchedule)
+	add("heartbeat_schedule", old.HeartbeatSchedule, new.HeartbeatSchedule)
+	add("posting_window", old.PostingWindow, new.PostingWindow)
+	add("maintenance_windows", strings.Join(old.MaintenanceWindows, ","), strings.Join(new.MaintenanceWindows, ","))
+	add("post_gap", time.Duration(old.PostGap), time.Duration(new.PostGap))
+	add("top_per_hour", old.TopPerHour, new.TopPerHour)
+	add("cleanup_schedule", old.CleanupSchedule, new.CleanupSchedule)
+	add("chat_languages", fmt.Sprint(old.ChatLanguages), fmt.Sprint(new.ChatLanguages))
+	add("footer", old.Footer, new.Footer)
+	add("message_format", old.MessageFormat, new.MessageFormat)
+	add("user_agent", old.UserAgent, new.UserAgent)
+	add("hn_request_interval", time.Duration(old.HNRequestInterval), time.Duration(new.HNRequestInterval))
+	add("request_budgets", fmt.Sprint(old.RequestBudgets), fmt.Sprint(new.RequestBudgets))
+	add("degrade_error_rate", old.DegradeErrorRate, new.DegradeErrorRate)
+	add("cache_size", old.CacheSize, new.CacheSize)
+	add("chat_footers", fmt.Sprint(old.ChatFooters), fmt.Sprint(new.ChatFooters))
+	add("poll_interval", time.Duration(old.PollInterval), time.Duration(new.PollInterval))
+	add("cleanup_interval", time.Duration(old.CleanupInterval), time.Duration(new.CleanupInterval))
+	add("batch_size", old.BatchSize, new.BatchSize)
+	add("cleanup_after_polls", old.CleanupAfterPolls, new.CleanupAfterPolls)
+	add("max_tracked_stories", old.MaxTrackedStories, new.MaxTrackedStories)
+	add("dormant_rank", old.DormantRank, new.DormantRank)
+	add("dormant_after_polls", old.DormantAfterPolls, new.DormantAfterPolls)
+	add("repost_days", old.RepostDays, new.RepostDays)
+	add("duplicate_titles", old.DuplicateTitles, new.DuplicateTitles)
+	add("duplicate_similarity", old.DuplicateSimilarity, new.DuplicateSimilarity)
+	add("story_groups", old.StoryGroups, new.StoryGroups)
+	add("enable_commands", old.EnableCommands, new.EnableCommands)
+	add("moderation", old.Moderation.String(), new.Moderation.String())
+	add("network", old.Network.String(), new.Network.String())
+	add("best_comment_button", old.BestCommentButton, new.BestCommentButton)
+	add("cassette_mode", old.CassetteMode, new.CassetteMode)
+	add("cassette_path", old.CassettePath, new.CassettePath)
+	add("audit_log", old.AuditLog, new.AuditLog)
+	add("audit_path", old.AuditPath, new.AuditPath)
+	add("on_this_day", old.OnThisDay, new.OnThisDay)
+	add("scoreboard", old.Scoreboard, new.Scoreboard)
+	add("growth_report", old.GrowthReport, new.GrowthReport)
+	add("radar_chat_id", old.RadarChatID, new.RadarChatID)
+	add("radar_keywords", strings.Join(old.RadarKeywords, ","), strings.Join(new.RadarKeywords, ","))
+	add("suggest_chat_id", old.SuggestChatID, new.SuggestChatID)
+	add("suggest_votes", old.SuggestVotes, new.SuggestVotes)
+	add("enrichers", strings.Join(old.Enrichers, ","), strings.Join(new.Enrichers, ","))
+	add("plugin_dir", old.PluginDir, new.PluginDir)
+	if !maps.EqualFunc(old.Plugins, new.Plugins, func(a, b json.RawMessage) bool { return bytes.Equal(a, b) }) {
+		changes = append(changes, "plugins: <redacted> -> <redacted>")
+	}
+	add("summary", old.Summary.String(), new.Summary.String())
+	add("digest_email", old.DigestEmail.String(), new.DigestEmail.String())
+	add("card", old.Card.String(), new.Card.String())
+	add("comment_milestones", fmt.Sprint(old.CommentMilestones), fmt.Sprint(new.CommentMilestones))
+	add("radar_score_threshold", old.RadarScoreThreshold, new.RadarScoreThreshold)
+	return changes
+}
+
+// mergeReloadable returns current with only the fields that are safe to
+// change at runtime taken from next. Fields that require a restart are kept
+// and reported.
+func mergeReloadable(current, next Config) (Config, []string) {
+	var ignored []string
+	if current.BotKey != next.BotKey {
+		ignored = append(ignored, "bot_key")
+	}
+	if current.ChatID != next.ChatID {
+		ignored = append(ignored, "chat_id")
+	}
+	if current.StateDir != next.StateDir {
+		ignored = append(ignored, "state_dir")
+	}
+	if current.DataPath != next.DataPath {
+		ignored = append(ignored, "data_path")
+	}
+	if current.StorageBackend != next.StorageBackend || current.DualWrite != next.DualWrite || current.DualWritePath != next.DualWritePath || current.RedisURL != next.RedisURL {
+		ignored = append(ignored, "storage_backend")
+	}
+	if current.LocalBackups != next.LocalBackups {
+		ignored = append(ignored, "local_backups")
+	}
+	if current.FailoverLease != next.FailoverLease || current.ReplicaID != next.ReplicaID {
+		ignored = append(ignored, "failover_lease")
+	}
+	if current.Backup != next.Backup {
+		ignored = append(ignored, "backup")
+	}
+	if current.APIAddr != next.APIAddr {
+		ignored = append(ignored, "api_addr")
+	}
+	if current.EventBus != next.EventBus || current.EventBusURL != next.EventBusURL || current.EventBusTopic != next.EventBusTopic {
+		ignored = append(ignored, "event_bus")
+	}
+	if current.TelegramAPIURL != next.TelegramAPIURL {
+		ignored = append(ignored, "telegram_api_url")
+	}
+	if current.EnableCommands != next.EnableCommands {
+		ignored = append(ignored, "enable_commands")
+	}
+	if current.Moderation.enabled() != next.Moderation.enabled() {
+		ignored = append(ignored, "moderation.enabled")
+	}
+	if current.Network != next.Network {
+		ignored = append(ignored, "network")
+	}
+	if current.CacheSize != next.CacheSize {
+		ignored = append(ignored, "cache_size")
+	}
+	if current.CassetteMode != next.CassetteMode || current.CassettePath != next.CassettePath {
+		ignored = append(ignored, "cassette_mode")
+	}
+	if current.AuditLog != next.AuditLog || current.AuditPath != next.AuditPath {
+		ignored = append(ignored, "audit_log")
+	}
+	if current.StorageKey != next.StorageKey {
+		ignored = append(ignored, "storage_key")
+	}
+
+	merged := current
+	merged.AdminChatID = next.AdminChatID
+	merged.ScoreThreshold = next.ScoreThreshold
+	merged.CommentsThreshold = next.CommentsThreshold
+	merged.HotScore = next.HotScore
+	merged.HotComments = next.HotComments
+	merged.ChatHot = next.ChatHot
+	merged.ThresholdSchedule = next.ThresholdSchedule
+	merged.DiscussionRatio = next.DiscussionRatio
+	merged.Routes = next.Routes
+	merged.Feeds = next.Feeds
+	merged.URLRewrites = next.URLRewrites
+	merged.ReaderMirrors = next.ReaderMirrors
+	merged.Shadow = next.Shadow
+	merged.Experiment = next.Experiment
+	merged.Language = next.Language
+	merged.ChatLanguages = next.ChatLanguages
+	merged.Footer = next.Footer
+	merged.MessageFormat = next.MessageFormat
+	merged.UserAgent = next.UserAgent
+	merged.HNRequestInterval = next.HNRequestInterval
+	merged.RequestBudgets = next.RequestBudgets
+	merged.DegradeErrorRate = next.DegradeErrorRate
+	merged.ChatFooters = next.ChatFooters
+	merged.Timezone = next.Timezone
+	merged.APIToken = next.APIToken
+	merged.WebhookURLs = next.WebhookURLs
+	merged.WebhookSecret = next.WebhookSecret
+	merged.loc = next.loc
+	merged.OnThisDaySchedule = next.OnThisDaySchedule
+	merged.ScoreboardSchedule = next.ScoreboardSchedule
+	merged.GrowthSchedule = next.GrowthSchedule
+	merged.HeartbeatSchedule = next.HeartbeatSchedule
+	merged.PostingWindow = next.PostingWindow
+	merged.MaintenanceWindows = next.MaintenanceWindows
+	merged.postingWindow = next.postingWindow
+	merged.maintenance = next.maintenance
+	merged.PostGap = next.PostGap
+	merged.TopPerHour = next.TopPerHour
+	merged.CleanupSchedule = next.CleanupSchedule
+	merged.PollInterval = next.PollInterval
+	merged.CleanupInterval = next.CleanupInterval
+	merged.BatchSize = next.BatchSize
+	merged.CleanupAfterPolls = next.CleanupAfterPolls
+	merged.MaxTrackedStories = next.MaxTrackedStories
+	merged.DormantRank = next.DormantRank
+	merged.DormantAfterPolls = next.DormantAfterPolls
+	merged.RepostDays = next.RepostDays
+	merged.DuplicateTitles = next.DuplicateTitles
+	merged.DuplicateSimilarity = next.DuplicateSimilarity
+	merged.StoryGroups = next.StoryGroups
+	merged.OnThisDay = next.OnThisDay
+	merged.Scoreboard = next.Scoreboard
+	merged.GrowthReport = next.GrowthReport
+	merged.BestCommentButton = next.BestCommentButton
+	merged.RadarChatID = next.RadarChatID
+	merged.RadarKeywords = next.RadarKeywords
+	merged.SuggestChatID = next.SuggestChatID
+	merged.SuggestVotes = next.SuggestVotes
+	merged.Enrichers = next.Enrichers
+	merged.PluginDir = next.PluginDir
+	merged.Plugins = next.Plugins
+	merged.plugins = next.plugins
+	merged.Summary = next.Summary
+	merged.DigestEmail = next.DigestEmail
+	merged.Card = next.Card
+	merged.card = next.card
+	merged.CommentMilestones = next.CommentMilestones
+	merged.RadarScoreThreshold = next.RadarScoreThreshold
+	merged.Moderation.Timeout = next.Moderation.Timeout
+	merged.Moderation.OnTimeout = next.Moderation.OnTimeout
+	return merged, ignored
+}
+
+type configHolder struct {
+	mutex  sync.RWMutex
+	config Config
+
+	// reloading serializes reloads from the watcher and SIGHUP.
+	reloading sync.Mutex
+}
+
+func (h *configHolder) get() Config {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return h.config
+}
+
+func (h *configHolder) set(config Config) {
+	h.mutex.Lock()
+	h.config = config
+	h.mutex.Unlock()
+}
+
+// ReloadConfig re-reads the config file and the environment and applies the
+// safe changes, like a change of the watched file. Stories being processed
+// finish with the config they started with. The binary calls it on SIGHUP.
+func (b *Bot) ReloadConfig() {
+	b.config.reloading.Lock()
+	defer b.config.reloading.Unlock()
+
+	next, err := LoadConfig()
+	if err != nil {
+		log.Printf("Config reload rejected, keeping current config: %v", err)
+		return
+	}
+
+	next.mapChats(b.resolvedChat)
+	current := b.cfg()
+	merged, ignored := mergeReloadable(current, next)
+	if len(ignored) > 0 {
+		log.Printf("Config reload: changes to %v require a restart and were not applied", ignored)
+	}
+
+	changes := diffConfig(current, merged)
+	if len(changes) == 0 {
+		log.Printf("Config reloaded, no applicable changes")
+		return
+	}
+
+	b.config.set(merged)
+	for _, change := range changes {
+		log.Printf("Config reloaded: %s", change)
+	}
+}
+
+// WatchConfig reloads the config file whenever it changes on disk. The parent
+// directory is watched so editors that save via rename are picked up too.
+func (b *Bot) WatchConfig() error {
+	path := b.cfg().ConfigPath
+	if path == "" {
+		return nil
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve config path: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(absPath)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch config directory: %w", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		var debounce *time.Timer
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != absPath || !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Rename) {
+					continue
+				}
+				if debounce != nil {
+					debounce.Stop()
+				}
+				debounce = time.AfterFunc(ConfigReloadDebounce, b.ReloadConfig)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("Config watcher error: %v", err)
+			}
+		}
+	}()
+
+	log.Printf("Watching config file %s for changes", absPath)
+	return nil
+}
+
+// splitList splits a comma-separated environment value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+// sampleFileConfig is what the sample config files below decode to.
+var sampleFileConfig = FileConfig{
+	ChatID:            "-100123",
+	ScoreThreshold:    ptr(int64(150)),
+	DiscussionRatio:   ptr(1.5),
+	EnableCommands:    ptr(true),
+	CommentMilestones: []int64{100, 500},
+	PollInterval:      ptr(Duration(90 * time.Second)),
+	Footer:            ptr("Tab\there, \"quoted\", é"),
+	Routes:            []filter.Route{{ChatID: "-100456", Match: "rust|go", ScoreThreshold: 50}},
+	ChatFooters:       map[string]string{"-100456": "it's"},
+	Backup:            &BackupConfig{Bucket: "hn", Interval: Duration(6 * time.Hour)},
+	Plugins:           map[string]PluginConfig{"tagger": PluginConfig(`{"tags":["a","b"]}`)},
+}
+
+func TestDecodeConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		data string
+		want *FileConfig // nil when decoding fails
+		err  string
+	}{
+		{
+			name: "json",
+			path: "config.json",
+			data: `{
+				"chat_id": "-100123",
+				"score_threshold": 150,
+				"discussion_ratio": 1.5,
+				"enable_commands": true,
+				"comment_milestones": [100, 500],
+				"poll_interval": "90s",
+				"footer": "Tab\there, \"quoted\", é",
+				"routes": [{"chat_id": "-100456", "match": "rust|go", "score_threshold": 50}],
+				"chat_footers": {"-100456": "it's"},
+				"backup": {"bucket": "hn", "interval": "6h"},
+				"plugins": {"tagger": {"tags":["a","b"]}}
+			}`,
+			want: &sampleFileConfig,
+		},
+		{
+			name: "yaml",
+			path: "config.yaml",
+			data: `# Production
+chat_id: "-100123"
+score_threshold: 150
+discussion_ratio: 1.5
+enable_commands: true
+comment_milestones: [100, 500]
+poll_interval: 90s
+footer: "Tab\there, \"quoted\", é"
+routes:
+  - chat_id: "-100456"
+    match: rust|go # a regexp
+    score_threshold: 50
+chat_footers:
+  "-100456": 'it''s'
+backup:
+  bucket: hn
+  interval: 6h
+plugins:
+  tagger:
+    tags: [a, b]
+`,
+			want: &sampleFileConfig,
+		},
+		{
+			name: "toml",
+			path: "config.toml",
+			data: `# Production
+chat_id = "-100123"
+score_threshold = 150
+discussion_ratio = 1.5
+enable_commands = true
+comment_milestones = [100, 500]
+poll_interval = "90s"
+footer = "Tab\there, \"quoted\", é"
+chat_footers = { "-100456" = "it's" }
+
+[[routes]]
+chat_id = "-100456"
+match = 'rust|go' # a regexp
+score_threshold = 50
+
+[backup]
+bucket = "hn"
+interval = "6h"
+
+[plugins.tagger]
+tags = ["a", "b"]
+`,
+			want: &sampleFileConfig,
+		},
+		{
+			name: "yaml block scalar and anchors",
+			path: "config.yml",
+			data: `message_format: |
+  <b>{{.Title}}</b>
+  {{.URL}}
+chat_languages: &languages
+  "-100123": de
+chat_footers: *languages
+`,
+			want: &FileConfig{
+				MessageFormat: "<b>{{.Title}}</b>\n{{.URL}}\n",
+				ChatLanguages: map[string]string{"-100123": "de"},
+				ChatFooters:   map[string]string{"-100123": "de"},
+			},
+		},
+		{name: "yaml number for a string", path: "config.yaml", data: "chat_id: -100123\n", want: &FileConfig{ChatID: "-100123"}},
+		{name: "toml integer for a float", path: "config.toml", data: "discussion_ratio = 2\n", want: &FileConfig{DiscussionRatio: ptr(2.0)}},
+		{name: "empty yaml", path: "config.yaml", data: "# nothing yet\n", want: &FileConfig{}},
+		{name: "empty toml", path: "config.toml", data: "", want: &FileConfig{}},
+		{name: "yaml unknown key", path: "config.yaml", data: "chat_id: \"1\"\nscore_treshold: 5\n", err: "score_treshold"},
+		{name: "yaml unknown nested key", path: "config.yaml", data: "backup:\n  bucket: hn\n  buckett: x\n", err: "buckett"},
+		{name: "toml unknown key", path: "config.toml", data: "score_treshold = 5\n", err: "score_treshold"},
+		{name: "toml unknown nested key", path: "config.toml", data: "[backup]\nbuckett = \"x\"\n", err: "backup.buckett"},
+		{name: "json unknown key", path: "config.json", data: `{"score_treshold": 5}`, err: "score_treshold"},
+		{name: "yaml duration without unit", path: "config.yaml", data: "poll_interval: 90\n", err: "duration must be a string"},
+		{name: "toml duration without unit", path: "config.toml", data: "poll_interval = 90\n", err: "missing unit"},
+		{name: "yaml wrong type", path: "config.yaml", data: "score_threshold: high\n", err: "cannot unmarshal"},
+		{name: "toml wrong type", path: "config.toml", data: "score_threshold = \"high\"\n", err: "score_threshold"},
+		{name: "toml syntax error", path: "config.toml", data: "chat_id = \n", err: "expected value"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got FileConfig
+			err := decodeConfigFile(tt.path, []byte(tt.data), &got)
+			if tt.want == nil {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("decodeConfigFile() error = %v, want one mentioning %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(normalizePlugins(t, got), normalizePlugins(t, *tt.want)) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("decodeConfigFile() =\n%s\nwant\n%s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+// normalizePlugins compacts the plugin configs, which keep the spacing of a
+// JSON file.
+func normalizePlugins(t *testing.T, fc FileConfig) FileConfig {
+	t.Helper()
+	if fc.Plugins == nil {
+		return fc
+	}
+	plugins := make(map[string]PluginConfig, len(fc.Plugins))
+	for name, config := range fc.Plugins {
+		var value any
+		if err := json.Unmarshal(config, &value); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(value)
+		plugins[name] = data
+	}
+	fc.Plugins = plugins
+	return fc
+}
@@ -0,0 +1,247 @@
+package bot
+
+import (
+	"errors"
+	"html"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// Degradation levels, stepped through one at a time while Telegram errors
+// spike. Each level keeps the restrictions of the ones below it.
+const (
+	DegradeNone = iota
+	// DegradeNoEdits stops editing messages. Posting goes on, and the
+	// messages are caught up once edits resume.
+	DegradeNoEdits
+	// DegradeNoEnrichment also stops enriching freshly posted stories.
+	DegradeNoEnrichment
+	// DegradeSlowPolling also polls only every BudgetSlowPolls intervals.
+	DegradeSlowPolling
+	// DegradePaused stops polling altogether.
+	DegradePaused
+)
+
+var degradeLevels = []string{"normal", "no_edits", "no_enrichment", "slow_polling", "paused"}
+
+const (
+	// DegradeWindow is how far back Telegram calls count towards the error
+	// rate.
+	DegradeWindow = 10 * time.Minute
+
+	// DegradeMinCalls is how many calls the window needs before a high error
+	// rate degrades the bot.
+	DegradeMinCalls = 10
+
+	// DegradeStep is how long the bot stays at a level before stepping
+	// further down or back up.
+	DegradeStep = 5 * time.Minute
+
+	// DegradeRecoverRate is the error rate under which the bot steps back up.
+	DegradeRecoverRate = 0.1
+)
+
+// degradation tracks the outcome of recent Telegram calls and the
+// degradation level they led to.
+type degradation struct {
+	mutex   sync.Mutex
+	calls   []degradeCall // oldest first
+	level   int
+	changed time.Time
+
+	// resumed is set when edits resume, until the next poll catches up the
+	// messages.
+	resumed bool
+}
+
+type degradeCall struct {
+	at     time.Time
+	failed bool
+}
+
+// DegradeStatus is the degradation state reported by /status and
+// /api/stats.
+type DegradeStatus struct {
+	Level     string     `json:"level"`
+	Since     *time.Time `json:"since,omitempty"`
+	Calls     int        `json:"calls"`
+	Failed    int        `json:"failed"`
+	ErrorRate float64    `json:"error_rate"`
+}
+
+// outage reports whether err means Telegram is failing rather than refusing
+// one request: a network error, a server error or a rate limit.
+func outage(err error) bool {
+	if err == nil || errors.Is(err, ErrBudgetExhausted) {
+		return false
+	}
+	var apiErr *telegram.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode == 429 || apiErr.ErrorCode >= 500
+	}
+	return true
+}
+
+// observeCall counts a Telegram call towards the error rate.
+func (b *Bot) observeCall(err error) {
+	now := b.clock.Now()
+	b.degrade.mutex.Lock()
+	defer b.degrade.mutex.Unlock()
+	b.degrade.calls = append(b.degrade.calls, degradeCall{at: now, failed: outage(err)})
+	b.degrade.prune(now)
+}
+
+// prune drops the calls older than DegradeWindow. It runs under mutex.
+func (d *degradation) prune(now time.Time) {
+	i := 0
+	for i < len(d.calls) && now.Sub(d.calls[i].at) > DegradeWindow {
+		i++
+	}
+	d.calls = d.calls[i:]
+}
+
+// counts returns the calls in the window and how many of them failed. It
+// runs under mutex.
+func (d *degradation) counts() (calls, failed int) {
+	for _, call := range d.calls {
+		if call.failed {
+			failed++
+		}
+	}
+	return len(d.calls), failed
+}
+
+func errorRate(calls, failed int) float64 {
+	if calls == 0 {
+		return 0
+	}
+	return float64(failed) / float64(calls)
+}
+
+// updateDegradation steps the degradation level one down when the Telegram
+// error rate reaches DEGRADE_ERROR_RATE, and one back up once it is under
+// DegradeRecoverRate, at most once per DegradeStep. It runs before each poll.
+// While degraded it probes Telegram first, since the bot then makes too few
+// calls of its own to tell whether Telegram recovered.
+func (b *Bot) updateDegradation() {
+	if b.degraded(DegradeNoEdits) {
+		b.probeTelegram()
+	}
+	threshold := b.cfg().DegradeErrorRate
+	now := b.clock.Now()
+
+	b.degrade.mutex.Lock()
+	b.degrade.prune(now)
+	calls, failed := b.degrade.counts()
+	rate := errorRate(calls, failed)
+	from := b.degrade.level
+	to := from
+	switch {
+	case threshold == 0:
+		// Disabled, recover at once
+		to = DegradeNone
+	case now.Sub(b.degrade.changed) < DegradeStep:
+	case from < DegradePaused && calls >= DegradeMinCalls && rate >= threshold:
+		to = from + 1
+	case from > DegradeNone && calls > 0 && rate < DegradeRecoverRate:
+		to = from - 1
+	}
+	if to != from {
+		b.degrade.level = to
+		b.degrade.changed = now
+		if from >= DegradeNoEdits && to < DegradeNoEdits {
+			b.degrade.resumed = true
+		}
+	}
+	b.degrade.mutex.Unlock()
+
+	switch {
+	case to > from:
+		b.event(EventWarning, "Telegram errors at %.0f%% of %d calls in the last %v, degrading to %s",
+			rate*100, calls, DegradeWindow, degradeLevels[to])
+	case to < from:
+		b.event(EventInfo, "Telegram errors down to %.0f%% of %d calls in the last %v, recovering to %s",
+			rate*100, calls, DegradeWindow, degradeLevels[to])
+	}
+}
+
+// degraded reports whether the bot is degraded to level or further.
+func (b *Bot) degraded(level int) bool {
+	b.degrade.mutex.Lock()
+	defer b.degrade.mutex.Unlock()
+	return b.degrade.level >= level
+}
+
+// editsResumed reports whether edits resumed since it was last called, so
+// the messages left alone in the meantime need catching up.
+func (b *Bot) editsResumed() bool {
+	b.degrade.mutex.Lock()
+	defer b.degrade.mutex.Unlock()
+	resumed := b.degrade.resumed
+	b.degrade.resumed = false
+	return resumed
+}
+
+func (b *Bot) degradeStatus() DegradeStatus {
+	b.degrade.mutex.Lock()
+	defer b.degrade.mutex.Unlock()
+	b.degrade.prune(b.clock.Now())
+	calls, failed := b.degrade.counts()
+	status := DegradeStatus{
+		Level:     degradeLevels[b.degrade.level],
+		Calls:     calls,
+		Failed:    failed,
+		ErrorRate: errorRate(calls, failed),
+	}
+	if b.degrade.level > DegradeNone {
+		since := b.degrade.changed
+		status.Since = &since
+	}
+	return status
+}
+
+// probeTelegram calls getMe, which counts towards the error rate like any
+// other call.
+func (b *Bot) probeTelegram() {
+	if err := b.tg.Call("getMe", struct{}{}, nil); err != nil {
+		log.Printf("Degraded, Telegram still failing: %v", err)
+	}
+}
+
+func (b *Bot) registerStatus() {
+	b.handleCommand("status", b.statusCommand)
+}
+
+// statusCommand replies with the degradation level and the Telegram error
+// rate behind it. With ADMIN_CHAT_ID set, it only answers there.
+func (b *Bot) statusCommand(msg *telegram.Message, args string) {
+	config := b.cfg()
+	if config.AdminChatID != "" && !config.isAdminChat(msg.Chat) {
+		return
+	}
+
+	lang := b.chatLanguage(msg.Chat)
+	status := b.degradeStatus()
+	level := tr(lang, "status_"+status.Level)
+	lines := []string{tr(lang, "status_level", level)}
+	if status.Since != nil {
+		lines[0] = tr(lang, "status_level_since", level, status.Since.In(config.location()).Format("2006-01-02 15:04"))
+	}
+	lines = append(lines, tr(lang, "status_errors", status.Failed, status.Calls, frontPageTime(DegradeWindow), status.ErrorRate*100))
+	if config.DegradeErrorRate == 0 {
+		lines = append(lines, tr(lang, "status_disabled"))
+	} else {
+		lines = append(lines, tr(lang, "status_threshold", config.DegradeErrorRate*100))
+	}
+	if b.inMaintenance() {
+		lines = append(lines, tr(lang, "status_maintenance"))
+	}
+	if budgets := b.budgetLines(); len(budgets) > 0 {
+		lines = append(lines, tr(lang, "stats_budgets", html.EscapeString(strings.Join(budgets, " "))))
+	}
+	b.reply(msg, strings.Join(lines, "\n"), nil)
+}
@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+const (
+	DigestFormatMarkdown = "md"
+	DigestFormatHTML     = "html"
+)
+
+// digestDate is how dates are shown in digests.
+const digestDate = "2006-01-02"
+
+// RunDigest implements `digest export --since=7d --format=md|html`, which
+// writes a newsletter of the stories posted in a period. Of opts, only
+// WithClock applies.
+func RunDigest(args []string, out io.Writer, opts ...Option) error {
+	clock := newOptions(opts).clock
+	if len(args) == 0 || args[0] != "export" {
+		return errors.New("usage: digest export [--since=7d] [--format=md|html] [--output=file]")
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("digest export", flag.ContinueOnError)
+	since := sinceFlag(7 * 24 * time.Hour)
+	flags.Var(&since, "since", "stories first seen in the last duration, e.g. 7d or 36h")
+	format := flags.String("format", DigestFormatMarkdown, "output format, md or html")
+	output := flags.String("output", "", "file to write to instead of standard output")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *format != DigestFormatMarkdown && *format != DigestFormatHTML {
+		return fmt.Errorf("unknown format %q, expected md or html", *format)
+	}
+
+	path := config.backendPath(config.StorageBackend)
+	store, err := openStorageAt(config, config.StorageBackend, path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := store.Load(); err != nil {
+		return fmt.Errorf("failed to load storage from %s: %w", redactURL(path), err)
+	}
+
+	to := clock.Now().In(config.location())
+	from := to.Add(-time.Duration(since))
+	stories := digestStories(store, from)
+
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create digest: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if *format == DigestFormatHTML {
+		err = writeDigestHTML(out, from, to, stories)
+	} else {
+		err = writeDigestMarkdown(out, from, to, stories)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write digest: %w", err)
+	}
+	return nil
+}
+
+// sinceFlag is a duration flag that also accepts whole days, such as "7d".
+type sinceFlag time.Duration
+
+func (f *sinceFlag) String() string {
+	return time.Duration(*f).String()
+}
+
+func (f *sinceFlag) Set(value string) error {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid number of days %q", days)
+		}
+		*f = sinceFlag(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	*f = sinceFlag(d)
+	return nil
+}
+
+// digestStories returns the stories posted since from, both those still
+// tracked and those in the history, highest score first.
+func digestStories(store *storage.Store, from time.Time) []storage.PostedStory {
+	peaks := peakRanks(store, from)
+	store.RLock()
+	defer store.RUnlock()
+
+	byID := make(map[int64]storage.PostedStory)
+	for id, story := range store.History {
+		byID[id] = story
+	}
+	for id, story := range store.Stories {
+		if len(story.Messages) > 0 {
+			byID[id] = story.Posted(storySummary(story))
+		}
+	}
+
+	var stories []storage.PostedStory
+	for _, story := range byID {
+		if !story.FirstSeen.Before(from) {
+			story.PeakRank = peaks[story.ID]
+			stories = append(stories, story)
+		}
+	}
+	sort.Slice(stories, func(i, j int) bool {
+		if stories[i].Score != stories[j].Score {
+			return stories[i].Score > stories[j].Score
+		}
+		return stories[i].ID < stories[j].ID
+	})
+	return stories
+}
+
+// frontPageTime formats a story's time on the front page as whole hours, or
+// minutes under an hour, e.g. "14h".
+func frontPageTime(d time.Duration) string {
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh", int(d.Hours()))
+}
+
+// digestLink returns where a digest entry links to: the story's link, or its
+// discussion for Ask HN and other text posts.
+func digestLink(story storage.PostedStory) string {
+	if story.URL == "" {
+		return hn.ItemURL(story.ID)
+	}
+	return story.URL
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+func writeDigestMarkdown(out io.Writer, from, to time.Time, stories []storage.PostedStory) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Hacker News digest, %s to %s\n\n", from.Format(digestDate), to.Format(digestDate))
+	if len(stories) == 0 {
+		sb.WriteString("No stories were posted in this period.\n")
+	}
+	for i, story := range stories {
+		fmt.Fprintf(&sb, "%d. **[%s](<%s>)**", i+1, markdownEscaper.Replace(story.Title), digestLink(story))
+		if domain := storyDomain(story.URL); domain != "" {
+			fmt.Fprintf(&sb, " (%s)", markdownEscaper.Replace(domain))
+		}
+		fmt.Fprintf(&sb, "  \n   %d points · [%d comments](<%s>)", story.Score, story.Descendants, hn.ItemURL(story.ID))
+		if story.By != "" {
+			fmt.Fprintf(&sb, " · by %s", markdownEscaper.Replace(story.By))
+		}
+		if story.PeakRank > 0 {
+			fmt.Fprintf(&sb, " · peaked at #%d", story.PeakRank)
+		}
+		if d := story.FrontPage(); d >= time.Minute {
+			fmt.Fprintf(&sb, " · front page for %s", frontPageTime(d))
+		}
+		sb.WriteString("\n")
+		if story.Summary != "" {
+			// Keep the summary in the list item
+			summary := strings.Join(strings.Fields(story.Summary), " ")
+			fmt.Fprintf(&sb, "\n   %s\n", markdownEscaper.Replace(summary))
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(out, sb.String())
+	return err
+}
+
+var digestPage = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"link":    digestLink,
+	"domain":  func(story storage.PostedStory) string { return storyDomain(story.URL) },
+	"itemURL": hn.ItemURL,
+	"frontPage": func(story storage.PostedStory) string {
+		if d := story.FrontPage(); d >= time.Minute {
+			return frontPageTime(d)
+		}
+		return ""
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Hacker News digest, {{.From}} to {{.To}}</title>
+</head>
+<body style="font-family: sans-serif; max-width: 640px; margin: 0 auto;">
+<h1>Hacker News digest, {{.From}} to {{.To}}</h1>
+{{with .Stories}}<ol>
+{{range .}}<li style="margin-bottom: 1em;">
+<a href="{{link .}}"><b>{{.Title}}</b></a>{{with domain .}} <small>({{.}})</small>{{end}}<br>
+<small>{{.Score}} points · <a href="{{itemURL .ID}}">{{.Descendants}} comments</a>{{with .By}} · by {{.}}{{end}}{{with .PeakRank}} · peaked at #{{.}}{{end}}{{with frontPage .}} · front page for {{.}}{{end}}</small>
+{{with .Summary}}<p>{{.}}</p>{{end}}
+</li>
+{{end}}</ol>
+{{else}}<p>No stories were posted in this period.</p>
+{{end}}</body>
+</html>
+`))
+
+func writeDigestHTML(out io.Writer, from, to time.Time, stories []storage.PostedStory) error {
+	return digestPage.Execute(out, struct {
+		From, To string
+		Stories  []storage.PostedStory
+	}{from.Format(digestDate), to.Format(digestDate), stories})
+}
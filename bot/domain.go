@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+func (b *Bot) registerDomain() {
+	b.handleCommand("domain", b.domainCommand)
+}
+
+// domainCommand replies with how many stories of a domain were posted, their
+// average score and the latest of them. Stories still tracked count with
+// their current score.
+func (b *Bot) domainCommand(msg *telegram.Message, args string) {
+	config := b.cfg()
+	lang := b.chatLanguage(msg.Chat)
+	domain := args
+	if !strings.Contains(domain, "://") {
+		domain = "https://" + domain
+	}
+	domain = storyDomain(domain)
+	if args == "" || domain == "" {
+		b.reply(msg, tr(lang, "domain_usage"), nil)
+		return
+	}
+
+	stats := b.storage.Domain(domain)
+	b.storage.RLock()
+	for _, story := range b.storage.Stories {
+		if len(story.Messages) > 0 && storyDomain(story.URL) == domain {
+			stats.Add(storage.DomainStory{ID: story.ID, Title: story.Title, Score: story.Score, FirstSeen: story.FirstSeen})
+		}
+	}
+	b.storage.RUnlock()
+
+	if stats.Posted == 0 {
+		b.reply(msg, tr(lang, "domain_none", html.EscapeString(domain)), nil)
+		return
+	}
+	lines := []string{tr(lang, "domain_header", html.EscapeString(domain), stats.Posted, float64(stats.ScoreSum)/float64(stats.Posted)), ""}
+	for _, story := range stats.Recent {
+		entry := fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(hn.ItemURL(story.ID)), html.EscapeString(story.Title))
+		lines = append(lines, tr(lang, "domain_story", entry, story.Score, story.FirstSeen.In(config.location()).Format("2006-01-02")))
+	}
+	b.reply(msg, strings.Join(lines, "\n"), nil)
+}
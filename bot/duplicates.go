@@ -0,0 +1,79 @@
+package bot
+
+import (
+	"log"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// skipDuplicate looks for a recently posted story with nearly the same title
+// as the story, which is about to be posted, and reports whether the story
+// is to be skipped for it. The match is kept with the story, so that the
+// decision holds once the earlier story is gone.
+func (b *Bot) skipDuplicate(config *Config, story *storage.Story) bool {
+	if config.DuplicateTitles == "" {
+		return false
+	}
+	if story.DuplicateOf == 0 {
+		original, ok := b.findDuplicate(config, story)
+		if !ok {
+			return false
+		}
+		story.DuplicateOf = original
+		log.Printf("Story %d has nearly the same title as story %d", story.ID, original)
+	}
+	return config.DuplicateTitles == DuplicateSkip
+}
+
+// findDuplicate returns the earliest tracked story posted within
+// DuplicateTitleWindow whose title is at least DuplicateSimilarity alike.
+func (b *Bot) findDuplicate(config *Config, story *storage.Story) (int64, bool) {
+	now := b.clock.Now()
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+
+	var original *storage.Story
+	for id, other := range b.storage.Stories {
+		if id == story.ID || len(other.Messages) == 0 || now.Sub(other.FirstSeen) > DuplicateTitleWindow {
+			continue
+		}
+		if filter.TitleSimilarity(story.Title, other.Title) < config.DuplicateSimilarity {
+			continue
+		}
+		if original == nil || other.FirstSeen.Before(original.FirstSeen) ||
+			(other.FirstSeen.Equal(original.FirstSeen) && other.ID < original.ID) {
+			original = other
+		}
+	}
+	if original == nil {
+		return 0, false
+	}
+	return original.ID, true
+}
+
+// replyTarget makes the message of a duplicate or grouped story in chatID a
+// reply to the earlier story's message there, with DUPLICATE_TITLES=reply or
+// STORY_GROUPS=reply.
+func (b *Bot) replyTarget(story *storage.Story, chatID string) *telegram.ReplyParameters {
+	config := b.cfg()
+	var earlier int64
+	switch {
+	case story.DuplicateOf != 0 && config.DuplicateTitles == DuplicateReply:
+		earlier = story.DuplicateOf
+	case story.GroupOf != 0 && config.StoryGroups == GroupReply:
+		earlier = story.GroupOf
+	default:
+		return nil
+	}
+	original, ok := b.getStoredStory(earlier)
+	if !ok {
+		return nil
+	}
+	msg, ok := original.Messages[chatID]
+	if !ok {
+		return nil
+	}
+	return &telegram.ReplyParameters{MessageID: msg.MessageID, AllowSendingWithoutReply: true}
+}
@@ -0,0 +1,276 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+const (
+	DigestEmailFile            = "digest_email"
+	DefaultDigestEmailSchedule = "0 8 * * 1"
+	DefaultDigestEmailPeriod   = 7 * 24 * time.Hour
+
+	// DigestEmailTimeout bounds the whole conversation with the SMTP server.
+	DigestEmailTimeout = time.Minute
+)
+
+// DigestEmailConfig describes the SMTP server and recipients the digest is
+// emailed to.
+type DigestEmailConfig struct {
+	To       []string `json:"to,omitempty" yaml:"to,omitempty" toml:"to,omitempty"`
+	From     string   `json:"from,omitempty" yaml:"from,omitempty" toml:"from,omitempty"`
+	SMTPAddr string   `json:"smtp_addr,omitempty" yaml:"smtp_addr,omitempty" toml:"smtp_addr,omitempty"`
+	Username string   `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty"`
+	Password string   `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty"`
+	Schedule string   `json:"schedule,omitempty" yaml:"schedule,omitempty" toml:"schedule,omitempty"`
+	Period   Duration `json:"period,omitempty" yaml:"period,omitempty" toml:"period,omitempty"`
+}
+
+func (c DigestEmailConfig) String() string {
+	if !c.enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("to=%s from=%s smtp=%s schedule=%q period=%v",
+		strings.Join(c.To, ","), c.From, c.SMTPAddr, c.Schedule, time.Duration(c.Period))
+}
+
+// merge overrides fields with the ones set in other.
+func (c *DigestEmailConfig) merge(other DigestEmailConfig) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.From, other.From},
+		{&c.SMTPAddr, other.SMTPAddr},
+		{&c.Username, other.Username},
+		{&c.Password, other.Password},
+		{&c.Schedule, other.Schedule},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if len(other.To) > 0 {
+		c.To = other.To
+	}
+	if other.Period != 0 {
+		c.Period = other.Period
+	}
+}
+
+func (c *DigestEmailConfig) applyEnv() error {
+	if period := os.Getenv("DIGEST_EMAIL_PERIOD"); period != "" {
+		d, err := time.ParseDuration(period)
+		if err != nil {
+			return fmt.Errorf("invalid DIGEST_EMAIL_PERIOD %q: %w", period, err)
+		}
+		c.Period = Duration(d)
+	}
+	password, err := secretEnv("SMTP_PASSWORD")
+	if err != nil {
+		return err
+	}
+	c.merge(DigestEmailConfig{
+		To:       splitList(os.Getenv("DIGEST_EMAIL_TO")),
+		From:     os.Getenv("DIGEST_EMAIL_FROM"),
+		SMTPAddr: os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: password,
+		Schedule: os.Getenv("DIGEST_EMAIL_SCHEDULE"),
+	})
+	return nil
+}
+
+func (c DigestEmailConfig) enabled() bool {
+	return len(c.To) > 0
+}
+
+func (c DigestEmailConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+	if c.From == "" || c.SMTPAddr == "" {
+		return fmt.Errorf("digest email requires a sender and an SMTP server when recipients are set")
+	}
+	for _, address := range append([]string{c.From}, c.To...) {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("invalid digest email address %q: %w", address, err)
+		}
+	}
+	if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+		return fmt.Errorf("invalid SMTP server %q, expected host:port: %w", c.SMTPAddr, err)
+	}
+	if time.Duration(c.Period) < time.Hour {
+		return fmt.Errorf("digest email period must be at least 1h, got %v", time.Duration(c.Period))
+	}
+	return nil
+}
+
+// runDigestEmail emails the digest of the last DIGEST_EMAIL_PERIOD on
+// DIGEST_EMAIL_SCHEDULE. The date of the last email is kept in the state
+// directory so that it goes out at most once a day, even across restarts.
+func (b *Bot) runDigestEmail(ctx context.Context) {
+	b.runScheduled(ctx, "digest email", func(config Config) string {
+		if !config.DigestEmail.enabled() {
+			return ""
+		}
+		return config.DigestEmail.Schedule
+	}, b.digestEmail)
+}
+
+func (b *Bot) digestEmail() {
+	config := b.cfg()
+	now := b.clock.Now().In(config.location())
+	if b.lastDigestEmail() == now.Format(digestDate) {
+		return
+	}
+
+	from := now.Add(-time.Duration(config.DigestEmail.Period))
+	stories := digestStories(b.storage, from)
+	if err := sendDigestEmail(config.DigestEmail, config.language(config.ChatID), from, now, stories); err != nil {
+		b.event(EventWarning, "Digest email failed: %v", err)
+		return
+	}
+	log.Printf("Emailed digest of %d stories to %d recipients", len(stories), len(config.DigestEmail.To))
+	if err := os.WriteFile(config.statePath(DigestEmailFile), []byte(now.Format(digestDate)), 0o644); err != nil {
+		log.Printf("Error recording digest email: %v", err)
+	}
+}
+
+func (b *Bot) lastDigestEmail() string {
+	config := b.cfg()
+	data, err := os.ReadFile(config.statePath(DigestEmailFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// sendDigestEmail sends the digest as a multipart/alternative email with the
+// Markdown and the HTML export as its parts, and the subject in lang. The
+// connection is upgraded with STARTTLS when the server offers it.
+func sendDigestEmail(config DigestEmailConfig, lang string, from, to time.Time, stories []storage.PostedStory) error {
+	var text, page bytes.Buffer
+	if err := writeDigestMarkdown(&text, from, to, stories); err != nil {
+		return err
+	}
+	if err := writeDigestHTML(&page, from, to, stories); err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=utf-8", text.Bytes()},
+		{"text/html; charset=utf-8", page.Bytes()},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return err
+		}
+		if err := qp.Close(); err != nil {
+			return err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return err
+	}
+
+	subject := tr(lang, "digest_email_subject", formatDate(lang, from), formatDate(lang, to))
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", to.Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", parts.Boundary())
+	msg.Write(body.Bytes())
+
+	sender, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return err
+	}
+	recipients := make([]string, len(config.To))
+	for i, to := range config.To {
+		address, err := mail.ParseAddress(to)
+		if err != nil {
+			return err
+		}
+		recipients[i] = address.Address
+	}
+	if err := sendMail(config, sender.Address, recipients, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send digest email: %w", err)
+	}
+	return nil
+}
+
+// sendMail is smtp.SendMail with DigestEmailTimeout.
+func sendMail(config DigestEmailConfig, sender string, recipients []string, msg []byte) error {
+	host, _, _ := net.SplitHostPort(config.SMTPAddr)
+	conn, err := net.DialTimeout("tcp", config.SMTPAddr, DigestEmailTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(DigestEmailTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if config.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.Username, config.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(sender); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
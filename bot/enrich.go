@@ -0,0 +1,301 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/fetch"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+const (
+	// EnrichTimeout bounds how long an enricher may take for one story,
+	// unless it sets its own timeout.
+	EnrichTimeout   = 30 * time.Second
+	EnrichQueueSize = 64
+
+	GitHubAPIURL  = "https://api.github.com"
+	WaybackAPIURL = "https://archive.org/wayback/available"
+)
+
+// Enricher adds a line of extra information to a story's message, such as
+// the stars of the GitHub repository it links to. Enrichers can be slow, so
+// stories are posted without them and edited once they finish.
+type Enricher interface {
+	Name() string
+	// Enrich returns the HTML line to add to the message, or "" when there
+	// is nothing to add for the story.
+	Enrich(ctx context.Context, story *storage.Story) (string, error)
+}
+
+// enricherTimeout returns how long an enricher may take, which is
+// EnrichTimeout unless it has a Timeout method.
+func enricherTimeout(e Enricher) time.Duration {
+	if t, ok := e.(interface{ Timeout() time.Duration }); ok {
+		return t.Timeout()
+	}
+	return EnrichTimeout
+}
+
+// enrichers returns the built-in and plugin enrichers by name.
+func (b *Bot) enrichers() map[string]Enricher {
+	config := b.cfg()
+	enrichers := map[string]Enricher{
+		"github":     githubEnricher{fetcher: b.fetcher},
+		"archive":    archiveEnricher{fetcher: b.fetcher},
+		"summary":    summaryEnricher{config: config.Summary, articles: b.articles, httpClient: b.httpClient},
+		"discussion": discussionEnricher{config: config, hn: b.hn, httpClient: b.httpClient},
+	}
+	for _, p := range config.plugins {
+		if p.enricher != nil {
+			enrichers[p.name] = p.enricher
+		}
+	}
+	return enrichers
+}
+
+var enricherNames = []string{"github", "archive", "summary", "discussion"}
+
+// enrichJob asks for the enrichment of a story. Enrichers that already ran
+// for it are skipped, except refresh.
+type enrichJob struct {
+	id      int64
+	refresh string
+}
+
+// validateEnrichers checks Enrichers against the built-in enrichers and
+// those of the loaded plugins.
+func (c *Config) validateEnrichers() error {
+	known := slices.Clone(enricherNames)
+	for _, p := range c.plugins {
+		if p.enricher != nil {
+			known = append(known, p.name)
+		}
+	}
+	for _, name := range c.Enrichers {
+		if !slices.Contains(known, name) {
+			return fmt.Errorf("unknown enricher %q, expected one of %s", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// enrichLater queues a freshly posted story for enrichment. It never blocks
+// posting: when the queue is full the story is posted without enrichments.
+func (b *Bot) enrichLater(story *storage.Story) {
+	if len(b.cfg().Enrichers) == 0 {
+		return
+	}
+	if b.budgetLow(UpstreamEnrichment) {
+		log.Printf("Enrichment request budget is running low, not enriching story %d", story.ID)
+		return
+	}
+	if b.degraded(DegradeNoEnrichment) {
+		log.Printf("Degraded by Telegram errors, not enriching story %d", story.ID)
+		return
+	}
+	select {
+	case b.enrichQueue <- enrichJob{id: story.ID}:
+	default:
+		log.Printf("Enrichment queue is full, not enriching story %d", story.ID)
+	}
+}
+
+// runEnrichment enriches the queued stories concurrently until ctx is done.
+func (b *Bot) runEnrichment(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-b.enrichQueue:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.enrich(ctx, job)
+			}()
+		}
+	}
+}
+
+// enrich runs the configured enrichers for a story and edits its messages
+// once with all the results.
+func (b *Bot) enrich(ctx context.Context, job enrichJob) {
+	id := job.id
+	story, exists := b.getStoredStory(id)
+	if !exists {
+		return
+	}
+
+	config := b.cfg()
+	available := b.enrichers()
+	results := make(map[string]string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range config.Enrichers {
+		if _, done := story.Enrichments[name]; done && name != job.refresh {
+			continue
+		}
+		enricher := available[name]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, enricherTimeout(enricher))
+			defer cancel()
+			line, err := enricher.Enrich(ctx, story)
+			if err != nil {
+				log.Printf("Error enriching story %d with %s: %v", id, enricher.Name(), err)
+				return
+			}
+			mutex.Lock()
+			results[enricher.Name()] = line
+			mutex.Unlock()
+		}()
+	}
+	wg.Wait()
+	if len(results) == 0 {
+		return
+	}
+
+	// Serialize with polling, which also edits the messages
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	b.actors.do(id, func() { b.applyEnrichments(id, results) })
+}
+
+// applyEnrichments stores the enrichment results and edits the messages when
+// they changed. It runs on the story's actor.
+func (b *Bot) applyEnrichments(id int64, results map[string]string) {
+	story, exists := b.getStoredStory(id)
+	if !exists {
+		return
+	}
+	if story.Enrichments == nil {
+		story.Enrichments = make(map[string]string)
+	}
+	changed := false
+	for name, line := range results {
+		changed = changed || line != story.Enrichments[name]
+		story.Enrichments[name] = line
+	}
+	if _, ok := results["discussion"]; ok && b.clock.Now().Sub(story.FirstSeen) >= DiscussionRefreshAge {
+		story.DiscussionFinal = true
+	}
+	if changed && !b.inMaintenance() && !b.degraded(DegradeNoEdits) {
+		b.refreshMessages(story)
+	}
+	if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving enriched story %d: %v", id, err)
+	}
+}
+
+// refreshMessages edits the story's message in every chat it was posted to
+// with its current values.
+func (b *Bot) refreshMessages(story *storage.Story) {
+	config := b.cfg()
+	for chatID, msg := range story.Messages {
+		msg, err := b.editChatMessage(&config, story, chatID, msg)
+		if err != nil {
+			log.Printf("Error editing message for story %d in %s: %v", story.ID, chatID, err)
+			continue
+		}
+		story.Messages[chatID] = msg
+	}
+}
+
+// enrichmentLines returns the story's enrichment lines in the configured
+// order of the enrichers.
+func (c *Config) enrichmentLines(s *storage.Story) string {
+	var lines []string
+	for _, name := range c.Enrichers {
+		if line := s.Enrichments[name]; line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// githubEnricher adds the stars and language of the GitHub repository a
+// story links to.
+type githubEnricher struct {
+	fetcher *fetch.Fetcher
+}
+
+func (githubEnricher) Name() string { return "github" }
+
+func (e githubEnricher) Enrich(ctx context.Context, story *storage.Story) (string, error) {
+	u, err := url.Parse(story.URL)
+	if err != nil || (u.Host != "github.com" && u.Host != "www.github.com") {
+		return "", nil
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", nil
+	}
+
+	var repo struct {
+		Stars    int64  `json:"stargazers_count"`
+		Language string `json:"language"`
+	}
+	if err := e.fetcher.JSON(ctx, GitHubAPIURL+"/repos/"+url.PathEscape(parts[0])+"/"+url.PathEscape(strings.TrimSuffix(parts[1], ".git")), &repo); err != nil {
+		return "", fmt.Errorf("failed to get repository %s/%s: %w", parts[0], parts[1], err)
+	}
+	line := "⭐ " + compactCount(repo.Stars)
+	if repo.Language != "" {
+		line += " · " + html.EscapeString(repo.Language)
+	}
+	return line, nil
+}
+
+// archiveEnricher links the closest Wayback Machine snapshot of the page a
+// story links to.
+type archiveEnricher struct {
+	fetcher *fetch.Fetcher
+}
+
+func (archiveEnricher) Name() string { return "archive" }
+
+func (e archiveEnricher) Enrich(ctx context.Context, story *storage.Story) (string, error) {
+	if story.URL == "" {
+		return "", nil
+	}
+
+	var available struct {
+		Snapshots struct {
+			Closest struct {
+				Available bool   `json:"available"`
+				URL       string `json:"url"`
+			} `json:"closest"`
+		} `json:"archived_snapshots"`
+	}
+	if err := e.fetcher.JSON(ctx, WaybackAPIURL+"?url="+url.QueryEscape(story.URL), &available); err != nil {
+		return "", fmt.Errorf("failed to look up archived copy: %w", err)
+	}
+	closest := available.Snapshots.Closest
+	if !closest.Available || closest.URL == "" {
+		return "", nil
+	}
+	return fmt.Sprintf(`🗄 <a href="%s">web.archive.org</a>`, html.EscapeString(closest.URL)), nil
+}
+
+// compactCount formats n like 950, 1.2k or 34k.
+func compactCount(n int64) string {
+	switch {
+	case n < 1000:
+		return fmt.Sprint(n)
+	case n < 10000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1000), ".0") + "k"
+	default:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+}
@@ -0,0 +1,289 @@
+package bot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventBusNATS  = "nats"
+	EventBusKafka = "kafka"
+
+	DefaultEventBusTopic = "hn.stories"
+	EventBusTimeout      = 10 * time.Second
+)
+
+// EventBus publishes story lifecycle events to a message broker, making the
+// bot the curation front-end of a bigger pipeline. Events are published one
+// at a time, in order.
+type EventBus interface {
+	// Publish sends payload, the JSON encoded StoryEvent named event. key is
+	// the story ID, for brokers that partition by key.
+	Publish(ctx context.Context, event, key string, payload []byte) error
+	Close() error
+}
+
+func (b *Bot) publishToBus(ctx context.Context, event StoryEvent, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, EventBusTimeout)
+	defer cancel()
+	return b.bus.Publish(ctx, event.Event, strconv.FormatInt(event.Story.ID, 10), body)
+}
+
+func validateEventBus(kind, rawURL string) error {
+	if kind == "" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if rawURL == "" || err != nil || u.Host == "" {
+		return fmt.Errorf("event_bus %s requires event_bus_url", kind)
+	}
+	switch kind {
+	case EventBusNATS:
+		if u.Scheme != "nats" && u.Scheme != "tls" {
+			return fmt.Errorf("event_bus_url for nats must be a nats:// or tls:// URL, got %q", u.Redacted())
+		}
+	case EventBusKafka:
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("event_bus_url for kafka must be the http or https URL of a REST proxy, got %q", u.Redacted())
+		}
+	default:
+		return fmt.Errorf("event_bus must be %s or %s, got %q", EventBusNATS, EventBusKafka, kind)
+	}
+	return nil
+}
+
+// redactURL hides the password of rawURL, which may hold credentials.
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+// newEventBus returns the event bus configured by EVENT_BUS, or nil.
+func newEventBus(config Config, httpClient *http.Client) EventBus {
+	switch config.EventBus {
+	case EventBusNATS:
+		u, _ := url.Parse(config.EventBusURL)
+		return &natsBus{url: u, subject: config.EventBusTopic}
+	case EventBusKafka:
+		return &kafkaBus{
+			url:        strings.TrimSuffix(config.EventBusURL, "/"),
+			topic:      config.EventBusTopic,
+			httpClient: httpClient,
+		}
+	}
+	return nil
+}
+
+// natsBus publishes to NATS core subjects named after the topic and the
+// event, e.g. "hn.stories.posted". It keeps one connection, which is opened
+// on the first publish and reopened after errors.
+type natsBus struct {
+	url     *url.URL
+	subject string
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func (n *natsBus) Publish(ctx context.Context, event, key string, payload []byte) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return fmt.Errorf("failed to connect to NATS: %w", err)
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		n.conn.SetDeadline(deadline)
+	}
+
+	subject := n.subject + "." + strings.TrimPrefix(event, "story.")
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "PUB %s %d\r\n", subject, len(payload))
+	buf.Write(payload)
+	// The PONG confirms the server processed the PUB
+	buf.WriteString("\r\nPING\r\n")
+	if _, err := n.conn.Write(buf.Bytes()); err != nil {
+		n.reset()
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	if err := n.awaitPong(); err != nil {
+		n.reset()
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+	return nil
+}
+
+// connect opens the connection, upgrading it to TLS for tls:// URLs or when
+// the server requires it, and authenticates with the URL's user info.
+func (n *natsBus) connect(ctx context.Context) error {
+	host := n.url.Host
+	if n.url.Port() == "" {
+		host = net.JoinHostPort(n.url.Hostname(), "4222")
+	}
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	n.conn, n.reader = conn, bufio.NewReader(conn)
+
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		n.reset()
+		return err
+	}
+	infoJSON, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		n.reset()
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(infoJSON), &info)
+
+	useTLS := n.url.Scheme == "tls" || info.TLSRequired
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: n.url.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			n.reset()
+			return err
+		}
+		n.conn, n.reader = tlsConn, bufio.NewReader(tlsConn)
+	}
+
+	options := map[string]any{
+		"verbose":      false,
+		"pedantic":     false,
+		"tls_required": useTLS,
+		"name":         "tg_hacker_news",
+		"lang":         "go",
+		"version":      "1",
+	}
+	if user := n.url.User; user != nil {
+		if password, ok := user.Password(); ok {
+			options["user"], options["pass"] = user.Username(), password
+		} else {
+			options["auth_token"] = user.Username()
+		}
+	}
+	connect, err := json.Marshal(options)
+	if err != nil {
+		n.reset()
+		return err
+	}
+	if _, err := fmt.Fprintf(n.conn, "CONNECT %s\r\nPING\r\n", connect); err != nil {
+		n.reset()
+		return err
+	}
+	if err := n.awaitPong(); err != nil {
+		n.reset()
+		return err
+	}
+	return nil
+}
+
+// awaitPong reads until the server's PONG, answering its PINGs.
+func (n *natsBus) awaitPong() error {
+	for {
+		line, err := n.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := io.WriteString(n.conn, "PONG\r\n"); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
+
+func (n *natsBus) reset() {
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.conn, n.reader = nil, nil
+}
+
+func (n *natsBus) Close() error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.reset()
+	return nil
+}
+
+// kafkaBus produces to a Kafka topic through a REST proxy speaking the v2
+// API of the Confluent REST Proxy, which Redpanda's HTTP proxy also serves,
+// keyed by story ID.
+type kafkaBus struct {
+	url        string
+	topic      string
+	httpClient *http.Client
+}
+
+func (k *kafkaBus) Publish(ctx context.Context, event, key string, payload []byte) error {
+	body, err := json.Marshal(map[string]any{
+		"records": []map[string]any{{"key": key, "value": json.RawMessage(payload)}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.url+"/topics/"+url.PathEscape(k.topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := k.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce to Kafka: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to produce to Kafka: status %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	var result struct {
+		Offsets []struct {
+			Error string `json:"error"`
+		} `json:"offsets"`
+	}
+	json.Unmarshal(data, &result)
+	for _, offset := range result.Offsets {
+		if offset.Error != "" {
+			return fmt.Errorf("failed to produce to Kafka: %s", offset.Error)
+		}
+	}
+	return nil
+}
+
+func (k *kafkaBus) Close() error {
+	return nil
+}
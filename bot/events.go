@@ -0,0 +1,91 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	EventQueueSize = 100
+	EventInfo      = "ℹ️"
+	EventWarning   = "⚠️"
+)
+
+// eventLog forwards operational events to the optional admin chat. Events are
+// queued and sent from a single goroutine so reporting never blocks polling.
+type eventLog struct {
+	queue chan string
+
+	mutex       sync.Mutex
+	pausedUntil time.Time
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{queue: make(chan string, EventQueueSize)}
+}
+
+// event logs an operational event, hands it to the sinks and, if an admin
+// chat is configured, posts it there as a compact message.
+func (b *Bot) event(level string, format string, args ...any) {
+	text := fmt.Sprintf(format, args...)
+	log.Print(text)
+	for _, sink := range b.sinks {
+		sink(level, text)
+	}
+
+	if b.cfg().AdminChatID == "" {
+		return
+	}
+
+	select {
+	case b.events.queue <- level + " " + text:
+	default:
+		log.Printf("Event queue full, dropping event: %s", text)
+	}
+}
+
+func (b *Bot) runEventLog(ctx context.Context) {
+	for {
+		var text string
+		select {
+		case <-ctx.Done():
+			return
+		case text = <-b.events.queue:
+		}
+
+		config := b.cfg()
+		chatID := config.AdminChatID
+		if chatID == "" || config.inMaintenance(b.clock.Now()) {
+			continue
+		}
+
+		req := telegram.SendMessageRequest{
+			ChatID:              chatID,
+			Text:                text,
+			DisableNotification: true,
+		}
+		if err := b.tg.Call("sendMessage", req, nil); err != nil {
+			log.Printf("Error posting event to admin chat %s: %v", chatID, err)
+		}
+	}
+}
+
+// rateLimited reports a Telegram rate-limit pause once per pause window.
+func (b *Bot) rateLimited(method string, retryAfter int) {
+	until := b.clock.Now().Add(time.Duration(retryAfter) * time.Second)
+
+	b.events.mutex.Lock()
+	if b.clock.Now().Before(b.events.pausedUntil) {
+		b.events.mutex.Unlock()
+		return
+	}
+	b.events.pausedUntil = until
+	b.events.mutex.Unlock()
+
+	b.event(EventWarning, "Rate limited by Telegram in %s, retry after %ds", method, retryAfter)
+}
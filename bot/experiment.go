@@ -0,0 +1,159 @@
+package bot
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// Experiment splits stories between two variants, assigned by a hash of
+// the experiment name and the story ID so a story always gets the same one.
+type Experiment struct {
+	Name string            `json:"name" yaml:"name" toml:"name"`
+	A    ExperimentVariant `json:"a" yaml:"a" toml:"a"`
+	B    ExperimentVariant `json:"b" yaml:"b" toml:"b"`
+}
+
+// ExperimentVariant overrides the main chat's thresholds and the message
+// template for the stories assigned to it. Unset fields use the live values.
+type ExperimentVariant struct {
+	ScoreThreshold    *int64 `json:"score_threshold,omitempty" yaml:"score_threshold,omitempty" toml:"score_threshold,omitempty"`
+	CommentsThreshold *int64 `json:"comments_threshold,omitempty" yaml:"comments_threshold,omitempty" toml:"comments_threshold,omitempty"`
+
+	// Template is a text/template for the message text, see messageData.
+	Template string `json:"template,omitempty" yaml:"template,omitempty" toml:"template,omitempty"`
+
+	template *template.Template
+}
+
+func (e *Experiment) String() string {
+	if e == nil {
+		return "off"
+	}
+	format := func(v ExperimentVariant) string {
+		return fmt.Sprintf("%s template=%q", HotThresholds{Score: v.ScoreThreshold, Comments: v.CommentsThreshold}, v.Template)
+	}
+	return fmt.Sprintf("%s a(%s) b(%s)", e.Name, format(e.A), format(e.B))
+}
+
+// messageData is what message templates are executed with. Title and Tags
+// are HTML escaped, Enrichments is HTML with one line per enricher.
+type messageData struct {
+	Title    string
+	URL      string
+	HNURL    string
+	Score    int64
+	Comments int64
+	Tags     string
+
+	Enrichments string
+	Developing  string
+}
+
+// validate checks the experiment and parses its templates.
+func (e *Experiment) validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("experiment: name is required")
+	}
+	for name, v := range map[string]*ExperimentVariant{"a": &e.A, "b": &e.B} {
+		if (v.ScoreThreshold != nil && *v.ScoreThreshold < 0) || (v.CommentsThreshold != nil && *v.CommentsThreshold < 0) {
+			return fmt.Errorf("experiment %s: thresholds of variant %s must not be negative", e.Name, name)
+		}
+		if v.Template == "" {
+			continue
+		}
+		tmpl, err := template.New(name).Parse(v.Template)
+		if err != nil {
+			return fmt.Errorf("experiment %s: variant %s: %w", e.Name, name, err)
+		}
+		v.template = tmpl
+	}
+	return nil
+}
+
+// variant returns the variant a story belongs to and its key,
+// "experiment/variant", or nil when no experiment runs.
+func (c *Config) variant(id int64) (string, *ExperimentVariant) {
+	e := c.Experiment
+	if e == nil {
+		return "", nil
+	}
+	h := fnv.New32a()
+	h.Write([]byte(e.Name + ":" + strconv.FormatInt(id, 10)))
+	if h.Sum32()%2 == 0 {
+		return e.Name + "/a", &e.A
+	}
+	return e.Name + "/b", &e.B
+}
+
+// renderTemplate executes the message template of the story's variant. It
+// reports false when there is none or it fails, and the default format is
+// used.
+func (c *Config) renderTemplate(s *storage.Story, data messageData) (string, bool) {
+	_, v := c.variant(s.ID)
+	if v == nil || v.template == nil {
+		return "", false
+	}
+	var text strings.Builder
+	if err := v.template.Execute(&text, data); err != nil {
+		log.Printf("Error executing message template of experiment %s for story %d: %v", c.Experiment.Name, s.ID, err)
+		return "", false
+	}
+	return text.String(), true
+}
+
+// countVariantPost attributes a sent message to the story's variant, which
+// is fixed when the story is first posted.
+func (b *Bot) countVariantPost(config *Config, story *storage.Story) {
+	if story.Variant == "" {
+		story.Variant, _ = config.variant(story.ID)
+	}
+	if story.Variant != "" {
+		b.storage.CountVariant(story.Variant, 1, 0)
+	}
+}
+
+// reactionCount records the new reaction total of a tracked message and adds
+// the change to the counters of its story's variant.
+func (b *Bot) reactionCount(update *telegram.MessageReactionCountUpdated) {
+	var total int64
+	for _, reaction := range update.Reactions {
+		total += reaction.TotalCount
+	}
+
+	chatIDs := []string{chatIDString(update.Chat)}
+	if update.Chat.Username != "" {
+		chatIDs = append(chatIDs, "@"+update.Chat.Username)
+	}
+
+	var variant string
+	var delta int64
+	b.storage.Lock()
+	for _, story := range b.storage.Stories {
+		for _, chatID := range chatIDs {
+			msg, ok := story.Messages[chatID]
+			if !ok || msg.MessageID != update.MessageID {
+				continue
+			}
+			delta = total - msg.Reactions
+			msg.Reactions = total
+			story.Messages[chatID] = msg
+			variant = story.Variant
+		}
+	}
+	b.storage.Unlock()
+
+	if variant == "" || delta == 0 {
+		return
+	}
+	b.storage.CountVariant(variant, 0, delta)
+	if err := b.storage.Save(); err != nil {
+		log.Printf("Error saving storage: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// MinFailoverLease is the shortest FAILOVER_LEASE, which leaves the active
+// replica a few seconds for each renewal.
+const MinFailoverLease = 10 * time.Second
+
+func defaultReplicaID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// AwaitLease blocks while another replica holds the failover lease, standing
+// by to take over once it expires or is released, and returns when this
+// replica got it or ctx is done. It returns at once without FAILOVER_LEASE.
+// Of opts, only WithClock applies. The replicas share the storage backend:
+// an sqlite database on one volume for hosts at a single site, or a Redis
+// server for replicas in different regions.
+func AwaitLease(ctx context.Context, config Config, opts ...Option) error {
+	clock := newOptions(opts).clock
+	ttl := time.Duration(config.FailoverLease)
+	if ttl == 0 {
+		return nil
+	}
+	storageOpts := config.storageOptions()
+	storageOpts.DualWrite = ""
+	store, err := storage.Open(storageOpts)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	standby := false
+	for {
+		lease, err := store.AcquireLease(config.ReplicaID, ttl, clock.Now())
+		switch {
+		case err != nil:
+			log.Printf("Error checking the failover lease: %v", err)
+		case lease.Holder == config.ReplicaID:
+			if standby {
+				log.Printf("Failover lease taken over as %s", config.ReplicaID)
+			}
+			return nil
+		case !standby:
+			log.Printf("Standing by as %s, %s holds the failover lease until %s",
+				config.ReplicaID, lease.Holder, lease.Expires.Format(time.RFC3339))
+			standby = true
+		}
+
+		timer := clock.NewTimer(ttl / 3)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// acquireLease takes the failover lease for the storage of a starting bot,
+// before it is loaded, so saves fail once another replica takes it over.
+func acquireLease(config Config, store *storage.Store, now time.Time) error {
+	lease, err := store.AcquireLease(config.ReplicaID, time.Duration(config.FailoverLease), now)
+	if err != nil {
+		return err
+	}
+	if lease.Holder != config.ReplicaID {
+		return fmt.Errorf("%w: %s until %s", storage.ErrLeaseHeld, lease.Holder, lease.Expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// runLease renews the failover lease every third of FAILOVER_LEASE, and
+// stops the bot through stop when another replica took it over, or when it
+// could not be renewed for two thirds of it, before a standby may take over.
+func (b *Bot) runLease(ctx context.Context, stop context.CancelFunc) {
+	config := b.cfg()
+	ttl := time.Duration(config.FailoverLease)
+	if ttl == 0 {
+		return
+	}
+	renewed := b.clock.Now()
+	ticker := b.clock.NewTicker(ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		now := b.clock.Now()
+		lease, err := b.storage.AcquireLease(config.ReplicaID, ttl, now)
+		switch {
+		case err == nil && lease.Holder == config.ReplicaID:
+			renewed = now
+			continue
+		case err == nil:
+			b.event(EventWarning, "%s took over the failover lease, stopping %s", lease.Holder, config.ReplicaID)
+		case now.Sub(renewed) < ttl*2/3:
+			log.Printf("Error renewing the failover lease: %v", err)
+			continue
+		default:
+			b.event(EventWarning, "Failed to renew the failover lease since %s, stopping %s before a standby takes over: %v",
+				renewed.Format(time.RFC3339), config.ReplicaID, err)
+		}
+		b.leaseLost.Store(true)
+		stop()
+		return
+	}
+}
+
+// LeaseLost reports whether the bot stopped because it lost the failover
+// lease.
+func (b *Bot) LeaseLost() bool {
+	return b.leaseLost.Load()
+}
+
+// releaseLease gives up the failover lease on shutdown, so a standby takes
+// over at once.
+func (b *Bot) releaseLease() {
+	config := b.cfg()
+	if config.FailoverLease == 0 || b.leaseLost.Load() {
+		return
+	}
+	if err := b.storage.ReleaseLease(config.ReplicaID); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Faults are the rates, from 0 to 1, at which faults are injected to
+// exercise the retry, degradation and reconciliation paths in staging. They
+// are set with the hidden -chaos-* flags of the binary, never by the config.
+type Faults struct {
+	// Telegram answers Telegram requests with a 429 or a 500, half each,
+	// without sending them.
+	Telegram float64
+	// HN fails HN requests with a timeout without sending them.
+	HN float64
+	// Storage fails storage saves without writing.
+	Storage float64
+}
+
+// ErrInjectedFault is the cause of the errors injected by Faults.
+var ErrInjectedFault = errors.New("injected fault")
+
+func (f Faults) enabled() bool {
+	return f.Telegram > 0 || f.HN > 0 || f.Storage > 0
+}
+
+func (f Faults) String() string {
+	return fmt.Sprintf("telegram=%g hn=%g storage=%g", f.Telegram, f.HN, f.Storage)
+}
+
+func (f Faults) validate() error {
+	for name, rate := range map[string]float64{"telegram": f.Telegram, "hn": f.HN, "storage": f.Storage} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("%s fault rate must be between 0 and 1, got %g", name, rate)
+		}
+	}
+	return nil
+}
+
+// hit reports whether a fault is due at rate.
+func hit(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate
+}
+
+// inject is the outboundTransport hook answering a request to upstream with
+// an injected fault, or returning nil, nil to send it.
+func (f Faults) inject(upstream string, req *http.Request) (*http.Response, error) {
+	switch {
+	case upstream == UpstreamTelegram && hit(f.Telegram):
+		if rand.Intn(2) == 0 {
+			return faultResponse(req, http.StatusTooManyRequests,
+				`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1 (injected fault)","parameters":{"retry_after":1}}`), nil
+		}
+		return faultResponse(req, http.StatusInternalServerError,
+			`{"ok":false,"error_code":500,"description":"Internal Server Error (injected fault)"}`), nil
+	case upstream == UpstreamHN && hit(f.HN):
+		return nil, fmt.Errorf("%w: %w", ErrInjectedFault, os.ErrDeadlineExceeded)
+	}
+	return nil, nil
+}
+
+func faultResponse(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// saveFault is the storage SaveFault hook.
+func (f Faults) saveFault() error {
+	if hit(f.Storage) {
+		return ErrInjectedFault
+	}
+	return nil
+}
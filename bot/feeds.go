@@ -0,0 +1,127 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// FeedConfig is an HN story list polled besides the top list. Its stories are
+// posted to ChatID once they pass its thresholds, and are kept while they
+// are on the list, like those of the top list.
+type FeedConfig struct {
+	Name              string `json:"name" yaml:"name" toml:"name"`
+	ChatID            string `json:"chat_id" yaml:"chat_id" toml:"chat_id"`
+	BatchSize         int    `json:"batch_size,omitempty" yaml:"batch_size,omitempty" toml:"batch_size,omitempty"`
+	ScoreThreshold    int64  `json:"score_threshold" yaml:"score_threshold" toml:"score_threshold"`
+	CommentsThreshold int64  `json:"comments_threshold" yaml:"comments_threshold" toml:"comments_threshold"`
+	Disabled          bool   `json:"disabled,omitempty" yaml:"disabled,omitempty" toml:"disabled,omitempty"`
+}
+
+func (f FeedConfig) String() string {
+	if f.Disabled {
+		return fmt.Sprintf("%s (disabled)", f.Name)
+	}
+	return fmt.Sprintf("%s to %s (batch %d, score %d, comments %d)", f.Name, f.ChatID, f.BatchSize, f.ScoreThreshold, f.CommentsThreshold)
+}
+
+// addFeeds adds the feeds of the config file, with a route limited to its
+// list for each enabled one.
+func (c *Config) addFeeds(feeds []FeedConfig) error {
+	for i := range feeds {
+		feed := &feeds[i]
+		if !slices.Contains(hn.Lists, feed.Name) {
+			return fmt.Errorf("feeds: unknown feed %q, expected one of %v", feed.Name, hn.Lists)
+		}
+		if feed.ChatID == "" {
+			return fmt.Errorf("feeds: the %s feed needs a chat_id", feed.Name)
+		}
+		if feed.BatchSize == 0 {
+			feed.BatchSize = DefaultBatchSize
+		}
+		if feed.BatchSize < 1 || feed.BatchSize > MaxBatchSize {
+			return fmt.Errorf("feeds: batch_size of the %s feed must be between 1 and %d, got %d", feed.Name, MaxBatchSize, feed.BatchSize)
+		}
+		if feed.Disabled {
+			continue
+		}
+		c.Routes = append(c.Routes, filter.Route{
+			ChatID:            feed.ChatID,
+			ScoreThreshold:    feed.ScoreThreshold,
+			CommentsThreshold: feed.CommentsThreshold,
+			Feed:              feed.Name,
+		})
+	}
+	c.Feeds = feeds
+	return nil
+}
+
+// feedBatches returns the lists of the enabled feeds in config order, with
+// the largest batch size configured for each.
+func (c *Config) feedBatches() (lists []string, batches map[string]int) {
+	batches = make(map[string]int)
+	for _, feed := range c.Feeds {
+		if feed.Disabled {
+			continue
+		}
+		if _, ok := batches[feed.Name]; !ok {
+			lists = append(lists, feed.Name)
+		}
+		batches[feed.Name] = max(batches[feed.Name], feed.BatchSize)
+	}
+	return lists, batches
+}
+
+// pollFeeds fetches the lists of the enabled feeds and returns the stories
+// on them that are not among topStories, in order. The top feed reuses
+// topStories when its batch fits. A list that fails to load keeps its stories
+// from the last poll.
+func (b *Bot) pollFeeds(config *Config, topStories []int64) []int64 {
+	names, batches := config.feedBatches()
+	b.frontPageMutex.RLock()
+	previous := b.feedLists
+	b.frontPageMutex.RUnlock()
+
+	lists := make(map[string][]int64, len(names))
+	feeds := make(map[int64][]string)
+	seen := make(map[int64]bool, len(topStories))
+	for _, id := range topStories {
+		seen[id] = true
+	}
+	var extra []int64
+	for _, name := range names {
+		var ids []int64
+		var err error
+		if name == "top" && batches[name] <= config.BatchSize {
+			ids = topStories[:min(batches[name], len(topStories))]
+		} else if ids, err = b.hn.Stories(name, batches[name]); err != nil {
+			b.count(storage.Counters{APIErrors: 1})
+			log.Printf("Error getting the %s feed, keeping its last list: %v", name, err)
+			ids = previous[name]
+		}
+		lists[name] = ids
+		for _, id := range ids {
+			feeds[id] = append(feeds[id], name)
+			if !seen[id] {
+				seen[id] = true
+				extra = append(extra, id)
+			}
+		}
+	}
+
+	b.frontPageMutex.Lock()
+	b.feedLists, b.feeds = lists, feeds
+	b.frontPageMutex.Unlock()
+	return extra
+}
+
+// storyFeeds returns the feeds the story was on at the last poll.
+func (b *Bot) storyFeeds(id int64) []string {
+	b.frontPageMutex.RLock()
+	defer b.frontPageMutex.RUnlock()
+	return slices.Clone(b.feeds[id])
+}
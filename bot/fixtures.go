@@ -0,0 +1,166 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+)
+
+const (
+	DefaultFixturesDir     = "fixtures"
+	DefaultFixtureStories  = 30
+	DefaultFixtureComments = 20
+)
+
+// RunFixtures implements `fixtures capture`, which snapshots the live top
+// list with its stories and their comments into a directory laid out like the
+// HN API: topstories.json and item/<id>.json. Every file is normalized to
+// indented JSON with sorted keys, so that refreshing the fixtures gives small
+// diffs, and items no longer captured are removed. An hn.Client pointed at an
+// http.FileServer of the directory reads the fixtures like the live API.
+func RunFixtures(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "capture" {
+		return errors.New("usage: fixtures capture [--dir=fixtures] [--stories=30] [--comments=20]")
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("fixtures capture", flag.ContinueOnError)
+	dir := flags.String("dir", DefaultFixturesDir, "directory to write the fixtures to")
+	stories := flags.Int("stories", DefaultFixtureStories, "number of top stories to capture")
+	comments := flags.Int("comments", DefaultFixtureComments, "comments to capture per story")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *stories <= 0 || *comments < 0 {
+		return errors.New("--stories must be positive and --comments must not be negative")
+	}
+
+	transport, _ := config.Network.transport(config.CacheSize)
+	client := hn.NewClient(&http.Client{Timeout: DefaultTimeout, Transport: transport})
+	ids, err := client.TopStories(*stories)
+	if err != nil {
+		return err
+	}
+	if len(ids) > *stories {
+		ids = ids[:*stories]
+	}
+
+	itemDir := filepath.Join(*dir, "item")
+	if err := os.MkdirAll(itemDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create fixtures directory: %w", err)
+	}
+	top, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	if err := writeFixture(filepath.Join(*dir, "topstories.json"), top); err != nil {
+		return err
+	}
+
+	captured := make(map[string]bool)
+	total := 0
+	for _, id := range ids {
+		n, err := captureStory(client, itemDir, id, *comments, captured)
+		if err != nil {
+			return err
+		}
+		total += n
+	}
+
+	entries, err := os.ReadDir(itemDir)
+	if err != nil {
+		return fmt.Errorf("failed to read fixtures directory: %w", err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") && !captured[entry.Name()] {
+			if err := os.Remove(filepath.Join(itemDir, entry.Name())); err != nil {
+				return fmt.Errorf("failed to remove stale fixture: %w", err)
+			}
+			removed++
+		}
+	}
+	fmt.Fprintf(out, "Captured %d stories and %d comments to %s, removed %d stale items\n", len(ids), total, *dir, removed)
+	return nil
+}
+
+// captureStory writes the story and the comments the bot would read for it
+// to dir: the first limit live comments in the order of hn.Client.Comments,
+// together with the deleted, dead and null ones fetched on the way. It
+// returns the number of live comments.
+func captureStory(client *hn.Client, dir string, id int64, limit int, captured map[string]bool) (int, error) {
+	story, err := captureItem(client, dir, id, captured)
+	if err != nil {
+		return 0, err
+	}
+	live := 0
+	queue := append([]int64(nil), story.Kids...)
+	for fetches := 0; len(queue) > 0 && live < limit && fetches < hn.MaxCommentFetches; fetches++ {
+		comment, err := captureItem(client, dir, queue[0], captured)
+		queue = queue[1:]
+		if err != nil {
+			return live, err
+		}
+		if comment.ID == 0 || comment.Deleted || comment.Dead {
+			continue
+		}
+		live++
+		queue = append(queue, comment.Kids...)
+	}
+	return live, nil
+}
+
+// captureItem fetches and writes an item, returning the fields needed to
+// follow its comments. Those are zero for null items and items that don't
+// decode, which are written as they are.
+func captureItem(client *hn.Client, dir string, id int64, captured map[string]bool) (hn.Item, error) {
+	data, err := client.RawItem(id)
+	if err != nil {
+		return hn.Item{}, err
+	}
+	name := strconv.FormatInt(id, 10) + ".json"
+	if err := writeFixture(filepath.Join(dir, name), data); err != nil {
+		return hn.Item{}, err
+	}
+	captured[name] = true
+
+	var item hn.Item
+	json.Unmarshal(data, &item)
+	return item, nil
+}
+
+// writeFixture writes data, which is JSON, normalized to indented JSON with
+// sorted keys and unescaped HTML.
+func writeFixture(path string, data []byte) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		return fmt.Errorf("failed to write fixture: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// RankChange is a story's move on the top list between two polls. Ranks
+// start at 1; 0 means off the list.
+type RankChange struct {
+	ID   int64
+	From int
+	To   int
+}
+
+func (c RankChange) String() string {
+	switch {
+	case c.From == 0:
+		return fmt.Sprintf("story %d entered at #%d", c.ID, c.To)
+	case c.To == 0:
+		return fmt.Sprintf("story %d fell from #%d to off-list", c.ID, c.From)
+	case c.To < c.From:
+		return fmt.Sprintf("story %d rose from #%d to #%d", c.ID, c.From, c.To)
+	default:
+		return fmt.Sprintf("story %d fell from #%d to #%d", c.ID, c.From, c.To)
+	}
+}
+
+// ScoreChange is a change of a story's score between two polls.
+type ScoreChange struct {
+	ID   int64
+	From int64
+	To   int64
+}
+
+// FrontPageDiff is the difference between two consecutive snapshots of the
+// top list, which drives a poll: the stories on the list are processed at
+// their rank, the ones that left it start expiring. Score changes are only
+// known once the stories are fetched and are added while they are processed.
+type FrontPageDiff struct {
+	// Ranks maps the stories on the current list onto their rank.
+	Ranks map[int64]int
+
+	Entered []RankChange
+	Left    []RankChange
+	Moved   []RankChange
+
+	mutex  sync.Mutex
+	scores []ScoreChange
+}
+
+// diffFrontPage compares the ranks of the previous poll with the current top
+// list.
+func diffFrontPage(previous map[int64]int, current []int64) *FrontPageDiff {
+	diff := &FrontPageDiff{Ranks: make(map[int64]int, len(current))}
+	for i, id := range current {
+		rank := i + 1
+		diff.Ranks[id] = rank
+		switch from := previous[id]; {
+		case from == 0:
+			diff.Entered = append(diff.Entered, RankChange{ID: id, To: rank})
+		case from != rank:
+			diff.Moved = append(diff.Moved, RankChange{ID: id, From: from, To: rank})
+		}
+	}
+	for id, from := range previous {
+		if _, ok := diff.Ranks[id]; !ok {
+			diff.Left = append(diff.Left, RankChange{ID: id, From: from})
+		}
+	}
+	sort.Slice(diff.Left, func(i, j int) bool { return diff.Left[i].From < diff.Left[j].From })
+	return diff
+}
+
+// scoreChanged records the change of a story's score found while processing
+// it.
+func (d *FrontPageDiff) scoreChanged(id, from, to int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.scores = append(d.scores, ScoreChange{ID: id, From: from, To: to})
+}
+
+// ScoreChanged returns the score changes recorded so far.
+func (d *FrontPageDiff) ScoreChanged() []ScoreChange {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return append([]ScoreChange(nil), d.scores...)
+}
+
+func (d *FrontPageDiff) String() string {
+	return fmt.Sprintf("%d entered, %d left, %d moved, %d scores changed",
+		len(d.Entered), len(d.Left), len(d.Moved), len(d.ScoreChanged()))
+}
+
+// logFrontPage logs every story that entered, left or moved on the top list,
+// followed by a summary of the diff.
+func logFrontPage(diff *FrontPageDiff) {
+	var changes []string
+	for _, group := range [][]RankChange{diff.Entered, diff.Left, diff.Moved} {
+		for _, change := range group {
+			changes = append(changes, change.String())
+		}
+	}
+	for _, change := range changes {
+		log.Printf("Front page: %s", change)
+	}
+	if len(changes) > 0 || len(diff.ScoreChanged()) > 0 {
+		log.Printf("Front page: %s", diff)
+	}
+}
+
+// previousRanks returns the ranks the tracked stories had at the last poll.
+func (b *Bot) previousRanks() map[int64]int {
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+
+	ranks := make(map[int64]int)
+	for id, story := range b.storage.Stories {
+		if story.Rank > 0 {
+			ranks[id] = story.Rank
+		}
+	}
+	return ranks
+}
+
+// snapshot records the top list with the scores found by the poll, at most
+// once per storage.SnapshotInterval.
+func (b *Bot) snapshot(topStories []int64) {
+	snapshot := storage.Snapshot{Time: b.clock.Now()}
+	b.storage.RLock()
+	for i, id := range topStories {
+		if story, ok := b.storage.Stories[id]; ok {
+			snapshot.Stories = append(snapshot.Stories, storage.SnapshotStory{
+				ID:       id,
+				Rank:     i + 1,
+				Score:    story.Score,
+				Comments: story.Descendants,
+			})
+		}
+	}
+	b.storage.RUnlock()
+
+	if !b.storage.RecordSnapshot(snapshot) {
+		return
+	}
+	if err := b.storage.Save(); err != nil {
+		log.Printf("Error saving front page snapshot: %v", err)
+	}
+}
+
+// peakRanks returns the best rank each story reached in the snapshots taken
+// since from.
+func peakRanks(store *storage.Store, from time.Time) map[int64]int {
+	peaks := make(map[int64]int)
+	for _, snapshot := range store.SnapshotsSince(from) {
+		for _, story := range snapshot.Stories {
+			if peak, ok := peaks[story.ID]; !ok || story.Rank < peak {
+				peaks[story.ID] = story.Rank
+			}
+		}
+	}
+	return peaks
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// combineGroup looks for a recently posted story about the same ongoing
+// event as the story, which is about to be posted, and reports whether the
+// story was added to that story's message instead. The group is kept with the
+// story; it is posted on its own once the first story's messages are gone.
+func (b *Bot) combineGroup(config *Config, story *storage.Story) bool {
+	if config.StoryGroups == "" {
+		return false
+	}
+	if story.GroupOf == 0 {
+		first, ok := b.findGroup(story)
+		if !ok {
+			return false
+		}
+		story.GroupOf = first
+		log.Printf("Story %d covers the same event as story %d", story.ID, first)
+	}
+	if config.StoryGroups != GroupCombine {
+		return false
+	}
+
+	// The first story is tracked and never calls into other actors, so
+	// waiting for it cannot deadlock
+	combined := false
+	b.actors.do(story.GroupOf, func() {
+		combined = b.addToGroup(story.GroupOf, story)
+	})
+	return combined
+}
+
+// findGroup returns the story a group with the story starts with: the
+// earliest tracked story posted within StoryGroupWindow whose title shares
+// StoryGroupTerms significant words with the story's, or the story that
+// one was grouped with.
+func (b *Bot) findGroup(story *storage.Story) (int64, bool) {
+	now := b.clock.Now()
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+
+	var first *storage.Story
+	for id, other := range b.storage.Stories {
+		if id == story.ID || len(other.Messages) == 0 || now.Sub(other.FirstSeen) > StoryGroupWindow {
+			continue
+		}
+		if filter.SharedTerms(story.Title, other.Title) < StoryGroupTerms {
+			continue
+		}
+		if first == nil || other.FirstSeen.Before(first.FirstSeen) ||
+			(other.FirstSeen.Equal(first.FirstSeen) && other.ID < first.ID) {
+			first = other
+		}
+	}
+	if first == nil {
+		return 0, false
+	}
+	if root, ok := b.storage.Stories[first.GroupOf]; ok && len(root.Messages) > 0 {
+		return root.ID, true
+	}
+	return first.ID, true
+}
+
+// addToGroup adds the story to the developing story of the story with the
+// given ID and edits its messages, reporting false when it has none left.
+// It runs on the first story's actor.
+func (b *Bot) addToGroup(id int64, story *storage.Story) bool {
+	first, exists := b.getStoredStory(id)
+	if !exists || len(first.Messages) == 0 {
+		return false
+	}
+	related := storage.RelatedStory{ID: story.ID, Title: story.Title, URL: story.URL}
+	i := slices.IndexFunc(first.Developing, func(r storage.RelatedStory) bool { return r.ID == story.ID })
+	if i >= 0 && first.Developing[i] == related {
+		return true
+	}
+	if i >= 0 {
+		first.Developing[i] = related
+	} else {
+		first.Developing = append(first.Developing, related)
+		log.Printf("Added story %d to the developing story %d", story.ID, id)
+	}
+	if !b.degraded(DegradeNoEdits) {
+		// Otherwise caught up once edits resume
+		b.refreshMessages(first)
+	}
+	if err := b.saveStory(first); err != nil {
+		log.Printf("Error saving developing story %d: %v", id, err)
+	}
+	return true
+}
+
+// developingLines lists the stories added to the story's message, one link
+// per line under a header, or returns "".
+func developingLines(s *storage.Story, lang string) string {
+	if len(s.Developing) == 0 {
+		return ""
+	}
+	lines := []string{tr(lang, "developing")}
+	for _, related := range s.Developing {
+		link := related.URL
+		if link == "" {
+			link = hn.ItemURL(related.ID)
+		}
+		lines = append(lines, fmt.Sprintf(`• <a href="%s">%s</a> (<a href="%s">HN</a>)`,
+			html.EscapeString(link), html.EscapeString(related.Title), hn.ItemURL(related.ID)))
+	}
+	return strings.Join(lines, "\n")
+}
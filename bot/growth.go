@@ -0,0 +1,125 @@
+package bot
+
+import (
+	"context"
+	"html"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// MemberCountSchedule is when the member counts of the posting chats are
+// recorded while the growth report is on.
+const MemberCountSchedule = "55 23 * * *"
+
+// runMemberCounts records the member counts of the posting chats every day
+// while the growth report is on.
+func (b *Bot) runMemberCounts(ctx context.Context) {
+	b.runScheduled(ctx, "member counts", func(config Config) string {
+		if !config.GrowthReport {
+			return ""
+		}
+		return MemberCountSchedule
+	}, func() { b.recordMemberCounts() })
+}
+
+// runGrowthReport posts the growth report to ADMIN_CHAT_ID on
+// GROWTH_SCHEDULE.
+func (b *Bot) runGrowthReport(ctx context.Context) {
+	b.runScheduled(ctx, "growth report", func(config Config) string {
+		if !config.GrowthReport {
+			return ""
+		}
+		return config.GrowthSchedule
+	}, b.growthReport)
+}
+
+// storyChats are the chats stories are posted to, CHAT_ID first.
+func (c *Config) storyChats() []string {
+	chats := []string{c.ChatID}
+	for _, route := range c.Routes {
+		if !slices.Contains(chats, route.ChatID) {
+			chats = append(chats, route.ChatID)
+		}
+	}
+	return chats
+}
+
+// recordMemberCounts records the current member count of every posting chat
+// and returns the chats it failed for.
+func (b *Bot) recordMemberCounts() []string {
+	config := b.cfg()
+	var failed []string
+	for _, chatID := range config.storyChats() {
+		var count int64
+		if err := b.tg.Call("getChatMemberCount", telegram.GetChatMemberCountRequest{ChatID: chatID}, &count); err != nil {
+			log.Printf("Error getting the member count of %s: %v", chatID, err)
+			failed = append(failed, chatID)
+			continue
+		}
+		b.storage.RecordMemberCount(chatID, count, b.clock.Now())
+	}
+	if err := b.storage.Save(); err != nil {
+		log.Printf("Error saving member counts: %v", err)
+	}
+	return failed
+}
+
+// growthReport posts the member counts of the posting chats, their change
+// over the last week and four weeks, and the stories of the last week.
+func (b *Bot) growthReport() {
+	failed := b.recordMemberCounts()
+	config := b.cfg()
+	lang := config.language(config.AdminChatID)
+	now := b.clock.Now().In(config.location())
+	weekAgo := now.AddDate(0, 0, -7)
+
+	lines := []string{tr(lang, "growth_header", weekAgo.Format(time.DateOnly), now.Format(time.DateOnly)), ""}
+	for _, chatID := range config.storyChats() {
+		current, ok := b.storage.MemberCountOn(chatID, now)
+		if !ok || slices.Contains(failed, chatID) {
+			lines = append(lines, tr(lang, "growth_unavailable", html.EscapeString(chatID)))
+			continue
+		}
+		line := tr(lang, "growth_chat", html.EscapeString(chatID), current.Count)
+		for _, change := range []struct {
+			since time.Time
+			key   string
+		}{
+			{weekAgo, "growth_week"},
+			{now.AddDate(0, 0, -28), "growth_four_weeks"},
+		} {
+			if then, ok := b.storage.MemberCountOn(chatID, change.since); ok {
+				line += ", " + tr(lang, change.key, current.Count-then.Count)
+			}
+		}
+		lines = append(lines, line)
+	}
+
+	var week storage.Counters
+	since := weekAgo.UTC().Format(time.DateOnly)
+	for _, day := range b.storage.MetricsSnapshot().Days {
+		if day.Date > since {
+			week.Posted += day.Posted
+			week.Edited += day.Edited
+			week.Deleted += day.Deleted
+		}
+	}
+	lines = append(lines, "", tr(lang, "growth_stories", week.Posted, week.Edited, week.Deleted))
+
+	req := telegram.SendMessageRequest{
+		ChatID:              config.AdminChatID,
+		Text:                strings.Join(lines, "\n"),
+		ParseMode:           "HTML",
+		DisableNotification: true,
+	}
+	if err := b.tg.Call("sendMessage", req, nil); err != nil {
+		b.event(EventWarning, "Growth report failed: %v", err)
+		return
+	}
+	log.Printf("Posted growth report")
+}
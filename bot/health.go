@@ -0,0 +1,26 @@
+package bot
+
+import "fmt"
+
+// RunHealth implements `health`, the container health check. It fails when
+// the data file of the configured backend, DATA_PATH or the backend's default
+// file in STATE_DIR, has not been created yet by the bot, or with Redis when
+// the server can't be reached or holds no storage yet.
+func RunHealth(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("health takes no arguments")
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	path := config.backendPath(config.StorageBackend)
+	exists, err := backendExists(config.StorageBackend, path)
+	if err != nil {
+		return fmt.Errorf("no data file: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("no data file: %s holds no storage yet", redactURL(path))
+	}
+	return nil
+}
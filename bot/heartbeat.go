@@ -0,0 +1,52 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// runHeartbeat posts a heartbeat to every chat stories are posted to on
+// HEARTBEAT_SCHEDULE.
+func (b *Bot) runHeartbeat(ctx context.Context) {
+	failing := make(map[string]bool)
+	b.runScheduled(ctx, "heartbeat", func(config Config) string {
+		return config.HeartbeatSchedule
+	}, func() { b.heartbeat(failing) })
+}
+
+// heartbeat posts a silent message to every chat stories are posted to and
+// deletes it right away, to find out that the bot lost the right to post
+// before the next story fails to go out. Chats it fails for are reported to
+// the admin chat on every run, and once again when they recover; failing
+// holds them between runs.
+func (b *Bot) heartbeat(failing map[string]bool) {
+	config := b.cfg()
+	for _, chatID := range config.storyChats() {
+		msg, err := b.tg.SendMessage(telegram.SendMessageRequest{
+			ChatID:              chatID,
+			Text:                tr(config.language(chatID), "heartbeat"),
+			DisableNotification: true,
+		})
+		switch {
+		case errors.Is(err, ErrBudgetExhausted):
+			log.Printf("Skipped the heartbeat to %s: %v", chatID, err)
+			continue
+		case err != nil:
+			failing[chatID] = true
+			b.event(EventWarning, "Heartbeat to %s failed, stories may not be posted there: %v", chatID, err)
+			continue
+		case failing[chatID]:
+			delete(failing, chatID)
+			b.event(EventInfo, "Heartbeat to %s succeeded again", chatID)
+		default:
+			log.Printf("Heartbeat to %s succeeded", chatID)
+		}
+
+		if err := b.tg.DeleteMessage(chatID, msg.MessageID); err != nil {
+			b.event(EventWarning, "Heartbeat posted to %s but not deleted, check the \"Delete messages\" permission of the bot: %v", chatID, err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+var storyTransitions = map[storage.State][]storage.State{
+	"":                      {storage.StateCandidate, storage.StatePending, storage.StateQueued, storage.StatePosted, storage.StateSuppressed},
+	storage.StateCandidate:  {storage.StatePending, storage.StateQueued, storage.StatePosted, storage.StateDeleted, storage.StateSuppressed},
+	storage.StateQueued:     {storage.StateCandidate, storage.StatePosted, storage.StateDeleted, storage.StateSuppressed},
+	storage.StatePending:    {storage.StatePosted, storage.StateDeleted, storage.StateSuppressed},
+	storage.StatePosted:     {storage.StateUpdating, storage.StateDormant, storage.StateExpiring, storage.StateSuppressed},
+	storage.StateUpdating:   {storage.StateDormant, storage.StateExpiring, storage.StateSuppressed},
+	storage.StateDormant:    {storage.StateUpdating, storage.StateExpiring, storage.StateSuppressed},
+	storage.StateExpiring:   {storage.StateUpdating, storage.StateDormant, storage.StateArchived, storage.StateDeleted, storage.StateSuppressed},
+	storage.StateSuppressed: {storage.StatePosted, storage.StateDeleted},
+}
+
+// TransitionHook is called after a story changed state. Hooks run
+// synchronously, possibly with the storage lock held, and must not block.
+type TransitionHook func(story *storage.Story, from, to storage.State)
+
+func canTransition(from, to storage.State) bool {
+	for _, allowed := range storyTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OnTransition registers a hook that runs after every state change.
+func (b *Bot) OnTransition(hook TransitionHook) {
+	b.hooks = append(b.hooks, hook)
+}
+
+// transition moves story to the given state and runs the registered hooks.
+// Moving to the current state is a no-op.
+func (b *Bot) transition(story *storage.Story, to storage.State) error {
+	from := story.State
+	if from == to {
+		return nil
+	}
+	if !canTransition(from, to) {
+		return fmt.Errorf("invalid state transition for story %d: %q -> %q", story.ID, from, to)
+	}
+
+	story.State = to
+	for _, hook := range b.hooks {
+		hook(story, from, to)
+	}
+	return nil
+}
+
+func logTransition(story *storage.Story, from, to storage.State) {
+	if from == "" {
+		from = "new"
+	}
+	log.Printf("Story %d: %s -> %s", story.ID, from, to)
+}
+
+// stateCounts returns the number of tracked stories in each state.
+func (b *Bot) stateCounts() map[storage.State]int {
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+
+	counts := make(map[storage.State]int)
+	for _, story := range b.storage.Stories {
+		counts[story.State]++
+	}
+	return counts
+}
+
+func formatStateCounts(counts map[storage.State]int) string {
+	parts := make([]string, 0, len(counts))
+	for state, n := range counts {
+		parts = append(parts, fmt.Sprintf("%s=%d", state, n))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
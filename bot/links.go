@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"strings"
+)
+
+// URLRewrite replaces every match of Match in a story's link with Replace,
+// which may refer to submatches as $1.
+type URLRewrite struct {
+	Match   string `json:"match" yaml:"match" toml:"match"`
+	Replace string `json:"replace" yaml:"replace" toml:"replace"`
+
+	pattern *regexp.Regexp
+}
+
+func (r URLRewrite) String() string {
+	return fmt.Sprintf("%s -> %s", r.Match, r.Replace)
+}
+
+func (r *URLRewrite) compile() error {
+	pattern, err := regexp.Compile(r.Match)
+	if err != nil {
+		return fmt.Errorf("url_rewrites: invalid match %q: %w", r.Match, err)
+	}
+	r.pattern = pattern
+	return nil
+}
+
+// validateReaderMirrors checks that every mirror is keyed by a bare domain
+// and expands to an http(s) URL.
+func validateReaderMirrors(mirrors map[string]string) error {
+	for domain, mirror := range mirrors {
+		if domain == "" || domain != strings.ToLower(domain) || strings.ContainsAny(domain, "/:") {
+			return fmt.Errorf("reader_mirrors: %q is not a lowercase domain", domain)
+		}
+		u, err := neturl.Parse(expandMirror(mirror, "https://example.com/", "example.com", "/"))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("reader_mirrors: mirror %q of %s is not an http(s) URL", mirror, domain)
+		}
+	}
+	return nil
+}
+
+func expandMirror(mirror, url, host, path string) string {
+	return strings.NewReplacer("{url}", url, "{host}", host, "{path}", path).Replace(mirror)
+}
+
+// linkURL is the link posted for a story, see links.
+func (c *Config) linkURL(url string) string {
+	link, _ := c.links(url)
+	return link
+}
+
+// links returns the link posted for a story: its URL after the rewrite rules
+// or, when its domain or a parent domain has a reader mirror, the mirror. In
+// that case original is the rewritten URL, shown as a button of its own.
+func (c *Config) links(url string) (link, original string) {
+	link = c.rewriteURL(url)
+	if len(c.ReaderMirrors) == 0 {
+		return link, ""
+	}
+	u, err := neturl.Parse(link)
+	if err != nil || u.Host == "" {
+		return link, ""
+	}
+	host := strings.ToLower(u.Hostname())
+	path := strings.TrimPrefix(link, u.Scheme+"://"+u.Host)
+	for domain := host; domain != ""; {
+		if mirror, ok := c.ReaderMirrors[domain]; ok {
+			return expandMirror(mirror, link, u.Host, path), link
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+	return link, ""
+}
+
+// rewriteURL applies the rewrite rules, in order, to a story's link. A "?"
+// or "&" left dangling at the end by removing query parameters is dropped.
+func (c *Config) rewriteURL(url string) string {
+	if len(c.URLRewrites) == 0 {
+		return url
+	}
+	rewritten := url
+	for _, rule := range c.URLRewrites {
+		if rule.pattern != nil {
+			rewritten = rule.pattern.ReplaceAllString(rewritten, rule.Replace)
+		}
+	}
+	if rewritten == url {
+		return url
+	}
+	return strings.TrimRight(rewritten, "?&")
+}
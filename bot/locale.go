@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// locales maps a language code to its user-facing strings, which are
+// fmt format strings. Missing strings fall back to English.
+var locales = mustLoadLocales()
+
+func mustLoadLocales() map[string]map[string]string {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	loaded := make(map[string]map[string]string)
+	for _, file := range files {
+		data, err := localeFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var strs map[string]string
+		if err := json.Unmarshal(data, &strs); err != nil {
+			panic(fmt.Sprintf("invalid locale file %s: %v", file.Name(), err))
+		}
+		loaded[strings.TrimSuffix(file.Name(), ".json")] = strs
+	}
+	return loaded
+}
+
+func languageNames() string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func validLanguage(lang string) error {
+	if _, ok := locales[lang]; !ok {
+		return fmt.Errorf("unknown language %q (available: %s)", lang, languageNames())
+	}
+	return nil
+}
+
+// tr formats the string key in lang.
+func tr(lang, key string, args ...any) string {
+	format, ok := locales[lang][key]
+	if !ok {
+		format = locales[DefaultLanguage][key]
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// formatDate formats t as a date the way lang writes dates, with the Go
+// time layout in its date_layout string.
+func formatDate(lang string, t time.Time) string {
+	return t.Format(tr(lang, "date_layout"))
+}
+
+// language returns the language of a chat, which may be known by several
+// IDs such as its numeric ID and @username. The first configured one wins.
+func (c *Config) language(chatIDs ...string) string {
+	for _, chatID := range chatIDs {
+		if lang, ok := c.ChatLanguages[chatID]; ok {
+			return lang
+		}
+	}
+	return c.Language
+}
+
+// chatLanguage returns the language of a chat a command came from.
+func (b *Bot) chatLanguage(chat telegram.Chat) string {
+	config := b.cfg()
+	if chat.Username != "" {
+		return config.language(chatIDString(chat), "@"+chat.Username)
+	}
+	return config.language(chatIDString(chat))
+}
@@ -0,0 +1,23 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDigestEmailSubjectFollowsLanguage(t *testing.T) {
+	from := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 9, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"en", "Hacker News digest, Mar 2, 2026 to Mar 9, 2026"},
+		{"zh", "Hacker News 摘要，2026年3月2日 至 2026年3月9日"},
+	}
+	for _, tt := range tests {
+		if got := tr(tt.lang, "digest_email_subject", formatDate(tt.lang, from), formatDate(tt.lang, to)); got != tt.want {
+			t.Errorf("subject in %s = %q, want %q", tt.lang, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// MaintenanceWindow is a time range, such as "2024-06-01T02:00/2024-06-01T04:00"
+// in TIMEZONE, during which the bot makes no changes in Telegram: it keeps
+// polling and tracking stories, and catches up once the window ends.
+type MaintenanceWindow struct {
+	Start, End time.Time
+}
+
+// ParseMaintenanceWindow parses a "start/end" range of timestamps as taken
+// by replay --from, in loc.
+func ParseMaintenanceWindow(s string, loc *time.Location) (MaintenanceWindow, error) {
+	from, to, ok := strings.Cut(s, "/")
+	if !ok {
+		return MaintenanceWindow{}, fmt.Errorf("maintenance window %q must look like 2024-06-01T02:00/2024-06-01T04:00", s)
+	}
+	var w MaintenanceWindow
+	var err error
+	if w.Start, err = parseTimestamp(strings.TrimSpace(from), loc); err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	if w.End, err = parseTimestamp(strings.TrimSpace(to), loc); err != nil {
+		return MaintenanceWindow{}, fmt.Errorf("invalid maintenance window %q: %w", s, err)
+	}
+	if !w.End.After(w.Start) {
+		return MaintenanceWindow{}, fmt.Errorf("maintenance window %q ends before it starts", s)
+	}
+	return w, nil
+}
+
+// maintenanceUntil returns the end of the maintenance window now is in, or
+// the zero time.
+func (c *Config) maintenanceUntil(now time.Time) time.Time {
+	for _, w := range c.maintenance {
+		if !now.Before(w.Start) && now.Before(w.End) {
+			return w.End
+		}
+	}
+	return time.Time{}
+}
+
+// inMaintenance reports whether now is in a maintenance window.
+func (c *Config) inMaintenance(now time.Time) bool {
+	return !c.maintenanceUntil(now).IsZero()
+}
+
+// inMaintenance reports whether a maintenance window is in effect now.
+func (b *Bot) inMaintenance() bool {
+	config := b.cfg()
+	return config.inMaintenance(b.clock.Now())
+}
+
+// checkMaintenance announces the start and the end of maintenance windows
+// at the start of a poll and reports whether one just ended. It runs under
+// cycleMutex.
+func (b *Bot) checkMaintenance() (ended bool) {
+	config := b.cfg()
+	until := config.maintenanceUntil(b.clock.Now())
+	switch {
+	case !until.IsZero() && !b.maintenance:
+		b.maintenance = true
+		b.event(EventInfo, "Maintenance window until %s: suspending posts, edits and deletions", until.In(config.location()).Format(time.RFC3339))
+	case until.IsZero() && b.maintenance:
+		b.maintenance = false
+		b.event(EventInfo, "Maintenance window ended, catching up")
+		return true
+	}
+	return false
+}
+
+// reconcile edits the messages whose text is out of date after a
+// maintenance window or once edits resume after degrading, such as those of
+// stories enriched in the meantime. Posts and
+// the edits of stories on the front page are caught up by the poll before
+// it, deletions by the cleanup.
+func (b *Bot) reconcile() {
+	b.storage.RLock()
+	var ids []int64
+	for id, story := range b.storage.Stories {
+		if len(story.Messages) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	b.storage.RUnlock()
+
+	refreshed := 0
+	for _, id := range ids {
+		b.actors.do(id, func() {
+			if b.refreshStale(id) {
+				refreshed++
+			}
+		})
+	}
+	if refreshed > 0 {
+		log.Printf("Refreshed the messages of %d out of date stories", refreshed)
+	}
+}
+
+// refreshStale edits the story's messages when the text of any of them is
+// out of date. It runs on the story's actor.
+func (b *Bot) refreshStale(id int64) bool {
+	story, exists := b.getStoredStory(id)
+	if !exists {
+		return false
+	}
+	config := b.cfg()
+	stale := false
+	for chatID, msg := range story.Messages {
+		stale = stale || msg.TextHash != textHash(messageText(story, config, chatID, b.storage.Settings(chatID)))
+	}
+	if !stale {
+		return false
+	}
+	b.refreshMessages(story)
+	if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving story %d: %v", id, err)
+	}
+	return true
+}
+
+// holdForMaintenance saves a story seen during a maintenance window without
+// touching its messages; new stories become candidates.
+func (b *Bot) holdForMaintenance(story *storage.Story) {
+	if story.State == "" {
+		if err := b.transition(story, storage.StateCandidate); err != nil {
+			log.Printf("Error tracking candidate story %d: %v", story.ID, err)
+			return
+		}
+	}
+	if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving story %d: %v", story.ID, err)
+	}
+}
@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// CacheStats is the fill of an in-memory cache bounded by CACHE_SIZE.
+type CacheStats struct {
+	Name    string `json:"name"`
+	Entries int    `json:"entries"`
+	Size    int    `json:"size"`
+}
+
+// MemoryStats is the memory use of the process reported by /stats and
+// /api/stats.
+type MemoryStats struct {
+	HeapAlloc uint64       `json:"heap_alloc"`
+	HeapSys   uint64       `json:"heap_sys"`
+	Sys       uint64       `json:"sys"`
+	NumGC     uint32       `json:"num_gc"`
+	Caches    []CacheStats `json:"caches"`
+}
+
+func (b *Bot) memoryStats() MemoryStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := MemoryStats{HeapAlloc: m.HeapAlloc, HeapSys: m.HeapSys, Sys: m.Sys, NumGC: m.NumGC}
+
+	if b.dns != nil {
+		stats.Caches = append(stats.Caches, b.dns.cacheStats())
+	}
+	entries, size := b.fetcher.RobotsCached()
+	stats.Caches = append(stats.Caches, CacheStats{Name: "robots", Entries: entries, Size: size})
+	stats.Caches = append(stats.Caches, b.outbound.cacheStats())
+	return stats
+}
+
+// cacheLine formats the caches as name=entries/size.
+func (s MemoryStats) cacheLine() string {
+	fields := make([]string, len(s.Caches))
+	for i, cache := range s.Caches {
+		fields[i] = fmt.Sprintf("%s=%d/%d", cache.Name, cache.Entries, cache.Size)
+	}
+	return strings.Join(fields, " ")
+}
+
+func megabytes(n uint64) float64 {
+	return float64(n) / (1 << 20)
+}
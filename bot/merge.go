@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"errors"
+	"log"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// takeMerged looks for a tracked story that HN merged into story, which is
+// not tracked yet: a posted story with the same link whose item is now dead,
+// deleted or null, as moderators leave duplicates. The merged story is removed
+// from storage and returned so that story takes over its messages.
+func (b *Bot) takeMerged(story *storage.Story) (*storage.Story, bool) {
+	if story.URL == "" {
+		return nil, false
+	}
+	key := storage.URLKey(story.URL)
+
+	b.storage.RLock()
+	var candidates []*storage.Story
+	for _, tracked := range b.storage.Stories {
+		if tracked.ID != story.ID && len(tracked.Messages) > 0 && tracked.URL != "" && storage.URLKey(tracked.URL) == key {
+			candidates = append(candidates, tracked.Clone())
+		}
+	}
+	b.storage.RUnlock()
+
+	for _, candidate := range candidates {
+		var merged *storage.Story
+		var ok bool
+		b.actors.do(candidate.ID, func() { merged, ok = b.takeIfMerged(story, candidate) })
+		if ok {
+			return merged, true
+		}
+	}
+	return nil, false
+}
+
+// takeIfMerged removes candidate from storage if its item is gone. It runs
+// on the candidate's actor, after the candidate's processing in the same poll.
+func (b *Bot) takeIfMerged(story, candidate *storage.Story) (*storage.Story, bool) {
+
+	item, err := b.hn.Item(candidate.ID)
+	if err != nil && !errors.Is(err, hn.ErrNullItem) {
+		log.Printf("Error checking whether story %d was merged into %d: %v", candidate.ID, story.ID, err)
+		return nil, false
+	}
+	if err == nil && !item.Dead && !item.Deleted {
+		return nil, false
+	}
+
+	b.storage.Lock()
+	stored, tracked := b.storage.Stories[candidate.ID]
+	delete(b.storage.Stories, candidate.ID)
+	b.storage.Unlock()
+	if !tracked {
+		return nil, false // cleaned up meanwhile
+	}
+	b.storage.MoveSends(candidate.ID, story.ID)
+	log.Printf("Story %d was merged into %d, moving its messages", candidate.ID, story.ID)
+	return stored.Clone(), true
+}
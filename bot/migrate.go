@@ -0,0 +1,132 @@
+package bot
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// RunMigrate implements `migrate --from=json --to=sqlite`, which copies all
+// tracked state between storage backends and verifies the copy. Paths are
+// files, except for Redis, where they are the URL of the server.
+func RunMigrate(args []string) error {
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := flags.String("from", storage.BackendJSON, "source backend (json, sqlite or redis)")
+	to := flags.String("to", storage.BackendSQLite, "target backend (json, sqlite or redis)")
+	fromPath := flags.String("from-path", "", "source path (default: REDIS_URL for redis, DATA_PATH for the configured backend, else the backend's default file in STATE_DIR)")
+	toPath := flags.String("to-path", "", "target path (default: REDIS_URL for redis, else the backend's default file in STATE_DIR)")
+	force := flags.Bool("force", false, "overwrite an existing target")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *from == *to {
+		return fmt.Errorf("--from and --to must name different backends")
+	}
+	if *fromPath == "" {
+		*fromPath = config.backendPath(*from)
+	}
+	if *toPath == "" && *to == storage.BackendRedis {
+		*toPath = config.RedisURL
+	} else if *toPath == "" {
+		*toPath = config.resolveStatePath(storage.DefaultFile(*to))
+	}
+
+	if exists, err := backendExists(*from, *fromPath); err != nil {
+		return fmt.Errorf("source %s: %w", redactURL(*fromPath), err)
+	} else if !exists {
+		return fmt.Errorf("source %s holds no storage", redactURL(*fromPath))
+	}
+	if exists, err := backendExists(*to, *toPath); err != nil {
+		return fmt.Errorf("target %s: %w", redactURL(*toPath), err)
+	} else if exists && !*force {
+		return fmt.Errorf("target %s already exists, use --force to overwrite it", redactURL(*toPath))
+	}
+
+	source, err := openStorageAt(config, *from, *fromPath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	if err := source.Load(); err != nil {
+		return fmt.Errorf("failed to load %s storage from %s: %w", *from, redactURL(*fromPath), err)
+	}
+
+	target, err := openStorageAt(config, *to, *toPath)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	target.Version = source.Version
+	target.Stories = source.Stories
+	target.Dropped = source.Dropped
+	target.Posted = source.Posted
+	target.Metrics = source.Metrics
+	target.UpdatesOffset = source.UpdatesOffset
+	if err := target.Save(); err != nil {
+		return fmt.Errorf("failed to write %s storage to %s: %w", *to, redactURL(*toPath), err)
+	}
+
+	// Read the target back through a fresh backend and compare story by story
+	check, err := openStorageAt(config, *to, *toPath)
+	if err != nil {
+		return err
+	}
+	defer check.Close()
+	if err := check.Load(); err != nil {
+		return fmt.Errorf("verification failed, cannot read back %s: %w", redactURL(*toPath), err)
+	}
+	if err := storage.Compare(source, check); err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+
+	fmt.Printf("Migrated %d stories (storage version %d) from %s %s to %s %s, verified\n",
+		len(source.Stories), source.Version, *from, redactURL(*fromPath), *to, redactURL(*toPath))
+	return nil
+}
+
+// backendExists reports whether the backend of kind holds storage at path:
+// whether the data file exists, or the Redis server has the storage.
+func backendExists(kind, path string) (bool, error) {
+	if kind == storage.BackendRedis {
+		return storage.RedisExists(path)
+	}
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func openStorageAt(config Config, kind, path string) (*storage.Store, error) {
+	opts := storage.Options{Backend: kind, Path: path}
+	if kind != storage.BackendSQLite {
+		opts.Key = config.StorageKey
+	}
+	return storage.Open(opts)
+}
+
+// backendPath returns where the given backend keeps its data for this config:
+// REDIS_URL for Redis and a file otherwise.
+func (c *Config) backendPath(kind string) string {
+	switch kind {
+	case "":
+		return ""
+	case storage.BackendRedis:
+		return c.RedisURL
+	case c.StorageBackend:
+		return c.DataPath
+	case c.DualWrite:
+		return c.DualWritePath
+	default:
+		return c.resolveStatePath(storage.DefaultFile(kind))
+	}
+}
@@ -0,0 +1,250 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	DefaultModerationTimeout = 2 * time.Hour
+
+	// What happens to a story nobody approved or rejected within the
+	// moderation timeout.
+	ModerationApprove = "approve"
+	ModerationExpire  = "expire"
+)
+
+// ModerationConfig holds stories that qualify for posting in the admin chat
+// until someone approves or rejects them.
+type ModerationConfig struct {
+	Enabled   *bool    `json:"enabled,omitempty" yaml:"enabled,omitempty" toml:"enabled,omitempty"`
+	Timeout   Duration `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+	OnTimeout string   `json:"on_timeout,omitempty" yaml:"on_timeout,omitempty" toml:"on_timeout,omitempty"`
+}
+
+func (c ModerationConfig) enabled() bool {
+	return c.Enabled != nil && *c.Enabled
+}
+
+func (c ModerationConfig) String() string {
+	if !c.enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("timeout=%v on_timeout=%s", time.Duration(c.Timeout), c.OnTimeout)
+}
+
+// merge overrides fields with the ones set in other.
+func (c *ModerationConfig) merge(other ModerationConfig) {
+	if other.Enabled != nil {
+		c.Enabled = other.Enabled
+	}
+	if other.Timeout != 0 {
+		c.Timeout = other.Timeout
+	}
+	if other.OnTimeout != "" {
+		c.OnTimeout = other.OnTimeout
+	}
+}
+
+func (c *ModerationConfig) applyEnv() error {
+	if enabled := os.Getenv("MODERATION"); enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("invalid MODERATION %q: %w", enabled, err)
+		}
+		c.Enabled = &b
+	}
+	if timeout := os.Getenv("MODERATION_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid MODERATION_TIMEOUT %q: %w", timeout, err)
+		}
+		c.Timeout = Duration(d)
+	}
+	c.merge(ModerationConfig{OnTimeout: os.Getenv("MODERATION_ON_TIMEOUT")})
+	return nil
+}
+
+func (c ModerationConfig) validate(adminChatID string) error {
+	if !c.enabled() {
+		return nil
+	}
+	if adminChatID == "" {
+		return fmt.Errorf("moderation requires ADMIN_CHAT_ID")
+	}
+	if time.Duration(c.Timeout) < time.Minute {
+		return fmt.Errorf("moderation timeout must be at least 1m, got %v", time.Duration(c.Timeout))
+	}
+	if c.OnTimeout != ModerationApprove && c.OnTimeout != ModerationExpire {
+		return fmt.Errorf("moderation on_timeout must be %q or %q, got %q", ModerationApprove, ModerationExpire, c.OnTimeout)
+	}
+	return nil
+}
+
+func (b *Bot) registerModeration() {
+	b.handleCallback("review:", b.reviewCallback)
+}
+
+// requestReview sends a story that qualifies for posting to the admin chat
+// with Approve and Reject buttons instead of posting it.
+func (b *Bot) requestReview(story *storage.Story, chats []string) {
+	config := b.cfg()
+	lang := config.language(config.AdminChatID)
+	id := strconv.FormatInt(story.ID, 10)
+	msg, err := b.tg.SendMessage(telegram.SendMessageRequest{
+		ChatID:    config.AdminChatID,
+		Text:      messageText(story, config, config.AdminChatID, storage.ChatSettings{}) + "\n\n" + tr(lang, "review_prompt", html.EscapeString(strings.Join(chats, ", "))),
+		ParseMode: "HTML",
+		ReplyMarkup: &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+			{Text: tr(lang, "review_approve_button"), CallbackData: "review:approve:" + id},
+			{Text: tr(lang, "review_reject_button"), CallbackData: "review:reject:" + id},
+		}}},
+		LinkPreviewOptions: &telegram.LinkPreviewOptions{IsDisabled: true},
+	})
+	if err != nil {
+		// Still new or a candidate, so the next poll asks again
+		b.count(storage.Counters{APIErrors: 1})
+		log.Printf("Error sending story %d for review: %v", story.ID, err)
+		return
+	}
+
+	story.ReviewMessage = msg.MessageID
+	story.ReviewSince = b.clock.Now()
+	if err := b.transition(story, storage.StatePending); err != nil {
+		log.Printf("Error tracking pending story %d: %v", story.ID, err)
+		return
+	}
+	if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving pending story %d: %v", story.ID, err)
+	}
+}
+
+// checkReview keeps a pending story up to date and decides it once the
+// moderation timeout has passed without a decision. An approved story that
+// could not be posted yet is posted again.
+func (b *Bot) checkReview(story *storage.Story, chats []string) {
+	config := b.cfg()
+	if story.ReviewMessage == 0 {
+		if len(chats) == 0 {
+			chats = []string{config.ChatID}
+		}
+		b.sendToChats(story, chats)
+		return
+	}
+
+	timeout := time.Duration(config.Moderation.Timeout)
+	if b.clock.Now().Sub(story.ReviewSince) < timeout {
+		if err := b.saveStory(story); err != nil {
+			log.Printf("Error saving pending story %d: %v", story.ID, err)
+		}
+		return
+	}
+
+	if config.Moderation.OnTimeout == ModerationApprove {
+		log.Printf("Story %d was not reviewed within %v, approving it", story.ID, timeout)
+		b.approve(story, chats, "review_auto_approved", timeout.String())
+	} else {
+		log.Printf("Story %d was not reviewed within %v, rejecting it", story.ID, timeout)
+		b.reject(story, "review_expired", timeout.String())
+	}
+}
+
+// reviewCallback handles "review:<approve|reject>:<id>" button presses in the
+// admin chat.
+func (b *Bot) reviewCallback(query *telegram.CallbackQuery, data string) {
+	config := b.cfg()
+	if query.Message == nil || !config.isAdminChat(query.Message.Chat) {
+		b.answerCallback(query, "")
+		return
+	}
+
+	action, idText, _ := strings.Cut(data, ":")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil || (action != "approve" && action != "reject") {
+		b.answerCallback(query, "")
+		return
+	}
+
+	// Serialize with polling, which also changes pending stories
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	b.actors.do(id, func() { b.decideReview(query, id, action) })
+}
+
+// decideReview approves or rejects a pending story. It runs on the story's
+// actor.
+func (b *Bot) decideReview(query *telegram.CallbackQuery, id int64, action string) {
+	config := b.cfg()
+	story, exists := b.getStoredStory(id)
+	if !exists || story.State != storage.StatePending {
+		b.answerCallback(query, tr(config.language(config.AdminChatID), "review_gone"))
+		return
+	}
+
+	who := html.EscapeString(displayName(query.From))
+	if action == "approve" {
+		log.Printf("Story %d approved by %s", id, who)
+		b.approve(story, b.destinations(&config, story), "review_approved", who)
+	} else {
+		log.Printf("Story %d rejected by %s", id, who)
+		b.reject(story, "review_rejected", who)
+	}
+	b.answerCallback(query, "")
+}
+
+// approve posts a pending story to chats, or to the main chat when it no
+// longer qualifies for any, and records the decision, the decisionKey
+// locale string with arg and the chats, in the admin chat.
+func (b *Bot) approve(story *storage.Story, chats []string, decisionKey, arg string) {
+	config := b.cfg()
+	if len(chats) == 0 {
+		chats = []string{config.ChatID}
+	}
+	lang := config.language(config.AdminChatID)
+	b.closeReview(story, tr(lang, decisionKey, arg, html.EscapeString(strings.Join(chats, ", "))))
+	story.ReviewMessage, story.ReviewSince = 0, time.Time{}
+	b.sendToChats(story, chats)
+}
+
+// reject suppresses a pending story, so it is not posted while tracked, and
+// records the decision in the admin chat.
+func (b *Bot) reject(story *storage.Story, decisionKey, arg string) {
+	config := b.cfg()
+	b.closeReview(story, tr(config.language(config.AdminChatID), decisionKey, arg))
+	story.ReviewMessage, story.ReviewSince = 0, time.Time{}
+	if err := b.transition(story, storage.StateSuppressed); err != nil {
+		log.Printf("Error rejecting story %d: %v", story.ID, err)
+		return
+	}
+	if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving rejected story %d: %v", story.ID, err)
+	}
+}
+
+// closeReview replaces the question and buttons of the review message with
+// the decision.
+func (b *Bot) closeReview(story *storage.Story, decision string) {
+	if story.ReviewMessage == 0 {
+		return
+	}
+	config := b.cfg()
+	req := telegram.EditMessageTextRequest{
+		ChatID:             config.AdminChatID,
+		MessageID:          story.ReviewMessage,
+		Text:               messageText(story, config, config.AdminChatID, storage.ChatSettings{}) + "\n\n" + decision,
+		ParseMode:          "HTML",
+		LinkPreviewOptions: &telegram.LinkPreviewOptions{IsDisabled: true},
+	}
+	if err := b.tg.Call("editMessageText", req, nil); err != nil {
+		log.Printf("Error updating review message of story %d: %v", story.ID, err)
+	}
+}
@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/lru"
+)
+
+const (
+	// IP preferences for outbound connections. Preferring a family tries its
+	// addresses first and falls back to the other family after
+	// DialFallbackDelay, while the "only" variants never use the other one.
+	IPAuto   = "auto"
+	IPv4     = "ipv4"
+	IPv6     = "ipv6"
+	IPv4Only = "ipv4only"
+	IPv6Only = "ipv6only"
+
+	// DialFallbackDelay is how long connecting to the preferred addresses
+	// may take before the other address family is tried in parallel.
+	DialFallbackDelay = 300 * time.Millisecond
+	DialTimeout       = 30 * time.Second
+	DNSTimeout        = 5 * time.Second
+)
+
+// NetworkConfig tunes how the bot connects to HN, Telegram and the other
+// services it calls. The zero value uses Go's defaults.
+type NetworkConfig struct {
+	IPPreference string   `json:"ip_preference,omitempty" yaml:"ip_preference,omitempty" toml:"ip_preference,omitempty"`
+	DNSCacheTTL  Duration `json:"dns_cache_ttl,omitempty" yaml:"dns_cache_ttl,omitempty" toml:"dns_cache_ttl,omitempty"`
+	DNSServer    string   `json:"dns_server,omitempty" yaml:"dns_server,omitempty" toml:"dns_server,omitempty"`
+}
+
+func (c NetworkConfig) isDefault() bool {
+	return (c.IPPreference == "" || c.IPPreference == IPAuto) && c.DNSCacheTTL == 0 && c.DNSServer == ""
+}
+
+func (c NetworkConfig) String() string {
+	if c.isDefault() {
+		return "default"
+	}
+	return fmt.Sprintf("ip_preference=%s dns_cache_ttl=%v dns_server=%q", c.IPPreference, time.Duration(c.DNSCacheTTL), c.DNSServer)
+}
+
+// merge overrides fields with the ones set in other.
+func (c *NetworkConfig) merge(other NetworkConfig) {
+	if other.IPPreference != "" {
+		c.IPPreference = other.IPPreference
+	}
+	if other.DNSCacheTTL != 0 {
+		c.DNSCacheTTL = other.DNSCacheTTL
+	}
+	if other.DNSServer != "" {
+		c.DNSServer = other.DNSServer
+	}
+}
+
+func (c *NetworkConfig) applyEnv() error {
+	if ttl := os.Getenv("DNS_CACHE_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid DNS_CACHE_TTL %q: %w", ttl, err)
+		}
+		c.DNSCacheTTL = Duration(d)
+	}
+	c.merge(NetworkConfig{
+		IPPreference: os.Getenv("IP_PREFERENCE"),
+		DNSServer:    os.Getenv("DNS_SERVER"),
+	})
+	return nil
+}
+
+func (c NetworkConfig) validate() error {
+	switch c.IPPreference {
+	case "", IPAuto, IPv4, IPv6, IPv4Only, IPv6Only:
+	default:
+		return fmt.Errorf("network ip_preference must be one of %s, %s, %s, %s or %s, got %q", IPAuto, IPv4, IPv6, IPv4Only, IPv6Only, c.IPPreference)
+	}
+	if c.DNSCacheTTL < 0 {
+		return fmt.Errorf("network dns_cache_ttl must not be negative, got %v", time.Duration(c.DNSCacheTTL))
+	}
+	if c.DNSServer != "" {
+		if _, _, err := net.SplitHostPort(c.DNSServer); err != nil {
+			return fmt.Errorf("network dns_server must look like 1.1.1.1:53: %w", err)
+		}
+	}
+	return nil
+}
+
+// transport returns the HTTP transport for the settings and its dialer, or
+// nil for Go's default one. The DNS cache holds up to cacheSize hosts.
+func (c NetworkConfig) transport(cacheSize int) (http.RoundTripper, *dialer) {
+	if c.isDefault() {
+		return nil, nil
+	}
+	d := &dialer{
+		config:   c,
+		dialer:   net.Dialer{Timeout: DialTimeout, KeepAlive: 30 * time.Second},
+		resolver: net.DefaultResolver,
+		cache:    lru.New[string, dnsEntry](cacheSize),
+	}
+	if c.DNSServer != "" {
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{Timeout: DNSTimeout}).DialContext(ctx, network, c.DNSServer)
+			},
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = d.DialContext
+	return transport, d
+}
+
+type dnsEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// dialer connects to hosts with the configured resolver, DNS cache and IP
+// preference.
+type dialer struct {
+	config   NetworkConfig
+	dialer   net.Dialer
+	resolver *net.Resolver
+
+	mutex sync.Mutex
+	cache *lru.Cache[string, dnsEntry]
+}
+
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || net.ParseIP(host) != nil {
+		return d.dialer.DialContext(ctx, network, address)
+	}
+
+	ips, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	primaries, fallbacks := d.order(ips)
+	if len(primaries) == 0 {
+		primaries, fallbacks = fallbacks, nil
+	}
+	if len(primaries) == 0 {
+		return nil, fmt.Errorf("no usable address for %s with ip_preference %s", host, d.config.IPPreference)
+	}
+	return d.dialParallel(ctx, network, port, primaries, fallbacks)
+}
+
+// lookup resolves host, from the cache while its entry is fresh.
+func (d *dialer) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	ttl := time.Duration(d.config.DNSCacheTTL)
+	if ttl > 0 {
+		d.mutex.Lock()
+		entry, ok := d.cache.Get(host)
+		d.mutex.Unlock()
+		if ok && time.Now().Before(entry.expires) {
+			return entry.ips, nil
+		}
+	}
+
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	if ttl > 0 {
+		d.mutex.Lock()
+		d.cache.Add(host, dnsEntry{ips: ips, expires: time.Now().Add(ttl)})
+		d.mutex.Unlock()
+	}
+	return ips, nil
+}
+
+// cacheStats returns the fill of the DNS cache.
+func (d *dialer) cacheStats() CacheStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return CacheStats{Name: "dns", Entries: d.cache.Len(), Size: d.cache.Size()}
+}
+
+// order splits ips into the addresses to try first and the ones to fall back
+// to, by the IP preference. Without one, the family of the first resolved
+// address goes first, like Go's own dialer.
+func (d *dialer) order(ips []net.IP) (primaries, fallbacks []net.IP) {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	switch d.config.IPPreference {
+	case IPv4:
+		return v4, v6
+	case IPv6:
+		return v6, v4
+	case IPv4Only:
+		return v4, nil
+	case IPv6Only:
+		return v6, nil
+	}
+	if len(ips) > 0 && ips[0].To4() == nil {
+		return v6, v4
+	}
+	return v4, v6
+}
+
+// dialParallel connects to the primaries one after another and starts on the
+// fallbacks when that takes longer than DialFallbackDelay or fails. The first
+// connection made wins.
+func (d *dialer) dialParallel(ctx context.Context, network, port string, primaries, fallbacks []net.IP) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return d.dialSerial(ctx, network, port, primaries)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	start := func(ips []net.IP) {
+		go func() {
+			conn, err := d.dialSerial(ctx, network, port, ips)
+			results <- result{conn, err}
+		}()
+	}
+
+	start(primaries)
+	pending, fallbackStarted := 1, false
+	timer := time.NewTimer(DialFallbackDelay)
+	defer timer.Stop()
+
+	var errs []error
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				start(fallbacks)
+				pending, fallbackStarted = pending+1, true
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Close a connection the other attempt makes after all
+				if pending > 0 {
+					go func() {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}()
+				}
+				return r.conn, nil
+			}
+			errs = append(errs, r.err)
+			if !fallbackStarted {
+				start(fallbacks)
+				pending, fallbackStarted = pending+1, true
+			} else if pending == 0 {
+				return nil, errors.Join(errs...)
+			}
+		}
+	}
+}
+
+func (d *dialer) dialSerial(ctx context.Context, network, port string, ips []net.IP) (net.Conn, error) {
+	var errs []error
+	for _, ip := range ips {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
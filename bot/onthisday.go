@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	OnThisDayFile     = "on_this_day"
+	OnThisDayStories  = 3 // stories per year
+	onThisDayDateForm = "2006-01-02"
+)
+
+// OnThisDayYears are how many years back the retrospective looks.
+var OnThisDayYears = []int{1, 5, 10}
+
+// runOnThisDay posts the "On this day on HN" retrospective on
+// ON_THIS_DAY_SCHEDULE. The date of the last post is kept in the state
+// directory so that it goes out at most once a day, even across restarts.
+func (b *Bot) runOnThisDay(ctx context.Context) {
+	b.runScheduled(ctx, "on this day", func(config Config) string {
+		if !config.OnThisDay {
+			return ""
+		}
+		return config.OnThisDaySchedule
+	}, b.onThisDay)
+}
+
+func (b *Bot) onThisDay() {
+	config := b.cfg()
+	now := b.clock.Now().In(config.location())
+	if b.lastOnThisDay() == now.Format(onThisDayDateForm) {
+		return
+	}
+
+	if err := b.postOnThisDay(now); err != nil {
+		b.event(EventWarning, "On this day post failed: %v", err)
+		return
+	}
+	if err := os.WriteFile(config.statePath(OnThisDayFile), []byte(now.Format(onThisDayDateForm)), 0o644); err != nil {
+		log.Printf("Error recording on this day post: %v", err)
+	}
+}
+
+func (b *Bot) lastOnThisDay() string {
+	config := b.cfg()
+	data, err := os.ReadFile(config.statePath(OnThisDayFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (b *Bot) postOnThisDay(now time.Time) error {
+	posted := 0
+	for _, years := range OnThisDayYears {
+		day := now.AddDate(-years, 0, 0)
+		hits, err := b.topStoriesOn(day)
+		if err != nil {
+			return fmt.Errorf("failed to fetch stories from %s: %w", day.Format(onThisDayDateForm), err)
+		}
+
+		for _, hit := range hits {
+			if err := b.sendRetrospective(hit, years); err != nil {
+				return err
+			}
+			posted++
+		}
+	}
+
+	log.Printf("Posted on this day retrospective with %d stories", posted)
+	return nil
+}
+
+// topStoriesOn returns the highest scoring stories submitted on the given
+// day, in the day's time zone.
+func (b *Bot) topStoriesOn(day time.Time) ([]hn.Hit, error) {
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+
+	params := hn.StorySearchParams("", 0, 50)
+	params.Set("numericFilters", fmt.Sprintf("created_at_i>=%d,created_at_i<%d", start.Unix(), end.Unix()))
+	result, err := b.hn.Search(params)
+	if err != nil {
+		return nil, err
+	}
+
+	hits := result.Hits
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Points > hits[j].Points })
+	if len(hits) > OnThisDayStories {
+		hits = hits[:OnThisDayStories]
+	}
+	return hits, nil
+}
+
+// sendRetrospective posts a story like a regular one, marked with how long
+// ago it was on HN. Retrospective posts are not tracked, updated or deleted.
+func (b *Bot) sendRetrospective(hit hn.Hit, years int) error {
+	id, err := strconv.ParseInt(hit.ObjectID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid story id %q: %w", hit.ObjectID, err)
+	}
+	story := &storage.Story{
+		ID:          id,
+		URL:         hit.URL,
+		Title:       hit.Title,
+		Score:       hit.Points,
+		Descendants: hit.NumComments,
+		Type:        "story",
+	}
+	if story.URL == "" {
+		story.URL = hn.ItemURL(id)
+	}
+
+	config := b.cfg()
+	chatID := config.ChatID
+	lang := config.language(chatID)
+
+	ago := tr(lang, "one_year_ago")
+	if years != 1 {
+		ago = tr(lang, "years_ago", years)
+	}
+
+	req := telegram.SendMessageRequest{
+		ChatID: chatID,
+		Text: config.withFooter(fmt.Sprintf("<i>%s</i>\n<b>%s</b>  %s", tr(lang, "on_this_day_header", ago, hit.CreatedAt().Format(onThisDayDateForm)),
+			html.EscapeString(story.Title), config.linkURL(story.URL)), chatID),
+		ParseMode:           "HTML",
+		ReplyMarkup:         b.replyMarkup(story, chatID),
+		DisableNotification: true,
+	}
+	return b.tg.Call("sendMessage", req, nil)
+}
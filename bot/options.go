@@ -0,0 +1,91 @@
+package bot
+
+import "github.com/daoleno/tg_hacker_news/storage"
+
+// Option configures a Bot created with New.
+type Option func(*options)
+
+type options struct {
+	config  *Config
+	store   *storage.Store
+	filters []Filter
+	sinks   []Sink
+	clock   Clock
+	bus     EventBus
+	faults  Faults
+}
+
+// Filter reports whether a story may be posted. Stories rejected by any
+// filter stay candidates, like stories below the thresholds.
+type Filter func(story *storage.Story) bool
+
+// Sink receives operational events, such as failed polls and cleanup
+// summaries, in addition to the log and the admin chat. Sinks are called
+// synchronously and must not block.
+type Sink func(level, text string)
+
+// WithConfig sets the configuration. Without it, New loads the config from
+// the environment and CONFIG_PATH like the binary does.
+func WithConfig(config Config) Option {
+	return func(o *options) {
+		o.config = &config
+	}
+}
+
+// WithStorage makes the bot keep its state in store instead of opening the
+// configured backend. The store is used as is: it is neither loaded nor
+// restored from a backup.
+func WithStorage(store *storage.Store) Option {
+	return func(o *options) {
+		o.store = store
+	}
+}
+
+// WithFilters adds filters every story has to pass before it is posted to
+// any chat.
+func WithFilters(filters ...Filter) Option {
+	return func(o *options) {
+		o.filters = append(o.filters, filters...)
+	}
+}
+
+// WithSinks adds receivers for operational events.
+func WithSinks(sinks ...Sink) Option {
+	return func(o *options) {
+		o.sinks = append(o.sinks, sinks...)
+	}
+}
+
+// WithEventBus publishes story lifecycle events to bus instead of the one
+// configured by EVENT_BUS. The bot closes it in Close.
+func WithEventBus(bus EventBus) Option {
+	return func(o *options) {
+		o.bus = bus
+	}
+}
+
+// WithClock replaces the real clock for the run loop, schedules, cleanup and
+// story ages. A nil clock keeps the real one.
+func WithClock(clock Clock) Option {
+	return func(o *options) {
+		if clock != nil {
+			o.clock = clock
+		}
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{clock: realClock{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithFaults injects faults at the given rates, see Faults. It is meant for
+// staging only.
+func WithFaults(faults Faults) Option {
+	return func(o *options) {
+		o.faults = faults
+	}
+}
@@ -0,0 +1,177 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/lru"
+)
+
+// DefaultUserAgent identifies the bot to the services it calls.
+const DefaultUserAgent = "tg_hacker_news (+https://github.com/daoleno/tg_hacker_news)"
+
+// HostCounters counts the outbound requests to one host since startup.
+type HostCounters struct {
+	Host        string `json:"host"`
+	Requests    int64  `json:"requests"`
+	Errors      int64  `json:"errors"`
+	RateLimited int64  `json:"rate_limited"`
+}
+
+// outboundTransport sets the User-Agent on every outbound request, paces
+// requests to the HN APIs by HN_REQUEST_INTERVAL, counts requests per host
+// and charges them to the daily budget of their upstream.
+type outboundTransport struct {
+	base http.RoundTripper
+
+	// config, spend and upstreams are set once the bot exists; until then
+	// requests go out with the default User-Agent, without pacing and
+	// uncounted.
+	config    func() Config
+	spend     func(upstream string) error
+	upstreams map[string]string
+
+	// inject, when set, may answer a request with an injected fault
+	// instead of sending it, see Faults.
+	inject func(upstream string, req *http.Request) (*http.Response, error)
+
+	mutex  sync.Mutex
+	hosts  *lru.Cache[string, *HostCounters]
+	hnNext time.Time // earliest start of the next HN request
+}
+
+// newOutboundTransport returns a transport that counts the requests to up to
+// hosts hosts; the least recently requested are forgotten first.
+func newOutboundTransport(base http.RoundTripper, hosts int) *outboundTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &outboundTransport{base: base, hosts: lru.New[string, *HostCounters](hosts)}
+}
+
+// classify counts requests to the hosts of the given base URLs under
+// upstream. Requests to other hosts count under UpstreamOther.
+func (t *outboundTransport) classify(upstream string, baseURLs ...string) {
+	if t.upstreams == nil {
+		t.upstreams = make(map[string]string)
+	}
+	for _, baseURL := range baseURLs {
+		if u, err := url.Parse(baseURL); err == nil {
+			t.upstreams[u.Host] = upstream
+		}
+	}
+}
+
+func (t *outboundTransport) upstream(host string) string {
+	if upstream, ok := t.upstreams[host]; ok {
+		return upstream
+	}
+	return UpstreamOther
+}
+
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	userAgent, interval := DefaultUserAgent, time.Duration(0)
+	if t.config != nil {
+		config := t.config()
+		userAgent, interval = config.UserAgent, time.Duration(config.HNRequestInterval)
+	}
+	upstream := t.upstream(req.URL.Host)
+	var err error
+	if t.spend != nil {
+		err = t.spend(upstream)
+	}
+	if err == nil && interval > 0 && upstream == UpstreamHN {
+		err = t.pace(req.Context(), interval)
+	}
+	if err != nil {
+		// A RoundTripper closes the request body even when it fails
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	// A RoundTripper must not change the request it was given
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent)
+	var resp *http.Response
+	if t.inject != nil {
+		resp, err = t.inject(upstream, req)
+		if (resp != nil || err != nil) && req.Body != nil {
+			req.Body.Close()
+		}
+	}
+	if resp == nil && err == nil {
+		resp, err = t.base.RoundTrip(req)
+	}
+
+	t.mutex.Lock()
+	counters, ok := t.hosts.Get(req.URL.Host)
+	if !ok {
+		counters = &HostCounters{Host: req.URL.Host}
+		t.hosts.Add(req.URL.Host, counters)
+	}
+	counters.Requests++
+	switch {
+	case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+		counters.Errors++
+	case resp.StatusCode == http.StatusTooManyRequests:
+		counters.RateLimited++
+	}
+	t.mutex.Unlock()
+	return resp, err
+}
+
+// cacheStats returns the fill of the request counters by host.
+func (t *outboundTransport) cacheStats() CacheStats {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return CacheStats{Name: "hosts", Entries: t.hosts.Len(), Size: t.hosts.Size()}
+}
+
+// pace waits until interval has passed since the previous paced request was
+// allowed to start.
+func (t *outboundTransport) pace(ctx context.Context, interval time.Duration) error {
+	t.mutex.Lock()
+	start := time.Now()
+	if t.hnNext.After(start) {
+		start = t.hnNext
+	}
+	t.hnNext = start.Add(interval)
+	t.mutex.Unlock()
+
+	wait := time.Until(start)
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// hostCounters returns the request counters by host, busiest first.
+func (t *outboundTransport) hostCounters() []HostCounters {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	counters := make([]HostCounters, 0, t.hosts.Len())
+	t.hosts.Each(func(_ string, c *HostCounters) {
+		counters = append(counters, *c)
+	})
+	sort.Slice(counters, func(i, j int) bool {
+		if counters[i].Requests != counters[j].Requests {
+			return counters[i].Requests > counters[j].Requests
+		}
+		return counters[i].Host < counters[j].Host
+	})
+	return counters
+}
@@ -0,0 +1,362 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	// OutboxQueued entries are stories waiting for the posting window or
+	// for POST_GAP, in the order they are released.
+	OutboxQueued = "queued"
+
+	// OutboxUnconfirmed entries are sends whose outcome is unknown, which
+	// are retried once storage.UnconfirmedSendTTL has passed.
+	OutboxUnconfirmed = "unconfirmed"
+)
+
+var (
+	errNotInOutbox = errors.New("story is not in the outbox")
+	errInvalidMove = errors.New("only queued stories can be moved")
+)
+
+// OutboxEntry is a post waiting to go out, as listed by /queue and
+// /api/queue.
+type OutboxEntry struct {
+	Kind     string   `json:"kind"`
+	Position int      `json:"position,omitempty"`
+	StoryID  int64    `json:"story_id"`
+	Title    string   `json:"title"`
+	Score    int64    `json:"score"`
+	Rank     int      `json:"rank,omitempty"`
+	Chats    []string `json:"chats"`
+
+	// Reason is why a queued story is waiting.
+	Reason string `json:"reason,omitempty"`
+
+	// RetryAt is when an unconfirmed send is retried.
+	RetryAt *time.Time `json:"retry_at,omitempty"`
+}
+
+// queuedStories returns copies of the queued stories in the order
+// releaseQueued posts them: stories moved by hand first, then highest
+// ranked or, with PostGap set, highest score first.
+func (b *Bot) queuedStories(config *Config) []*storage.Story {
+	b.storage.RLock()
+	var queued []*storage.Story
+	for _, story := range b.storage.Stories {
+		if story.State == storage.StateQueued {
+			queued = append(queued, story.Clone())
+		}
+	}
+	b.storage.RUnlock()
+
+	sort.Slice(queued, func(i, j int) bool {
+		a, b := queued[i], queued[j]
+		if (a.QueuePosition > 0) != (b.QueuePosition > 0) {
+			return a.QueuePosition > 0
+		}
+		if a.QueuePosition != b.QueuePosition {
+			return a.QueuePosition < b.QueuePosition
+		}
+		if config.PostGap > 0 && a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if (a.Rank > 0) != (b.Rank > 0) {
+			return a.Rank > 0
+		}
+		if a.Rank != b.Rank {
+			return a.Rank < b.Rank
+		}
+		return a.ID < b.ID
+	})
+	return queued
+}
+
+// Outbox returns the queued stories, in release order, followed by the
+// unconfirmed sends.
+func (b *Bot) Outbox() []OutboxEntry {
+	config := b.cfg()
+	reason := config.queueReason(b.clock.Now())
+	if config.inMaintenance(b.clock.Now()) {
+		reason = "maintenance window"
+	}
+
+	entries := []OutboxEntry{}
+	for i, story := range b.queuedStories(&config) {
+		var chats []string
+		for _, chatID := range b.destinations(&config, story) {
+			if _, sent := story.Messages[chatID]; !sent {
+				chats = append(chats, chatID)
+			}
+		}
+		entries = append(entries, OutboxEntry{
+			Kind:     OutboxQueued,
+			Position: i + 1,
+			StoryID:  story.ID,
+			Title:    story.Title,
+			Score:    story.Score,
+			Rank:     story.Rank,
+			Chats:    chats,
+			Reason:   reason,
+		})
+	}
+
+	unconfirmed := b.storage.UnconfirmedSends()
+	sort.Slice(unconfirmed, func(i, j int) bool {
+		return unconfirmed[i].Claimed.Before(unconfirmed[j].Claimed)
+	})
+	for _, sent := range unconfirmed {
+		retryAt := sent.Claimed.Add(storage.UnconfirmedSendTTL)
+		entry := OutboxEntry{
+			Kind:    OutboxUnconfirmed,
+			StoryID: sent.StoryID,
+			Chats:   []string{sent.ChatID},
+			RetryAt: &retryAt,
+		}
+		if story, ok := b.getStoredStory(sent.StoryID); ok {
+			entry.Title, entry.Score, entry.Rank = story.Title, story.Score, story.Rank
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// FlushOutbox posts queued stories right away, regardless of the posting
+// window and POST_GAP, and lets unconfirmed sends be retried on the next
+// poll. With id 0 every queued story is posted; unconfirmed sends are only
+// released by id, after checking the chat. It returns the number of entries
+// flushed.
+func (b *Bot) FlushOutbox(id int64) (int, error) {
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	config := b.cfg()
+	if config.inMaintenance(b.clock.Now()) {
+		return 0, errors.New("a maintenance window is in effect")
+	}
+
+	flushed := 0
+	var errs []error
+	for _, story := range b.queuedStories(&config) {
+		if id != 0 && story.ID != id {
+			continue
+		}
+		var err error
+		b.actors.do(story.ID, func() { err = b.flushStory(&config, story) })
+		if err != nil {
+			errs = append(errs, fmt.Errorf("story %d: %w", story.ID, err))
+			continue
+		}
+		flushed++
+	}
+
+	if id != 0 {
+		for _, sent := range b.storage.UnconfirmedSends() {
+			if sent.StoryID == id {
+				b.storage.ReleaseSend(sent.StoryID, sent.ChatID)
+				log.Printf("Released unconfirmed send of story %d to %s, retrying it on the next poll", sent.StoryID, sent.ChatID)
+				flushed++
+			}
+		}
+		if flushed == 0 && len(errs) == 0 {
+			return 0, errNotInOutbox
+		}
+		if err := b.storage.Save(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return flushed, errors.Join(errs...)
+}
+
+// flushStory posts a queued story to the chats it qualifies for, or makes it
+// a candidate again when it no longer qualifies. It runs on the story's
+// actor.
+func (b *Bot) flushStory(config *Config, story *storage.Story) error {
+	chats := b.destinations(config, story)
+	if len(chats) == 0 {
+		b.releaseStory(config, story)
+		return errors.New("no longer qualifies for posting")
+	}
+	if story.URL == "" {
+		story.URL = hn.ItemURL(story.ID)
+	}
+
+	var errs []error
+	for _, chatID := range chats {
+		if _, sent := story.Messages[chatID]; sent {
+			continue
+		}
+		err := b.sendMessage(story, chatID)
+		if err != nil && !errors.Is(err, errSendUnconfirmed) {
+			errs = append(errs, fmt.Errorf("chat %s: %w", chatID, err))
+			continue
+		}
+		log.Printf("Flushed queued story to %s: %d - %s", chatID, story.ID, story.Title)
+	}
+	return errors.Join(errs...)
+}
+
+// MoveInOutbox moves a queued story to position, counted from 1, in the
+// release order. The moved stories keep their order until they are posted.
+func (b *Bot) MoveInOutbox(id int64, position int) error {
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	config := b.cfg()
+	queued := b.queuedStories(&config)
+	from := -1
+	for i, story := range queued {
+		if story.ID == id {
+			from = i
+		}
+	}
+	if from < 0 {
+		return errInvalidMove
+	}
+	if position < 1 {
+		return fmt.Errorf("invalid position %d", position)
+	}
+	to := min(position, len(queued)) - 1
+
+	moved := queued[from]
+	queued = append(queued[:from], queued[from+1:]...)
+	queued = append(queued[:to], append([]*storage.Story{moved}, queued[to:]...)...)
+
+	// Pin the order of every story up to the moved one
+	for i, story := range queued[:to+1] {
+		pinned := i + 1
+		b.actors.do(story.ID, func() {
+			current, ok := b.getStoredStory(story.ID)
+			if !ok || current.State != storage.StateQueued {
+				return
+			}
+			current.QueuePosition = pinned
+			if err := b.saveStory(current); err != nil {
+				log.Printf("Error saving queued story %d: %v", story.ID, err)
+			}
+		})
+	}
+	log.Printf("Moved queued story %d to position %d", id, to+1)
+	return nil
+}
+
+// DropFromOutbox keeps a queued story, or a story with an unconfirmed send
+// and no messages, from being posted, like Suppress.
+func (b *Bot) DropFromOutbox(id int64) (err error) {
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	story, ok := b.getStoredStory(id)
+	if !ok {
+		return errNotInOutbox
+	}
+	unconfirmed := false
+	for _, sent := range b.storage.UnconfirmedSends() {
+		unconfirmed = unconfirmed || sent.StoryID == id
+	}
+	switch {
+	case story.State == storage.StateQueued:
+	case unconfirmed && len(story.Messages) > 0:
+		return fmt.Errorf("story %d has messages, suppress it instead", id)
+	case !unconfirmed:
+		return errNotInOutbox
+	}
+
+	b.actors.do(id, func() { err = b.suppress(id) })
+	if err == nil {
+		log.Printf("Dropped story %d from the outbox", id)
+	}
+	return err
+}
+
+func (b *Bot) registerQueue() {
+	b.handleCommand("queue", b.queueCommand)
+}
+
+// queueCommand lists the outbox in the admin chat and handles
+// "/queue flush [id]", "/queue move <id> <position>" and "/queue drop <id>".
+// Without ADMIN_CHAT_ID the command is ignored.
+func (b *Bot) queueCommand(msg *telegram.Message, args string) {
+	config := b.cfg()
+	if !config.isAdminChat(msg.Chat) {
+		return
+	}
+
+	lang := b.chatLanguage(msg.Chat)
+	fields := strings.Fields(args)
+	ids := make([]int64, 0, 2)
+	for _, field := range fields[min(len(fields), 1):] {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || n <= 0 {
+			b.reply(msg, tr(lang, "queue_usage"), nil)
+			return
+		}
+		ids = append(ids, n)
+	}
+
+	action := ""
+	if len(fields) > 0 {
+		action = fields[0]
+	}
+	var err error
+	switch {
+	case action == "":
+		b.reply(msg, b.outboxText(lang), nil)
+		return
+	case action == "flush" && len(ids) <= 1:
+		var id int64
+		if len(ids) == 1 {
+			id = ids[0]
+		}
+		var flushed int
+		if flushed, err = b.FlushOutbox(id); err == nil {
+			b.reply(msg, tr(lang, "queue_flushed", flushed), nil)
+			return
+		}
+	case action == "move" && len(ids) == 2:
+		if err = b.MoveInOutbox(ids[0], int(ids[1])); err == nil {
+			b.reply(msg, tr(lang, "queue_moved", ids[0], ids[1]), nil)
+			return
+		}
+	case action == "drop" && len(ids) == 1:
+		if err = b.DropFromOutbox(ids[0]); err == nil {
+			b.reply(msg, tr(lang, "queue_dropped", ids[0]), nil)
+			return
+		}
+	default:
+		b.reply(msg, tr(lang, "queue_usage"), nil)
+		return
+	}
+	b.reply(msg, tr(lang, "queue_failed", html.EscapeString(err.Error())), nil)
+}
+
+// outboxText formats the outbox for /queue.
+func (b *Bot) outboxText(lang string) string {
+	entries := b.Outbox()
+	if len(entries) == 0 {
+		return tr(lang, "queue_empty")
+	}
+	lines := []string{tr(lang, "queue_header", len(entries))}
+	for _, entry := range entries {
+		link := fmt.Sprintf(`<a href="%s">%d</a>`, hn.ItemURL(entry.StoryID), entry.StoryID)
+		chats := html.EscapeString(strings.Join(entry.Chats, ", "))
+		switch entry.Kind {
+		case OutboxQueued:
+			lines = append(lines, tr(lang, "queue_queued", entry.Position, link, html.EscapeString(entry.Title), entry.Score, chats, html.EscapeString(entry.Reason)))
+		case OutboxUnconfirmed:
+			lines = append(lines, tr(lang, "queue_unconfirmed", link, html.EscapeString(entry.Title), chats, entry.RetryAt.UTC().Format("2006-01-02 15:04 MST")))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,256 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// Plugin is implemented by the Plugin variable a Go plugin in PLUGIN_DIR
+// exports. Plugins are built with `go build -buildmode=plugin` against the
+// same version of this module and Go as the bot.
+type Plugin interface {
+	// Name is the name the plugin is configured under in plugins and, for
+	// enrichers, listed under in ENRICHERS.
+	Name() string
+	// Schema declares the fields of the plugin's config with their JSON
+	// types: "string", "number", "boolean", "array" or "object".
+	Schema() map[string]string
+	// New returns the plugin configured with config, a JSON object checked
+	// against Schema. It is an Enricher, a StoryFilter or both. New is called
+	// again for every config reload, so it should not keep global state.
+	New(config json.RawMessage) (any, error)
+}
+
+// StoryFilter is implemented by plugins that filter stories. Like a Filter,
+// stories it rejects are not posted to any chat.
+type StoryFilter interface {
+	Accept(story *storage.Story) bool
+}
+
+// loadedPlugin is a configured plugin, set on the config by validate.
+type loadedPlugin struct {
+	name     string
+	schema   map[string]string
+	enricher Enricher
+	filter   Filter
+}
+
+var pluginTypes = []string{"string", "number", "boolean", "array", "object"}
+
+// openedPlugin is a plugin opened from path.
+type openedPlugin struct {
+	path   string
+	plugin Plugin
+}
+
+// openedPlugins are the plugins of each plugin directory. A directory is
+// listed and its plugins opened the first time it is configured; reloads
+// only configure them again, as Go plugins cannot be unloaded.
+var openedPlugins = struct {
+	sync.Mutex
+	dirs map[string][]openedPlugin
+}{dirs: make(map[string][]openedPlugin)}
+
+// dirPlugins returns the plugins in dir, opening them on first use.
+func dirPlugins(dir string) ([]openedPlugin, error) {
+	if !pluginsSupported {
+		return nil, fmt.Errorf("plugin_dir is set to %s, but this binary cannot load Go plugins: "+
+			"they need a build with cgo (CGO_ENABLED=1) on Linux, macOS or FreeBSD, which the Docker image is not", dir)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve plugin directory: %w", err)
+	}
+
+	openedPlugins.Lock()
+	defer openedPlugins.Unlock()
+	if plugins, ok := openedPlugins.dirs[abs]; ok {
+		return plugins, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(abs, "*.so"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugins: %w", err)
+	}
+	var plugins []openedPlugin
+	for _, path := range paths {
+		p, err := openPlugin(path)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, openedPlugin{path: path, plugin: p})
+	}
+	openedPlugins.dirs[abs] = plugins
+	return plugins, nil
+}
+
+// loadPlugins configures the plugins in PluginDir with Plugins.
+func (c *Config) loadPlugins() error {
+	c.plugins = nil
+	if c.PluginDir == "" {
+		if len(c.Plugins) > 0 {
+			return errors.New("plugins are configured but plugin_dir is not set")
+		}
+		return nil
+	}
+	plugins, err := dirPlugins(c.PluginDir)
+	if err != nil {
+		return err
+	}
+	for _, opened := range plugins {
+		p := opened.plugin
+		name := p.Name()
+		if slices.Contains(enricherNames, name) || c.plugin(name) != nil {
+			return fmt.Errorf("plugin %s: name %q is already taken", opened.path, name)
+		}
+		schema := p.Schema()
+		config := c.Plugins[name]
+		if err := checkPluginConfig(schema, config); err != nil {
+			return fmt.Errorf("invalid config for plugin %s: %w", name, err)
+		}
+		if config == nil {
+			config = json.RawMessage("{}")
+		}
+		value, err := p.New(config)
+		if err != nil {
+			return fmt.Errorf("failed to configure plugin %s: %w", name, err)
+		}
+
+		loaded := &loadedPlugin{name: name, schema: schema}
+		if enricher, ok := value.(Enricher); ok {
+			loaded.enricher = enricher
+		}
+		if filter, ok := value.(StoryFilter); ok {
+			loaded.filter = filter.Accept
+		}
+		if loaded.enricher == nil && loaded.filter == nil {
+			return fmt.Errorf("plugin %s is neither an enricher nor a filter", name)
+		}
+		c.plugins = append(c.plugins, loaded)
+	}
+	for name := range c.Plugins {
+		if c.plugin(name) == nil {
+			return fmt.Errorf("plugins has config for %q, which is not in %s", name, c.PluginDir)
+		}
+	}
+	return nil
+}
+
+func (c *Config) plugin(name string) *loadedPlugin {
+	for _, p := range c.plugins {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// checkPluginConfig checks that config, a JSON object, only has the fields of
+// schema, each of its type.
+func checkPluginConfig(schema map[string]string, config json.RawMessage) error {
+	for field, typ := range schema {
+		if !slices.Contains(pluginTypes, typ) {
+			return fmt.Errorf("schema of %q has unknown type %q", field, typ)
+		}
+	}
+	if config == nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(config, &fields); err != nil || fields == nil {
+		return errors.New("config must be an object")
+	}
+	for field, raw := range fields {
+		typ, ok := schema[field]
+		if !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		if got := jsonType(raw); got != typ {
+			return fmt.Errorf("%s must be a %s, got a %s", field, typ, got)
+		}
+	}
+	return nil
+}
+
+// jsonType returns the schema type of a JSON value.
+func jsonType(raw json.RawMessage) string {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return "null"
+	}
+	switch raw[0] {
+	case '"':
+		return "string"
+	case '[':
+		return "array"
+	case '{':
+		return "object"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	}
+	return "number"
+}
+
+// storyFilters returns the filters passed to New followed by those of the
+// configured plugins.
+func (b *Bot) storyFilters(config *Config) []Filter {
+	filters := slices.Clip(b.filters)
+	for _, p := range config.plugins {
+		if p.filter != nil {
+			filters = append(filters, p.filter)
+		}
+	}
+	return filters
+}
+
+// RunPlugins implements `plugins`, which lists the plugins in PLUGIN_DIR with
+// what they are and the schema of their config.
+func RunPlugins(args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return errors.New("usage: plugins")
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if config.PluginDir == "" {
+		return errors.New("PLUGIN_DIR (or plugin_dir in the config file) is not set")
+	}
+	if err := config.loadPlugins(); err != nil {
+		return err
+	}
+	if len(config.plugins) == 0 {
+		fmt.Fprintf(out, "No plugins in %s\n", config.PluginDir)
+		return nil
+	}
+	for _, p := range config.plugins {
+		var kinds []string
+		if p.enricher != nil {
+			kinds = append(kinds, "enricher")
+		}
+		if p.filter != nil {
+			kinds = append(kinds, "filter")
+		}
+		fields := make([]string, 0, len(p.schema))
+		for field, typ := range p.schema {
+			fields = append(fields, field+": "+typ)
+		}
+		sort.Strings(fields)
+		fmt.Fprintf(out, "%s (%s)\n", p.name, strings.Join(kinds, ", "))
+		for _, field := range fields {
+			fmt.Fprintf(out, "  %s\n", field)
+		}
+	}
+	return nil
+}
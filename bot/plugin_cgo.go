@@ -0,0 +1,31 @@
+//go:build cgo && (linux || darwin || freebsd)
+
+package bot
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// pluginsSupported reports whether the binary can open Go plugins.
+const pluginsSupported = true
+
+// openPlugin opens the plugin at path.
+func openPlugin(path string) (Plugin, error) {
+	lib, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin %s: %w", path, err)
+	}
+	symbol, err := lib.Lookup("Plugin")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load plugin %s: %w", path, err)
+	}
+	// A variable is looked up as a pointer to it
+	if p, ok := symbol.(*Plugin); ok {
+		return *p, nil
+	}
+	if p, ok := symbol.(Plugin); ok {
+		return p, nil
+	}
+	return nil, fmt.Errorf("failed to load plugin %s: Plugin is a %T, not a bot.Plugin", path, symbol)
+}
@@ -0,0 +1,13 @@
+//go:build !cgo || !(linux || darwin || freebsd)
+
+package bot
+
+import "errors"
+
+// pluginsSupported reports whether the binary can open Go plugins. Without
+// cgo, or on other systems, the plugin package cannot.
+const pluginsSupported = false
+
+func openPlugin(path string) (Plugin, error) {
+	return nil, errors.New("plugins are not supported by this build")
+}
@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPluginDirWithoutPluginSupport(t *testing.T) {
+	if pluginsSupported {
+		t.Skip("this build can load plugins, run with CGO_ENABLED=0")
+	}
+	config := Config{PluginDir: t.TempDir()}
+	if err := config.loadPlugins(); err == nil || !strings.Contains(err.Error(), "CGO_ENABLED=1") {
+		t.Fatalf("loadPlugins() = %v, want an error asking for a cgo build", err)
+	}
+}
+
+func TestPluginDirOpenedOnce(t *testing.T) {
+	if !pluginsSupported {
+		t.Skip("this build cannot load plugins")
+	}
+	dir := t.TempDir()
+	config := Config{PluginDir: dir}
+	if err := config.loadPlugins(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A reload configures the plugins found at startup again, without
+	// listing the directory or opening files in it
+	if err := os.WriteFile(filepath.Join(dir, "broken.so"), []byte("not a plugin"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.loadPlugins(); err != nil {
+		t.Fatalf("reload opened the directory again: %v", err)
+	}
+	if len(config.plugins) != 0 {
+		t.Errorf("reload loaded %d plugins, want none", len(config.plugins))
+	}
+}
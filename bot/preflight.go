@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// Preflight verifies the bot token and access to the configured chats before
+// the first poll, so misconfiguration is reported at startup instead of as
+// failed sends later on. Chats configured by username are resolved to their
+// numeric IDs.
+func (b *Bot) Preflight() error {
+	me, err := b.verifyToken()
+	if err != nil {
+		return err
+	}
+	log.Printf("Authenticated as @%s (id %d)", me.Username, me.ID)
+
+	b.resolveChats()
+
+	config := b.cfg()
+	for _, chat := range config.postChats() {
+		if err := b.checkChat(&me, chat.chatID); err != nil {
+			if chat.name == "" {
+				return err
+			}
+			return fmt.Errorf("%s: %w", chat.name, err)
+		}
+	}
+	return nil
+}
+
+// verifyToken checks BOT_KEY with getMe and returns the bot's user.
+func (b *Bot) verifyToken() (telegram.User, error) {
+	var me telegram.User
+	if err := b.tg.Call("getMe", struct{}{}, &me); err != nil {
+		var apiErr *telegram.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == 401 {
+			return me, fmt.Errorf("BOT_KEY was rejected by Telegram (401 Unauthorized): check the token from @BotFather")
+		}
+		return me, fmt.Errorf("failed to verify bot token: %w", err)
+	}
+	return me, nil
+}
+
+// postChat is a chat the bot posts to, named for error messages. The main
+// chat has no name.
+type postChat struct {
+	name   string
+	chatID string
+}
+
+// postChats returns the configured chats the bot posts to.
+func (c *Config) postChats() []postChat {
+	chats := []postChat{{chatID: c.ChatID}}
+	if c.AdminChatID != "" {
+		chats = append(chats, postChat{"admin chat", c.AdminChatID})
+	}
+	if c.RadarChatID != "" {
+		chats = append(chats, postChat{"radar chat", c.RadarChatID})
+	}
+	if c.SuggestChatID != "" {
+		chats = append(chats, postChat{"suggestion chat", c.SuggestChatID})
+	}
+	for _, route := range c.Routes {
+		name := "route /" + route.Match + "/"
+		switch {
+		case route.Feed != "":
+			name = route.Feed + " feed"
+		case route.Match == "":
+			name = "chat"
+		}
+		chats = append(chats, postChat{name, route.ChatID})
+	}
+	return chats
+}
+
+func (b *Bot) checkChat(me *telegram.User, chatID string) error {
+	var chat telegram.Chat
+	if err := b.tg.Call("getChat", telegram.GetChatRequest{ChatID: chatID}, &chat); err != nil {
+		var apiErr *telegram.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == 400 {
+			return fmt.Errorf("chat %s not found: check CHAT_ID and that @%s has been added to it", chatID, me.Username)
+		}
+		if errors.As(err, &apiErr) && apiErr.ErrorCode == 403 {
+			return fmt.Errorf("bot @%s has no access to chat %s: add it to the chat first", me.Username, chatID)
+		}
+		return fmt.Errorf("failed to look up chat %s: %w", chatID, err)
+	}
+
+	// A private chat with a user needs no membership, only a started bot
+	if chat.Type == "private" {
+		log.Printf("Chat %s verified: private chat (id %d)", chatID, chat.ID)
+		return nil
+	}
+
+	var member telegram.ChatMember
+	if err := b.tg.Call("getChatMember", telegram.GetChatMemberRequest{ChatID: chatID, UserID: me.ID}, &member); err != nil {
+		return fmt.Errorf("failed to check bot membership in %s: %w", chatID, err)
+	}
+
+	isAdmin := member.Status == "administrator" || member.Status == "creator"
+	switch {
+	case member.Status == "left" || member.Status == "kicked":
+		return fmt.Errorf("bot @%s is not a member of %s: add it to the chat", me.Username, chatID)
+	case chat.Type == "channel" && !isAdmin:
+		return fmt.Errorf("bot @%s is not an admin of %s: promote it to administrator", me.Username, chatID)
+	case chat.Type == "channel" && member.Status == "administrator" && !member.CanPostMessages:
+		return fmt.Errorf("bot @%s is an admin of %s but lacks the \"Post messages\" permission", me.Username, chatID)
+	}
+
+	if chat.Type == "channel" && member.Status == "administrator" && !member.CanDeleteMessages {
+		log.Printf("Warning: bot lacks the \"Delete messages\" permission in %s, cleanup may fail", chatID)
+	}
+
+	log.Printf("Chat %s verified: %s %q (id %d), bot status %s", chatID, chat.Type, chatTitle(&chat), chat.ID, member.Status)
+	return nil
+}
+
+func chatTitle(chat *telegram.Chat) string {
+	if chat.Title != "" {
+		return chat.Title
+	}
+	return "@" + chat.Username
+}
@@ -0,0 +1,167 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// PostingWindow is the daily time range new stories are posted in, such as
+// "09:00-22:00" in TIMEZONE. A range that ends before it starts spans
+// midnight.
+type PostingWindow struct {
+	start, end int // minutes since midnight
+}
+
+// ParsePostingWindow parses a "HH:MM-HH:MM" range.
+func ParsePostingWindow(s string) (*PostingWindow, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return nil, fmt.Errorf("posting window %q must look like 09:00-22:00", s)
+	}
+	var w PostingWindow
+	for _, bound := range []struct {
+		text   string
+		target *int
+	}{{from, &w.start}, {to, &w.end}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(bound.text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid posting window %q: %w", s, err)
+		}
+		*bound.target = t.Hour()*60 + t.Minute()
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("posting window %q is empty", s)
+	}
+	return &w, nil
+}
+
+func (w *PostingWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// postingOpen reports whether new stories may be posted at now.
+func (c *Config) postingOpen(now time.Time) bool {
+	return c.postingWindow == nil || c.postingWindow.contains(now.In(c.location()))
+}
+
+// postSpacing remembers when a story was last posted to each chat, to keep
+// POST_GAP between posts. It is not persisted.
+type postSpacing struct {
+	mutex sync.Mutex
+	last  map[string]time.Time
+}
+
+// spaced reports whether chatID got a story less than PostGap ago.
+func (b *Bot) spaced(config *Config, chatID string) bool {
+	if config.PostGap <= 0 {
+		return false
+	}
+	b.spacing.mutex.Lock()
+	defer b.spacing.mutex.Unlock()
+	last, ok := b.spacing.last[chatID]
+	return ok && b.clock.Now().Sub(last) < time.Duration(config.PostGap)
+}
+
+func (b *Bot) markPosted(chatID string) {
+	b.spacing.mutex.Lock()
+	defer b.spacing.mutex.Unlock()
+	if b.spacing.last == nil {
+		b.spacing.last = make(map[string]time.Time)
+	}
+	b.spacing.last[chatID] = b.clock.Now()
+}
+
+// queueReason returns why a story that qualifies for posting goes through the
+// queue instead of being posted right away, or "" if it doesn't. With PostGap
+// or TopPerHour set every story is queued, because stories are processed
+// concurrently and releaseQueued has to pick the best ones for each chat.
+func (c *Config) queueReason(now time.Time) string {
+	if !c.postingOpen(now) {
+		return "outside the posting window"
+	}
+	if c.PostGap > 0 {
+		return "with post_gap set"
+	}
+	if c.TopPerHour > 0 {
+		return "with top_per_hour set"
+	}
+	return ""
+}
+
+// hourFull reports whether the main chat already got TopPerHour stories in
+// the current hour in TIMEZONE. Sends are counted by their idempotency keys,
+// so the count survives restarts.
+func (b *Bot) hourFull(config *Config, chatID string) bool {
+	if config.TopPerHour <= 0 || chatID != config.ChatID {
+		return false
+	}
+	now := b.clock.Now().In(config.location())
+	hour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
+	return b.storage.SentSince(chatID, hour) >= config.TopPerHour
+}
+
+// queue holds a story that qualifies for posting until releaseQueued posts
+// it.
+func (b *Bot) queue(story *storage.Story, reason string) {
+	if story.State != storage.StateQueued {
+		log.Printf("Story %d qualifies %s, queueing it", story.ID, reason)
+		story.QueuePosition = 0
+	}
+	if err := b.transition(story, storage.StateQueued); err != nil {
+		log.Printf("Error queueing story %d: %v", story.ID, err)
+		return
+	}
+	if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving queued story %d: %v", story.ID, err)
+	}
+}
+
+// releaseQueued posts the queued stories once the posting window is open and
+// no maintenance window is in effect, in the order of queuedStories, so each
+// chat gets the best waiting story when its gap has passed. Stories that no
+// longer qualify go back to being candidates. Only the stories still listed,
+// on the top list or a feed, are released.
+func (b *Bot) releaseQueued(listed []int64) {
+	config := b.cfg()
+	if !config.postingOpen(b.clock.Now()) || config.inMaintenance(b.clock.Now()) {
+		return
+	}
+
+	rank := make(map[int64]int, len(listed))
+	for i, id := range listed {
+		rank[id] = i + 1
+	}
+
+	for _, story := range b.queuedStories(&config) {
+		if rank[story.ID] == 0 {
+			continue
+		}
+		b.actors.do(story.ID, func() { b.releaseStory(&config, story) })
+	}
+}
+
+// releaseStory posts a queued story, or makes it a candidate again when it
+// no longer qualifies. It runs on the story's actor.
+func (b *Bot) releaseStory(config *Config, story *storage.Story) {
+	chats := b.destinations(config, story)
+	if len(chats) == 0 {
+		if err := b.transition(story, storage.StateCandidate); err != nil {
+			log.Printf("Error tracking candidate story %d: %v", story.ID, err)
+			return
+		}
+		if err := b.saveStory(story); err != nil {
+			log.Printf("Error saving candidate story %d: %v", story.ID, err)
+		}
+		return
+	}
+	b.sendToChats(story, chats)
+}
@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	RadarFile         = "radar.json"
+	RadarBatchSize    = 100
+	DefaultRadarScore = 1
+)
+
+// radarState remembers which new stories were already checked. Titles that
+// don't match are never fetched again; matches below the score threshold are
+// rechecked on the next scan.
+type radarState struct {
+	mutex   sync.Mutex
+	skipped map[int64]bool
+	posted  map[int64]bool
+}
+
+func (b *Bot) getNewStories() ([]int64, error) {
+	return b.hn.NewStories(RadarBatchSize)
+}
+
+// runRadar scans /new for titles matching RADAR_KEYWORDS every poll
+// interval and posts matches to the radar chat.
+func (b *Bot) runRadar(ctx context.Context) {
+	b.radar.load(b.cfg())
+
+	interval := time.Duration(b.cfg().PollInterval)
+	ticker := b.clock.NewTicker(interval)
+	defer func() { ticker.Stop() }()
+
+	for {
+		config := b.cfg()
+		if config.RadarChatID != "" && len(config.RadarKeywords) > 0 && !config.inMaintenance(b.clock.Now()) {
+			if err := b.scanNewStories(config); err != nil {
+				log.Printf("Error scanning new stories: %v", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			ticker = b.retick(ticker, &interval)
+		}
+	}
+}
+
+func (b *Bot) scanNewStories(config Config) error {
+	ids, err := b.getNewStories()
+	if err != nil {
+		return err
+	}
+
+	current := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		current[id] = true
+		if b.radar.checked(id) {
+			continue
+		}
+
+		story, err := b.getStoryDetails(id)
+		if err != nil {
+			log.Printf("Error getting new story %d: %v", id, err)
+			continue
+		}
+
+		keyword, ok := filter.MatchKeyword(story.Title, config.RadarKeywords)
+		if !ok || story.Type != "story" {
+			b.radar.skip(id)
+			continue
+		}
+		if story.Score < config.RadarScoreThreshold {
+			continue
+		}
+
+		if err := b.sendRadar(config.RadarChatID, story, keyword); err != nil {
+			log.Printf("Error posting radar match %d: %v", id, err)
+			continue
+		}
+		log.Printf("Radar: story %d matched %q", id, keyword)
+		b.radar.post(id)
+	}
+
+	b.radar.forget(current)
+	return b.radar.save(config)
+}
+
+func (b *Bot) sendRadar(chatID string, story *storage.Story, keyword string) error {
+	config := b.cfg()
+	if story.URL == "" {
+		story.URL = hn.ItemURL(story.ID)
+	}
+	req := telegram.SendMessageRequest{
+		ChatID: chatID,
+		Text: config.withFooter(fmt.Sprintf("<i>%s</i>\n<b>%s</b>  %s", tr(config.language(chatID), "radar_header", html.EscapeString(keyword)),
+			html.EscapeString(story.Title), config.linkURL(story.URL)), chatID),
+		ParseMode:   "HTML",
+		ReplyMarkup: b.replyMarkup(story, chatID),
+	}
+	return b.tg.Call("sendMessage", req, nil)
+}
+
+func (r *radarState) checked(id int64) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.skipped[id] || r.posted[id]
+}
+
+func (r *radarState) skip(id int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.skipped[id] = true
+}
+
+func (r *radarState) post(id int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.posted[id] = true
+}
+
+// forget drops stories that have fallen off the /new list.
+func (r *radarState) forget(current map[int64]bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for id := range r.skipped {
+		if !current[id] {
+			delete(r.skipped, id)
+		}
+	}
+	for id := range r.posted {
+		if !current[id] {
+			delete(r.posted, id)
+		}
+	}
+}
+
+// load restores the posted stories, so a restart doesn't post them again.
+func (r *radarState) load(config Config) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.skipped = make(map[int64]bool)
+	r.posted = make(map[int64]bool)
+
+	data, err := os.ReadFile(config.statePath(RadarFile))
+	if err != nil {
+		return
+	}
+	var posted []int64
+	if err := json.Unmarshal(data, &posted); err != nil {
+		log.Printf("Ignoring invalid radar state: %v", err)
+		return
+	}
+	for _, id := range posted {
+		r.posted[id] = true
+	}
+}
+
+func (r *radarState) save(config Config) error {
+	r.mutex.Lock()
+	posted := make([]int64, 0, len(r.posted))
+	for id := range r.posted {
+		posted = append(posted, id)
+	}
+	r.mutex.Unlock()
+
+	data, err := json.Marshal(posted)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(config.statePath(RadarFile), data, 0o644); err != nil {
+		return fmt.Errorf("failed to save radar state: %w", err)
+	}
+	return nil
+}
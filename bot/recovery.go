@@ -0,0 +1,34 @@
+package bot
+
+import (
+	"log"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// markSeen marks a story that qualifies for posting as seen instead, while
+// the bot reconciles with the front page after losing its storage. It
+// reports whether the story was marked.
+func (b *Bot) markSeen(story *storage.Story) bool {
+	if !b.reconciling.Load() {
+		return false
+	}
+	if err := b.transition(story, storage.StateSuppressed); err != nil {
+		log.Printf("Error marking story %d as seen: %v", story.ID, err)
+		return true
+	}
+	if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving seen story %d: %v", story.ID, err)
+	}
+	b.reconciled.Add(1)
+	return true
+}
+
+// finishReconcile ends reconcile-only mode after the first successful poll.
+func (b *Bot) finishReconcile() {
+	if !b.reconciling.Swap(false) {
+		return
+	}
+	b.event(EventWarning, "Storage was corrupted, marked %d front page stories as seen instead of posting them again",
+		b.reconciled.Load())
+}
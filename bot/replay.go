@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// RunReplay implements `replay --from=<timestamp>`, which runs the stored
+// front page snapshots since then through the posting decisions with the
+// current configuration, without sending anything, and shows why each story
+// was or wasn't posted. Of opts, only WithClock applies.
+func RunReplay(args []string, out io.Writer, opts ...Option) error {
+	clock := newOptions(opts).clock
+	config, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	from := flags.String("from", "", "first snapshot to replay, as 2006-01-02T15:04 or 2006-01-02 in the configured timezone, or RFC 3339")
+	to := flags.String("to", "", "last snapshot to replay, defaults to the latest")
+	storyID := flags.Int64("story", 0, "only this story")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" {
+		return errors.New("usage: replay --from=<timestamp> [--to=<timestamp>] [--story=<id>]")
+	}
+	start, err := parseTimestamp(*from, config.location())
+	if err != nil {
+		return err
+	}
+	end := clock.Now()
+	if *to != "" {
+		if end, err = parseTimestamp(*to, config.location()); err != nil {
+			return err
+		}
+	}
+
+	path := config.backendPath(config.StorageBackend)
+	store, err := openStorageAt(config, config.StorageBackend, path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	if err := store.Load(); err != nil {
+		return fmt.Errorf("failed to load storage from %s: %w", redactURL(path), err)
+	}
+
+	replayed := 0
+	for _, snapshot := range store.SnapshotsSince(start) {
+		if snapshot.Time.After(end) {
+			break
+		}
+		replayed++
+		fmt.Fprintf(out, "== %s ==\n", snapshot.Time.In(config.location()).Format("2006-01-02 15:04 MST"))
+		for _, entry := range snapshot.Stories {
+			if *storyID != 0 && entry.ID != *storyID {
+				continue
+			}
+			story, known, posted := replayStory(store, entry)
+			verdict := explainDecision(&config, story, known, snapshot.Time)
+			if posted {
+				verdict += " (was posted)"
+			}
+			fmt.Fprintf(out, "#%-3d %-9d %5d points %5d comments  %s\n", entry.Rank, entry.ID, entry.Score, entry.Comments, story.Title)
+			fmt.Fprintf(out, "     %s\n", verdict)
+		}
+	}
+	if replayed == 0 {
+		return fmt.Errorf("no snapshots between %s and %s", start.Format(time.RFC3339), end.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// parseTimestamp parses an RFC 3339 timestamp or a date with an optional
+// time in loc.
+func parseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected 2006-01-02T15:04, 2006-01-02 or RFC 3339", value)
+}
+
+// replayStory returns the story as it was in a snapshot, with its details
+// from storage, whether they are known, which they are not once a story that
+// was never posted stops being tracked, and whether it was posted.
+func replayStory(store *storage.Store, entry storage.SnapshotStory) (story *storage.Story, known, posted bool) {
+	store.RLock()
+	defer store.RUnlock()
+
+	story = &storage.Story{ID: entry.ID}
+	if tracked, ok := store.Stories[entry.ID]; ok {
+		story = tracked.Clone()
+		known, posted = true, len(tracked.Messages) > 0
+	} else if history, ok := store.History[entry.ID]; ok {
+		story.Title, story.URL, story.Type = history.Title, history.URL, "story"
+		known, posted = true, true
+	}
+	story.Score, story.Descendants = entry.Score, entry.Comments
+	return story, known, posted
+}
+
+// explainDecision describes what the poll decides for the story at the given
+// time with the configuration, and why. Without its details, known is false,
+// only the thresholds can be checked.
+func explainDecision(config *Config, story *storage.Story, known bool, at time.Time) string {
+	score, comments := config.storyThresholds(story, at)
+	var reasons []string
+	if story.Score < score {
+		reasons = append(reasons, fmt.Sprintf("score %d below %d", story.Score, score))
+	}
+	if story.Descendants < comments {
+		reasons = append(reasons, fmt.Sprintf("%d comments below %d", story.Descendants, comments))
+	}
+	if !known {
+		if len(reasons) > 0 {
+			return "skipped: " + strings.Join(reasons, ", ")
+		}
+		return "meets the thresholds, but its title, link and type are unknown since it is no longer tracked"
+	}
+
+	chats := config.destinations(story, at)
+	if len(chats) == 0 {
+		if story.Type != "story" {
+			reasons = append(reasons, fmt.Sprintf("not a story but a %s", story.Type))
+		} else if story.URL == "" {
+			reasons = append(reasons, "no link")
+		}
+		return "skipped: " + strings.Join(reasons, ", ")
+	}
+
+	verdict := "qualifies for " + strings.Join(chats, ", ")
+	if len(reasons) > 0 {
+		verdict += " by a route (main chat: " + strings.Join(reasons, ", ") + ")"
+	}
+	if config.Moderation.enabled() {
+		verdict += ", waits for approval in the admin chat"
+	} else if reason := config.queueReason(at); reason != "" {
+		verdict += ", queued " + reason
+	}
+	return verdict
+}
@@ -0,0 +1,206 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "time/tzdata" // IANA time zones for minimal images without zoneinfo
+)
+
+// ScheduleCheckInterval bounds how long a scheduled job sleeps before it
+// looks at the config again, so reloaded schedules take effect promptly.
+const ScheduleCheckInterval = time.Minute
+
+// Schedule is a standard five-field cron expression (minute, hour, day of
+// month, month, day of week) evaluated in a fixed time zone. Fields accept
+// *, lists, ranges and steps; @hourly, @daily, @weekly and @monthly are
+// shorthands.
+type Schedule struct {
+	expr                          string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+	loc                           *time.Location
+}
+
+var scheduleMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// ParseSchedule parses a cron expression to be evaluated in loc.
+func ParseSchedule(expr string, loc *time.Location) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if macro, ok := scheduleMacros[spec]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &Schedule{expr: expr, loc: loc}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: minute: %w", expr, err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: hour: %w", expr, err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: day of month: %w", expr, err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: month: %w", expr, err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: day of week: %w", expr, err)
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is Sunday as well
+	}
+	s.domRestricted = !strings.HasPrefix(fields[2], "*")
+	s.dowRestricted = !strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parseCronField returns the set of values matched by a field as a bitmask.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeSpec, stepSpec, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepSpec)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepSpec)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		if rangeSpec != "*" {
+			from, to, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return 0, fmt.Errorf("invalid value %q", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return 0, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (s *Schedule) String() string {
+	return fmt.Sprintf("%s (%s)", s.expr, s.loc)
+}
+
+// Next returns the first time after t that matches the schedule, or the
+// zero time if there is none within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case !matches(s.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.loc)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.loc)
+		case !matches(s.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.loc)
+		case !matches(s.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Matches reports whether t falls on a minute matched by the schedule, which
+// lets an expression such as "* 18-21 * * 1-5" describe a time window.
+func (s *Schedule) Matches(t time.Time) bool {
+	t = t.In(s.loc)
+	return matches(s.month, int(t.Month())) &&
+		s.dayMatches(t) &&
+		matches(s.hour, t.Hour()) &&
+		matches(s.minute, t.Minute())
+}
+
+// dayMatches follows cron: when both day fields are restricted, either may
+// match.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := matches(s.dom, t.Day())
+	dow := matches(s.dow, int(t.Weekday()))
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func matches(set uint64, v int) bool {
+	return set&(1<<v) != 0
+}
+
+// runScheduled runs job at the times given by the cron expression that spec
+// returns for the current config. An empty expression disables the job. The
+// config is re-read at least every ScheduleCheckInterval, so schedule and
+// time zone changes apply without a restart. It returns when ctx is done.
+func (b *Bot) runScheduled(ctx context.Context, name string, spec func(Config) string, job func()) {
+	var current string
+	var schedule *Schedule
+	var next time.Time
+
+	for {
+		config := b.cfg()
+		expr := spec(config)
+		if key := expr + "|" + config.Timezone; key != current {
+			current = key
+			schedule, next = nil, time.Time{}
+			if expr != "" {
+				var err error
+				if schedule, err = ParseSchedule(expr, config.location()); err != nil {
+					log.Printf("Error in %s schedule: %v", name, err)
+				} else {
+					next = schedule.Next(b.clock.Now())
+					log.Printf("Scheduled %s at %s, next run %s", name, schedule, next.Format(time.RFC3339))
+				}
+			}
+		}
+
+		// Jobs due during a maintenance window run once it ends
+		if !next.IsZero() && !b.clock.Now().Before(next) && !config.inMaintenance(b.clock.Now()) {
+			job()
+			next = schedule.Next(b.clock.Now())
+		}
+
+		wait := ScheduleCheckInterval
+		if until := next.Sub(b.clock.Now()); !next.IsZero() && until > 0 && until < wait {
+			wait = until
+		}
+		if !b.sleep(ctx, wait) {
+			return
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	ScoreboardFile    = "scoreboard"
+	ScoreboardDomains = 10
+	ScoreboardAuthors = 5
+	scoreboardMonth   = "2006-01"
+)
+
+// countHit adds a story posted for the first time to the hits of the
+// current month, which the scoreboard is made of.
+func (b *Bot) countHit(config *Config, story *storage.Story) {
+	month := b.clock.Now().In(config.location()).Format(scoreboardMonth)
+	b.storage.CountHit(month, storyDomain(story.URL), story.By)
+}
+
+// storyDomain returns the host a story links to without "www.", or "" for
+// stories without a link.
+func storyDomain(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// runScoreboard posts the scoreboard of the previous month on
+// SCOREBOARD_SCHEDULE. The last month posted is kept in the state directory
+// so that each goes out once, even across restarts.
+func (b *Bot) runScoreboard(ctx context.Context) {
+	b.runScheduled(ctx, "scoreboard", func(config Config) string {
+		if !config.Scoreboard {
+			return ""
+		}
+		return config.ScoreboardSchedule
+	}, b.scoreboard)
+}
+
+func (b *Bot) scoreboard() {
+	config := b.cfg()
+	now := b.clock.Now().In(config.location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).AddDate(0, -1, 0)
+	if b.lastScoreboard() == month.Format(scoreboardMonth) {
+		return
+	}
+
+	hits := b.storage.MonthHits(month.Format(scoreboardMonth))
+	if len(hits.Domains) == 0 && len(hits.Authors) == 0 {
+		log.Printf("No stories were posted in %s, skipping the scoreboard", month.Format(scoreboardMonth))
+	} else if err := b.postScoreboard(&config, month, hits); err != nil {
+		b.event(EventWarning, "Scoreboard post failed: %v", err)
+		return
+	}
+	if err := os.WriteFile(config.statePath(ScoreboardFile), []byte(month.Format(scoreboardMonth)), 0o644); err != nil {
+		log.Printf("Error recording scoreboard post: %v", err)
+	}
+}
+
+func (b *Bot) lastScoreboard() string {
+	config := b.cfg()
+	data, err := os.ReadFile(config.statePath(ScoreboardFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (b *Bot) postScoreboard(config *Config, month time.Time, hits storage.MonthlyHits) error {
+	chatID := config.ChatID
+	lang := config.language(chatID)
+
+	lines := []string{tr(lang, "scoreboard_header", month.Year(), month.Month().String(), int(month.Month()))}
+	if len(hits.Domains) > 0 {
+		lines = append(lines, "", tr(lang, "scoreboard_domains"))
+		lines = append(lines, scoreboardLines(lang, hits.Domains, ScoreboardDomains, func(domain string) string {
+			return hn.WebBase + "/from?site=" + url.QueryEscape(domain)
+		})...)
+	}
+	if len(hits.Authors) > 0 {
+		lines = append(lines, "", tr(lang, "scoreboard_authors"))
+		lines = append(lines, scoreboardLines(lang, hits.Authors, ScoreboardAuthors, func(author string) string {
+			return hn.WebBase + "/user?id=" + url.QueryEscape(author)
+		})...)
+	}
+
+	req := telegram.SendMessageRequest{
+		ChatID:              chatID,
+		Text:                config.withFooter(strings.Join(lines, "\n"), chatID),
+		ParseMode:           "HTML",
+		DisableNotification: true,
+		LinkPreviewOptions:  &telegram.LinkPreviewOptions{IsDisabled: true},
+	}
+	if err := b.tg.Call("sendMessage", req, nil); err != nil {
+		return err
+	}
+	log.Printf("Posted scoreboard for %s", month.Format(scoreboardMonth))
+	return nil
+}
+
+// scoreboardLines returns the ranked lines of the limit names with the most
+// hits, linked to link(name). Ties are ranked by name.
+func scoreboardLines(lang string, counts map[string]int64, limit int, link func(string) string) []string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > limit {
+		names = names[:limit]
+	}
+
+	lines := make([]string, len(names))
+	for i, name := range names {
+		key := "scoreboard_line"
+		if counts[name] == 1 {
+			key = "scoreboard_line_one"
+		}
+		entry := fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(link(name)), html.EscapeString(name))
+		lines[i] = tr(lang, key, i+1, entry, counts[name])
+	}
+	return lines
+}
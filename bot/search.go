@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	SearchResultsPerPage = 5
+	MaxStoredSearches    = 1000
+)
+
+// searchStore remembers queries behind "next" buttons, since callback data
+// is limited to 64 bytes. Old entries are dropped first.
+type searchStore struct {
+	mutex   sync.Mutex
+	nextID  int64
+	queries map[int64]string
+}
+
+func (s *searchStore) add(query string) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.queries == nil {
+		s.queries = make(map[int64]string)
+	}
+	s.nextID++
+	s.queries[s.nextID] = query
+	delete(s.queries, s.nextID-MaxStoredSearches)
+	return s.nextID
+}
+
+func (s *searchStore) get(id int64) (string, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	query, ok := s.queries[id]
+	return query, ok
+}
+
+func (b *Bot) registerSearch() {
+	b.handleCommand("search", b.searchCommand)
+	b.handleCallback("search:", b.searchCallback)
+}
+
+func (b *Bot) searchCommand(msg *telegram.Message, args string) {
+	lang := b.chatLanguage(msg.Chat)
+	if args == "" {
+		b.reply(msg, tr(lang, "search_usage"), nil)
+		return
+	}
+
+	id := b.searches.add(args)
+	text, markup, err := b.searchPage(lang, id, args, 0)
+	if err != nil {
+		b.reply(msg, tr(lang, "search_failed"), nil)
+		return
+	}
+	b.reply(msg, text, markup)
+}
+
+// searchCallback handles "search:<id>:<page>" button presses by editing the
+// results message in place.
+func (b *Bot) searchCallback(query *telegram.CallbackQuery, data string) {
+	idText, pageText, _ := strings.Cut(data, ":")
+	id, _ := strconv.ParseInt(idText, 10, 64)
+	page, _ := strconv.Atoi(pageText)
+
+	lang := b.cfg().Language
+	if query.Message != nil {
+		lang = b.chatLanguage(query.Message.Chat)
+	}
+
+	search, ok := b.searches.get(id)
+	if !ok || query.Message == nil {
+		b.answerCallback(query, tr(lang, "search_expired"))
+		return
+	}
+
+	text, markup, err := b.searchPage(lang, id, search, page)
+	if err != nil {
+		b.answerCallback(query, tr(lang, "search_failed"))
+		return
+	}
+
+	req := telegram.EditMessageTextRequest{
+		ChatID:             chatIDString(query.Message.Chat),
+		MessageID:          query.Message.MessageID,
+		Text:               text,
+		ParseMode:          "HTML",
+		ReplyMarkup:        markup,
+		LinkPreviewOptions: &telegram.LinkPreviewOptions{IsDisabled: true},
+	}
+	if err := b.tg.Call("editMessageText", req, nil); err != nil && !telegram.IsNotModified(err) {
+		b.answerCallback(query, tr(lang, "search_update_failed"))
+		return
+	}
+	b.answerCallback(query, "")
+}
+
+// searchPage renders one page of results with navigation buttons.
+func (b *Bot) searchPage(lang string, id int64, query string, page int) (string, *telegram.InlineKeyboardMarkup, error) {
+	result, err := b.hn.Search(hn.StorySearchParams(query, page, SearchResultsPerPage))
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(result.Hits) == 0 {
+		return tr(lang, "search_no_results", html.EscapeString(query)), nil, nil
+	}
+
+	var sb strings.Builder
+	sb.WriteString(tr(lang, "search_header", html.EscapeString(query), page+1, result.NbPages) + "\n")
+	for i, hit := range result.Hits {
+		link := hit.URL
+		if link == "" {
+			link = "https://news.ycombinator.com/item?id=" + hit.ObjectID
+		}
+		fmt.Fprintf(&sb, "\n%d. <a href=\"%s\">%s</a>\n", page*SearchResultsPerPage+i+1, html.EscapeString(link), html.EscapeString(hit.Title))
+		sb.WriteString(tr(lang, "search_result_stats", hit.Points, "https://news.ycombinator.com/item?id="+hit.ObjectID,
+			hit.NumComments, hit.CreatedAt().Format("2006-01-02")) + "\n")
+	}
+
+	var buttons []telegram.InlineKeyboardButton
+	if page > 0 {
+		buttons = append(buttons, telegram.InlineKeyboardButton{Text: tr(lang, "search_prev"), CallbackData: fmt.Sprintf("search:%d:%d", id, page-1)})
+	}
+	if page+1 < result.NbPages {
+		buttons = append(buttons, telegram.InlineKeyboardButton{Text: tr(lang, "search_next"), CallbackData: fmt.Sprintf("search:%d:%d", id, page+1)})
+	}
+	if len(buttons) == 0 {
+		return sb.String(), nil, nil
+	}
+	return sb.String(), &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{buttons}}, nil
+}
@@ -0,0 +1,380 @@
+package bot
+
+import (
+	"html"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// Presets offered by /settings. Callback data is limited to 64 bytes, so the
+// buttons carry the values themselves.
+var (
+	ScoreThresholdPresets    = []int64{50, 100, 200, 500}
+	CommentsThresholdPresets = []int64{0, 25, 50, 100}
+	QuietHoursPresets        = []string{"22:00-07:00", "23:00-08:00", "00:00-06:00"}
+)
+
+func (b *Bot) registerSettings() {
+	b.handleCommand("settings", b.settingsCommand)
+	b.handleCallback("settings:", b.settingsCallback)
+}
+
+// settingsCommand opens the settings menu of the chat for its admins.
+func (b *Bot) settingsCommand(msg *telegram.Message, args string) {
+	config := b.cfg()
+	lang := b.chatLanguage(msg.Chat)
+	chatID, ok := config.destinationChat(msg.Chat)
+	if !ok {
+		b.reply(msg, tr(lang, "settings_not_destination"), nil)
+		return
+	}
+	// Only admins post in a channel, and channel posts have no sender
+	if msg.From != nil && !b.isChatAdmin(msg.Chat, msg.From.ID) {
+		b.reply(msg, tr(lang, "settings_not_admin"), nil)
+		return
+	}
+	text, markup := b.settingsMenu(&config, lang, chatID, "menu")
+	b.reply(msg, text, markup)
+}
+
+// settingsCallback handles "settings:<action>[:<value>]" button presses by
+// applying the action and editing the menu in place.
+func (b *Bot) settingsCallback(query *telegram.CallbackQuery, data string) {
+	config := b.cfg()
+	if query.Message == nil {
+		b.answerCallback(query, "")
+		return
+	}
+	chat := query.Message.Chat
+	lang := b.chatLanguage(chat)
+	chatID, ok := config.destinationChat(chat)
+	if !ok {
+		b.answerCallback(query, tr(lang, "settings_not_destination"))
+		return
+	}
+	if !b.isChatAdmin(chat, query.From.ID) {
+		b.answerCallback(query, tr(lang, "settings_not_admin"))
+		return
+	}
+
+	action, value, _ := strings.Cut(data, ":")
+	page := action
+	settings := b.storage.Settings(chatID)
+	changed := true
+	switch action {
+	case "score":
+		settings.ScoreThreshold = parsePreset(value)
+		page = "thresholds"
+	case "comments":
+		settings.CommentsThreshold = parsePreset(value)
+		page = "thresholds"
+	case "kind":
+		if i := slices.Index(settings.Muted, value); i >= 0 {
+			settings.Muted = slices.Delete(settings.Muted, i, i+1)
+		} else if slices.Contains(filter.Kinds, value) {
+			settings.Muted = append(settings.Muted, value)
+		}
+		page = "kinds"
+	case "quiet":
+		settings.QuietHours = ""
+		if slices.Contains(QuietHoursPresets, value) {
+			settings.QuietHours = value
+		}
+		page = "menu"
+	case "hashtags":
+		settings.Hashtags = !settings.Hashtags
+		page = "menu"
+	case "reset":
+		settings = storage.ChatSettings{}
+		page = "menu"
+	default:
+		changed = false
+	}
+	if changed {
+		b.storage.SetSettings(chatID, settings)
+		if err := b.storage.Save(); err != nil {
+			log.Printf("Error saving settings of chat %s: %v", chatID, err)
+		}
+		log.Printf("Settings of chat %s changed by user %d: %s", chatID, query.From.ID, data)
+	}
+
+	text, markup := b.settingsMenu(&config, lang, chatID, page)
+	req := telegram.EditMessageTextRequest{
+		ChatID:             chatIDString(chat),
+		MessageID:          query.Message.MessageID,
+		Text:               text,
+		ParseMode:          "HTML",
+		ReplyMarkup:        markup,
+		LinkPreviewOptions: &telegram.LinkPreviewOptions{IsDisabled: true},
+	}
+	if err := b.tg.Call("editMessageText", req, nil); err != nil && !telegram.IsNotModified(err) {
+		b.answerCallback(query, tr(lang, "settings_update_failed"))
+		return
+	}
+	b.answerCallback(query, "")
+}
+
+// parsePreset parses the value of a threshold button, "default" for none.
+func parsePreset(value string) *int64 {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return nil
+	}
+	return &n
+}
+
+// isChatAdmin reports whether the user is an admin of chat. Anyone can
+// change the settings of their private chat with the bot.
+func (b *Bot) isChatAdmin(chat telegram.Chat, userID int64) bool {
+	if chat.Type == "private" {
+		return true
+	}
+	var member telegram.ChatMember
+	req := telegram.GetChatMemberRequest{ChatID: chatIDString(chat), UserID: userID}
+	if err := b.tg.Call("getChatMember", req, &member); err != nil {
+		log.Printf("Error checking admin rights of user %d in chat %d: %v", userID, chat.ID, err)
+		return false
+	}
+	return member.Status == "administrator" || member.Status == "creator"
+}
+
+// destinationChat returns the chat ID the bot posts to chat by, the main
+// chat or a route's, given as an ID or as an @username.
+func (c *Config) destinationChat(chat telegram.Chat) (string, bool) {
+	chatIDs := []string{c.ChatID}
+	for _, route := range c.Routes {
+		chatIDs = append(chatIDs, route.ChatID)
+	}
+	for _, chatID := range chatIDs {
+		if chatID != "" && (chatID == chatIDString(chat) || (chat.Username != "" && chatID == "@"+chat.Username)) {
+			return chatID, true
+		}
+	}
+	return "", false
+}
+
+// chatThresholds returns the configured thresholds of chatID at now: those of
+// the main chat, or of the first route to chatID.
+func (c *Config) chatThresholds(chatID string, now time.Time) (score, comments int64) {
+	if chatID == c.ChatID {
+		if c.TopPerHour > 0 {
+			return 0, 0
+		}
+		return c.thresholds(now)
+	}
+	for _, route := range c.Routes {
+		if route.ChatID == chatID {
+			return route.ScoreThreshold, route.CommentsThreshold
+		}
+	}
+	return 0, 0
+}
+
+// settingsMenu renders a page of the settings menu: "menu", "thresholds",
+// "kinds" or "quiet". Any other page closes the menu, leaving the summary.
+func (b *Bot) settingsMenu(config *Config, lang, chatID, page string) (string, *telegram.InlineKeyboardMarkup) {
+	settings := b.storage.Settings(chatID)
+	score, comments := config.chatThresholds(chatID, b.clock.Now())
+	custom := ""
+	if settings.ScoreThreshold != nil || settings.CommentsThreshold != nil {
+		custom = tr(lang, "settings_custom")
+	}
+	if settings.ScoreThreshold != nil {
+		score = *settings.ScoreThreshold
+	}
+	if settings.CommentsThreshold != nil {
+		comments = *settings.CommentsThreshold
+	}
+	kinds := make([]string, 0, len(filter.Kinds))
+	for _, kind := range filter.Kinds {
+		if !slices.Contains(settings.Muted, kind) {
+			kinds = append(kinds, tr(lang, "kind_"+kind))
+		}
+	}
+	quiet := tr(lang, "settings_off")
+	if settings.QuietHours != "" {
+		quiet = settings.QuietHours
+	}
+
+	lines := []string{
+		tr(lang, "settings_header"),
+		tr(lang, "settings_thresholds", score, comments, custom),
+		tr(lang, "settings_kinds", html.EscapeString(strings.Join(kinds, ", "))),
+		tr(lang, "settings_quiet", quiet, config.location()),
+		tr(lang, "settings_hashtags", onOff(lang, settings.Hashtags)),
+	}
+	if len(kinds) == 0 {
+		lines[2] = tr(lang, "settings_kinds", tr(lang, "settings_none"))
+	}
+	text := strings.Join(lines, "\n")
+
+	button := func(text, data string) telegram.InlineKeyboardButton {
+		return telegram.InlineKeyboardButton{Text: text, CallbackData: "settings:" + data}
+	}
+	back := []telegram.InlineKeyboardButton{button(tr(lang, "settings_back_button"), "menu")}
+	var keyboard [][]telegram.InlineKeyboardButton
+	switch page {
+	case "menu":
+		keyboard = [][]telegram.InlineKeyboardButton{
+			{button(tr(lang, "settings_thresholds_button"), "thresholds"), button(tr(lang, "settings_kinds_button"), "kinds")},
+			{button(tr(lang, "settings_quiet_button"), "quiet"), button(tr(lang, "settings_hashtags_button"), "hashtags")},
+			{button(tr(lang, "settings_reset_button"), "reset"), button(tr(lang, "settings_done_button"), "done")},
+		}
+	case "thresholds":
+		row := []telegram.InlineKeyboardButton{button(selected(settings.ScoreThreshold == nil, tr(lang, "settings_default_button")), "score:default")}
+		for _, n := range ScoreThresholdPresets {
+			row = append(row, button(selected(settings.ScoreThreshold != nil && *settings.ScoreThreshold == n, tr(lang, "settings_score_button", n)), "score:"+strconv.FormatInt(n, 10)))
+		}
+		keyboard = append(keyboard, row)
+		row = []telegram.InlineKeyboardButton{button(selected(settings.CommentsThreshold == nil, tr(lang, "settings_default_button")), "comments:default")}
+		for _, n := range CommentsThresholdPresets {
+			row = append(row, button(selected(settings.CommentsThreshold != nil && *settings.CommentsThreshold == n, tr(lang, "settings_comments_button", n)), "comments:"+strconv.FormatInt(n, 10)))
+		}
+		keyboard = append(keyboard, row, back)
+	case "kinds":
+		for _, kind := range filter.Kinds {
+			mark := "✅ "
+			if slices.Contains(settings.Muted, kind) {
+				mark = "❌ "
+			}
+			keyboard = append(keyboard, []telegram.InlineKeyboardButton{button(mark+tr(lang, "kind_"+kind), "kind:"+kind)})
+		}
+		keyboard = append(keyboard, back)
+	case "quiet":
+		row := []telegram.InlineKeyboardButton{button(selected(settings.QuietHours == "", tr(lang, "settings_off")), "quiet:off")}
+		for _, preset := range QuietHoursPresets {
+			row = append(row, button(selected(settings.QuietHours == preset, preset), "quiet:"+preset))
+		}
+		keyboard = append(keyboard, row, back)
+	default:
+		return text, nil
+	}
+	return text, &telegram.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+}
+
+// selected marks the button text of the current choice.
+func selected(ok bool, text string) string {
+	if ok {
+		return "• " + text
+	}
+	return text
+}
+
+func onOff(lang string, on bool) string {
+	if on {
+		return tr(lang, "settings_on")
+	}
+	return tr(lang, "settings_off")
+}
+
+// applySettings narrows chats, the destinations of the story by the config,
+// by the /settings of the main chat and the route chats: their thresholds,
+// muted story kinds and quiet hours. A chat whose thresholds were lowered
+// may be added.
+func (b *Bot) applySettings(config *Config, story *storage.Story, chats []string, now time.Time) []string {
+	b.storage.RLock()
+	none := len(b.storage.ChatSettings) == 0
+	b.storage.RUnlock()
+	if none {
+		return chats
+	}
+
+	candidates := []string{config.ChatID}
+	for _, route := range config.Routes {
+		if !slices.Contains(candidates, route.ChatID) {
+			candidates = append(candidates, route.ChatID)
+		}
+	}
+	var result []string
+	for _, chatID := range candidates {
+		settings := b.storage.Settings(chatID)
+		qualifies := slices.Contains(chats, chatID)
+		if settings.ScoreThreshold != nil || settings.CommentsThreshold != nil {
+			qualifies = config.qualifiesWith(story, chatID, settings, now)
+		}
+		if qualifies && !slices.Contains(settings.Muted, filter.Kind(story)) && !config.quiet(settings, now) {
+			result = append(result, chatID)
+		}
+	}
+	return result
+}
+
+// qualifiesWith reports whether the story qualifies for chatID with the
+// thresholds of its settings in place of the configured ones.
+func (c *Config) qualifiesWith(story *storage.Story, chatID string, settings storage.ChatSettings, now time.Time) bool {
+	override := func(score, comments int64) (int64, int64) {
+		if settings.ScoreThreshold != nil {
+			score = *settings.ScoreThreshold
+		}
+		if settings.CommentsThreshold != nil {
+			comments = *settings.CommentsThreshold
+		}
+		return score, comments
+	}
+	if chatID == c.ChatID {
+		score, comments := override(c.storyThresholds(story, now))
+		if !filter.BelowThresholds(story, score, comments) {
+			return true
+		}
+	}
+	for _, route := range c.Routes {
+		if route.ChatID != chatID {
+			continue
+		}
+		route.ScoreThreshold, route.CommentsThreshold = override(route.ScoreThreshold, route.CommentsThreshold)
+		if route.Accepts(story) {
+			return true
+		}
+	}
+	return false
+}
+
+// quiet reports whether now falls within the quiet hours of settings.
+// Stories that qualify meanwhile are posted once they end.
+func (c *Config) quiet(settings storage.ChatSettings, now time.Time) bool {
+	if settings.QuietHours == "" {
+		return false
+	}
+	window, err := ParsePostingWindow(settings.QuietHours)
+	return err == nil && window.contains(now.In(c.location()))
+}
+
+// hashtags returns the hashtags of the story: its kind and the site it links
+// to, such as "#ShowHN #github".
+func hashtags(s *storage.Story) string {
+	var tags []string
+	switch filter.Kind(s) {
+	case filter.KindShow:
+		tags = append(tags, "#ShowHN")
+	case filter.KindAsk:
+		tags = append(tags, "#AskHN")
+	case filter.KindLaunch:
+		tags = append(tags, "#LaunchHN")
+	}
+	// Text posts link to their own discussion
+	domain := storyDomain(s.URL)
+	if labels := strings.Split(domain, "."); len(labels) >= 2 && domain != "news.ycombinator.com" {
+		site := labels[len(labels)-2]
+		// Second-level domains such as co.uk
+		if len(site) <= 3 && len(labels) >= 3 {
+			site = labels[len(labels)-3]
+		}
+		site = strings.Map(func(r rune) rune {
+			if r == '-' || r == '_' {
+				return -1
+			}
+			return r
+		}, site)
+		if site != "" {
+			tags = append(tags, "#"+site)
+		}
+	}
+	return strings.Join(tags, " ")
+}
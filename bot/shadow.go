@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+const ShadowFile = "shadow.jsonl"
+
+// ShadowConfig is a filter configuration evaluated alongside the live one
+// without sending anything. Unset fields use the live values; an empty
+// threshold_schedule or routes list disables them in the shadow.
+type ShadowConfig struct {
+	ScoreThreshold    *int64            `json:"score_threshold,omitempty" yaml:"score_threshold,omitempty" toml:"score_threshold,omitempty"`
+	CommentsThreshold *int64            `json:"comments_threshold,omitempty" yaml:"comments_threshold,omitempty" toml:"comments_threshold,omitempty"`
+	ThresholdSchedule []ThresholdWindow `json:"threshold_schedule,omitempty" yaml:"threshold_schedule,omitempty" toml:"threshold_schedule,omitempty"`
+	Routes            []filter.Route    `json:"routes,omitempty" yaml:"routes,omitempty" toml:"routes,omitempty"`
+}
+
+func (s *ShadowConfig) String() string {
+	if s == nil {
+		return "off"
+	}
+	return fmt.Sprintf("%s schedule=%v routes=%v", HotThresholds{Score: s.ScoreThreshold, Comments: s.CommentsThreshold}, s.ThresholdSchedule, s.Routes)
+}
+
+// ShadowEntry is a post the shadow configuration would have made, as
+// written to ShadowFile.
+type ShadowEntry struct {
+	Time     time.Time `json:"time"`
+	StoryID  int64     `json:"story_id"`
+	Title    string    `json:"title"`
+	Score    int64     `json:"score"`
+	Comments int64     `json:"comments"`
+	ChatID   string    `json:"chat_id"`
+
+	// Live is whether the live configuration posts the story to the chat
+	// too, by the same poll at the latest.
+	Live bool `json:"live"`
+}
+
+var shadowFileMutex sync.Mutex
+
+// shadowed returns the live config with the shadow's filters applied, or nil
+// when no shadow is configured.
+func (c *Config) shadowed() *Config {
+	if c.Shadow == nil {
+		return nil
+	}
+	shadow := *c
+	if c.Shadow.ScoreThreshold != nil {
+		shadow.ScoreThreshold = *c.Shadow.ScoreThreshold
+	}
+	if c.Shadow.CommentsThreshold != nil {
+		shadow.CommentsThreshold = *c.Shadow.CommentsThreshold
+	}
+	if c.Shadow.ThresholdSchedule != nil {
+		shadow.ThresholdSchedule = c.Shadow.ThresholdSchedule
+	}
+	if c.Shadow.Routes != nil {
+		shadow.Routes = c.Shadow.Routes
+	}
+	return &shadow
+}
+
+// validate checks the shadow's thresholds and compiles its routes. Its
+// threshold windows are compiled by validateSchedules.
+func (s *ShadowConfig) validate() error {
+	if (s.ScoreThreshold != nil && *s.ScoreThreshold < 0) || (s.CommentsThreshold != nil && *s.CommentsThreshold < 0) {
+		return fmt.Errorf("shadow: thresholds must not be negative")
+	}
+	for i := range s.Routes {
+		if err := s.Routes[i].Compile(); err != nil {
+			return fmt.Errorf("shadow: %w", err)
+		}
+	}
+	return nil
+}
+
+// shadow records the chats the shadow configuration would post the story to
+// for the first time. live are the chats the live configuration posts it to.
+func (b *Bot) shadow(config *Config, story *storage.Story, live []string) {
+	shadow := config.shadowed()
+	if shadow == nil {
+		return
+	}
+
+	for _, chatID := range b.destinations(shadow, story) {
+		if slices.Contains(story.Shadow, chatID) {
+			continue
+		}
+		story.Shadow = append(story.Shadow, chatID)
+
+		_, posted := story.Messages[chatID]
+		entry := ShadowEntry{
+			Time:     b.clock.Now().UTC(),
+			StoryID:  story.ID,
+			Title:    story.Title,
+			Score:    story.Score,
+			Comments: story.Descendants,
+			ChatID:   chatID,
+			Live:     posted || slices.Contains(live, chatID),
+		}
+		log.Printf("Shadow: would post story %d to %s (live: %t) - %s", story.ID, chatID, entry.Live, story.Title)
+		if err := appendShadowEntry(config.statePath(ShadowFile), entry); err != nil {
+			log.Printf("Error writing shadow entry: %v", err)
+		}
+	}
+}
+
+func appendShadowEntry(path string, entry ShadowEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	shadowFileMutex.Lock()
+	defer shadowFileMutex.Unlock()
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
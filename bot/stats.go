@@ -0,0 +1,142 @@
+package bot
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// count adds to the persisted counters reported by /stats and /api/stats.
+func (b *Bot) count(delta storage.Counters) {
+	b.storage.Count(delta, b.clock.Now())
+}
+
+// RejectedByFilter counts the stories rejected by the filters added with
+// WithFilters, next to the rules of filter.Explain.
+const RejectedByFilter = "filter"
+
+// countRejection counts a story that qualifies for no chat under the rule
+// that rejected it, at most once per UTC day.
+func (b *Bot) countRejection(config *Config, story *storage.Story) {
+	now := b.clock.Now()
+	today := now.UTC().Format(time.DateOnly)
+	if story.RejectedOn == today {
+		return
+	}
+	rule := RejectedByFilter
+	if !slices.ContainsFunc(b.storyFilters(config), func(accept Filter) bool { return !accept(story) }) {
+		score, comments := config.storyThresholds(story, now)
+		rule = filter.Rejection(filter.Explain(story, config.ChatID, score, comments, config.Routes))
+	}
+	if rule == "" || rule == filter.RuleFeed {
+		// Stories only on feeds are no rejections of the top list
+		return
+	}
+	story.RejectedOn = today
+	b.storage.CountRejection(rule, now)
+}
+
+// rejectionLines formats today's rejections by filter rule.
+func (b *Bot) rejectionLines() []string {
+	rejected := b.storage.MetricsSnapshot().RejectedToday(b.clock.Now())
+	rules := make([]string, 0, len(rejected))
+	for rule := range rejected {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+
+	lines := make([]string, len(rules))
+	for i, rule := range rules {
+		lines[i] = fmt.Sprintf("%s=%d", rule, rejected[rule])
+	}
+	return lines
+}
+
+// longestOnFrontPage returns the story on the front page that has been there
+// the longest, or nil.
+func (b *Bot) longestOnFrontPage() *storage.Story {
+	b.storage.RLock()
+	defer b.storage.RUnlock()
+
+	var longest *storage.Story
+	for _, story := range b.storage.Stories {
+		if story.Rank > 0 && story.FrontPage() >= time.Minute &&
+			(longest == nil || story.FrontPageSeconds > longest.FrontPageSeconds) {
+			longest = story
+		}
+	}
+	if longest == nil {
+		return nil
+	}
+	return longest.Clone()
+}
+
+// anomaly is the hn.Client OnAnomaly hook.
+func (b *Bot) anomaly(a hn.Anomaly) {
+	log.Printf("Warning: unexpected HN API data: %s", a)
+	b.count(storage.Counters{HNAnomalies: 1})
+}
+
+func (b *Bot) registerStats() {
+	b.handleCommand("stats", b.statsCommand)
+}
+
+// statsCommand replies with today's and the total counters. With
+// ADMIN_CHAT_ID set, it only answers there.
+func (b *Bot) statsCommand(msg *telegram.Message, args string) {
+	config := b.cfg()
+	if config.AdminChatID != "" && !config.isAdminChat(msg.Chat) {
+		return
+	}
+
+	lang := b.chatLanguage(msg.Chat)
+	now := b.clock.Now()
+	metrics := b.storage.MetricsSnapshot()
+	if metrics.Since.IsZero() {
+		metrics.Since = now
+	}
+	format := func(c storage.Counters) string {
+		return tr(lang, "stats_counters", c.Posted, c.Edited, c.Deleted, c.APIErrors, c.HNAnomalies)
+	}
+
+	lines := []string{
+		tr(lang, "stats_today", format(metrics.Today(now))),
+		tr(lang, "stats_total", metrics.Since.Format("2006-01-02"), format(metrics.Total)),
+		fmt.Sprintf("<code>%s</code>", formatStateCounts(b.stateCounts())),
+	}
+	if budgets := b.budgetLines(); len(budgets) > 0 {
+		lines = append(lines, tr(lang, "stats_budgets", html.EscapeString(strings.Join(budgets, " "))))
+	}
+	if rejections := b.rejectionLines(); len(rejections) > 0 {
+		lines = append(lines, tr(lang, "stats_rejected", html.EscapeString(strings.Join(rejections, " "))))
+	}
+	if story := b.longestOnFrontPage(); story != nil {
+		lines = append(lines, tr(lang, "stats_front_page", html.EscapeString(hn.ItemURL(story.ID)),
+			html.EscapeString(story.Title), frontPageTime(story.FrontPage())))
+	}
+	memory := b.memoryStats()
+	lines = append(lines, tr(lang, "stats_memory", megabytes(memory.HeapAlloc), megabytes(memory.Sys),
+		html.EscapeString(memory.cacheLine())))
+	for _, host := range b.outbound.hostCounters() {
+		lines = append(lines, tr(lang, "stats_host", html.EscapeString(host.Host), host.Requests, host.Errors, host.RateLimited))
+	}
+	variants := make([]string, 0, len(metrics.Variants))
+	for variant := range metrics.Variants {
+		variants = append(variants, variant)
+	}
+	sort.Strings(variants)
+	for _, variant := range variants {
+		counters := metrics.Variants[variant]
+		lines = append(lines, tr(lang, "stats_variant", html.EscapeString(variant), counters.Posted, counters.Reactions))
+	}
+	b.reply(msg, strings.Join(lines, "\n"), nil)
+}
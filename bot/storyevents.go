@@ -0,0 +1,115 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+const StoryEventQueueSize = 256
+
+// Story lifecycle events, sent to the webhooks and the event bus.
+const (
+	StoryPosted  = "story.posted"
+	StoryUpdated = "story.updated"
+	StoryRemoved = "story.removed"
+)
+
+// StoryEvent is a story lifecycle event as it is sent, JSON encoded, to the
+// webhooks and the event bus.
+type StoryEvent struct {
+	Event string     `json:"event"`
+	Time  time.Time  `json:"time"`
+	Story EventStory `json:"story"`
+}
+
+// EventStory is a story as sent in events, with the IDs of its messages by
+// chat.
+type EventStory struct {
+	ID       int64            `json:"id"`
+	Title    string           `json:"title"`
+	URL      string           `json:"url,omitempty"`
+	HNURL    string           `json:"hn_url"`
+	By       string           `json:"by,omitempty"`
+	Score    int64            `json:"score"`
+	Comments int64            `json:"comments"`
+	State    storage.State    `json:"state"`
+	Messages map[string]int64 `json:"messages,omitempty"`
+}
+
+// storyTransition is the TransitionHook sending story.posted and
+// story.removed.
+func (b *Bot) storyTransition(story *storage.Story, from, to storage.State) {
+	switch to {
+	case storage.StatePosted:
+		b.publishStory(StoryPosted, story)
+	case storage.StateDeleted, storage.StateArchived, storage.StateSuppressed:
+		switch from {
+		case storage.StatePosted, storage.StateUpdating, storage.StateDormant, storage.StateExpiring:
+			b.publishStory(StoryRemoved, story)
+		}
+	}
+}
+
+// publishStory queues an event for the webhooks and the event bus. It never
+// blocks: when the queue is full the event is dropped.
+func (b *Bot) publishStory(event string, story *storage.Story) {
+	if len(b.cfg().WebhookURLs) == 0 && b.bus == nil {
+		return
+	}
+	messages := make(map[string]int64, len(story.Messages))
+	for chatID, msg := range story.Messages {
+		messages[chatID] = msg.MessageID
+	}
+	e := StoryEvent{
+		Event: event,
+		Time:  b.clock.Now().UTC(),
+		Story: EventStory{
+			ID:       story.ID,
+			Title:    story.Title,
+			URL:      story.URL,
+			HNURL:    hn.ItemURL(story.ID),
+			By:       story.By,
+			Score:    story.Score,
+			Comments: story.Descendants,
+			State:    story.State,
+			Messages: messages,
+		},
+	}
+	select {
+	case b.storyEvents <- e:
+	default:
+		log.Printf("Story event queue is full, dropping %s event of story %d", event, story.ID)
+	}
+}
+
+// runStoryEvents delivers the queued events in order until ctx is done.
+func (b *Bot) runStoryEvents(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-b.storyEvents:
+			body, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("Error encoding story event: %v", err)
+				continue
+			}
+			config := b.cfg()
+			for _, target := range config.WebhookURLs {
+				if err := b.postWebhook(ctx, target, config.WebhookSecret, event.Event, body); err != nil {
+					log.Printf("Error delivering %s event of story %d to %s: %v", event.Event, event.Story.ID, target, err)
+				}
+			}
+			if b.bus != nil {
+				if err := b.publishToBus(ctx, event, body); err != nil {
+					log.Printf("Error publishing %s event of story %d: %v", event.Event, event.Story.ID, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package bot
+
+import (
+	"errors"
+	"html"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+func (b *Bot) registerSuggest() {
+	b.handleCommand("suggest", b.suggestCommand)
+	b.handleCallback("suggest:", b.suggestCallback)
+}
+
+// isSuggestChat reports whether chat is SUGGEST_CHAT_ID, given as an ID or as
+// an @username.
+func (c *Config) isSuggestChat(chat telegram.Chat) bool {
+	return c.SuggestChatID != "" && (c.SuggestChatID == chatIDString(chat) ||
+		(chat.Username != "" && c.SuggestChatID == "@"+chat.Username))
+}
+
+// displayName names a user in messages, by @username when they have one.
+func displayName(user telegram.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return user.FirstName
+}
+
+// suggestCommand handles "/suggest <hn-url-or-id>" in the suggestion chat.
+func (b *Bot) suggestCommand(msg *telegram.Message, args string) {
+	config := b.cfg()
+	if !config.isSuggestChat(msg.Chat) || msg.From == nil {
+		return
+	}
+	id, ok := hn.ParseItemID(args)
+	if !ok {
+		b.reply(msg, tr(b.chatLanguage(msg.Chat), "suggest_usage"), nil)
+		return
+	}
+
+	// Serialize with polling, which also posts stories
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	b.actors.do(id, func() { b.suggest(msg, id) })
+}
+
+// suggest posts the suggestion of a story to the suggestion chat for admins
+// to decide and members to vote on. It runs on the story's actor.
+func (b *Bot) suggest(msg *telegram.Message, id int64) {
+	config := b.cfg()
+	lang := b.chatLanguage(msg.Chat)
+	if stored, ok := b.getStoredStory(id); ok {
+		if _, posted := stored.Messages[config.ChatID]; posted {
+			b.reply(msg, tr(lang, "suggest_posted_already"), nil)
+			return
+		}
+		if stored.State == storage.StateSuppressed {
+			b.reply(msg, tr(lang, "suggest_suppressed"), nil)
+			return
+		}
+	}
+	if _, ok := b.storage.Suggestion(id); ok {
+		b.reply(msg, tr(lang, "suggest_pending"), nil)
+		return
+	}
+	story, err := b.getStoryDetails(id)
+	if errors.Is(err, errItemGone) || (err == nil && story.Type != "story") {
+		b.reply(msg, tr(lang, "suggest_not_story"), nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Error getting suggested story %d: %v", id, err)
+		b.reply(msg, tr(lang, "suggest_failed"), nil)
+		return
+	}
+
+	suggestion := storage.Suggestion{
+		StoryID:   id,
+		Title:     story.Title,
+		By:        displayName(*msg.From),
+		UserID:    msg.From.ID,
+		Suggested: b.clock.Now(),
+	}
+	text := suggestionText(lang, suggestion)
+	if config.SuggestVotes > 0 {
+		text += "\n" + tr(lang, "suggest_votes", config.SuggestVotes)
+	}
+	idText := strconv.FormatInt(id, 10)
+	sent, err := b.tg.SendMessage(telegram.SendMessageRequest{
+		ChatID:    chatIDString(msg.Chat),
+		Text:      text,
+		ParseMode: "HTML",
+		ReplyMarkup: &telegram.InlineKeyboardMarkup{InlineKeyboard: [][]telegram.InlineKeyboardButton{{
+			{Text: tr(lang, "suggest_post_button"), CallbackData: "suggest:post:" + idText},
+			{Text: tr(lang, "suggest_dismiss_button"), CallbackData: "suggest:dismiss:" + idText},
+		}}},
+		LinkPreviewOptions: &telegram.LinkPreviewOptions{IsDisabled: true},
+		ReplyParameters:    &telegram.ReplyParameters{MessageID: msg.MessageID, AllowSendingWithoutReply: true},
+	})
+	if err != nil {
+		log.Printf("Error posting suggestion of story %d: %v", id, err)
+		return
+	}
+	suggestion.MessageID = sent.MessageID
+	b.storage.AddSuggestion(suggestion)
+	if err := b.storage.Save(); err != nil {
+		log.Printf("Error saving suggestion of story %d: %v", id, err)
+	}
+	log.Printf("Story %d suggested by %s", id, suggestion.By)
+}
+
+func suggestionText(lang string, s storage.Suggestion) string {
+	return tr(lang, "suggest_prompt", hn.ItemURL(s.StoryID), html.EscapeString(s.Title), html.EscapeString(s.By))
+}
+
+// suggestCallback handles "suggest:<post|dismiss>:<id>" button presses of the
+// admins of the suggestion chat.
+func (b *Bot) suggestCallback(query *telegram.CallbackQuery, data string) {
+	config := b.cfg()
+	if query.Message == nil || !config.isSuggestChat(query.Message.Chat) {
+		b.answerCallback(query, "")
+		return
+	}
+	action, idText, _ := strings.Cut(data, ":")
+	id, err := strconv.ParseInt(idText, 10, 64)
+	if err != nil || (action != "post" && action != "dismiss") {
+		b.answerCallback(query, "")
+		return
+	}
+	lang := b.chatLanguage(query.Message.Chat)
+	if !b.isChatAdmin(query.Message.Chat, query.From.ID) {
+		b.answerCallback(query, tr(lang, "suggest_admins_only"))
+		return
+	}
+
+	// Serialize with polling, which also posts stories
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	b.actors.do(id, func() {
+		who := html.EscapeString(displayName(query.From))
+		var answer string
+		switch {
+		case action == "dismiss":
+			suggestion, ok := b.storage.TakeSuggestion(id)
+			if !ok {
+				answer = tr(lang, "suggest_gone")
+				break
+			}
+			log.Printf("Suggestion of story %d dismissed by %s", id, who)
+			b.closeSuggestion(suggestion, tr(lang, "suggest_dismissed", who))
+			if err := b.storage.Save(); err != nil {
+				log.Printf("Error saving suggestions: %v", err)
+			}
+		default:
+			if err := b.postSuggestion(id, tr(lang, "suggest_approved", who)); errors.Is(err, errNoSuggestion) {
+				answer = tr(lang, "suggest_gone")
+			} else if err != nil {
+				answer = tr(lang, "suggest_post_failed")
+			}
+		}
+		b.answerCallback(query, answer)
+	})
+}
+
+var errNoSuggestion = errors.New("no such suggestion")
+
+// postSuggestion posts a suggested story to CHAT_ID as a community pick and
+// closes its suggestion with decision. On failure the suggestion stays open.
+// It runs on the story's actor.
+func (b *Bot) postSuggestion(id int64, decision string) error {
+	suggestion, ok := b.storage.TakeSuggestion(id)
+	if !ok {
+		return errNoSuggestion
+	}
+	config := b.cfg()
+	story, exists := b.getStoredStory(id)
+	if !exists {
+		var err error
+		if story, err = b.getStoryDetails(id); err != nil {
+			b.storage.AddSuggestion(suggestion)
+			log.Printf("Error getting suggested story %d: %v", id, err)
+			return err
+		}
+	}
+
+	story.CommunityPick = true
+	if _, posted := story.Messages[config.ChatID]; !posted {
+		if err := b.sendMessage(story, config.ChatID); err != nil {
+			b.storage.AddSuggestion(suggestion)
+			log.Printf("Error posting suggested story %d: %v", id, err)
+			return err
+		}
+	} else if err := b.saveStory(story); err != nil {
+		log.Printf("Error saving story %d: %v", id, err)
+	}
+	log.Printf("Posted suggested story %d as a community pick", id)
+	b.closeSuggestion(suggestion, decision)
+	return b.storage.Save()
+}
+
+// closeSuggestion replaces the buttons and the vote line of a suggestion
+// message with the decision.
+func (b *Bot) closeSuggestion(s storage.Suggestion, decision string) {
+	config := b.cfg()
+	req := telegram.EditMessageTextRequest{
+		ChatID:             config.SuggestChatID,
+		MessageID:          s.MessageID,
+		Text:               suggestionText(config.language(config.SuggestChatID), s) + "\n\n" + decision,
+		ParseMode:          "HTML",
+		LinkPreviewOptions: &telegram.LinkPreviewOptions{IsDisabled: true},
+	}
+	if err := b.tg.Call("editMessageText", req, nil); err != nil {
+		log.Printf("Error updating suggestion of story %d: %v", s.StoryID, err)
+	}
+}
+
+// suggestionReaction counts the reaction of a member to a suggestion message
+// as a vote, and posts the story once it has SuggestVotes votes. Reactions of
+// the member who suggested it do not count.
+func (b *Bot) suggestionReaction(update *telegram.MessageReactionUpdated) {
+	config := b.cfg()
+	if config.SuggestVotes == 0 || !config.isSuggestChat(update.Chat) || update.User == nil || update.User.IsBot {
+		return
+	}
+	suggestion, ok := b.storage.VoteSuggestion(update.MessageID, update.User.ID, len(update.NewReaction) > 0)
+	if !ok {
+		return
+	}
+	votes := len(suggestion.Voters)
+	if slices.Contains(suggestion.Voters, suggestion.UserID) {
+		votes--
+	}
+	if votes < config.SuggestVotes {
+		if err := b.storage.Save(); err != nil {
+			log.Printf("Error saving suggestion votes: %v", err)
+		}
+		return
+	}
+
+	// Serialize with polling, which also posts stories
+	b.cycleMutex.Lock()
+	defer b.cycleMutex.Unlock()
+
+	lang := config.language(config.SuggestChatID)
+	b.actors.do(suggestion.StoryID, func() {
+		if err := b.postSuggestion(suggestion.StoryID, tr(lang, "suggest_voted", votes)); err != nil && !errors.Is(err, errNoSuggestion) {
+			log.Printf("Error posting story %d after %d votes: %v", suggestion.StoryID, votes, err)
+		}
+	})
+}
+
+// pruneSuggestions closes the suggestions nobody decided on in
+// storage.SuggestionTTL.
+func (b *Bot) pruneSuggestions() {
+	config := b.cfg()
+	for _, suggestion := range b.storage.PruneSuggestions(b.clock.Now()) {
+		b.closeSuggestion(suggestion, tr(config.language(config.SuggestChatID), "suggest_expired"))
+	}
+}
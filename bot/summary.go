@@ -0,0 +1,257 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/summarize"
+)
+
+const (
+	// Summary providers
+	SummaryOpenAI     = "openai"
+	SummaryOllama     = "ollama"
+	SummaryExtractive = "extractive"
+
+	// MaxSummaryChars is how long a summary in a message may be.
+	MaxSummaryChars = 600
+
+	// DiscussionComments is how many comments the discussion summary is
+	// made of, and MinDiscussionComments how many there have to be for one.
+	// Discussions change a lot in their first hours, so the summary is made
+	// again once when the story is DiscussionRefreshAge old.
+	DiscussionComments     = 30
+	MinDiscussionComments  = 5
+	DiscussionRefreshAge   = 3 * time.Hour
+	DiscussionFetchTimeout = 30 * time.Second
+)
+
+// summaryDefaults holds the URL, model and timeout each provider uses unless
+// configured otherwise. Local models get longer, as they often run on CPUs.
+var summaryDefaults = map[string]SummaryConfig{
+	SummaryOpenAI:     {URL: "https://api.openai.com/v1", Model: "gpt-4o-mini", Timeout: Duration(30 * time.Second)},
+	SummaryOllama:     {URL: "http://localhost:11434", Model: "llama3.2", Timeout: Duration(2 * time.Minute)},
+	SummaryExtractive: {},
+}
+
+// SummaryConfig selects the provider of the summary enricher.
+type SummaryConfig struct {
+	Provider string   `json:"provider,omitempty" yaml:"provider,omitempty" toml:"provider,omitempty"`
+	URL      string   `json:"url,omitempty" yaml:"url,omitempty" toml:"url,omitempty"`
+	Model    string   `json:"model,omitempty" yaml:"model,omitempty" toml:"model,omitempty"`
+	APIKey   string   `json:"api_key,omitempty" yaml:"api_key,omitempty" toml:"api_key,omitempty"`
+	Timeout  Duration `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+}
+
+func (c SummaryConfig) String() string {
+	if c.Provider == "" {
+		return "off"
+	}
+	c = c.withDefaults()
+	s := fmt.Sprintf("provider=%s", c.Provider)
+	if c.Provider != SummaryExtractive {
+		s += fmt.Sprintf(" url=%s model=%s timeout=%v", c.URL, c.Model, time.Duration(c.Timeout))
+	}
+	return s
+}
+
+// merge overrides fields with the ones set in other.
+func (c *SummaryConfig) merge(other SummaryConfig) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.Provider, other.Provider},
+		{&c.URL, other.URL},
+		{&c.Model, other.Model},
+		{&c.APIKey, other.APIKey},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+	if other.Timeout != 0 {
+		c.Timeout = other.Timeout
+	}
+}
+
+func (c *SummaryConfig) applyEnv() error {
+	if timeout := os.Getenv("SUMMARY_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid SUMMARY_TIMEOUT %q: %w", timeout, err)
+		}
+		c.Timeout = Duration(d)
+	}
+	apiKey, err := secretEnv("SUMMARY_API_KEY")
+	if err != nil {
+		return err
+	}
+	c.merge(SummaryConfig{
+		Provider: os.Getenv("SUMMARY_PROVIDER"),
+		URL:      os.Getenv("SUMMARY_URL"),
+		Model:    os.Getenv("SUMMARY_MODEL"),
+		APIKey:   apiKey,
+	})
+	return nil
+}
+
+func (c SummaryConfig) validate(enrichers []string) error {
+	if _, ok := summaryDefaults[c.Provider]; c.Provider != "" && !ok {
+		return fmt.Errorf("summary provider must be %s, %s or %s, got %q", SummaryOpenAI, SummaryOllama, SummaryExtractive, c.Provider)
+	}
+	for _, name := range enrichers {
+		switch {
+		case name == "summary" && c.Provider == "":
+			return fmt.Errorf("the summary enricher requires SUMMARY_PROVIDER")
+		case name == "discussion" && (c.Provider == "" || c.Provider == SummaryExtractive):
+			return fmt.Errorf("the discussion enricher requires SUMMARY_PROVIDER %s or %s", SummaryOpenAI, SummaryOllama)
+		}
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("summary timeout must not be negative, got %v", time.Duration(c.Timeout))
+	}
+	return nil
+}
+
+// withDefaults fills in the provider's defaults for unset fields.
+func (c SummaryConfig) withDefaults() SummaryConfig {
+	defaults := summaryDefaults[c.Provider]
+	defaults.merge(c)
+	return defaults
+}
+
+// summarizer returns the configured provider.
+func (c SummaryConfig) summarizer(httpClient *http.Client) summarize.Summarizer {
+	c = c.withDefaults()
+	switch c.Provider {
+	case SummaryOpenAI:
+		return &summarize.OpenAI{BaseURL: c.URL, Model: c.Model, APIKey: c.APIKey, HTTPClient: httpClient}
+	case SummaryOllama:
+		return &summarize.Ollama{BaseURL: c.URL, Model: c.Model, HTTPClient: httpClient}
+	}
+	return summarize.Extractive{MaxChars: MaxSummaryChars}
+}
+
+// summaryEnricher adds a short summary of the article a story links to.
+type summaryEnricher struct {
+	config     SummaryConfig
+	articles   *articleCache
+	httpClient *http.Client
+}
+
+func (summaryEnricher) Name() string { return "summary" }
+
+// Timeout lets the summary take longer than the other enrichers, as language
+// models can be slow.
+func (e summaryEnricher) Timeout() time.Duration {
+	return ArticleFetchTimeout + time.Duration(e.config.withDefaults().Timeout)
+}
+
+func (e summaryEnricher) Enrich(ctx context.Context, story *storage.Story) (string, error) {
+	if story.URL == "" {
+		return "", nil
+	}
+	text, err := e.articles.text(ctx, story.URL)
+	if err != nil || text == "" {
+		return "", err
+	}
+
+	config := e.config.withDefaults()
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(config.Timeout))
+		defer cancel()
+	}
+	summary, err := config.summarizer(e.httpClient).Summarize(ctx, summarize.ArticleInstruction, story.Title, text)
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize with %s: %w", config.Provider, err)
+	}
+	summary = summarize.FirstParagraphs(summary, MaxSummaryChars)
+	if summary == "" {
+		return "", nil
+	}
+	return "📝 " + html.EscapeString(summary), nil
+}
+
+// storySummary returns the plain text of the story's summary enrichment, or
+// "" when it has none.
+func storySummary(story *storage.Story) string {
+	line, ok := strings.CutPrefix(story.Enrichments["summary"], "📝 ")
+	if !ok {
+		return ""
+	}
+	return html.UnescapeString(line)
+}
+
+// discussionEnricher adds a summary of the main viewpoints in the top
+// comments of a story, "What HN thinks".
+type discussionEnricher struct {
+	config     Config
+	hn         *hn.Client
+	httpClient *http.Client
+}
+
+func (discussionEnricher) Name() string { return "discussion" }
+
+func (e discussionEnricher) Timeout() time.Duration {
+	return DiscussionFetchTimeout + time.Duration(e.config.Summary.withDefaults().Timeout)
+}
+
+func (e discussionEnricher) Enrich(ctx context.Context, story *storage.Story) (string, error) {
+	item, err := e.hn.Item(story.ID)
+	if err != nil {
+		return "", err
+	}
+	comments, err := e.hn.Comments(item, DiscussionComments)
+	if err != nil {
+		return "", fmt.Errorf("failed to get comments: %w", err)
+	}
+	if len(comments) < MinDiscussionComments {
+		return "", nil
+	}
+	var text strings.Builder
+	for _, comment := range comments {
+		text.WriteString("- " + summarize.ExtractText(comment.Text) + "\n")
+	}
+
+	config := e.config.Summary.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Timeout))
+	defer cancel()
+	summary, err := config.summarizer(e.httpClient).Summarize(ctx, summarize.DiscussionInstruction, story.Title, text.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize with %s: %w", config.Provider, err)
+	}
+	summary = summarize.FirstParagraphs(summary, MaxSummaryChars)
+	if summary == "" {
+		return "", nil
+	}
+	return tr(e.config.language(e.config.ChatID), "discussion_summary", html.EscapeString(summary)), nil
+}
+
+// refreshDiscussionLater queues the story for a new discussion summary once
+// it is DiscussionRefreshAge old, if its first one was made earlier.
+func (b *Bot) refreshDiscussionLater(config *Config, story *storage.Story) {
+	if _, done := story.Enrichments["discussion"]; !done || story.DiscussionFinal ||
+		!slices.Contains(config.Enrichers, "discussion") ||
+		b.clock.Now().Sub(story.FirstSeen) < DiscussionRefreshAge {
+		return
+	}
+	// Refreshed at most once, even when the queue is full
+	story.DiscussionFinal = true
+	select {
+	case b.enrichQueue <- enrichJob{id: story.ID, refresh: "discussion"}:
+		log.Printf("Refreshing the discussion summary of story %d", story.ID)
+	default:
+		log.Printf("Enrichment queue is full, not refreshing the discussion summary of story %d", story.ID)
+	}
+}
@@ -0,0 +1,241 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	UpdatesTimeout    = 30 // seconds, long-poll timeout for getUpdates
+	UpdatesRetryDelay = 5 * time.Second
+
+	// UpdateWorkers is how many updates are handled concurrently.
+	UpdateWorkers    = 4
+	UpdatesQueueSize = 16
+)
+
+// CommandHandler handles a "/command args" message.
+type CommandHandler func(msg *telegram.Message, args string)
+
+// CallbackHandler handles an inline button press whose data starts with the
+// prefix it was registered for. data excludes the prefix.
+type CallbackHandler func(query *telegram.CallbackQuery, data string)
+
+type commandRegistry struct {
+	commands  map[string]CommandHandler
+	callbacks map[string]CallbackHandler
+}
+
+func (b *Bot) handleCommand(name string, handler CommandHandler) {
+	if b.registry.commands == nil {
+		b.registry.commands = make(map[string]CommandHandler)
+	}
+	b.registry.commands[name] = handler
+}
+
+func (b *Bot) handleCallback(prefix string, handler CallbackHandler) {
+	if b.registry.callbacks == nil {
+		b.registry.callbacks = make(map[string]CallbackHandler)
+	}
+	b.registry.callbacks[prefix] = handler
+}
+
+// runUpdates long-polls getUpdates until ctx is done and hands the updates to
+// UpdateWorkers workers. Updates from the same chat always go to the same
+// worker, so they are handled in order. The offset is persisted once a batch
+// is queued: after a restart the bot resumes with the updates it has not
+// received, and a batch cut short by shutdown is not handled again.
+func (b *Bot) runUpdates(ctx context.Context) {
+	var wg sync.WaitGroup
+	queues := make([]chan *telegram.Update, UpdateWorkers)
+	for i := range queues {
+		queues[i] = make(chan *telegram.Update, UpdatesQueueSize)
+		wg.Add(1)
+		go func(queue <-chan *telegram.Update) {
+			defer wg.Done()
+			for update := range queue {
+				b.dispatchUpdate(update)
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	b.storage.RLock()
+	offset := b.storage.UpdatesOffset
+	b.storage.RUnlock()
+
+	for ctx.Err() == nil {
+		allowed := b.allowedUpdates()
+		if len(allowed) == 0 {
+			b.sleep(ctx, UpdatesRetryDelay)
+			continue
+		}
+
+		var updates []telegram.Update
+		req := telegram.GetUpdatesRequest{
+			Offset:         offset,
+			Timeout:        UpdatesTimeout,
+			AllowedUpdates: allowed,
+		}
+		if err := b.tg.Call("getUpdates", req, &updates); err != nil {
+			log.Printf("Error getting updates: %v", err)
+			b.sleep(ctx, UpdatesRetryDelay)
+			continue
+		}
+		if len(updates) == 0 {
+			continue
+		}
+
+		for i := range updates {
+			update := &updates[i]
+			queues[updateChat(update)%UpdateWorkers] <- update
+		}
+		offset = updates[len(updates)-1].UpdateID + 1
+		b.storage.Lock()
+		b.storage.UpdatesOffset = offset
+		b.storage.Unlock()
+		if err := b.storage.Save(); err != nil {
+			log.Printf("Error saving updates offset: %v", err)
+		}
+	}
+}
+
+// allowedUpdates are the update types the bot has handlers for: messages
+// with commands enabled, button presses with commands or moderation enabled,
+// reactions to suggestions when members vote on them, and reaction counts
+// while an experiment runs.
+func (b *Bot) allowedUpdates() []string {
+	config := b.cfg()
+	var allowed []string
+	if config.EnableCommands {
+		allowed = append(allowed, "message", "channel_post")
+	}
+	if config.EnableCommands || config.Moderation.enabled() {
+		allowed = append(allowed, "callback_query")
+	}
+	if config.SuggestChatID != "" && config.SuggestVotes > 0 {
+		allowed = append(allowed, "message_reaction")
+	}
+	if config.Experiment != nil {
+		allowed = append(allowed, "message_reaction_count")
+	}
+	return allowed
+}
+
+// updateChat returns a non-negative number identifying the chat an update
+// comes from, used to pick its worker.
+func updateChat(update *telegram.Update) int64 {
+	var id int64
+	switch {
+	case update.Message != nil:
+		id = update.Message.Chat.ID
+	case update.ChannelPost != nil:
+		id = update.ChannelPost.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil:
+		id = update.CallbackQuery.Message.Chat.ID
+	case update.CallbackQuery != nil:
+		id = update.CallbackQuery.From.ID
+	case update.MessageReaction != nil:
+		id = update.MessageReaction.Chat.ID
+	case update.MessageReactionCount != nil:
+		id = update.MessageReactionCount.Chat.ID
+	}
+	if id < 0 {
+		return -id
+	}
+	return id
+}
+
+// dispatchUpdate runs the handler of an update on the calling worker.
+func (b *Bot) dispatchUpdate(update *telegram.Update) {
+	msg := update.Message
+	if msg == nil {
+		msg = update.ChannelPost
+	}
+
+	switch {
+	case update.MessageReaction != nil:
+		b.suggestionReaction(update.MessageReaction)
+	case update.MessageReactionCount != nil:
+		if b.cfg().Experiment != nil {
+			b.reactionCount(update.MessageReactionCount)
+		}
+	case msg != nil:
+		name, args, ok := parseCommand(msg.Text)
+		if !ok || !b.cfg().EnableCommands {
+			return
+		}
+		if handler, exists := b.registry.commands[name]; exists {
+			handler(msg, args)
+		}
+	case update.CallbackQuery != nil:
+		if config := b.cfg(); !config.EnableCommands && !config.Moderation.enabled() {
+			return
+		}
+		query := update.CallbackQuery
+		for prefix, handler := range b.registry.callbacks {
+			if data, found := strings.CutPrefix(query.Data, prefix); found {
+				handler(query, data)
+				return
+			}
+		}
+	}
+}
+
+// parseCommand splits "/name@bot args" into its name and arguments.
+func parseCommand(text string) (name, args string, ok bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+
+	name, args = text[1:], ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, args = name[:i], name[i:]
+	}
+	name, _, _ = strings.Cut(name, "@")
+	return strings.ToLower(name), strings.TrimSpace(args), name != ""
+}
+
+func chatIDString(chat telegram.Chat) string {
+	return strconv.FormatInt(chat.ID, 10)
+}
+
+// isAdminChat reports whether chat is ADMIN_CHAT_ID, given as an ID or as
+// an @username.
+func (c *Config) isAdminChat(chat telegram.Chat) bool {
+	return c.AdminChatID != "" && (c.AdminChatID == chatIDString(chat) ||
+		(chat.Username != "" && c.AdminChatID == "@"+chat.Username))
+}
+
+// reply sends a plain HTML message to the chat msg came from.
+func (b *Bot) reply(msg *telegram.Message, text string, markup *telegram.InlineKeyboardMarkup) {
+	req := telegram.SendMessageRequest{
+		ChatID:             chatIDString(msg.Chat),
+		Text:               text,
+		ParseMode:          "HTML",
+		ReplyMarkup:        markup,
+		LinkPreviewOptions: &telegram.LinkPreviewOptions{IsDisabled: true},
+	}
+	if err := b.tg.Call("sendMessage", req, nil); err != nil {
+		log.Printf("Error replying in chat %d: %v", msg.Chat.ID, err)
+	}
+}
+
+func (b *Bot) answerCallback(query *telegram.CallbackQuery, text string) {
+	req := telegram.AnswerCallbackQueryRequest{CallbackQueryID: query.ID, Text: text}
+	if err := b.tg.Call("answerCallbackQuery", req, nil); err != nil {
+		log.Printf("Error answering callback query: %v", err)
+	}
+}
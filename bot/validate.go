@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// RunValidate implements `validate`, which checks the config, that DATA_PATH
+// is writable or REDIS_URL reachable, that BOT_KEY is valid and that the bot
+// can post to every configured chat, and prints a report. Unlike startup, it
+// does not stop at the first problem, and it opens no storage, so it is safe
+// to run next to a running bot.
+func RunValidate(args []string, out io.Writer) error {
+	if len(args) > 0 {
+		return errors.New("usage: validate")
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(out, "FAIL  config: %v\n", err)
+		return errors.New("the configuration is invalid")
+	}
+	fmt.Fprintln(out, "ok    config")
+
+	failed := 0
+	report := func(check string, err error) {
+		if err != nil {
+			failed++
+			fmt.Fprintf(out, "FAIL  %s: %v\n", check, err)
+			return
+		}
+		fmt.Fprintf(out, "ok    %s\n", check)
+	}
+
+	if config.StorageBackend == storage.BackendRedis {
+		err := config.CheckStateDir()
+		if err == nil {
+			_, err = backendExists(storage.BackendRedis, config.RedisURL)
+		}
+		report("redis "+redactURL(config.RedisURL), err)
+	} else {
+		report("data path "+config.DataPath, config.checkDataPath())
+	}
+
+	transport, _ := config.Network.transport(config.CacheSize)
+	b := &Bot{
+		config: configHolder{config: config},
+		tg:     telegram.NewClient(config.BotKey, &http.Client{Timeout: DefaultTimeout, Transport: transport}),
+	}
+	if config.TelegramAPIURL != "" {
+		b.tg.BaseURL = strings.TrimSuffix(config.TelegramAPIURL, "/") + "/"
+	}
+	me, err := b.verifyToken()
+	if err != nil {
+		report("bot token", err)
+		fmt.Fprintln(out, "skip  chats: need a valid bot token")
+	} else {
+		report("bot token, @"+me.Username, nil)
+		for _, chat := range config.postChats() {
+			check := "chat " + chat.chatID
+			if chat.name != "" {
+				check = chat.name + " " + chat.chatID
+			}
+			report(check, b.checkChat(&me, chat.chatID))
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// checkDataPath checks that the data file can be written: that files can be
+// created next to it, as backups and SQLite journals are, and that it can be
+// opened for writing when it exists.
+func (c *Config) checkDataPath() error {
+	if err := c.CheckStateDir(); err != nil {
+		return err
+	}
+	dir := filepath.Dir(c.DataPath)
+	probe, err := os.CreateTemp(dir, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("directory %s is not writable: %w", dir, err)
+	}
+	probe.Close()
+	if err := os.Remove(probe.Name()); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(c.DataPath, os.O_WRONLY|os.O_APPEND, 0)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("data file is not writable: %w", err)
+	}
+	return file.Close()
+}
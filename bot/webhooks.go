@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	WebhookTimeout = 10 * time.Second
+
+	// WebhookSignatureHeader carries "sha256=" and the hex HMAC-SHA256 of
+	// the body keyed with WEBHOOK_SECRET.
+	WebhookSignatureHeader = "X-Signature-256"
+	WebhookEventHeader     = "X-Webhook-Event"
+)
+
+func validateWebhookURLs(urls []string) error {
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q, expected an http or https URL", raw)
+		}
+	}
+	return nil
+}
+
+func (b *Bot) postWebhook(ctx context.Context, target, secret, event string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, WebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, event)
+	if secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(hmacSHA256([]byte(secret), string(body))))
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
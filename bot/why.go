@@ -0,0 +1,262 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/daoleno/tg_hacker_news/filter"
+	"github.com/daoleno/tg_hacker_news/hn"
+	"github.com/daoleno/tg_hacker_news/storage"
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+// explanation is why a story would or would not be posted right now.
+type explanation struct {
+	story *storage.Story
+
+	// filtered is the position, from 1, of the filter that rejected the
+	// story, or 0. WithFilters filters come before plugin filters.
+	filtered int
+	checks   []filter.Check
+	chats    []string
+
+	// remaining are the chats of chats the story has no message in yet.
+	remaining []string
+
+	// duplicate is the story the story would be skipped as a duplicate of,
+	// or 0.
+	duplicate int64
+
+	// group is the story whose developing story the story would be added
+	// to, or 0.
+	group int64
+
+	// paused, review, closed and gap tell whether a qualifying story would
+	// wait for a maintenance window to end, for approval, for the posting
+	// window or for the post gap.
+	paused, review, closed, gap bool
+
+	// hourly is TopPerHour when a qualifying story would wait for its turn
+	// among the top stories of the hour, or 0.
+	hourly int
+}
+
+// explain evaluates the story with the given ID against the current
+// configuration like a poll would, without changing anything.
+func (b *Bot) explain(id int64) (*explanation, error) {
+	story, err := b.getStoryDetails(id)
+	if err != nil {
+		return nil, err
+	}
+	if stored, exists := b.getStoredStory(id); exists {
+		story.State, story.Messages, story.Rank = stored.State, stored.Messages, stored.Rank
+		story.DuplicateOf, story.GroupOf = stored.DuplicateOf, stored.GroupOf
+	}
+
+	config := b.cfg()
+	now := b.clock.Now()
+	e := &explanation{story: story}
+	for i, accept := range b.storyFilters(&config) {
+		if !accept(story) {
+			e.filtered = i + 1
+			break
+		}
+	}
+	score, comments := config.storyThresholds(story, now)
+	e.checks = filter.Explain(story, config.ChatID, score, comments, config.Routes)
+	e.chats = b.destinations(&config, story)
+	for _, chatID := range e.chats {
+		if _, sent := story.Messages[chatID]; !sent {
+			e.remaining = append(e.remaining, chatID)
+		}
+	}
+	if len(e.chats) > 0 && len(story.Messages) == 0 && config.DuplicateTitles == DuplicateSkip {
+		e.duplicate = story.DuplicateOf
+		if e.duplicate == 0 {
+			e.duplicate, _ = b.findDuplicate(&config, story)
+		}
+	}
+	if len(e.chats) > 0 && len(story.Messages) == 0 && config.StoryGroups == GroupCombine {
+		e.group = story.GroupOf
+		if e.group == 0 {
+			e.group, _ = b.findGroup(story)
+		}
+	}
+	if len(e.chats) > 0 {
+		e.paused = config.inMaintenance(now)
+		e.review = config.Moderation.enabled()
+		e.closed = !config.postingOpen(now)
+		e.gap = config.PostGap > 0
+		e.hourly = config.TopPerHour
+	}
+	return e, nil
+}
+
+// postedTo returns the chats the story has messages in.
+func (e *explanation) postedTo() []string {
+	var chats []string
+	for chatID := range e.story.Messages {
+		chats = append(chats, chatID)
+	}
+	sort.Strings(chats)
+	return chats
+}
+
+func (b *Bot) registerWhy() {
+	b.handleCommand("why", b.whyCommand)
+}
+
+// whyCommand replies with every rule the story passed or failed and whether
+// it would be posted now.
+func (b *Bot) whyCommand(msg *telegram.Message, args string) {
+	lang := b.chatLanguage(msg.Chat)
+	id, err := strconv.ParseInt(strings.TrimSpace(args), 10, 64)
+	if err != nil || id <= 0 {
+		b.reply(msg, tr(lang, "why_usage"), nil)
+		return
+	}
+	e, err := b.explain(id)
+	if errors.Is(err, errItemGone) {
+		b.reply(msg, tr(lang, "why_gone", id), nil)
+		return
+	}
+	if err != nil {
+		b.reply(msg, tr(lang, "why_error", id), nil)
+		return
+	}
+	b.reply(msg, e.html(lang), nil)
+}
+
+func (e *explanation) html(lang string) string {
+	story := e.story
+	lines := []string{tr(lang, "why_header", html.EscapeString(story.Title), story.Score, story.Descendants)}
+	if story.State == storage.StateSuppressed {
+		lines = append(lines, tr(lang, "why_suppressed"))
+	}
+	if chats := e.postedTo(); len(chats) > 0 {
+		lines = append(lines, tr(lang, "why_posted", html.EscapeString(strings.Join(chats, ", "))))
+	}
+	if e.filtered > 0 {
+		lines = append(lines, tr(lang, "why_filter", e.filtered))
+	}
+
+	chat := ""
+	for _, check := range e.checks {
+		if check.Chat != chat {
+			chat = check.Chat
+			lines = append(lines, "", tr(lang, "why_chat", html.EscapeString(chat)))
+		}
+		mark := "✅"
+		if !check.Passed {
+			mark = "❌"
+		}
+		var rule string
+		switch check.Rule {
+		case filter.RuleType:
+			rule = tr(lang, "why_type", html.EscapeString(check.Detail))
+		case filter.RuleLink:
+			rule = tr(lang, "why_link")
+		case filter.RuleScore:
+			rule = tr(lang, "why_score", check.Value, check.Limit)
+		case filter.RuleComments:
+			rule = tr(lang, "why_comments", check.Value, check.Limit)
+		case filter.RuleRoute:
+			rule = tr(lang, "why_route", html.EscapeString(check.Detail))
+		case filter.RuleFeed:
+			rule = tr(lang, "why_feed", html.EscapeString(check.Detail))
+		}
+		lines = append(lines, mark+" "+rule)
+	}
+
+	lines = append(lines, "")
+	chats := html.EscapeString(strings.Join(e.remaining, ", "))
+	switch {
+	case story.State == storage.StateSuppressed, len(e.chats) == 0:
+		lines = append(lines, tr(lang, "why_skip"))
+	case len(e.remaining) == 0:
+		lines = append(lines, tr(lang, "why_done", html.EscapeString(strings.Join(e.chats, ", "))))
+	case e.duplicate != 0:
+		lines = append(lines, tr(lang, "why_duplicate", hn.ItemURL(e.duplicate), e.duplicate))
+	case e.group != 0:
+		lines = append(lines, tr(lang, "why_group", hn.ItemURL(e.group), e.group))
+	case e.paused:
+		lines = append(lines, tr(lang, "why_maintenance", chats))
+	case e.review:
+		lines = append(lines, tr(lang, "why_review", chats))
+	case e.closed:
+		lines = append(lines, tr(lang, "why_window", chats))
+	case e.gap:
+		lines = append(lines, tr(lang, "why_gap", chats))
+	case e.hourly > 0:
+		lines = append(lines, tr(lang, "why_hourly", chats, e.hourly))
+	default:
+		lines = append(lines, tr(lang, "why_post", chats))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// RunWhy implements `why <id>`, which prints the result of /why.
+func RunWhy(args []string, out io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: why <hn-id>")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("invalid story id %q", args[0])
+	}
+
+	b, err := New()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	e, err := b.explain(id)
+	if err != nil {
+		return fmt.Errorf("failed to explain story %d: %w", id, err)
+	}
+
+	story := e.story
+	fmt.Fprintf(out, "%s (%d points, %d comments)\n", story.Title, story.Score, story.Descendants)
+	if story.State == storage.StateSuppressed {
+		fmt.Fprintln(out, "suppressed, not posted again while tracked")
+	}
+	if chats := e.postedTo(); len(chats) > 0 {
+		fmt.Fprintf(out, "already posted to %s\n", strings.Join(chats, ", "))
+	}
+	if e.filtered > 0 {
+		fmt.Fprintf(out, "rejected by filter #%d (WithFilters filters first, then plugins)\n", e.filtered)
+	}
+	for _, check := range e.checks {
+		fmt.Fprintln(out, check)
+	}
+
+	chats := strings.Join(e.remaining, ", ")
+	switch {
+	case story.State == storage.StateSuppressed, len(e.chats) == 0:
+		fmt.Fprintln(out, "would not be posted")
+	case len(e.remaining) == 0:
+		fmt.Fprintf(out, "qualifies for %s, where it is already posted\n", strings.Join(e.chats, ", "))
+	case e.duplicate != 0:
+		fmt.Fprintf(out, "would not be posted, its title is nearly the same as story %d's\n", e.duplicate)
+	case e.group != 0:
+		fmt.Fprintf(out, "would be added to the developing story of story %d\n", e.group)
+	case e.paused:
+		fmt.Fprintf(out, "would wait for the maintenance window to end before being posted to %s\n", chats)
+	case e.review:
+		fmt.Fprintf(out, "would wait for approval before being posted to %s\n", chats)
+	case e.closed:
+		fmt.Fprintf(out, "would be queued for %s until the posting window opens\n", chats)
+	case e.gap:
+		fmt.Fprintf(out, "would be queued for %s, which gets the best queued story once POST_GAP has passed\n", chats)
+	case e.hourly > 0:
+		fmt.Fprintf(out, "would be queued for %s, where the %d highest ranked queued stories are posted each hour\n", chats, e.hourly)
+	default:
+		fmt.Fprintf(out, "would be posted to %s\n", chats)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Package cassette records HTTP interactions to a file and replays them, so a
+// sequence of API responses seen in production can be run through the bot
+// again, in tests or dry runs.
+package cassette
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+)
+
+// Interaction is one recorded request and its response. Response bodies that
+// are not valid UTF-8, such as encrypted backups, are kept base64 encoded in
+// BinaryBody instead.
+type Interaction struct {
+	Time        time.Time `json:"time"`
+	Method      string    `json:"method"`
+	URL         string    `json:"url"`
+	RequestBody string    `json:"request_body,omitempty"`
+	Status      int       `json:"status"`
+	ContentType string    `json:"content_type,omitempty"`
+	Body        string    `json:"body,omitempty"`
+	BinaryBody  []byte    `json:"binary_body,omitempty"`
+
+	used bool
+}
+
+// tokenPattern matches the bot token in Telegram API paths.
+var tokenPattern = regexp.MustCompile(`/bot[^/]+/`)
+
+// redact removes secrets from a request URL before it is written to disk or
+// matched against a recording.
+func redact(url string) string {
+	return tokenPattern.ReplaceAllString(url, "/bot<token>/")
+}
+
+// Transport is an http.RoundTripper that either passes requests on and
+// appends every interaction to a cassette file, or answers requests from a
+// previously recorded file without touching the network.
+type Transport struct {
+	mode string
+	next http.RoundTripper
+
+	mutex        sync.Mutex
+	file         *os.File
+	interactions []*Interaction
+}
+
+// Record returns a transport that sends requests through next, or
+// http.DefaultTransport when nil, and appends each interaction to the file at
+// path as a JSON line.
+func Record(path string, next http.RoundTripper) (*Transport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette %s: %w", path, err)
+	}
+	return &Transport{mode: ModeRecord, next: next, file: file}, nil
+}
+
+// Replay returns a transport that answers requests from the cassette at
+// path. Each interaction is used once, in recorded order, matching on
+// method, URL and request body, or on method and URL when no interaction
+// has the same body.
+func Replay(path string) (*Transport, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cassette %s: %w", path, err)
+	}
+	defer file.Close()
+
+	t := &Transport{mode: ModeReplay}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var interaction Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &interaction); err != nil {
+			return nil, fmt.Errorf("cassette %s line %d: %w", path, line, err)
+		}
+		t.interactions = append(t.interactions, &interaction)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+	return t, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.mode == ModeReplay {
+		return t.replay(req, body)
+	}
+	return t.record(req, body)
+}
+
+func (t *Transport) record(req *http.Request, body []byte) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Time:        time.Now().UTC(),
+		Method:      req.Method,
+		URL:         redact(req.URL.String()),
+		RequestBody: string(body),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+	if utf8.Valid(respBody) {
+		interaction.Body = string(respBody)
+	} else {
+		interaction.BinaryBody = respBody
+	}
+	if !utf8.Valid(body) {
+		interaction.RequestBody = ""
+	}
+
+	// Keep HTML in message texts readable in the file
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(interaction); err != nil {
+		return nil, err
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if _, err := t.file.Write(line.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return resp, nil
+}
+
+func (t *Transport) replay(req *http.Request, body []byte) (*http.Response, error) {
+	url := redact(req.URL.String())
+
+	t.mutex.Lock()
+	interaction := t.take(req.Method, url, string(body), true)
+	if interaction == nil {
+		interaction = t.take(req.Method, url, "", false)
+	}
+	t.mutex.Unlock()
+
+	if interaction == nil {
+		return nil, fmt.Errorf("cassette has no recorded response left for %s %s", req.Method, url)
+	}
+
+	respBody := interaction.BinaryBody
+	if respBody == nil {
+		respBody = []byte(interaction.Body)
+	}
+	header := make(http.Header)
+	if interaction.ContentType != "" {
+		header.Set("Content-Type", interaction.ContentType)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Status, http.StatusText(interaction.Status)),
+		StatusCode:    interaction.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}, nil
+}
+
+// take returns the first unused interaction for the request and marks it
+// used. The caller holds the lock.
+func (t *Transport) take(method, url, body string, matchBody bool) *Interaction {
+	for _, interaction := range t.interactions {
+		if interaction.used || interaction.Method != method || interaction.URL != url {
+			continue
+		}
+		if matchBody && strings.TrimSpace(interaction.RequestBody) != strings.TrimSpace(body) {
+			continue
+		}
+		interaction.used = true
+		return interaction
+	}
+	return nil
+}
+
+// Close closes the cassette file of a recording transport.
+func (t *Transport) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	return t.file.Close()
+}
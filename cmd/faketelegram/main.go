@@ -0,0 +1,511 @@
+// Command faketelegram is a stand-in for the Telegram Bot API for local
+// development. It keeps sent messages in memory and shows the resulting chats
+// on a web page, so the bot can run without a real token or channel:
+//
+//	go run ./cmd/faketelegram -addr :8081
+//	TELEGRAM_API_URL=http://localhost:8081/ BOT_KEY=dev CHAT_ID=@dev go run ./cmd/tg_hacker_news
+//
+// Messages typed on the page and presses of callback buttons are delivered to
+// the bot through getUpdates. Any token is accepted.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/telegram"
+)
+
+const (
+	// DeveloperID is the user ID of messages sent from the web page.
+	DeveloperID = 1
+	BotID       = 2
+)
+
+type message struct {
+	ID      int64
+	From    string
+	Text    string
+	HTML    bool
+	Markup  *telegram.InlineKeyboardMarkup
+	Photo   []byte
+	Sent    time.Time
+	Edits   int
+	Deleted bool
+}
+
+type chat struct {
+	Name     string
+	ID       int64
+	Messages []*message
+}
+
+type server struct {
+	mutex   sync.Mutex
+	chats   []*chat
+	updates []telegram.Update
+	nextID  int64
+
+	// waiting is closed and replaced whenever an update is queued, waking
+	// up long-polling getUpdates calls.
+	waiting chan struct{}
+}
+
+func newServer() *server {
+	return &server{nextID: 1, waiting: make(chan struct{})}
+}
+
+// chat returns the chat with the given name or numeric ID, creating it on
+// first use. The caller holds the lock.
+func (s *server) chat(name string) *chat {
+	for _, c := range s.chats {
+		if c.Name == name || strconv.FormatInt(c.ID, 10) == name {
+			return c
+		}
+	}
+
+	id, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		id = -1000000000001 - int64(len(s.chats))
+	}
+	c := &chat{Name: name, ID: id}
+	s.chats = append(s.chats, c)
+	return c
+}
+
+func (c *chat) telegramChat() telegram.Chat {
+	if c.ID > 0 {
+		return telegram.Chat{ID: c.ID, Type: "private", Username: "developer"}
+	}
+	return telegram.Chat{ID: c.ID, Type: "channel", Title: c.Name, Username: strings.TrimPrefix(c.Name, "@")}
+}
+
+func (c *chat) message(id int64) *message {
+	for _, m := range c.Messages {
+		if m.ID == id && !m.Deleted {
+			return m
+		}
+	}
+	return nil
+}
+
+func (c *chat) add(m *message) *message {
+	m.ID = int64(len(c.Messages)) + 1
+	m.Sent = time.Now()
+	c.Messages = append(c.Messages, m)
+	return m
+}
+
+// queue adds an update for the bot. The caller holds the lock.
+func (s *server) queue(update telegram.Update) {
+	update.UpdateID = s.nextID
+	s.nextID++
+	s.updates = append(s.updates, update)
+
+	close(s.waiting)
+	s.waiting = make(chan struct{})
+}
+
+// apiError is a failed Bot API response.
+type apiError struct {
+	code        int
+	description string
+}
+
+func (s *server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	// Paths look like /bot<token>/<method>
+	_, method, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var params json.RawMessage
+	files := make(map[string][]byte)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		params = multipartParams(r, files)
+	} else if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&params)
+	}
+
+	result, apiErr := s.call(method, params, files)
+	response := telegram.APIResponse{OK: apiErr == nil}
+	if apiErr != nil {
+		response.ErrorCode = apiErr.code
+		response.Description = apiErr.description
+		log.Printf("%s: %d %s", method, apiErr.code, apiErr.description)
+	} else {
+		response.Result, _ = json.Marshal(result)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// multipartParams returns the fields of a multipart request as JSON
+// parameters and adds its files to files.
+func multipartParams(r *http.Request, files map[string][]byte) json.RawMessage {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil
+	}
+	params := make(map[string]json.RawMessage)
+	for key, values := range r.MultipartForm.Value {
+		// Objects and numbers are JSON, chat IDs and texts are strings
+		value := []byte(values[0])
+		if key == "chat_id" || !json.Valid(value) {
+			value, _ = json.Marshal(values[0])
+		}
+		params[key] = value
+	}
+	for key, headers := range r.MultipartForm.File {
+		if f, err := headers[0].Open(); err == nil {
+			files[key], _ = io.ReadAll(f)
+			f.Close()
+		}
+	}
+	encoded, _ := json.Marshal(params)
+	return encoded
+}
+
+func (s *server) call(method string, params json.RawMessage, files map[string][]byte) (any, *apiError) {
+	decode := func(v any) *apiError {
+		if len(params) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(params, v); err != nil {
+			return &apiError{400, "Bad Request: " + err.Error()}
+		}
+		return nil
+	}
+
+	switch method {
+	case "getMe":
+		return telegram.User{ID: BotID, IsBot: true, FirstName: "Fake bot", Username: "fake_bot"}, nil
+
+	case "getChat":
+		var req telegram.GetChatRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		return s.chat(req.ChatID).telegramChat(), nil
+
+	case "getChatMemberCount":
+		return 1, nil
+
+	case "getChatMember":
+		return telegram.ChatMember{Status: "administrator", CanPostMessages: true, CanEditMessages: true, CanDeleteMessages: true}, nil
+
+	case "sendMessage":
+		var req telegram.SendMessageRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c := s.chat(req.ChatID)
+		m := c.add(&message{From: "bot", Text: req.Text, HTML: req.ParseMode == "HTML", Markup: req.ReplyMarkup})
+		log.Printf("sendMessage: %s #%d", c.Name, m.ID)
+		return telegram.Message{MessageID: m.ID, Chat: c.telegramChat(), Text: req.Text}, nil
+
+	case "sendPhoto":
+		var req telegram.SendPhotoRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		if files["photo"] == nil {
+			return nil, &apiError{400, "Bad Request: there is no photo in the request"}
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c := s.chat(req.ChatID)
+		m := c.add(&message{From: "bot", Text: req.Caption, HTML: req.ParseMode == "HTML", Markup: req.ReplyMarkup, Photo: files["photo"]})
+		log.Printf("sendPhoto: %s #%d", c.Name, m.ID)
+		return telegram.Message{MessageID: m.ID, Chat: c.telegramChat()}, nil
+
+	case "editMessageCaption":
+		var req telegram.EditMessageCaptionRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c := s.chat(req.ChatID)
+		m := c.message(req.MessageID)
+		if m == nil || m.Photo == nil {
+			return nil, &apiError{400, "Bad Request: message to edit not found"}
+		}
+		m.Text, m.HTML, m.Markup = req.Caption, req.ParseMode == "HTML", req.ReplyMarkup
+		m.Edits++
+		log.Printf("editMessageCaption: %s #%d", c.Name, m.ID)
+		return telegram.Message{MessageID: m.ID, Chat: c.telegramChat()}, nil
+
+	case "editMessageMedia":
+		var req telegram.EditMessageMediaRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		photo := files[strings.TrimPrefix(req.Media.Media, "attach://")]
+		if photo == nil {
+			return nil, &apiError{400, "Bad Request: there is no photo in the request"}
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c := s.chat(req.ChatID)
+		m := c.message(req.MessageID)
+		if m == nil || m.Photo == nil {
+			return nil, &apiError{400, "Bad Request: message to edit not found"}
+		}
+		m.Text, m.HTML, m.Markup, m.Photo = req.Media.Caption, req.Media.ParseMode == "HTML", req.ReplyMarkup, photo
+		m.Edits++
+		log.Printf("editMessageMedia: %s #%d", c.Name, m.ID)
+		return telegram.Message{MessageID: m.ID, Chat: c.telegramChat()}, nil
+
+	case "editMessageText":
+		var req telegram.EditMessageTextRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c := s.chat(req.ChatID)
+		m := c.message(req.MessageID)
+		if m == nil {
+			return nil, &apiError{400, "Bad Request: message to edit not found"}
+		}
+		if m.Photo != nil {
+			return nil, &apiError{400, "Bad Request: there is no text in the message to edit"}
+		}
+		if m.Text == req.Text && sameMarkup(m.Markup, req.ReplyMarkup) {
+			return nil, &apiError{400, "Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message"}
+		}
+		m.Text, m.HTML, m.Markup = req.Text, req.ParseMode == "HTML", req.ReplyMarkup
+		m.Edits++
+		log.Printf("editMessageText: %s #%d", c.Name, m.ID)
+		return telegram.Message{MessageID: m.ID, Chat: c.telegramChat(), Text: req.Text}, nil
+
+	case "editMessageReplyMarkup":
+		var req telegram.EditMessageReplyMarkupRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c := s.chat(req.ChatID)
+		m := c.message(req.MessageID)
+		if m == nil {
+			return nil, &apiError{400, "Bad Request: message to edit not found"}
+		}
+		if sameMarkup(m.Markup, req.ReplyMarkup) {
+			return nil, &apiError{400, "Bad Request: message is not modified: specified new message content and reply markup are exactly the same as a current content and reply markup of the message"}
+		}
+		m.Markup = req.ReplyMarkup
+		m.Edits++
+		log.Printf("editMessageReplyMarkup: %s #%d", c.Name, m.ID)
+		return telegram.Message{MessageID: m.ID, Chat: c.telegramChat(), Text: m.Text}, nil
+
+	case "deleteMessage":
+		var req telegram.DeleteMessageRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		c := s.chat(req.ChatID)
+		m := c.message(req.MessageID)
+		if m == nil {
+			return nil, &apiError{400, "Bad Request: message to delete not found"}
+		}
+		m.Deleted = true
+		log.Printf("deleteMessage: %s #%d", c.Name, m.ID)
+		return true, nil
+
+	case "getUpdates":
+		var req telegram.GetUpdatesRequest
+		if err := decode(&req); err != nil {
+			return nil, err
+		}
+		return s.getUpdates(req), nil
+
+	case "answerCallbackQuery":
+		return true, nil
+	}
+
+	return nil, &apiError{404, "Not Found: method " + method + " is not implemented by faketelegram"}
+}
+
+// getUpdates confirms updates before the offset and waits up to the request's
+// timeout for new ones.
+func (s *server) getUpdates(req telegram.GetUpdatesRequest) []telegram.Update {
+	deadline := time.After(time.Duration(req.Timeout) * time.Second)
+	for {
+		s.mutex.Lock()
+		pending := s.updates[:0]
+		for _, update := range s.updates {
+			if update.UpdateID >= req.Offset {
+				pending = append(pending, update)
+			}
+		}
+		s.updates = pending
+		waiting := s.waiting
+		s.mutex.Unlock()
+
+		if len(pending) > 0 || req.Timeout == 0 {
+			return append([]telegram.Update{}, pending...)
+		}
+		select {
+		case <-waiting:
+		case <-deadline:
+			return []telegram.Update{}
+		}
+	}
+}
+
+func sameMarkup(a, b *telegram.InlineKeyboardMarkup) bool {
+	aj, _ := json.Marshal(a)
+	bj, _ := json.Marshal(b)
+	return string(aj) == string(bj)
+}
+
+// handleSend queues a message typed on the page as if a user had sent it.
+func (s *server) handleSend(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.FormValue("text"))
+	if r.Method != http.MethodPost || text == "" {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	s.mutex.Lock()
+	c := s.chat(r.FormValue("chat"))
+	m := c.add(&message{From: "you", Text: text})
+	from := &telegram.User{ID: DeveloperID, FirstName: "Developer", Username: "developer"}
+	s.queue(telegram.Update{Message: &telegram.Message{MessageID: m.ID, From: from, Chat: c.telegramChat(), Text: text}})
+	s.mutex.Unlock()
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// handleCallback queues the press of an inline callback button.
+func (s *server) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	messageID, _ := strconv.ParseInt(r.FormValue("message"), 10, 64)
+
+	s.mutex.Lock()
+	c := s.chat(r.FormValue("chat"))
+	query := &telegram.CallbackQuery{
+		ID:      strconv.FormatInt(s.nextID, 10),
+		From:    telegram.User{ID: DeveloperID, FirstName: "Developer", Username: "developer"},
+		Message: &telegram.Message{MessageID: messageID, Chat: c.telegramChat()},
+		Data:    r.FormValue("data"),
+	}
+	s.queue(telegram.Update{CallbackQuery: query})
+	s.mutex.Unlock()
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// handleIndex serves the Bot API under /bot<token>/ and the chat page
+// everywhere else.
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/bot") {
+		s.handleAPI(w, r)
+		return
+	}
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := page.Execute(w, s.chats); err != nil {
+		log.Printf("Error rendering page: %v", err)
+	}
+}
+
+var page = template.Must(template.New("page").Funcs(template.FuncMap{
+	"text": func(m *message) template.HTML {
+		text := m.Text
+		if !m.HTML {
+			text = template.HTMLEscapeString(text)
+		}
+		return template.HTML(strings.ReplaceAll(text, "\n", "<br>"))
+	},
+	"photo": func(png []byte) template.URL {
+		return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(png))
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>faketelegram</title>
+<style>
+body { font-family: sans-serif; background: #e7ebf0; margin: 0; padding: 1em; }
+.chat { background: #fff; border-radius: 8px; margin: 0 auto 1em; max-width: 640px; padding: 1em; }
+.msg { border-left: 3px solid #5288c1; margin: .8em 0; padding: .2em .6em; }
+.msg.you { border-color: #7bc862; }
+.msg.deleted { opacity: .4; text-decoration: line-through; }
+.msg img { border-radius: 4px; display: block; max-width: 100%; }
+.meta { color: #888; font-size: .8em; }
+.buttons a, .buttons button { background: #f0f4f8; border: 0; border-radius: 4px; color: #2a5885; display: inline-block; font-size: .9em; margin: .3em .3em 0 0; padding: .3em .8em; text-decoration: none; cursor: pointer; }
+form.inline { display: inline; }
+</style>
+</head>
+<body>
+<div class="chat">
+<form method="post" action="/send">
+<input name="chat" value="1" size="12" title="chat ID">
+<input name="text" placeholder="/search rust" size="40" autofocus>
+<button>Send as user</button>
+</form>
+</div>
+{{range .}}
+<div class="chat">
+<h3>{{.Name}}</h3>
+{{$chat := .Name}}
+{{range .Messages}}
+{{$msg := .}}
+<div class="msg {{.From}}{{if .Deleted}} deleted{{end}}">
+{{with .Photo}}<img src="{{photo .}}">{{end}}
+<div>{{text .}}</div>
+{{with .Markup}}<div class="buttons">{{range .InlineKeyboard}}<div>{{range .}}{{if .URL}}<a href="{{.URL}}" target="_blank">{{.Text}}</a>{{else}}<form class="inline" method="post" action="/callback"><input type="hidden" name="chat" value="{{$chat}}"><input type="hidden" name="message" value="{{$msg.ID}}"><input type="hidden" name="data" value="{{.CallbackData}}"><button>{{.Text}}</button></form>{{end}}{{end}}</div>{{end}}</div>{{end}}
+<div class="meta">#{{.ID}} · {{.From}} · {{.Sent.Format "15:04:05"}}{{if .Edits}} · edited {{.Edits}}×{{end}}{{if .Deleted}} · deleted{{end}}</div>
+</div>
+{{end}}
+</div>
+{{else}}
+<div class="chat">No messages yet. Point the bot here with TELEGRAM_API_URL.</div>
+{{end}}
+</body>
+</html>
+`))
+
+func main() {
+	addr := flag.String("addr", ":8081", "listen address")
+	flag.Parse()
+
+	s := newServer()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/send", s.handleSend)
+	mux.HandleFunc("/callback", s.handleCallback)
+	mux.HandleFunc("/", s.handleIndex)
+
+	log.Printf("Fake Telegram Bot API on %s, open http://localhost%s to see the chats", *addr, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/daoleno/tg_hacker_news/bot"
+)
+
+func main() {
+	configPath := flag.String("config", "", "config file, JSON, YAML (.yaml, .yml) or TOML (.toml), instead of CONFIG_PATH")
+
+	// Fault injection for staging, left out of the usage
+	var faults bot.Faults
+	flag.Float64Var(&faults.Telegram, "chaos-telegram", 0, "rate of Telegram requests answered with a 429 or a 500")
+	flag.Float64Var(&faults.HN, "chaos-hn", 0, "rate of HN requests failing with a timeout")
+	flag.Float64Var(&faults.Storage, "chaos-storage", 0, "rate of failing storage saves")
+	flag.Usage = usage
+	flag.Parse()
+	if *configPath != "" {
+		// The bot and the subcommands find the config file through CONFIG_PATH
+		os.Setenv("CONFIG_PATH", *configPath)
+	}
+
+	if args := flag.Args(); len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			if err := bot.RunMigrate(args[1:]); err != nil {
+				log.Fatalf("Migration failed: %v", err)
+			}
+			return
+		case "audit":
+			if err := bot.RunAudit(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Audit failed: %v", err)
+			}
+			return
+		case "digest":
+			if err := bot.RunDigest(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Digest failed: %v", err)
+			}
+			return
+		case "why":
+			if err := bot.RunWhy(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Why failed: %v", err)
+			}
+			return
+		case "fixtures":
+			if err := bot.RunFixtures(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Fixtures failed: %v", err)
+			}
+			return
+		case "bench":
+			if err := bot.RunBench(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Bench failed: %v", err)
+			}
+			return
+		case "replay":
+			if err := bot.RunReplay(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Replay failed: %v", err)
+			}
+			return
+		case "plugins":
+			if err := bot.RunPlugins(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Plugins failed: %v", err)
+			}
+			return
+		case "health":
+			if err := bot.RunHealth(args[1:]); err != nil {
+				log.Fatalf("Unhealthy: %v", err)
+			}
+			return
+		case "validate":
+			if err := bot.RunValidate(args[1:], os.Stdout); err != nil {
+				log.Fatalf("Validation failed: %v", err)
+			}
+			return
+		}
+	}
+
+	config, err := bot.LoadConfig()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if err := config.CheckStateDir(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// A standby replica waits here until the active one stops renewing the
+	// failover lease
+	if err := bot.AwaitLease(ctx, config); errors.Is(err, context.Canceled) {
+		return
+	} else if err != nil {
+		log.Fatalf("Failed to acquire the failover lease: %v", err)
+	}
+
+	b, err := bot.New(bot.WithConfig(config), bot.WithFaults(faults))
+	if err != nil {
+		log.Fatalf("Failed to create bot: %v", err)
+	}
+	defer b.Close()
+
+	if err := b.Preflight(); err != nil {
+		log.Fatalf("Startup check failed: %v", err)
+	}
+
+	if err := b.WatchConfig(); err != nil {
+		log.Printf("Warning: config hot-reload disabled: %v", err)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			log.Printf("Received SIGHUP, reloading config")
+			b.ReloadConfig()
+		}
+	}()
+
+	b.Run(ctx)
+	if b.LeaseLost() {
+		// Exit with an error, so the replica is restarted as a standby
+		b.Close()
+		log.Fatalf("Shutting down, lost the failover lease")
+	}
+	log.Printf("Shutting down")
+}
+
+// usage prints the flags without the hidden -chaos-* ones.
+func usage() {
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "chaos-") {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	fmt.Fprintf(visible.Output(), "Usage of %s:\n", os.Args[0])
+	visible.PrintDefaults()
+}
@@ -0,0 +1,191 @@
+// Package fetch downloads pages and API responses for the enrichers with
+// limits that keep them well-behaved: robots.txt is respected for pages,
+// bodies are capped in size, content types are checked and redirect chains
+// are cut short.
+package fetch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/daoleno/tg_hacker_news/lru"
+)
+
+const (
+	DefaultMaxBodySize  = 2 << 20
+	DefaultMaxRedirects = 5
+	DefaultMaxRobots    = 1000
+)
+
+var (
+	// ErrDisallowed is returned for pages robots.txt does not let the
+	// fetcher crawl.
+	ErrDisallowed = errors.New("disallowed by robots.txt")
+	// ErrTooLarge is returned for bodies larger than MaxBodySize.
+	ErrTooLarge = errors.New("body too large")
+	// ErrContentType is returned for responses of a content type that was
+	// not asked for.
+	ErrContentType = errors.New("unexpected content type")
+	// ErrTooManyRedirects is returned when following a response would take
+	// more than MaxRedirects redirects.
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// Response is a successfully fetched body.
+type Response struct {
+	URL         string // after redirects
+	ContentType string // media type without parameters
+	Body        []byte
+}
+
+// Fetcher fetches with the limits of its fields. The zero value is not
+// usable, use New.
+type Fetcher struct {
+	HTTPClient   *http.Client
+	MaxBodySize  int64
+	MaxRedirects int
+
+	// MaxRobots is how many hosts' robots.txt are cached, the least
+	// recently used are evicted first. It is read on the first fetch.
+	MaxRobots int
+
+	// UserAgent returns the User-Agent the requests are sent with, whose
+	// first word is matched against the groups of robots.txt.
+	UserAgent func() string
+
+	mutex  sync.Mutex
+	robots *lru.Cache[string, *robotsEntry] // by scheme://host
+}
+
+// New returns a fetcher with the default limits. A nil httpClient uses
+// http.DefaultClient.
+func New(httpClient *http.Client, userAgent func() string) *Fetcher {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Fetcher{
+		HTTPClient:   httpClient,
+		MaxBodySize:  DefaultMaxBodySize,
+		MaxRedirects: DefaultMaxRedirects,
+		MaxRobots:    DefaultMaxRobots,
+		UserAgent:    userAgent,
+	}
+}
+
+// Page fetches the page at rawURL, and every page it redirects to, only when
+// robots.txt allows it. The response must have one of mediaTypes, or any
+// type when none are given.
+func (f *Fetcher) Page(ctx context.Context, rawURL string, mediaTypes ...string) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkRobots(ctx, u); err != nil {
+		return nil, err
+	}
+	return f.get(ctx, rawURL, true, mediaTypes)
+}
+
+// JSON decodes the JSON response to a GET request for rawURL into v. API
+// requests are not subject to robots.txt.
+func (f *Fetcher) JSON(ctx context.Context, rawURL string, v any) error {
+	resp, err := f.get(ctx, rawURL, false, []string{"application/json"})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(resp.Body, v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+func (f *Fetcher) get(ctx context.Context, rawURL string, robots bool, mediaTypes []string) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(mediaTypes) > 0 {
+		req.Header.Set("Accept", strings.Join(mediaTypes, ", "))
+	}
+
+	resp, err := f.client(robots).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if len(mediaTypes) > 0 && !matchesMediaType(mediaType, mediaTypes) {
+		return nil, fmt.Errorf("%w %q", ErrContentType, mediaType)
+	}
+	if resp.ContentLength > f.MaxBodySize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrTooLarge, resp.ContentLength)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.MaxBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %w", err)
+	}
+	if int64(len(body)) > f.MaxBodySize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, f.MaxBodySize)
+	}
+	return &Response{URL: resp.Request.URL.String(), ContentType: mediaType, Body: body}, nil
+}
+
+// client returns a copy of HTTPClient that stops after MaxRedirects
+// redirects and, for pages, at redirects to pages robots.txt disallows.
+func (f *Fetcher) client(robots bool) *http.Client {
+	client := *f.HTTPClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > f.MaxRedirects {
+			return fmt.Errorf("%w: more than %d", ErrTooManyRedirects, f.MaxRedirects)
+		}
+		if robots {
+			return f.checkRobots(req.Context(), req.URL)
+		}
+		return nil
+	}
+	return &client
+}
+
+// matchesMediaType reports whether mediaType is one of mediaTypes, where
+// "text/*" matches every text type and a "+json" or "+xml" suffix matches
+// "application/json" or "application/xml".
+func matchesMediaType(mediaType string, mediaTypes []string) bool {
+	for _, t := range mediaTypes {
+		switch {
+		case t == mediaType:
+			return true
+		case strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*")):
+			return true
+		case t == "application/json" && strings.HasSuffix(mediaType, "+json"):
+			return true
+		case t == "application/xml" && strings.HasSuffix(mediaType, "+xml"):
+			return true
+		}
+	}
+	return false
+}
+
+// robotsAgent returns the product token robots.txt groups are matched
+// against: the User-Agent up to its first space or slash.
+func (f *Fetcher) robotsAgent() string {
+	agent := "*"
+	if f.UserAgent != nil {
+		agent = f.UserAgent()
+	}
+	if i := strings.IndexAny(agent, " /"); i > 0 {
+		agent = agent[:i]
+	}
+	return strings.ToLower(agent)
+}
@@ -0,0 +1,210 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/daoleno/tg_hacker_news/lru"
+)
+
+const (
+	// RobotsTTL is how long a host's robots.txt is cached, and
+	// RobotsErrorTTL how long a host whose robots.txt could not be fetched
+	// is treated as disallowing everything.
+	RobotsTTL      = 24 * time.Hour
+	RobotsErrorTTL = time.Hour
+	MaxRobotsSize  = 512 << 10
+)
+
+type robotsEntry struct {
+	rules   robotsRules
+	err     error // fetching failed, everything is disallowed
+	expires time.Time
+}
+
+// robotsCache returns the cache of robots.txt by origin, creating it with
+// MaxRobots entries. The caller holds the mutex.
+func (f *Fetcher) robotsCache() *lru.Cache[string, *robotsEntry] {
+	if f.robots == nil {
+		f.robots = lru.New[string, *robotsEntry](f.MaxRobots)
+	}
+	return f.robots
+}
+
+// RobotsCached returns how many hosts' robots.txt are cached, and at most.
+func (f *Fetcher) RobotsCached() (entries, size int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	cache := f.robotsCache()
+	return cache.Len(), cache.Size()
+}
+
+// checkRobots returns ErrDisallowed when robots.txt of u's host does not let
+// the fetcher crawl u.
+func (f *Fetcher) checkRobots(ctx context.Context, u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+	origin := u.Scheme + "://" + u.Host
+
+	f.mutex.Lock()
+	entry, ok := f.robotsCache().Get(origin)
+	f.mutex.Unlock()
+	if !ok || time.Now().After(entry.expires) {
+		entry = f.fetchRobots(ctx, origin)
+		if errors.Is(entry.err, context.Canceled) || errors.Is(entry.err, context.DeadlineExceeded) {
+			// The caller gave up, which says nothing about the host
+			return entry.err
+		}
+		f.mutex.Lock()
+		f.robotsCache().Add(origin, entry)
+		f.mutex.Unlock()
+	}
+
+	if entry.err != nil {
+		return fmt.Errorf("%w: robots.txt of %s is unavailable: %v", ErrDisallowed, u.Host, entry.err)
+	}
+	if !entry.rules.allowed(f.robotsAgent(), u.EscapedPath()+queryPart(u)) {
+		return fmt.Errorf("%w: %s", ErrDisallowed, u.Redacted())
+	}
+	return nil
+}
+
+func queryPart(u *url.URL) string {
+	if u.RawQuery == "" {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
+// fetchRobots fetches and parses the robots.txt of origin. As RFC 9309
+// asks, a missing file allows everything and an unreachable one disallows
+// everything.
+func (f *Fetcher) fetchRobots(ctx context.Context, origin string) *robotsEntry {
+	entry := &robotsEntry{expires: time.Now().Add(RobotsTTL)}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		entry.err = err
+		return entry
+	}
+	resp, err := f.client(false).Do(req)
+	if err != nil {
+		entry.err, entry.expires = err, time.Now().Add(RobotsErrorTTL)
+		return entry
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 400 && resp.StatusCode < 500:
+		return entry
+	case resp.StatusCode != http.StatusOK:
+		entry.err, entry.expires = fmt.Errorf("unexpected status %s", resp.Status), time.Now().Add(RobotsErrorTTL)
+		return entry
+	}
+	// Rules beyond the size limit are ignored
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxRobotsSize))
+	if err != nil {
+		entry.err, entry.expires = err, time.Now().Add(RobotsErrorTTL)
+		return entry
+	}
+	entry.rules = parseRobots(data)
+	return entry
+}
+
+// robotsRules holds the rules of the groups in a robots.txt, by lowercased
+// user agent.
+type robotsRules map[string][]robotsRule
+
+type robotsRule struct {
+	allow bool
+	path  string
+}
+
+func parseRobots(data []byte) robotsRules {
+	rules := make(robotsRules)
+	var agents []string
+	inRules := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			// A user-agent line after rules starts a new group
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agent := strings.ToLower(value)
+			agents = append(agents, agent)
+			if _, ok := rules[agent]; !ok {
+				rules[agent] = nil
+			}
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				// An empty disallow allows everything, which is the default
+				continue
+			}
+			for _, agent := range agents {
+				rules[agent] = append(rules[agent], robotsRule{allow: key == "allow", path: value})
+			}
+		}
+	}
+	return rules
+}
+
+// allowed reports whether agent may fetch path. The group of the agent
+// applies, or the "*" group when there is none. Of the matching rules the
+// longest wins and allow wins ties.
+func (r robotsRules) allowed(agent, path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	if path == "/robots.txt" {
+		return true
+	}
+	rules, ok := r[agent]
+	if !ok {
+		rules = r["*"]
+	}
+
+	best, allow := -1, true
+	for _, rule := range rules {
+		if !robotsMatch(rule.path, path) {
+			continue
+		}
+		if n := len(rule.path); n > best || (n == best && rule.allow) {
+			best, allow = n, rule.allow
+		}
+	}
+	return allow
+}
+
+// robotsMatch reports whether path matches pattern, where "*" matches any
+// sequence of characters and a trailing "$" anchors the end.
+func robotsMatch(pattern, path string) bool {
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(strings.TrimSuffix(pattern, "$")), `\*`, ".*")
+	if strings.HasSuffix(pattern, "$") {
+		expr += "$"
+	}
+	re, err := regexp.Compile(expr)
+	return err == nil && re.MatchString(path)
+}
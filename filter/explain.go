@@ -0,0 +1,112 @@
+package filter
+
+import (
+	"fmt"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// Rules checked by Explain.
+const (
+	RuleType     = "type"
+	RuleLink     = "link"
+	RuleScore    = "score"
+	RuleComments = "comments"
+	RuleRoute    = "route"
+	RuleFeed     = "feed"
+)
+
+// Check is the outcome of one rule of the posting decision for one chat.
+type Check struct {
+	Chat   string
+	Rule   string
+	Passed bool
+
+	// Value and Limit are the story's score or comment count and the
+	// threshold, for RuleScore and RuleComments.
+	Value, Limit int64
+
+	// Detail is the story's type for RuleType, the route's pattern for
+	// RuleRoute and its feed for RuleFeed.
+	Detail string
+}
+
+func (c Check) String() string {
+	mark := "passed"
+	if !c.Passed {
+		mark = "failed"
+	}
+	switch c.Rule {
+	case RuleType:
+		return fmt.Sprintf("%s: is a story (type %q): %s", c.Chat, c.Detail, mark)
+	case RuleLink:
+		return fmt.Sprintf("%s: has a link: %s", c.Chat, mark)
+	case RuleScore:
+		return fmt.Sprintf("%s: score %d, at least %d: %s", c.Chat, c.Value, c.Limit, mark)
+	case RuleComments:
+		return fmt.Sprintf("%s: %d comments, at least %d: %s", c.Chat, c.Value, c.Limit, mark)
+	case RuleRoute:
+		return fmt.Sprintf("%s: title matches /%s/: %s", c.Chat, c.Detail, mark)
+	case RuleFeed:
+		return fmt.Sprintf("%s: on the %s feed: %s", c.Chat, c.Detail, mark)
+	}
+	return fmt.Sprintf("%s: %s: %s", c.Chat, c.Rule, mark)
+}
+
+// Explain returns every check Destinations makes for the story, in order:
+// the thresholds of mainChat, then for each route whether the story is on its
+// feed, unless it has none, whether the title matches, unless the route has
+// no pattern, and if both do, the route's thresholds. A chat is a destination
+// when all of its checks passed. Stories only on feeds fail the top feed of
+// mainChat and of the routes without a feed.
+func Explain(story *storage.Story, mainChat string, score, comments int64, routes []Route) []Check {
+	var checks []Check
+	if feedOnly(story) {
+		checks = append(checks, Check{Chat: mainChat, Rule: RuleFeed, Detail: "top"})
+	} else {
+		checks = thresholdChecks(story, mainChat, score, comments)
+	}
+	for i := range routes {
+		route := &routes[i]
+		if route.Feed != "" || feedOnly(story) {
+			feed := route.Feed
+			if feed == "" {
+				feed = "top"
+			}
+			onFeed := route.onFeed(story)
+			checks = append(checks, Check{Chat: route.ChatID, Rule: RuleFeed, Passed: onFeed, Detail: feed})
+			if !onFeed {
+				continue
+			}
+		}
+		matches := route.pattern != nil && route.pattern.MatchString(story.Title)
+		if route.Match != "" {
+			checks = append(checks, Check{Chat: route.ChatID, Rule: RuleRoute, Passed: matches, Detail: route.Match})
+		}
+		if matches {
+			checks = append(checks, thresholdChecks(story, route.ChatID, route.ScoreThreshold, route.CommentsThreshold)...)
+		}
+	}
+	return checks
+}
+
+// thresholdChecks are the checks of BelowThresholds.
+func thresholdChecks(story *storage.Story, chat string, score, comments int64) []Check {
+	return []Check{
+		{Chat: chat, Rule: RuleType, Passed: story.Type == "story", Detail: story.Type},
+		{Chat: chat, Rule: RuleLink, Passed: story.URL != ""},
+		{Chat: chat, Rule: RuleScore, Passed: story.Score >= score, Value: story.Score, Limit: score},
+		{Chat: chat, Rule: RuleComments, Passed: story.Descendants >= comments, Value: story.Descendants, Limit: comments},
+	}
+}
+
+// Rejection returns the rule that rejected the story, the first of checks
+// that failed, or "" when none did.
+func Rejection(checks []Check) string {
+	for _, check := range checks {
+		if !check.Passed {
+			return check.Rule
+		}
+	}
+	return ""
+}
@@ -0,0 +1,69 @@
+// Package filter decides which stories get posted and where.
+package filter
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// BelowThresholds reports whether the story is not a link story or misses
+// either threshold.
+func BelowThresholds(story *storage.Story, score, comments int64) bool {
+	return story.Type != "story" ||
+		story.Score < score ||
+		story.Descendants < comments ||
+		story.URL == ""
+}
+
+// Story kinds by the Hacker News prefix of the title, which chats can turn
+// off with /settings.
+const (
+	KindShow   = "show"
+	KindAsk    = "ask"
+	KindLaunch = "launch"
+	KindOther  = "other"
+)
+
+var Kinds = []string{KindShow, KindAsk, KindLaunch, KindOther}
+
+// Kind returns the kind of the story, such as KindShow for "Show HN: ...".
+func Kind(story *storage.Story) string {
+	title := strings.ToLower(story.Title)
+	switch {
+	case strings.HasPrefix(title, "show hn"):
+		return KindShow
+	case strings.HasPrefix(title, "ask hn"):
+		return KindAsk
+	case strings.HasPrefix(title, "launch hn"):
+		return KindLaunch
+	}
+	return KindOther
+}
+
+// IsDiscussionHeavy reports whether the story has at least ratio times as
+// many comments as points, the mark of a controversial thread. A ratio of 0
+// disables the check.
+func IsDiscussionHeavy(story *storage.Story, ratio float64) bool {
+	return ratio > 0 && story.Score > 0 &&
+		float64(story.Descendants) >= ratio*float64(story.Score)
+}
+
+// MatchKeyword reports the first keyword that appears in title as whole
+// words, ignoring case and punctuation.
+func MatchKeyword(title string, keywords []string) (string, bool) {
+	normalized := " " + normalizeWords(title) + " "
+	for _, keyword := range keywords {
+		if k := normalizeWords(keyword); k != "" && strings.Contains(normalized, " "+k+" ") {
+			return keyword, true
+		}
+	}
+	return "", false
+}
+
+func normalizeWords(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,88 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/daoleno/tg_hacker_news/storage"
+)
+
+// Route sends stories whose title matches Match to an additional chat, with
+// thresholds independent of the main chat. An empty Match matches every
+// story. The story gets its own message there, which is updated and cleaned
+// up like the main one.
+type Route struct {
+	ChatID            string `json:"chat_id" yaml:"chat_id" toml:"chat_id"`
+	Match             string `json:"match" yaml:"match" toml:"match"`
+	ScoreThreshold    int64  `json:"score_threshold" yaml:"score_threshold" toml:"score_threshold"`
+	CommentsThreshold int64  `json:"comments_threshold" yaml:"comments_threshold" toml:"comments_threshold"`
+
+	// Feed limits the route to the stories on that HN list at the last
+	// poll. It is set for the routes of the feeds in the config file.
+	Feed string `json:"-" yaml:"-" toml:"-"`
+
+	pattern *regexp.Regexp
+}
+
+func (r Route) String() string {
+	if r.Feed != "" {
+		return fmt.Sprintf("%s %s feed (score %d, comments %d)", r.ChatID, r.Feed, r.ScoreThreshold, r.CommentsThreshold)
+	}
+	return fmt.Sprintf("%s /%s/ (score %d, comments %d)", r.ChatID, r.Match, r.ScoreThreshold, r.CommentsThreshold)
+}
+
+// Compile validates the route and prepares its pattern. Matching is
+// case-insensitive.
+func (r *Route) Compile() error {
+	if r.ChatID == "" {
+		return fmt.Errorf("route %q has no chat_id", r.Match)
+	}
+	if r.ScoreThreshold < 0 || r.CommentsThreshold < 0 {
+		return fmt.Errorf("route to %s: thresholds must not be negative", r.ChatID)
+	}
+
+	pattern, err := regexp.Compile("(?i)" + r.Match)
+	if err != nil {
+		return fmt.Errorf("route to %s: invalid match %q: %w", r.ChatID, r.Match, err)
+	}
+	r.pattern = pattern
+	return nil
+}
+
+// Accepts reports whether the story matches the route and passes its
+// thresholds. Routes must be compiled first.
+func (r *Route) Accepts(story *storage.Story) bool {
+	return r.onFeed(story) && r.pattern != nil && r.pattern.MatchString(story.Title) &&
+		!BelowThresholds(story, r.ScoreThreshold, r.CommentsThreshold)
+}
+
+// onFeed reports whether the story is on the route's feed, or for routes
+// without one, on the top list.
+func (r *Route) onFeed(story *storage.Story) bool {
+	if r.Feed == "" {
+		return !feedOnly(story)
+	}
+	return slices.Contains(story.Feeds, r.Feed)
+}
+
+// feedOnly reports whether the story is on feeds but not on the top list, in
+// which case it only qualifies for the routes of its feeds.
+func feedOnly(story *storage.Story) bool {
+	return story.Rank == 0 && len(story.Feeds) > 0
+}
+
+// Destinations returns every chat the story currently qualifies for:
+// mainChat by the given thresholds, plus each matching route.
+func Destinations(story *storage.Story, mainChat string, score, comments int64, routes []Route) []string {
+	var chats []string
+	if !feedOnly(story) && !BelowThresholds(story, score, comments) {
+		chats = append(chats, mainChat)
+	}
+	for i := range routes {
+		if routes[i].Accepts(story) && !slices.Contains(chats, routes[i].ChatID) {
+			chats = append(chats, routes[i].ChatID)
+		}
+	}
+	return chats
+}
@@ -0,0 +1,102 @@
+package filter
+
+import "strings"
+
+// TitleSimilarity returns how alike two titles are, from 0 to 1: the higher
+// of the share of words they have in common and one minus their
+// Levenshtein distance relative to the longer title. Case and punctuation
+// are ignored, so that the same news covered by several outlets matches.
+func TitleSimilarity(a, b string) float64 {
+	a, b = normalizeWords(a), normalizeWords(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	return max(wordOverlap(strings.Fields(a), strings.Fields(b)), editSimilarity([]rune(a), []rune(b)))
+}
+
+// wordOverlap is the Jaccard index of the titles' words. Titles of fewer
+// than three words have too few words to compare.
+func wordOverlap(a, b []string) float64 {
+	if len(a) < 3 || len(b) < 3 {
+		return 0
+	}
+	words := make(map[string]int)
+	for _, w := range a {
+		words[w] |= 1
+	}
+	for _, w := range b {
+		words[w] |= 2
+	}
+	var common int
+	for _, in := range words {
+		if in == 3 {
+			common++
+		}
+	}
+	return float64(common) / float64(len(words))
+}
+
+// editSimilarity is one minus the Levenshtein distance of a and b divided by
+// the length of the longer one.
+func editSimilarity(a, b []rune) float64 {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(b)])/float64(max(len(a), len(b)))
+}
+
+// SharedTerms returns how many significant words two titles have in common:
+// words of at least three letters or digits that are not common English
+// words or Hacker News prefixes such as "Show HN".
+func SharedTerms(a, b string) int {
+	terms := make(map[string]bool)
+	for _, w := range strings.Fields(normalizeWords(a)) {
+		if significant(w) {
+			terms[w] = true
+		}
+	}
+	var shared int
+	for _, w := range strings.Fields(normalizeWords(b)) {
+		if terms[w] {
+			shared++
+			delete(terms, w)
+		}
+	}
+	return shared
+}
+
+func significant(word string) bool {
+	return len(word) >= 3 && !commonWords[word]
+}
+
+var commonWords = make(map[string]bool)
+
+func init() {
+	for _, w := range strings.Fields(`
+		about after again against all also and any are because been before
+		being between both but can could did does doing down during each few
+		for from further had has have having her here hers him his how into
+		its just more most new not now off once only other our out over own
+		same she should some such than that the their them then there these
+		they this those through too under until very was were what when where
+		which while who whom why will with would you your
+		ask hn show launch tell pdf video`) {
+		commonWords[w] = true
+	}
+}
@@ -0,0 +1,65 @@
+package hn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const AlgoliaAPIBase = "https://hn.algolia.com/api/v1"
+
+// Hit is a story returned by the HN Algolia search API.
+type Hit struct {
+	ObjectID    string `json:"objectID"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Author      string `json:"author"`
+	Points      int64  `json:"points"`
+	NumComments int64  `json:"num_comments"`
+	CreatedAtI  int64  `json:"created_at_i"`
+}
+
+// SearchResponse is a page of search results.
+type SearchResponse struct {
+	Hits    []Hit `json:"hits"`
+	Page    int   `json:"page"`
+	NbPages int   `json:"nbPages"`
+	NbHits  int   `json:"nbHits"`
+}
+
+// CreatedAt is when the story was submitted.
+func (h *Hit) CreatedAt() time.Time {
+	return time.Unix(h.CreatedAtI, 0).UTC()
+}
+
+// Search runs an Algolia search with the given query parameters.
+func (c *Client) Search(params url.Values) (*SearchResponse, error) {
+	resp, err := c.HTTPClient.Get(c.AlgoliaURL + "/search?" + params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query algolia: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("algolia returned status %d", resp.StatusCode)
+	}
+
+	var result SearchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode algolia response: %w", err)
+	}
+	return &result, nil
+}
+
+// StorySearchParams returns parameters for a story search. page is zero-based.
+func StorySearchParams(query string, page, hitsPerPage int) url.Values {
+	return url.Values{
+		"query":       {query},
+		"tags":        {"story"},
+		"page":        {strconv.Itoa(page)},
+		"hitsPerPage": {strconv.Itoa(hitsPerPage)},
+	}
+}
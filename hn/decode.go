@@ -0,0 +1,180 @@
+package hn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNullItem is returned for items the API returns as null, as it does for
+// IDs that do not exist (yet) or were purged.
+var ErrNullItem = errors.New("item is null")
+
+// Anomaly is a deviation from the documented item schema that decoding
+// tolerated, such as a missing field or a number sent as a string.
+type Anomaly struct {
+	ItemID int64
+	Kind   string // "null", "missing", "type" or "id"
+	Field  string
+	Detail string
+}
+
+func (a Anomaly) String() string {
+	s := fmt.Sprintf("item %d: %s", a.ItemID, a.Kind)
+	if a.Field != "" {
+		s += " " + a.Field
+	}
+	if a.Detail != "" {
+		s += ": " + a.Detail
+	}
+	return s
+}
+
+// decodeItem decodes the item with the given ID. Fields of an unexpected type
+// are converted when possible and left zero otherwise, and fields a live
+// story must have are checked; each deviation is returned as an Anomaly. It
+// only fails when data is not a JSON object, or ErrNullItem when it is null.
+func decodeItem(id int64, data []byte) (*Item, []Anomaly, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil, []Anomaly{{ItemID: id, Kind: "null"}}, ErrNullItem
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	var item Item
+	var anomalies []Anomaly
+	convert := func(name string, decode func(json.RawMessage) (bool, error)) bool {
+		raw, ok := fields[name]
+		if !ok || string(raw) == "null" {
+			return false
+		}
+		exact, err := decode(raw)
+		if err != nil {
+			anomalies = append(anomalies, Anomaly{ItemID: id, Kind: "type", Field: name, Detail: err.Error()})
+			return false
+		}
+		if !exact {
+			anomalies = append(anomalies, Anomaly{ItemID: id, Kind: "type", Field: name, Detail: "converted " + string(raw)})
+		}
+		return true
+	}
+
+	present := map[string]bool{
+		"id":          convert("id", intField(&item.ID)),
+		"type":        convert("type", stringField(&item.Type)),
+		"by":          convert("by", stringField(&item.By)),
+		"time":        convert("time", intField(&item.Time)),
+		"url":         convert("url", stringField(&item.URL)),
+		"title":       convert("title", stringField(&item.Title)),
+		"text":        convert("text", stringField(&item.Text)),
+		"score":       convert("score", intField(&item.Score)),
+		"descendants": convert("descendants", intField(&item.Descendants)),
+		"kids":        convert("kids", idsField(&item.Kids)),
+		"deleted":     convert("deleted", boolField(&item.Deleted)),
+		"dead":        convert("dead", boolField(&item.Dead)),
+	}
+
+	if !present["id"] {
+		item.ID = id
+		anomalies = append(anomalies, Anomaly{ItemID: id, Kind: "missing", Field: "id"})
+	} else if item.ID != id {
+		anomalies = append(anomalies, Anomaly{ItemID: id, Kind: "id", Field: "id", Detail: fmt.Sprintf("got %d", item.ID)})
+		item.ID = id
+	}
+
+	required := []string{"type"}
+	if item.Type == "story" && !item.Deleted && !item.Dead {
+		required = append(required, "title", "score", "time")
+	}
+	for _, name := range required {
+		if !present[name] {
+			anomalies = append(anomalies, Anomaly{ItemID: id, Kind: "missing", Field: name})
+		}
+	}
+	return &item, anomalies, nil
+}
+
+// The field decoders below report whether the value had the documented type.
+
+func intField(target *int64) func(json.RawMessage) (bool, error) {
+	return func(raw json.RawMessage) (bool, error) {
+		if json.Unmarshal(raw, target) == nil {
+			return true, nil
+		}
+		var f float64
+		if json.Unmarshal(raw, &f) == nil {
+			*target = int64(f)
+			return false, nil
+		}
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			n, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return false, fmt.Errorf("not a number: %s", raw)
+			}
+			*target = n
+			return false, nil
+		}
+		return false, fmt.Errorf("not a number: %s", raw)
+	}
+}
+
+func stringField(target *string) func(json.RawMessage) (bool, error) {
+	return func(raw json.RawMessage) (bool, error) {
+		if json.Unmarshal(raw, target) == nil {
+			return true, nil
+		}
+		var n json.Number
+		if json.Unmarshal(raw, &n) == nil {
+			*target = n.String()
+			return false, nil
+		}
+		return false, fmt.Errorf("not a string: %s", raw)
+	}
+}
+
+func boolField(target *bool) func(json.RawMessage) (bool, error) {
+	return func(raw json.RawMessage) (bool, error) {
+		if json.Unmarshal(raw, target) == nil {
+			return true, nil
+		}
+		switch string(raw) {
+		case "0", `"false"`:
+			*target = false
+		case "1", `"true"`:
+			*target = true
+		default:
+			return false, fmt.Errorf("not a boolean: %s", raw)
+		}
+		return false, nil
+	}
+}
+
+func idsField(target *[]int64) func(json.RawMessage) (bool, error) {
+	return func(raw json.RawMessage) (bool, error) {
+		var elements []json.RawMessage
+		if err := json.Unmarshal(raw, &elements); err != nil {
+			return false, fmt.Errorf("not an array: %s", raw)
+		}
+		exact := true
+		ids := make([]int64, 0, len(elements))
+		for _, element := range elements {
+			var id int64
+			ok, err := intField(&id)(element)
+			if err != nil {
+				exact = false
+				continue
+			}
+			exact = exact && ok
+			ids = append(ids, id)
+		}
+		*target = ids
+		return exact, nil
+	}
+}
@@ -0,0 +1,201 @@
+// Package hn is a client for the official Hacker News API and the HN Algolia
+// search API.
+package hn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	APIBase = "https://hacker-news.firebaseio.com/v0"
+	WebBase = "https://news.ycombinator.com"
+)
+
+// Item is a story, comment or other item as returned by the HN API. Only the
+// fields the bot uses are decoded.
+type Item struct {
+	ID          int64   `json:"id"`
+	Type        string  `json:"type"`
+	By          string  `json:"by"`
+	Time        int64   `json:"time"`
+	URL         string  `json:"url"`
+	Title       string  `json:"title"`
+	Text        string  `json:"text"`
+	Score       int64   `json:"score"`
+	Descendants int64   `json:"descendants"`
+	Kids        []int64 `json:"kids"`
+	Deleted     bool    `json:"deleted"`
+	Dead        bool    `json:"dead"`
+}
+
+// TopCommentCandidates is how many of a story's top-level comments
+// TopComment looks at before giving up.
+const TopCommentCandidates = 3
+
+// MaxCommentFetches bounds the items Comments fetches, as deleted and dead
+// comments are skipped.
+const MaxCommentFetches = 60
+
+// Client talks to the HN APIs. The zero value is not usable, use NewClient.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+	AlgoliaURL string
+
+	// OnAnomaly, when set, is called for every deviation from the item
+	// schema that Item tolerated.
+	OnAnomaly func(Anomaly)
+}
+
+// NewClient returns a client for the public HN APIs. A nil httpClient uses
+// http.DefaultClient.
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		HTTPClient: httpClient,
+		BaseURL:    APIBase,
+		AlgoliaURL: AlgoliaAPIBase,
+	}
+}
+
+// ItemURL is the discussion page of an item on the HN website.
+func ItemURL(id int64) string {
+	return WebBase + "/item?id=" + strconv.FormatInt(id, 10)
+}
+
+// ParseItemID parses an item ID, either as a number or as the URL of its
+// discussion page.
+func ParseItemID(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		if u.Host != strings.TrimPrefix(WebBase, "https://") {
+			return 0, false
+		}
+		s = u.Query().Get("id")
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil && id > 0
+}
+
+// Lists are the story lists of the API, by the name Stories takes.
+var Lists = []string{"top", "best", "new", "ask", "show"}
+
+// TopStories returns the IDs of the first limit stories on the front page.
+func (c *Client) TopStories(limit int) ([]int64, error) {
+	return c.Stories("top", limit)
+}
+
+// NewStories returns the IDs of the limit most recently submitted stories.
+func (c *Client) NewStories(limit int) ([]int64, error) {
+	return c.Stories("new", limit)
+}
+
+// Stories returns the IDs of the first limit stories of one of Lists.
+func (c *Client) Stories(list string, limit int) ([]int64, error) {
+	url := fmt.Sprintf("%s/%sstories.json?orderBy=\"$key\"&limitToFirst=%d", c.BaseURL, list, limit)
+	resp, err := c.HTTPClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s stories: %w", list, err)
+	}
+	defer resp.Body.Close()
+
+	var stories []int64
+	if err := json.NewDecoder(resp.Body).Decode(&stories); err != nil {
+		return nil, fmt.Errorf("failed to decode %s stories: %w", list, err)
+	}
+	return stories, nil
+}
+
+// TopComment returns the ID of the highest-ranked top-level comment of item
+// that is neither deleted, dead nor null, or 0 when there is none. HN returns kids
+// in ranked order.
+func (c *Client) TopComment(item *Item) (int64, error) {
+	for i, kid := range item.Kids {
+		if i == TopCommentCandidates {
+			break
+		}
+		comment, err := c.Item(kid)
+		if errors.Is(err, ErrNullItem) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if !comment.Deleted && !comment.Dead {
+			return comment.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// Comments returns up to limit comments of item that are neither deleted,
+// dead nor null: the top-level comments in ranked order first, then their
+// replies level by level.
+func (c *Client) Comments(item *Item, limit int) ([]*Item, error) {
+	var comments []*Item
+	queue := append([]int64(nil), item.Kids...)
+	for fetches := 0; len(queue) > 0 && len(comments) < limit && fetches < MaxCommentFetches; fetches++ {
+		comment, err := c.Item(queue[0])
+		queue = queue[1:]
+		if errors.Is(err, ErrNullItem) {
+			continue
+		}
+		if err != nil {
+			return comments, err
+		}
+		if comment.Deleted || comment.Dead {
+			continue
+		}
+		comments = append(comments, comment)
+		queue = append(queue, comment.Kids...)
+	}
+	return comments, nil
+}
+
+// Item returns the item with the given ID. It fails with ErrNullItem when the
+// API returns null, and tolerates other schema deviations, see decodeItem.
+func (c *Client) Item(id int64) (*Item, error) {
+	data, err := c.RawItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item, anomalies, err := decodeItem(id, data)
+	if c.OnAnomaly != nil {
+		for _, anomaly := range anomalies {
+			c.OnAnomaly(anomaly)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode item %d: %w", id, err)
+	}
+	return item, nil
+}
+
+// RawItem returns the item with the given ID as the API sent it, without
+// decoding it.
+func (c *Client) RawItem(id int64) ([]byte, error) {
+	resp, err := c.HTTPClient.Get(fmt.Sprintf("%s/item/%d.json", c.BaseURL, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get item %d: %w", id, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get item %d: %s", id, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read item %d: %w", id, err)
+	}
+	return data, nil
+}
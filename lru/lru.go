@@ -0,0 +1,80 @@
+// Package lru is a size-bounded cache that evicts the least recently used
+// entry, to keep the bot's in-memory caches from growing without bound.
+package lru
+
+import "container/list"
+
+// Cache holds up to Size entries. Get and Add count as a use. It is not safe
+// for concurrent use; callers guard it with their own lock.
+type Cache[K comparable, V any] struct {
+	size    int
+	order   *list.List // of *entry, most recently used first
+	entries map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New returns a cache for up to size entries, at least one.
+func New[K comparable, V any](size int) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:    max(size, 1),
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value cached for key.
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	element, ok := c.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Add caches value for key, evicting the least recently used entry when the
+// cache is full.
+func (c *Cache[K, V]) Add(key K, value V) {
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*entry[K, V]).value = value
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&entry[K, V]{key, value})
+	for c.order.Len() > c.size {
+		oldest := c.order.Remove(c.order.Back()).(*entry[K, V])
+		delete(c.entries, oldest.key)
+	}
+}
+
+// Remove forgets key.
+func (c *Cache[K, V]) Remove(key K) {
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Each calls f for every entry, most recently used first, without counting
+// as a use.
+func (c *Cache[K, V]) Each(f func(key K, value V)) {
+	for element := c.order.Front(); element != nil; element = element.Next() {
+		e := element.Value.(*entry[K, V])
+		f(e.key, e.value)
+	}
+}
+
+// Len returns the number of entries.
+func (c *Cache[K, V]) Len() int {
+	return c.order.Len()
+}
+
+// Size returns the most entries the cache holds.
+func (c *Cache[K, V]) Size() int {
+	return c.size
+}
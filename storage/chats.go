@@ -0,0 +1,60 @@
+package storage
+
+import "strings"
+
+// ResolvedChat returns the numeric ID the chat username, such as
+// "@hacker_news", resolved to when it was last seen.
+func (s *Store) ResolvedChat(username string) (int64, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	id, ok := s.Chats[strings.ToLower(username)]
+	return id, ok
+}
+
+// SetResolvedChat records the numeric ID a chat username resolved to.
+func (s *Store) SetResolvedChat(username string, id int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Chats == nil {
+		s.Chats = make(map[string]int64)
+	}
+	s.Chats[strings.ToLower(username)] = id
+}
+
+// RenameChat moves the messages, sends and member counts recorded for chat
+// from over to chat to, after a username was replaced by the numeric ID of
+// its chat. It returns the number of stories whose messages moved.
+func (s *Store) RenameChat(from, to string) int {
+	s.Lock()
+	defer s.Unlock()
+
+	renamed := 0
+	for _, story := range s.Stories {
+		msg, ok := story.Messages[from]
+		if !ok {
+			continue
+		}
+		delete(story.Messages, from)
+		if _, ok := story.Messages[to]; !ok {
+			story.Messages[to] = msg
+		}
+		renamed++
+	}
+	for key, sent := range s.Sent {
+		if sent.ChatID != from {
+			continue
+		}
+		delete(s.Sent, key)
+		sent.ChatID = to
+		s.Sent[IdempotencyKey(sent.StoryID, to)] = sent
+	}
+	if history, ok := s.Metrics.Members[from]; ok {
+		delete(s.Metrics.Members, from)
+		if _, ok := s.Metrics.Members[to]; !ok {
+			s.Metrics.Members[to] = history
+		}
+	}
+	return renamed
+}
@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// DomainRecent is how many of a domain's latest stories are remembered.
+const DomainRecent = 3
+
+// DomainStory is a posted story remembered for the statistics of the domain
+// it linked to.
+type DomainStory struct {
+	ID        int64     `json:"id"`
+	Title     string    `json:"title"`
+	Score     int64     `json:"score"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+// DomainStats sums up the posted stories of a domain that are no longer
+// tracked, with their last known scores.
+type DomainStats struct {
+	Posted   int64 `json:"posted"`
+	ScoreSum int64 `json:"score_sum"`
+
+	// Recent are the latest DomainRecent stories, newest first.
+	Recent []DomainStory `json:"recent,omitempty"`
+}
+
+// Add counts a story into the statistics.
+func (d *DomainStats) Add(story DomainStory) {
+	d.Posted++
+	d.ScoreSum += story.Score
+	i := 0
+	for i < len(d.Recent) && d.Recent[i].FirstSeen.After(story.FirstSeen) {
+		i++
+	}
+	d.Recent = slices.Insert(d.Recent, i, story)
+	if len(d.Recent) > DomainRecent {
+		d.Recent = d.Recent[:DomainRecent]
+	}
+}
+
+// RememberDomain counts a posted story that is no longer tracked into the
+// statistics of domain. Callers hold the lock.
+func (s *Store) RememberDomain(domain string, story *Story) {
+	if domain == "" {
+		return
+	}
+	if s.Domains == nil {
+		s.Domains = make(map[string]DomainStats)
+	}
+	stats := s.Domains[domain]
+	stats.Add(DomainStory{ID: story.ID, Title: story.Title, Score: story.Score, FirstSeen: story.FirstSeen})
+	s.Domains[domain] = stats
+}
+
+// Domain returns a copy of the statistics of domain.
+func (s *Store) Domain(domain string) DomainStats {
+	s.RLock()
+	defer s.RUnlock()
+
+	stats := s.Domains[domain]
+	stats.Recent = slices.Clone(stats.Recent)
+	return stats
+}
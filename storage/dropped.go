@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"log"
+	"time"
+)
+
+// SecondChanceWindow is how long a story that dropped off the front page is
+// remembered, so that it can be recognized when it comes back.
+const SecondChanceWindow = 7 * 24 * time.Hour
+
+// DroppedStory is what is kept of a story after it stopped being tracked.
+type DroppedStory struct {
+	FirstSeen time.Time `json:"first_seen"`
+	DroppedAt time.Time `json:"dropped_at"`
+	Score     int64     `json:"score"`
+
+	// FrontPageSeconds is the story's time on the front page so far, which
+	// keeps adding up when it returns.
+	FrontPageSeconds int64 `json:"front_page_seconds,omitempty"`
+
+	// Suppressed stories stay suppressed when they return.
+	Suppressed bool `json:"suppressed,omitempty"`
+}
+
+// RememberDropped records a story that is about to stop being tracked. The
+// caller holds the storage lock.
+func (s *Store) RememberDropped(story *Story, now time.Time) {
+	if s.Dropped == nil {
+		s.Dropped = make(map[int64]DroppedStory)
+	}
+	s.Dropped[story.ID] = DroppedStory{
+		FirstSeen: story.FirstSeen,
+		DroppedAt: now,
+		Score:     story.Score,
+
+		FrontPageSeconds: story.FrontPageSeconds,
+
+		Suppressed: story.State == StateSuppressed,
+	}
+}
+
+// TakeDropped returns and forgets the record of a dropped story.
+func (s *Store) TakeDropped(id int64) (DroppedStory, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	dropped, ok := s.Dropped[id]
+	delete(s.Dropped, id)
+	return dropped, ok
+}
+
+// PruneDropped forgets stories that dropped longer than SecondChanceWindow ago.
+func (s *Store) PruneDropped(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, dropped := range s.Dropped {
+		if now.Sub(dropped.DroppedAt) > SecondChanceWindow {
+			delete(s.Dropped, id)
+		}
+	}
+}
+
+// ReturnFrom restores the first-seen time of a story that re-entered the top
+// list. It gets a second chance when it has gained points since it dropped,
+// as stories re-upped by HN's second-chance pool do.
+func (s *Story) ReturnFrom(dropped DroppedStory, now time.Time) {
+	if !dropped.FirstSeen.IsZero() {
+		s.FirstSeen = dropped.FirstSeen
+	}
+	s.FrontPageSeconds = dropped.FrontPageSeconds
+	if dropped.Suppressed {
+		s.State = StateSuppressed
+		return
+	}
+	if s.Score > dropped.Score {
+		s.SecondChance = true
+		log.Printf("Story %d is back on the front page after dropping off %s ago, marking it as second chance",
+			s.ID, now.Sub(dropped.DroppedAt).Round(time.Minute))
+	}
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// encryptedMagic prefixes data files written with storage encryption.
+var encryptedMagic = []byte("TGHNENC1")
+
+// ErrKey is wrapped by errors caused by a missing, malformed or wrong
+// storage key.
+var ErrKey = errors.New("storage encryption key")
+
+// NewCipher returns the cipher for a storage key: 32 random bytes, base64
+// encoded.
+func NewCipher(key string) (cipher.AEAD, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(raw) != 32 {
+		return nil, fmt.Errorf("%w must be 32 bytes, base64 encoded (generate one with `openssl rand -base64 32`)", ErrKey)
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptStorage(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plaintext, encryptedMagic), nil
+}
+
+// decryptStorage returns the plaintext of an encrypted data file. Plaintext
+// files are returned unchanged so existing deployments can turn encryption on;
+// they are encrypted on the next save.
+func decryptStorage(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return data, nil
+	}
+	if aead == nil {
+		return nil, fmt.Errorf("data file is encrypted but no %w is configured (set STORAGE_KEY or STORAGE_KEY_FILE)", ErrKey)
+	}
+
+	data = data[len(encryptedMagic):]
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("encrypted data file is truncated")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, encryptedMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data file, wrong %w?", ErrKey)
+	}
+	return plaintext, nil
+}
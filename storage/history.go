@@ -0,0 +1,70 @@
+package storage
+
+import "time"
+
+// HistoryRetention is how long posted stories are remembered after they stop
+// being tracked, for digests.
+const HistoryRetention = 90 * 24 * time.Hour
+
+// PostedStory is what is remembered of a posted story once it is no longer
+// tracked, with its last known values.
+type PostedStory struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	By          string    `json:"by,omitempty"`
+	Score       int64     `json:"score"`
+	Descendants int64     `json:"descendants"`
+	FirstSeen   time.Time `json:"first_seen"`
+	Summary     string    `json:"summary,omitempty"`
+
+	// FrontPageSeconds is how long the story was on the front page.
+	FrontPageSeconds int64 `json:"front_page_seconds,omitempty"`
+
+	// PeakRank is the best rank the story reached in the front page
+	// snapshots of a digest's period, or 0. It is not stored.
+	PeakRank int `json:"-"`
+}
+
+// Posted returns what is remembered of the story once it is no longer
+// tracked, with summary as its plain text summary.
+func (s *Story) Posted(summary string) PostedStory {
+	return PostedStory{
+		ID:          s.ID,
+		URL:         s.URL,
+		Title:       s.Title,
+		By:          s.By,
+		Score:       s.Score,
+		Descendants: s.Descendants,
+		FirstSeen:   s.FirstSeen,
+		Summary:     summary,
+
+		FrontPageSeconds: s.FrontPageSeconds,
+	}
+}
+
+// FrontPage returns how long the story was on the front page.
+func (s PostedStory) FrontPage() time.Duration {
+	return time.Duration(s.FrontPageSeconds) * time.Second
+}
+
+// RememberHistory records a posted story that is about to stop being
+// tracked. The caller holds the storage lock.
+func (s *Store) RememberHistory(story PostedStory) {
+	if s.History == nil {
+		s.History = make(map[int64]PostedStory)
+	}
+	s.History[story.ID] = story
+}
+
+// PruneHistory forgets stories first seen longer than HistoryRetention ago.
+func (s *Store) PruneHistory(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, story := range s.History {
+		if now.Sub(story.FirstSeen) > HistoryRetention {
+			delete(s.History, id)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLeaseHeld is returned when another replica holds the failover lease, and
+// by Save once another replica took it over.
+var ErrLeaseHeld = errors.New("failover lease held by another replica")
+
+// ErrLeaseUnsupported is returned by the lease methods of backends that
+// replicas can't share.
+var ErrLeaseUnsupported = errors.New("failover lease needs the sqlite or redis backend")
+
+// Lease is the failover lease of the replicas sharing a backend: an sqlite
+// database on a common volume at one site, or a Redis server that replicas
+// in different regions reach. Only its holder polls and writes, until it
+// expires without being renewed.
+type Lease struct {
+	Holder  string
+	Expires time.Time
+}
+
+// leaseBackend is implemented by the backends that can hold the lease.
+type leaseBackend interface {
+	acquireLease(holder string, ttl time.Duration, now time.Time) (Lease, error)
+	releaseLease(holder string) error
+}
+
+func (s *Store) leaser() (leaseBackend, error) {
+	backend := s.backend
+	if dual, ok := backend.(*dualBackend); ok {
+		backend = dual.primary
+	}
+	leaser, ok := backend.(leaseBackend)
+	if !ok {
+		return nil, ErrLeaseUnsupported
+	}
+	return leaser, nil
+}
+
+// AcquireLease takes or renews the failover lease for holder until now plus
+// ttl, unless another holder's lease has not expired at now, or by the
+// server's clock with Redis. It returns the lease as it stands afterwards,
+// held by holder or not. Once holder got the lease, Save fails with
+// ErrLeaseHeld after another replica took it over, so a replica that missed
+// losing it can't overwrite the data of the new holder.
+func (s *Store) AcquireLease(holder string, ttl time.Duration, now time.Time) (Lease, error) {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	leaser, err := s.leaser()
+	if err != nil {
+		return Lease{}, err
+	}
+	return leaser.acquireLease(holder, ttl, now)
+}
+
+// ReleaseLease gives up the lease if holder holds it, so a standby replica
+// takes over without waiting for it to expire.
+func (s *Store) ReleaseLease(holder string) error {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	leaser, err := s.leaser()
+	if err != nil {
+		return err
+	}
+	return leaser.releaseLease(holder)
+}
+
+func (q *sqliteBackend) acquireLease(holder string, ttl time.Duration, now time.Time) (Lease, error) {
+	tx, err := q.db.Begin()
+	if err != nil {
+		return Lease{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO lease (id, holder, expires) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET holder = excluded.holder, expires = excluded.expires
+		WHERE lease.holder = excluded.holder OR lease.expires <= ?`,
+		holder, now.Add(ttl).UnixMilli(), now.UnixMilli()); err != nil {
+		return Lease{}, fmt.Errorf("failed to acquire the failover lease: %w", err)
+	}
+	var lease Lease
+	var expires int64
+	if err := tx.QueryRow(`SELECT holder, expires FROM lease WHERE id = 1`).Scan(&lease.Holder, &expires); err != nil {
+		return Lease{}, fmt.Errorf("failed to read the failover lease: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return Lease{}, fmt.Errorf("failed to acquire the failover lease: %w", err)
+	}
+	lease.Expires = time.UnixMilli(expires)
+	if lease.Holder == holder {
+		q.holder = holder
+	}
+	return lease, nil
+}
+
+func (q *sqliteBackend) releaseLease(holder string) error {
+	if _, err := q.db.Exec(`DELETE FROM lease WHERE id = 1 AND holder = ?`, holder); err != nil {
+		return fmt.Errorf("failed to release the failover lease: %w", err)
+	}
+	return nil
+}
+
+// checkLease fails with ErrLeaseHeld when the lease was taken over from the
+// holder of this backend, if any. It runs in the transaction of a save.
+func (q *sqliteBackend) checkLease(tx *sql.Tx) error {
+	if q.holder == "" {
+		return nil
+	}
+	var holder string
+	err := tx.QueryRow(`SELECT holder FROM lease WHERE id = 1`).Scan(&holder)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil // Released, nobody took over yet
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the failover lease: %w", err)
+	}
+	if holder != q.holder {
+		return fmt.Errorf("%w: %s", ErrLeaseHeld, holder)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// MemberHistoryDays is how many days of member counts are kept.
+const MemberHistoryDays = 400
+
+// MemberCount is the member count of a chat on one UTC day.
+type MemberCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// RecordMemberCount records the member count of chatID at now, replacing an
+// earlier count of the same day and dropping counts older than
+// MemberHistoryDays.
+func (s *Store) RecordMemberCount(chatID string, count int64, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	m := &s.Metrics
+	if m.Members == nil {
+		m.Members = make(map[string][]MemberCount)
+	}
+	date := now.UTC().Format(time.DateOnly)
+	history := m.Members[chatID]
+	if len(history) > 0 && history[len(history)-1].Date == date {
+		history = history[:len(history)-1]
+	}
+	history = append(history, MemberCount{Date: date, Count: count})
+
+	cutoff := now.UTC().AddDate(0, 0, -MemberHistoryDays+1).Format(time.DateOnly)
+	for len(history) > 0 && history[0].Date < cutoff {
+		history = history[1:]
+	}
+	m.Members[chatID] = history
+}
+
+// MemberCountOn returns the last member count of chatID recorded on or
+// before the UTC day of t.
+func (s *Store) MemberCountOn(chatID string, t time.Time) (MemberCount, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	date := t.UTC().Format(time.DateOnly)
+	history := s.Metrics.Members[chatID]
+	i, found := slices.BinarySearchFunc(history, date, func(c MemberCount, date string) int {
+		return strings.Compare(c.Date, date)
+	})
+	if found {
+		return history[i], true
+	}
+	if i == 0 {
+		return MemberCount{}, false
+	}
+	return history[i-1], true
+}
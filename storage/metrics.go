@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// MetricsHistoryDays is how many days of daily counters are kept.
+const MetricsHistoryDays = 90
+
+// Counters are cumulative counts of what the bot did.
+type Counters struct {
+	Posted    int64 `json:"posted"`
+	Edited    int64 `json:"edited"`
+	Deleted   int64 `json:"deleted"`
+	APIErrors int64 `json:"api_errors"`
+
+	// HNAnomalies are HN items that deviated from the API's schema.
+	HNAnomalies int64 `json:"hn_anomalies"`
+}
+
+func (c *Counters) add(delta Counters) {
+	c.Posted += delta.Posted
+	c.Edited += delta.Edited
+	c.Deleted += delta.Deleted
+	c.APIErrors += delta.APIErrors
+	c.HNAnomalies += delta.HNAnomalies
+}
+
+// DailyCounters are the counts of one UTC day.
+type DailyCounters struct {
+	Date string `json:"date"`
+	Counters
+
+	// Requests counts the outbound requests by upstream, such as "hn".
+	Requests map[string]int64 `json:"requests,omitempty"`
+
+	// Rejected counts the stories rejected by each filter rule, such as
+	// "score".
+	Rejected map[string]int64 `json:"rejected,omitempty"`
+}
+
+// Metrics are the bot's counters, persisted so they survive restarts: the
+// totals since Since and one entry per day, oldest first, for the last
+// MetricsHistoryDays days.
+type Metrics struct {
+	Since time.Time       `json:"since,omitempty"`
+	Total Counters        `json:"total"`
+	Days  []DailyCounters `json:"days,omitempty"`
+
+	// Variants are the counters of experiment variants, by
+	// "experiment/variant".
+	Variants map[string]VariantCounters `json:"variants,omitempty"`
+
+	// Hits are the stories posted per month by domain and author, for the
+	// monthly scoreboard, by "2006-01".
+	Hits map[string]MonthlyHits `json:"hits,omitempty"`
+
+	// Members are the daily member counts of the posting chats, oldest
+	// first, for the growth report.
+	Members map[string][]MemberCount `json:"members,omitempty"`
+}
+
+// VariantCounters are the messages posted under an experiment variant and
+// the reactions they received.
+type VariantCounters struct {
+	Posted    int64 `json:"posted"`
+	Reactions int64 `json:"reactions"`
+}
+
+// CountVariant adds to the counters of an experiment variant.
+func (s *Store) CountVariant(variant string, posted, reactions int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Metrics.Variants == nil {
+		s.Metrics.Variants = make(map[string]VariantCounters)
+	}
+	counters := s.Metrics.Variants[variant]
+	counters.Posted += posted
+	counters.Reactions += reactions
+	s.Metrics.Variants[variant] = counters
+}
+
+// Count adds delta to the totals and to the counters of the day of now,
+// starting a new day and dropping the oldest ones as needed.
+func (s *Store) Count(delta Counters, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	m := &s.Metrics
+	m.Total.add(delta)
+	m.today(now).add(delta)
+}
+
+// CountRequest adds a request to upstream to the counters of the day of now
+// and returns how many were made that day.
+func (s *Store) CountRequest(upstream string, now time.Time) int64 {
+	s.Lock()
+	defer s.Unlock()
+
+	day := s.Metrics.today(now)
+	if day.Requests == nil {
+		day.Requests = make(map[string]int64)
+	}
+	day.Requests[upstream]++
+	return day.Requests[upstream]
+}
+
+// CountRejection adds a story rejected by rule to the counters of the day
+// of now.
+func (s *Store) CountRejection(rule string, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	day := s.Metrics.today(now)
+	if day.Rejected == nil {
+		day.Rejected = make(map[string]int64)
+	}
+	day.Rejected[rule]++
+}
+
+// Requests returns how many requests to upstream were made on the day of now.
+func (s *Store) Requests(upstream string, now time.Time) int64 {
+	s.RLock()
+	defer s.RUnlock()
+
+	days := s.Metrics.Days
+	if len(days) > 0 && days[len(days)-1].Date == now.UTC().Format(time.DateOnly) {
+		return days[len(days)-1].Requests[upstream]
+	}
+	return 0
+}
+
+// today returns the counters of the day of now, starting a new day and
+// dropping the oldest ones as needed.
+func (m *Metrics) today(now time.Time) *DailyCounters {
+	if m.Since.IsZero() {
+		m.Since = now.UTC()
+	}
+
+	date := now.UTC().Format(time.DateOnly)
+	if len(m.Days) == 0 || m.Days[len(m.Days)-1].Date != date {
+		m.Days = append(m.Days, DailyCounters{Date: date})
+	}
+
+	cutoff := now.UTC().AddDate(0, 0, -MetricsHistoryDays+1).Format(time.DateOnly)
+	for len(m.Days) > 0 && m.Days[0].Date < cutoff {
+		m.Days = m.Days[1:]
+	}
+	return &m.Days[len(m.Days)-1]
+}
+
+// MetricsSnapshot returns a copy of the metrics.
+func (s *Store) MetricsSnapshot() Metrics {
+	s.RLock()
+	defer s.RUnlock()
+
+	m := s.Metrics
+	m.Days = slices.Clone(m.Days)
+	for i := range m.Days {
+		m.Days[i].Requests = maps.Clone(m.Days[i].Requests)
+		m.Days[i].Rejected = maps.Clone(m.Days[i].Rejected)
+	}
+	m.Variants = maps.Clone(m.Variants)
+	if m.Hits != nil {
+		hits := make(map[string]MonthlyHits, len(m.Hits))
+		for month, h := range m.Hits {
+			hits[month] = h.clone()
+		}
+		m.Hits = hits
+	}
+	if m.Members != nil {
+		members := make(map[string][]MemberCount, len(m.Members))
+		for chatID, history := range m.Members {
+			members[chatID] = slices.Clone(history)
+		}
+		m.Members = members
+	}
+	return m
+}
+
+// Today returns the counters of the day of now.
+func (m Metrics) Today(now time.Time) Counters {
+	date := now.UTC().Format(time.DateOnly)
+	if len(m.Days) > 0 && m.Days[len(m.Days)-1].Date == date {
+		return m.Days[len(m.Days)-1].Counters
+	}
+	return Counters{}
+}
+
+// RequestsToday returns the requests by upstream of the day of now.
+func (m Metrics) RequestsToday(now time.Time) map[string]int64 {
+	date := now.UTC().Format(time.DateOnly)
+	if len(m.Days) > 0 && m.Days[len(m.Days)-1].Date == date {
+		return m.Days[len(m.Days)-1].Requests
+	}
+	return nil
+}
+
+// RejectedToday returns the stories rejected by filter rule on the day of
+// now.
+func (m Metrics) RejectedToday(now time.Time) map[string]int64 {
+	date := now.UTC().Format(time.DateOnly)
+	if len(m.Days) > 0 && m.Days[len(m.Days)-1].Date == date {
+		return m.Days[len(m.Days)-1].Rejected
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PostedURL is what is remembered of a posted link: the story it was posted
+// for and when.
+type PostedURL struct {
+	ID     int64     `json:"id"`
+	Posted time.Time `json:"posted"`
+}
+
+// URLKey is the key a link is remembered under: a truncated hash of the link
+// without its scheme, "www." prefix, fragment and trailing slash, so that
+// trivially different submissions of the same page match.
+func URLKey(link string) string {
+	normalized := link
+	if u, err := url.Parse(link); err == nil && u.Host != "" {
+		host := strings.TrimPrefix(strings.ToLower(u.Host), "www.")
+		normalized = host + strings.TrimSuffix(u.EscapedPath(), "/")
+		if u.RawQuery != "" {
+			normalized += "?" + u.RawQuery
+		}
+	}
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// RememberPosted records the link of a story that was just posted.
+func (s *Store) RememberPosted(story *Story, now time.Time) {
+	if story.URL == "" {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Posted == nil {
+		s.Posted = make(map[string]PostedURL)
+	}
+	s.Posted[URLKey(story.URL)] = PostedURL{ID: story.ID, Posted: now}
+}
+
+// PreviousPost returns the ID of another story posted with the same link
+// within window.
+func (s *Store) PreviousPost(link string, id int64, window time.Duration, now time.Time) (int64, bool) {
+	if link == "" {
+		return 0, false
+	}
+	s.RLock()
+	defer s.RUnlock()
+
+	previous, ok := s.Posted[URLKey(link)]
+	if !ok || previous.ID == id || now.Sub(previous.Posted) > window {
+		return 0, false
+	}
+	return previous.ID, true
+}
+
+// PrunePosted forgets links posted longer than window ago.
+func (s *Store) PrunePosted(window time.Duration, now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for key, posted := range s.Posted {
+		if now.Sub(posted.Posted) > window {
+			delete(s.Posted, key)
+		}
+	}
+}
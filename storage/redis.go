@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RedisTimeout bounds every exchange with Redis, including connecting.
+	RedisTimeout = 10 * time.Second
+
+	// redisDataKey holds the storage as written to the JSON data file, and
+	// redisLeaseKey the holder of the failover lease, expiring with it.
+	redisDataKey  = "tg_hacker_news:storage"
+	redisLeaseKey = "tg_hacker_news:lease"
+)
+
+// errRedisConflict is returned by a transaction that Redis discarded because
+// a watched key changed.
+var errRedisConflict = errors.New("watched key changed")
+
+// redisBackend keeps the storage in a Redis server, which replicas in
+// different regions can share, as one value holding the same, optionally
+// encrypted, JSON as the data file. It keeps one connection, which is opened
+// on first use and reopened after errors.
+type redisBackend struct {
+	url *url.URL
+
+	mutex  sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+
+	// holder is the replica that got the failover lease, see AcquireLease.
+	holder string
+}
+
+// ValidateRedisURL checks a redis:// or rediss:// (TLS) URL, with an optional
+// user:password@ and database number path.
+func ValidateRedisURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		return fmt.Errorf("redis URL must be a redis:// or rediss:// URL with a host, got %q", redactURL(rawURL))
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if _, err := strconv.Atoi(db); err != nil {
+			return fmt.Errorf("redis URL path must be a database number, got %q", u.Path)
+		}
+	}
+	return nil
+}
+
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Redacted()
+}
+
+func openRedisBackend(rawURL string) (*redisBackend, error) {
+	if err := ValidateRedisURL(rawURL); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(rawURL)
+	return &redisBackend{url: u}, nil
+}
+
+// RedisExists reports whether the Redis server at rawURL holds stored data.
+// It is the data file check for the redis backend, and fails when the server
+// can't be reached.
+func RedisExists(rawURL string) (bool, error) {
+	r, err := openRedisBackend(rawURL)
+	if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	n, err := r.do("EXISTS", redisDataKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to check the storage in redis: %w", err)
+	}
+	return n == int64(1), nil
+}
+
+func (r *redisBackend) Load(s *Store) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	reply, err := r.do("GET", redisDataKey)
+	if err != nil {
+		return fmt.Errorf("failed to read storage from redis: %w", err)
+	}
+	if reply == nil {
+		return nil // Nothing stored yet
+	}
+	data, err := decryptStorage(s.cipher, reply.([]byte))
+	if err != nil {
+		return err
+	}
+	// Parse into a scratch store first, a failed parse leaves s half filled
+	var scratch Store
+	if err := scratch.unmarshal(data); err != nil {
+		return fmt.Errorf("%w: failed to parse storage from redis: %v", ErrCorrupt, err)
+	}
+	return s.unmarshal(data)
+}
+
+// Save writes the storage in a transaction watching the failover lease, so a
+// replica that lost it can't overwrite the data of the new holder, even when
+// the lease changes hands between the check and the write.
+func (r *redisBackend) Save(s *Store) error {
+	data, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for {
+		err := r.saveOnce(data)
+		if !errors.Is(err, errRedisConflict) {
+			return err
+		}
+	}
+}
+
+func (r *redisBackend) saveOnce(data []byte) error {
+	if r.holder != "" {
+		if _, err := r.do("WATCH", redisLeaseKey); err != nil {
+			return fmt.Errorf("failed to save storage to redis: %w", err)
+		}
+		holder, err := r.do("GET", redisLeaseKey)
+		if err != nil {
+			return fmt.Errorf("failed to read the failover lease: %w", err)
+		}
+		// A released lease nobody took over yet is fine
+		if holder != nil && string(holder.([]byte)) != r.holder {
+			r.do("UNWATCH")
+			return fmt.Errorf("%w: %s", ErrLeaseHeld, holder.([]byte))
+		}
+	}
+	if err := r.exec([]string{"SET", redisDataKey, string(data)}); err != nil {
+		if errors.Is(err, errRedisConflict) {
+			return err
+		}
+		return fmt.Errorf("failed to save storage to redis: %w", err)
+	}
+	return nil
+}
+
+func (r *redisBackend) acquireLease(holder string, ttl time.Duration, now time.Time) (Lease, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for {
+		lease, err := r.acquireLeaseOnce(holder, ttl, now)
+		if !errors.Is(err, errRedisConflict) {
+			return lease, err
+		}
+	}
+}
+
+// acquireLeaseOnce sets the lease key to holder, expiring after ttl on the
+// server's clock, unless another holder's key has not expired yet.
+func (r *redisBackend) acquireLeaseOnce(holder string, ttl time.Duration, now time.Time) (Lease, error) {
+	if _, err := r.do("WATCH", redisLeaseKey); err != nil {
+		return Lease{}, fmt.Errorf("failed to acquire the failover lease: %w", err)
+	}
+	current, err := r.do("GET", redisLeaseKey)
+	if err != nil {
+		return Lease{}, fmt.Errorf("failed to read the failover lease: %w", err)
+	}
+	if current != nil && string(current.([]byte)) != holder {
+		ttlLeft, err := r.do("PTTL", redisLeaseKey)
+		r.do("UNWATCH")
+		if err != nil {
+			return Lease{}, fmt.Errorf("failed to read the failover lease: %w", err)
+		}
+		ms, _ := ttlLeft.(int64)
+		return Lease{Holder: string(current.([]byte)), Expires: now.Add(time.Duration(ms) * time.Millisecond)}, nil
+	}
+
+	err = r.exec([]string{"SET", redisLeaseKey, holder, "PX", strconv.FormatInt(ttl.Milliseconds(), 10)})
+	if errors.Is(err, errRedisConflict) {
+		return Lease{}, err
+	}
+	if err != nil {
+		return Lease{}, fmt.Errorf("failed to acquire the failover lease: %w", err)
+	}
+	r.holder = holder
+	return Lease{Holder: holder, Expires: now.Add(ttl)}, nil
+}
+
+func (r *redisBackend) releaseLease(holder string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, err := r.do("WATCH", redisLeaseKey); err != nil {
+		return fmt.Errorf("failed to release the failover lease: %w", err)
+	}
+	current, err := r.do("GET", redisLeaseKey)
+	if err != nil {
+		return fmt.Errorf("failed to release the failover lease: %w", err)
+	}
+	if current == nil || string(current.([]byte)) != holder {
+		r.do("UNWATCH")
+		return nil
+	}
+	// A conflict means the lease was renewed or taken over meanwhile
+	if err := r.exec([]string{"DEL", redisLeaseKey}); err != nil && !errors.Is(err, errRedisConflict) {
+		return fmt.Errorf("failed to release the failover lease: %w", err)
+	}
+	return nil
+}
+
+func (r *redisBackend) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.reset()
+	return nil
+}
+
+// exec runs command in a MULTI/EXEC transaction, failing with
+// errRedisConflict when a key watched before changed.
+func (r *redisBackend) exec(command []string) error {
+	if _, err := r.do("MULTI"); err != nil {
+		return err
+	}
+	if _, err := r.do(command...); err != nil {
+		r.do("DISCARD")
+		return err
+	}
+	reply, err := r.do("EXEC")
+	if err != nil {
+		return err
+	}
+	if reply == nil {
+		return errRedisConflict
+	}
+	for _, result := range reply.([]any) {
+		if err, ok := result.(redisError); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// redisError is an error reply of the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// do sends a command and returns its reply: a string for a status, an int64,
+// []byte for a bulk string, []any for an array, or nil. The caller holds the
+// mutex. The connection is reset after network errors, but not after error
+// replies.
+func (r *redisBackend) do(args ...string) (any, error) {
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, fmt.Errorf("failed to connect to redis at %s: %w", r.url.Redacted(), err)
+		}
+	}
+	reply, err := r.roundTrip(args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		r.reset()
+	}
+	return reply, err
+}
+
+func (r *redisBackend) roundTrip(args []string) (any, error) {
+	r.conn.SetDeadline(time.Now().Add(RedisTimeout))
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.conn, buf.String()); err != nil {
+		return nil, err
+	}
+	return readRedisReply(r.reader)
+}
+
+// connect opens the connection, over TLS for rediss:// URLs, and
+// authenticates with the URL's user info and selects its database.
+func (r *redisBackend) connect() error {
+	host := r.url.Host
+	if r.url.Port() == "" {
+		host = net.JoinHostPort(r.url.Hostname(), "6379")
+	}
+	dialer := &net.Dialer{Timeout: RedisTimeout}
+	var conn net.Conn
+	var err error
+	if r.url.Scheme == "rediss" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: r.url.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return err
+	}
+	r.conn, r.reader = conn, bufio.NewReader(conn)
+
+	if user := r.url.User; user != nil {
+		args := []string{"AUTH", user.Username()}
+		if password, ok := user.Password(); ok {
+			args = []string{"AUTH", user.Username(), password}
+			if user.Username() == "" {
+				args = []string{"AUTH", password}
+			}
+		}
+		if _, err := r.roundTrip(args); err != nil {
+			r.reset()
+			return err
+		}
+	}
+	if db := strings.TrimPrefix(r.url.Path, "/"); db != "" && db != "0" {
+		if _, err := r.roundTrip([]string{"SELECT", db}); err != nil {
+			r.reset()
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *redisBackend) reset() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn, r.reader = nil, nil
+}
+
+// readRedisReply reads one RESP2 reply.
+func readRedisReply(reader *bufio.Reader) (any, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		for i := range items {
+			// Error replies inside EXEC belong to the queued command
+			item, err := readRedisReply(reader)
+			var replyErr redisError
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			if err != nil {
+				item = replyErr
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves the commands redisBackend uses, with expiry on a clock the
+// test advances and WATCH aborting transactions after writes or expiry.
+type fakeRedis struct {
+	t        *testing.T
+	listener net.Listener
+
+	mutex    sync.Mutex
+	now      time.Time
+	values   map[string]string
+	expires  map[string]time.Time
+	versions map[string]int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		t:        t,
+		listener: listener,
+		now:      time.Unix(1700000000, 0),
+		values:   make(map[string]string),
+		expires:  make(map[string]time.Time),
+		versions: make(map[string]int),
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) url() string {
+	return "redis://" + f.listener.Addr().String() + "/0"
+}
+
+func (f *fakeRedis) advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// expire drops key once its expiry passed. The caller holds the mutex.
+func (f *fakeRedis) expire(key string) {
+	if expires, ok := f.expires[key]; ok && !f.now.Before(expires) {
+		delete(f.values, key)
+		delete(f.expires, key)
+		f.versions[key]++
+	}
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	watched := map[string]int{}
+	var queued [][]string
+	inMulti := false
+
+	for {
+		args, err := readFakeCommand(reader)
+		if err != nil {
+			return
+		}
+		name := strings.ToUpper(args[0])
+
+		f.mutex.Lock()
+		var reply string
+		switch {
+		case inMulti && name != "EXEC" && name != "DISCARD":
+			queued = append(queued, args)
+			reply = "+QUEUED\r\n"
+		case name == "MULTI":
+			inMulti, queued = true, nil
+			reply = "+OK\r\n"
+		case name == "DISCARD":
+			inMulti, queued, watched = false, nil, map[string]int{}
+			reply = "+OK\r\n"
+		case name == "WATCH":
+			f.expire(args[1])
+			watched[args[1]] = f.versions[args[1]]
+			reply = "+OK\r\n"
+		case name == "UNWATCH":
+			watched = map[string]int{}
+			reply = "+OK\r\n"
+		case name == "EXEC":
+			aborted := false
+			for key, version := range watched {
+				f.expire(key)
+				if f.versions[key] != version {
+					aborted = true
+				}
+			}
+			if aborted {
+				reply = "*-1\r\n"
+			} else {
+				reply = fmt.Sprintf("*%d\r\n", len(queued))
+				for _, command := range queued {
+					reply += f.run(command)
+				}
+			}
+			inMulti, queued, watched = false, nil, map[string]int{}
+		default:
+			reply = f.run(args)
+		}
+		f.mutex.Unlock()
+
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+// run executes a command outside of MULTI. The caller holds the mutex.
+func (f *fakeRedis) run(args []string) string {
+	name := strings.ToUpper(args[0])
+	if len(args) > 1 {
+		f.expire(args[1])
+	}
+	switch name {
+	case "AUTH", "SELECT", "PING":
+		return "+OK\r\n"
+	case "GET":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+	case "SET":
+		f.values[args[1]] = args[2]
+		delete(f.expires, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			f.expires[args[1]] = f.now.Add(time.Duration(ms) * time.Millisecond)
+		}
+		f.versions[args[1]]++
+		return "+OK\r\n"
+	case "DEL":
+		if _, ok := f.values[args[1]]; !ok {
+			return ":0\r\n"
+		}
+		delete(f.values, args[1])
+		delete(f.expires, args[1])
+		f.versions[args[1]]++
+		return ":1\r\n"
+	case "EXISTS":
+		if _, ok := f.values[args[1]]; ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	case "PTTL":
+		expires, ok := f.expires[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", expires.Sub(f.now).Milliseconds())
+	}
+	return "-ERR unknown command '" + name + "'\r\n"
+}
+
+func readFakeCommand(reader *bufio.Reader) ([]string, error) {
+	reply, err := readRedisReply(reader)
+	if err != nil {
+		return nil, err
+	}
+	items, ok := reply.([]any)
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("command is not an array: %v", reply)
+	}
+	args := make([]string, len(items))
+	for i, item := range items {
+		args[i] = string(item.([]byte))
+	}
+	return args, nil
+}
+
+func openRedisStore(t *testing.T, f *fakeRedis) *Store {
+	store, err := Open(Options{Backend: BackendRedis, Path: f.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestRedisBackendRoundTrip(t *testing.T) {
+	f := newFakeRedis(t)
+	if exists, err := RedisExists(f.url()); err != nil || exists {
+		t.Fatalf("RedisExists before the first save = %v, %v, want false", exists, err)
+	}
+
+	store := openRedisStore(t, f)
+	store.Stories[40210123] = &Story{ID: 40210123, Title: "Show HN: A tiny Redis", State: StatePosted}
+	store.UpdatesOffset = 42
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := RedisExists(f.url()); err != nil || !exists {
+		t.Fatalf("RedisExists after a save = %v, %v, want true", exists, err)
+	}
+
+	loaded := openRedisStore(t, f)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Compare(store, loaded); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedisLeaseFailover(t *testing.T) {
+	f := newFakeRedis(t)
+	active, standby := openRedisStore(t, f), openRedisStore(t, f)
+	const ttl = 30 * time.Second
+
+	if lease, err := active.AcquireLease("eu", ttl, time.Now()); err != nil || lease.Holder != "eu" {
+		t.Fatalf("first AcquireLease = %+v, %v, want it held by eu", lease, err)
+	}
+	if lease, err := standby.AcquireLease("us", ttl, time.Now()); err != nil || lease.Holder != "eu" {
+		t.Fatalf("AcquireLease of the standby = %+v, %v, want it still held by eu", lease, err)
+	}
+	f.advance(ttl / 3)
+	if lease, err := active.AcquireLease("eu", ttl, time.Now()); err != nil || lease.Holder != "eu" {
+		t.Fatalf("renewal = %+v, %v, want it held by eu", lease, err)
+	}
+	if err := active.Save(); err != nil {
+		t.Fatalf("Save of the holder: %v", err)
+	}
+
+	// The active replica stops renewing, the standby takes over
+	f.advance(ttl)
+	if lease, err := standby.AcquireLease("us", ttl, time.Now()); err != nil || lease.Holder != "us" {
+		t.Fatalf("AcquireLease after expiry = %+v, %v, want it taken over by us", lease, err)
+	}
+	if err := active.Save(); !errors.Is(err, ErrLeaseHeld) {
+		t.Errorf("Save after the takeover = %v, want ErrLeaseHeld", err)
+	}
+	if err := standby.Save(); err != nil {
+		t.Errorf("Save of the new holder: %v", err)
+	}
+	// Releasing a lease held by another replica leaves it alone
+	if err := active.ReleaseLease("eu"); err != nil {
+		t.Fatal(err)
+	}
+	if lease, err := active.AcquireLease("eu", ttl, time.Now()); err != nil || lease.Holder != "us" {
+		t.Fatalf("AcquireLease of the old holder = %+v, %v, want it held by us", lease, err)
+	}
+
+	if err := standby.ReleaseLease("us"); err != nil {
+		t.Fatal(err)
+	}
+	if lease, err := active.AcquireLease("eu", ttl, time.Now()); err != nil || lease.Holder != "eu" {
+		t.Errorf("AcquireLease after release = %+v, %v, want it held by eu", lease, err)
+	}
+}
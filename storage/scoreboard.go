@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+)
+
+// ScoreboardMonths is how many months of front-page hits are kept.
+const ScoreboardMonths = 13
+
+// MonthlyHits counts the stories posted in one month by the domain they
+// link to and by their submitter.
+type MonthlyHits struct {
+	Domains map[string]int64 `json:"domains,omitempty"`
+	Authors map[string]int64 `json:"authors,omitempty"`
+}
+
+func (h MonthlyHits) clone() MonthlyHits {
+	return MonthlyHits{Domains: maps.Clone(h.Domains), Authors: maps.Clone(h.Authors)}
+}
+
+// CountHit adds a story that was just posted to the hits of month, formatted
+// like "2006-01", dropping the oldest months as needed. Empty domains and
+// authors are not counted.
+func (s *Store) CountHit(month, domain, author string) {
+	s.Lock()
+	defer s.Unlock()
+
+	m := &s.Metrics
+	if m.Hits == nil {
+		m.Hits = make(map[string]MonthlyHits)
+	}
+	hits := m.Hits[month]
+	if domain != "" {
+		if hits.Domains == nil {
+			hits.Domains = make(map[string]int64)
+		}
+		hits.Domains[domain]++
+	}
+	if author != "" {
+		if hits.Authors == nil {
+			hits.Authors = make(map[string]int64)
+		}
+		hits.Authors[author]++
+	}
+	m.Hits[month] = hits
+
+	months := make([]string, 0, len(m.Hits))
+	for month := range m.Hits {
+		months = append(months, month)
+	}
+	slices.Sort(months)
+	for len(months) > ScoreboardMonths {
+		delete(m.Hits, months[0])
+		months = months[1:]
+	}
+}
+
+// MonthHits returns a copy of the hits of month.
+func (s *Store) MonthHits(month string) MonthlyHits {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Metrics.Hits[month].clone()
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+const (
+	// UnconfirmedSendTTL is how long a send whose outcome is unknown, after
+	// a crash or a network error, keeps the story from being sent to the
+	// chat again.
+	UnconfirmedSendTTL = 6 * time.Hour
+
+	// SentKeyTTL is how long the key of a confirmed send is kept at most,
+	// in case its message is never deleted.
+	SentKeyTTL = 30 * 24 * time.Hour
+)
+
+// SentKey is the record of a send of a story to a chat, kept under its
+// idempotency key.
+type SentKey struct {
+	StoryID int64     `json:"story_id"`
+	ChatID  string    `json:"chat_id"`
+	Claimed time.Time `json:"claimed"`
+
+	// MessageID is the sent message, or 0 while the send is unconfirmed.
+	MessageID int64 `json:"message_id,omitempty"`
+}
+
+// IdempotencyKey returns the deterministic key of sending a story to a chat.
+func IdempotencyKey(storyID int64, chatID string) string {
+	sum := sha256.Sum256([]byte(strconv.FormatInt(storyID, 10) + "\x00" + chatID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// ClaimSend records that a story is about to be sent to a chat. When the key
+// is already claimed it returns the existing record and false.
+func (s *Store) ClaimSend(storyID int64, chatID string, now time.Time) (SentKey, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := IdempotencyKey(storyID, chatID)
+	if sent, ok := s.Sent[key]; ok {
+		return sent, false
+	}
+	if s.Sent == nil {
+		s.Sent = make(map[string]SentKey)
+	}
+	sent := SentKey{StoryID: storyID, ChatID: chatID, Claimed: now}
+	s.Sent[key] = sent
+	return sent, true
+}
+
+// ConfirmSend records the message a claimed send resulted in.
+func (s *Store) ConfirmSend(storyID int64, chatID string, messageID int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := IdempotencyKey(storyID, chatID)
+	sent := s.Sent[key]
+	sent.MessageID = messageID
+	s.Sent[key] = sent
+}
+
+// ReleaseSend forgets the key of sending a story to a chat, after the send
+// failed or its message was removed, so that it can be sent again.
+func (s *Store) ReleaseSend(storyID int64, chatID string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.Sent, IdempotencyKey(storyID, chatID))
+}
+
+// MoveSends hands the keys of the sends of story from over to story to, which
+// took over its messages.
+func (s *Store) MoveSends(from, to int64) {
+	s.Lock()
+	defer s.Unlock()
+
+	for key, sent := range s.Sent {
+		if sent.StoryID != from {
+			continue
+		}
+		delete(s.Sent, key)
+		sent.StoryID = to
+		s.Sent[IdempotencyKey(to, sent.ChatID)] = sent
+	}
+}
+
+// SentSince returns the number of sends to chatID claimed at or after since.
+func (s *Store) SentSince(chatID string, since time.Time) int {
+	s.RLock()
+	defer s.RUnlock()
+
+	n := 0
+	for _, sent := range s.Sent {
+		if sent.ChatID == chatID && !sent.Claimed.Before(since) {
+			n++
+		}
+	}
+	return n
+}
+
+// UnconfirmedSends returns the sends whose outcome is unknown.
+func (s *Store) UnconfirmedSends() []SentKey {
+	s.RLock()
+	defer s.RUnlock()
+
+	var unconfirmed []SentKey
+	for _, sent := range s.Sent {
+		if sent.MessageID == 0 {
+			unconfirmed = append(unconfirmed, sent)
+		}
+	}
+	return unconfirmed
+}
+
+// PruneSent forgets unconfirmed sends older than UnconfirmedSendTTL and
+// confirmed ones older than SentKeyTTL.
+func (s *Store) PruneSent(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	for key, sent := range s.Sent {
+		ttl := SentKeyTTL
+		if sent.MessageID == 0 {
+			ttl = UnconfirmedSendTTL
+		}
+		if now.Sub(sent.Claimed) > ttl {
+			delete(s.Sent, key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package storage
+
+import "slices"
+
+// ChatSettings are the choices the admins of a chat made with /settings.
+// Unset thresholds fall back to the configured ones.
+type ChatSettings struct {
+	ScoreThreshold    *int64 `json:"score_threshold,omitempty"`
+	CommentsThreshold *int64 `json:"comments_threshold,omitempty"`
+
+	// Muted are the story kinds the chat does not receive, see filter.Kind.
+	Muted []string `json:"muted,omitempty"`
+
+	// QuietHours is a daily "HH:MM-HH:MM" range in TIMEZONE during which
+	// nothing is posted to the chat.
+	QuietHours string `json:"quiet_hours,omitempty"`
+
+	// Hashtags adds a line of hashtags to the chat's messages.
+	Hashtags bool `json:"hashtags,omitempty"`
+}
+
+// IsZero reports whether the settings are all at their defaults.
+func (c ChatSettings) IsZero() bool {
+	return c.ScoreThreshold == nil && c.CommentsThreshold == nil && len(c.Muted) == 0 &&
+		c.QuietHours == "" && !c.Hashtags
+}
+
+// Settings returns the settings of chatID.
+func (s *Store) Settings(chatID string) ChatSettings {
+	s.RLock()
+	defer s.RUnlock()
+
+	settings := s.ChatSettings[chatID]
+	settings.Muted = slices.Clone(settings.Muted)
+	return settings
+}
+
+// SetSettings replaces the settings of chatID. Default settings are removed.
+func (s *Store) SetSettings(chatID string, settings ChatSettings) {
+	s.Lock()
+	defer s.Unlock()
+
+	if settings.IsZero() {
+		delete(s.ChatSettings, chatID)
+		return
+	}
+	if s.ChatSettings == nil {
+		s.ChatSettings = make(map[string]ChatSettings)
+	}
+	s.ChatSettings[chatID] = settings
+}
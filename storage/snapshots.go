@@ -0,0 +1,82 @@
+package storage
+
+import "time"
+
+const (
+	// SnapshotInterval is how often the front page is snapshotted.
+	SnapshotInterval = time.Hour
+
+	// SnapshotFullAge is how long every snapshot is kept. Older ones are
+	// downsampled to the first snapshot of each UTC day.
+	SnapshotFullAge = 7 * 24 * time.Hour
+
+	// SnapshotRetention is how long daily snapshots are kept.
+	SnapshotRetention = 90 * 24 * time.Hour
+)
+
+// Snapshot is the top list at one point in time.
+type Snapshot struct {
+	Time    time.Time       `json:"time"`
+	Stories []SnapshotStory `json:"stories"`
+}
+
+// SnapshotStory is a story's position on the top list in a snapshot.
+type SnapshotStory struct {
+	ID       int64 `json:"id"`
+	Rank     int   `json:"rank"`
+	Score    int64 `json:"score"`
+	Comments int64 `json:"comments,omitempty"`
+}
+
+// RecordSnapshot appends snapshot unless the last one was taken less than
+// SnapshotInterval earlier. It reports whether the snapshot was kept.
+func (s *Store) RecordSnapshot(snapshot Snapshot) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if n := len(s.Snapshots); n > 0 && snapshot.Time.Sub(s.Snapshots[n-1].Time) < SnapshotInterval {
+		return false
+	}
+	s.Snapshots = append(s.Snapshots, snapshot)
+	return true
+}
+
+// SnapshotsSince returns the snapshots taken since from, oldest first.
+func (s *Store) SnapshotsSince(from time.Time) []Snapshot {
+	s.RLock()
+	defer s.RUnlock()
+
+	var snapshots []Snapshot
+	for _, snapshot := range s.Snapshots {
+		if !snapshot.Time.Before(from) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return snapshots
+}
+
+// CompactSnapshots keeps only the first snapshot of each UTC day among those
+// older than SnapshotFullAge and forgets those older than SnapshotRetention.
+func (s *Store) CompactSnapshots(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	kept := s.Snapshots[:0]
+	var lastDay string
+	for _, snapshot := range s.Snapshots {
+		age := now.Sub(snapshot.Time)
+		if age > SnapshotRetention {
+			continue
+		}
+		if age > SnapshotFullAge {
+			day := snapshot.Time.UTC().Format("2006-01-02")
+			if day == lastDay {
+				continue
+			}
+			lastDay = day
+		}
+		kept = append(kept, snapshot)
+	}
+	clear(s.Snapshots[len(kept):])
+	s.Snapshots = kept
+}
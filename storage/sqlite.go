@@ -0,0 +1,353 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS stories (
+	id    INTEGER PRIMARY KEY,
+	state TEXT NOT NULL DEFAULT '',
+	data  TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS stories_state ON stories (state);
+CREATE TABLE IF NOT EXISTS lease (
+	id      INTEGER PRIMARY KEY CHECK (id = 1),
+	holder  TEXT NOT NULL,
+	expires INTEGER NOT NULL
+);
+`
+
+// sqliteBackend stores one row per story, with the story itself kept as JSON
+// so new story fields don't need schema migrations.
+type sqliteBackend struct {
+	db *sql.DB
+
+	// holder is the replica that got the failover lease, see AcquireLease.
+	holder string
+}
+
+func openSQLiteBackend(path string) (*sqliteBackend, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create sqlite schema in %s: %w", path, err)
+	}
+	return &sqliteBackend{db: db}, nil
+}
+
+func (q *sqliteBackend) Load(s *Store) error {
+	var version string
+	err := q.db.QueryRow(`SELECT value FROM meta WHERE key = 'version'`).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil // Fresh database
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read storage version: %w", err)
+	}
+	if s.Version, err = strconv.Atoi(version); err != nil {
+		return fmt.Errorf("invalid storage version %q: %w", version, err)
+	}
+
+	rows, err := q.db.Query(`SELECT data FROM stories`)
+	if err != nil {
+		return fmt.Errorf("failed to read stories: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("failed to read story: %w", err)
+		}
+
+		var story Story
+		if err := json.Unmarshal(data, &story); err != nil {
+			return fmt.Errorf("failed to decode story: %w", err)
+		}
+		s.Stories[story.ID] = &story
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var dropped string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'dropped'`).Scan(&dropped)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read dropped stories: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(dropped), &s.Dropped); err != nil {
+			return fmt.Errorf("failed to decode dropped stories: %w", err)
+		}
+	}
+
+	var posted string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'posted'`).Scan(&posted)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read posted links: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(posted), &s.Posted); err != nil {
+			return fmt.Errorf("failed to decode posted links: %w", err)
+		}
+	}
+
+	var domains string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'domains'`).Scan(&domains)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read domain statistics: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(domains), &s.Domains); err != nil {
+			return fmt.Errorf("failed to decode domain statistics: %w", err)
+		}
+	}
+
+	var settings string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'chat_settings'`).Scan(&settings)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read chat settings: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(settings), &s.ChatSettings); err != nil {
+			return fmt.Errorf("failed to decode chat settings: %w", err)
+		}
+	}
+
+	var suggestions string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'suggestions'`).Scan(&suggestions)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read suggestions: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(suggestions), &s.Suggestions); err != nil {
+			return fmt.Errorf("failed to decode suggestions: %w", err)
+		}
+	}
+
+	var history string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'history'`).Scan(&history)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read story history: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(history), &s.History); err != nil {
+			return fmt.Errorf("failed to decode story history: %w", err)
+		}
+	}
+
+	var sent string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'sent'`).Scan(&sent)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read idempotency keys: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(sent), &s.Sent); err != nil {
+			return fmt.Errorf("failed to decode idempotency keys: %w", err)
+		}
+	}
+
+	var chats string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'chats'`).Scan(&chats)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read resolved chats: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(chats), &s.Chats); err != nil {
+			return fmt.Errorf("failed to decode resolved chats: %w", err)
+		}
+	}
+
+	var snapshots string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'snapshots'`).Scan(&snapshots)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read front page snapshots: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal([]byte(snapshots), &s.Snapshots); err != nil {
+			return fmt.Errorf("failed to decode front page snapshots: %w", err)
+		}
+	}
+
+	var offset string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'updates_offset'`).Scan(&offset)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to read updates offset: %w", err)
+	}
+	if err == nil {
+		if s.UpdatesOffset, err = strconv.ParseInt(offset, 10, 64); err != nil {
+			return fmt.Errorf("invalid updates offset %q: %w", offset, err)
+		}
+	}
+
+	var metrics string
+	err = q.db.QueryRow(`SELECT value FROM meta WHERE key = 'metrics'`).Scan(&metrics)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metrics: %w", err)
+	}
+	if err := json.Unmarshal([]byte(metrics), &s.Metrics); err != nil {
+		return fmt.Errorf("failed to decode metrics: %w", err)
+	}
+	return nil
+}
+
+func (q *sqliteBackend) Save(s *Store) error {
+	type row struct {
+		id    int64
+		state State
+		data  []byte
+	}
+
+	s.RLock()
+	version := s.Version
+	offset := s.UpdatesOffset
+	rows := make([]row, 0, len(s.Stories))
+	for id, story := range s.Stories {
+		data, err := json.Marshal(story)
+		if err != nil {
+			s.RUnlock()
+			return fmt.Errorf("failed to encode story %d: %w", id, err)
+		}
+		rows = append(rows, row{id: id, state: story.State, data: data})
+	}
+	dropped, err := json.Marshal(s.Dropped)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode dropped stories: %w", err)
+	}
+	posted, err := json.Marshal(s.Posted)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode posted links: %w", err)
+	}
+	domains, err := json.Marshal(s.Domains)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode domain statistics: %w", err)
+	}
+	settings, err := json.Marshal(s.ChatSettings)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode chat settings: %w", err)
+	}
+	suggestions, err := json.Marshal(s.Suggestions)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode suggestions: %w", err)
+	}
+	history, err := json.Marshal(s.History)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode story history: %w", err)
+	}
+	sent, err := json.Marshal(s.Sent)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode idempotency keys: %w", err)
+	}
+	chats, err := json.Marshal(s.Chats)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode resolved chats: %w", err)
+	}
+	snapshots, err := json.Marshal(s.Snapshots)
+	if err != nil {
+		s.RUnlock()
+		return fmt.Errorf("failed to encode front page snapshots: %w", err)
+	}
+	metrics, err := json.Marshal(s.Metrics)
+	s.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics: %w", err)
+	}
+
+	tx, err := q.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := q.checkLease(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM stories`); err != nil {
+		return fmt.Errorf("failed to clear stories: %w", err)
+	}
+	for _, r := range rows {
+		if _, err := tx.Exec(`INSERT INTO stories (id, state, data) VALUES (?, ?, ?)`, r.id, string(r.state), string(r.data)); err != nil {
+			return fmt.Errorf("failed to write story %d: %w", r.id, err)
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('version', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, strconv.Itoa(version)); err != nil {
+		return fmt.Errorf("failed to write storage version: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('dropped', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(dropped)); err != nil {
+		return fmt.Errorf("failed to write dropped stories: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('posted', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(posted)); err != nil {
+		return fmt.Errorf("failed to write posted links: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('domains', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(domains)); err != nil {
+		return fmt.Errorf("failed to write domain statistics: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('chat_settings', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(settings)); err != nil {
+		return fmt.Errorf("failed to write chat settings: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('suggestions', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(suggestions)); err != nil {
+		return fmt.Errorf("failed to write suggestions: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('history', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(history)); err != nil {
+		return fmt.Errorf("failed to write story history: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('sent', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(sent)); err != nil {
+		return fmt.Errorf("failed to write idempotency keys: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('chats', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(chats)); err != nil {
+		return fmt.Errorf("failed to write resolved chats: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('snapshots', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(snapshots)); err != nil {
+		return fmt.Errorf("failed to write front page snapshots: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('updates_offset', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, strconv.FormatInt(offset, 10)); err != nil {
+		return fmt.Errorf("failed to write updates offset: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('metrics', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, string(metrics)); err != nil {
+		return fmt.Errorf("failed to write metrics: %w", err)
+	}
+	return tx.Commit()
+}
+
+func (q *sqliteBackend) Close() error {
+	return q.db.Close()
+}
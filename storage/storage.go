@@ -0,0 +1,510 @@
+// Package storage persists the stories tracked by the bot in a JSON file, an
+// SQLite database or Redis.
+package storage
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	BackendJSON   = "json"
+	BackendSQLite = "sqlite"
+	BackendRedis  = "redis"
+
+	// Version is the current storage format version.
+	Version = 3
+
+	// BackupRotation is how often the JSON data file is copied to its
+	// rotated backups.
+	BackupRotation = time.Hour
+)
+
+// ErrCorrupt is returned by Load when the JSON data file and all of its
+// rotated backups fail to parse.
+var ErrCorrupt = errors.New("data file and its backups are corrupted")
+
+// Backend persists the tracked stories. Store is the in-memory working set;
+// a backend fills it on startup and writes it back after every change.
+type Backend interface {
+	// Load fills s from the backend. The caller holds the storage lock.
+	Load(s *Store) error
+	// Save writes the current contents of s.
+	Save(s *Store) error
+	Close() error
+}
+
+// Store holds the tracked stories. Callers hold its lock while reading or
+// changing Stories, Dropped, Posted, Metrics and UpdatesOffset.
+type Store struct {
+	sync.RWMutex `json:"-"`
+
+	Version int              `json:"version"`
+	Stories map[int64]*Story `json:"stories"`
+
+	// Dropped remembers stories that are no longer tracked, to recognize
+	// second-chance stories when they return.
+	Dropped map[int64]DroppedStory `json:"dropped,omitempty"`
+
+	// Posted remembers the links of posted stories by URLKey, to recognize
+	// reposts.
+	Posted map[string]PostedURL `json:"posted,omitempty"`
+
+	// Domains sums up the posted stories that are no longer tracked by the
+	// domain they linked to, for /domain.
+	Domains map[string]DomainStats `json:"domains,omitempty"`
+
+	// History remembers the posted stories that are no longer tracked for
+	// HistoryRetention, for digests.
+	History map[int64]PostedStory `json:"history,omitempty"`
+
+	// Sent holds the idempotency keys of the sends to chats, see
+	// IdempotencyKey, so that a story is never sent to a chat twice.
+	Sent map[string]SentKey `json:"sent,omitempty"`
+
+	// Snapshots holds the top list over time, oldest first, see
+	// RecordSnapshot and CompactSnapshots.
+	Snapshots []Snapshot `json:"snapshots,omitempty"`
+
+	// Chats holds the numeric IDs of the configured chat usernames, see
+	// ResolvedChat.
+	Chats map[string]int64 `json:"chats,omitempty"`
+
+	// ChatSettings holds the /settings of each chat by chat ID.
+	ChatSettings map[string]ChatSettings `json:"chat_settings,omitempty"`
+
+	// Suggestions holds the stories suggested with /suggest that wait for a
+	// decision, by story ID.
+	Suggestions map[int64]Suggestion `json:"suggestions,omitempty"`
+
+	// Metrics are the cumulative counters reported by /stats and the API.
+	Metrics Metrics `json:"metrics"`
+
+	// UpdatesOffset is the getUpdates offset of the first update not
+	// received yet.
+	UpdatesOffset int64 `json:"updates_offset,omitempty"`
+
+	// cipher encrypts the data file at rest when a storage key is configured.
+	cipher cipher.AEAD
+
+	// recovered is the backup the last Load fell back to.
+	recovered string
+
+	backend   Backend
+	saveMutex sync.Mutex
+	saveFault func() error
+}
+
+func newStore(backend Backend, aead cipher.AEAD) *Store {
+	return &Store{
+		Version: Version,
+		Stories: make(map[int64]*Story),
+		Dropped: make(map[int64]DroppedStory),
+		cipher:  aead,
+		backend: backend,
+	}
+}
+
+// Options selects the backend of a Store.
+type Options struct {
+	Backend string
+	// Path is the data file, or the URL of the server for BackendRedis.
+	Path string
+
+	// DualWrite names a secondary backend written alongside the primary one.
+	DualWrite     string
+	DualWritePath string
+
+	// Key encrypts the data file at rest, see NewCipher.
+	Key string
+
+	// Backups is how many rotated copies of the JSON data file are kept,
+	// named after it with ".1" for the newest. Load falls back to them when
+	// the data file fails to parse.
+	Backups int
+}
+
+// Open creates the storage described by opts, including the secondary
+// backend when dual-write is enabled.
+func Open(opts Options) (*Store, error) {
+	var aead cipher.AEAD
+	if opts.Key != "" {
+		var err error
+		if aead, err = NewCipher(opts.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	backend, err := openBackend(opts.Backend, opts.Path, opts.Backups)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.DualWrite != "" {
+		secondary, err := openBackend(opts.DualWrite, opts.DualWritePath, 0)
+		if err != nil {
+			backend.Close()
+			return nil, fmt.Errorf("failed to open dual-write backend: %w", err)
+		}
+		log.Printf("Dual-write enabled: %s (%s) -> %s (%s)", opts.Backend, opts.Path, opts.DualWrite, opts.DualWritePath)
+		backend = &dualBackend{primary: backend, secondary: secondary}
+	}
+
+	return newStore(backend, aead), nil
+}
+
+func openBackend(kind, path string, backups int) (Backend, error) {
+	switch kind {
+	case BackendJSON:
+		return &jsonBackend{path: path, backups: backups}, nil
+	case BackendSQLite:
+		return openSQLiteBackend(path)
+	case BackendRedis:
+		return openRedisBackend(path)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q (expected %s, %s or %s)", kind, BackendJSON, BackendSQLite, BackendRedis)
+	}
+}
+
+// DefaultFile is the data file name used for a backend when no path is
+// configured.
+func DefaultFile(kind string) string {
+	if kind == BackendSQLite {
+		return "stories.db"
+	}
+	return "stories.json"
+}
+
+// Load fills the store from its backend.
+func (s *Store) Load() error {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.backend.Load(s)
+}
+
+// Restore replaces the stories with a snapshot as produced by Snapshot.
+func (s *Store) Restore(data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	data, err := decryptStorage(s.cipher, data)
+	if err != nil {
+		return err
+	}
+	return s.unmarshal(data)
+}
+
+// unmarshal fills s from a JSON data file. Files written before storage was
+// versioned have no version field, so the version is reset first for
+// Migrate to find 0 instead of the current version newStore starts with.
+func (s *Store) unmarshal(data []byte) error {
+	s.Version = 0
+	return json.Unmarshal(data, s)
+}
+
+// Migrate upgrades data loaded from an older storage version. Version 1 kept
+// a single message ID per story, which belongs to the configured chat.
+// Version 2 had no lifecycle states.
+func (s *Store) Migrate(chatID string) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.Version >= Version {
+		return
+	}
+
+	from := s.Version
+	if from == 0 {
+		from = 1 // version 1 files have no version field
+	}
+
+	for _, story := range s.Stories {
+		if from < 2 && story.LegacyMessageID != 0 {
+			story.SetMessage(chatID, story.LegacyMessageID)
+			story.LegacyMessageID = 0
+		}
+		if from < 3 {
+			story.State = StateCandidate
+			if len(story.Messages) > 0 {
+				story.State = StateUpdating
+			}
+		}
+	}
+
+	log.Printf("Migrated storage from version %d to %d (%d stories)", from, Version, len(s.Stories))
+	s.Version = Version
+}
+
+// Save writes the storage to its backend. Saves are serialized so concurrent
+// callers never interleave writes.
+func (s *Store) Save() error {
+	s.saveMutex.Lock()
+	defer s.saveMutex.Unlock()
+
+	if s.saveFault != nil {
+		if err := s.saveFault(); err != nil {
+			return fmt.Errorf("failed to save storage: %w", err)
+		}
+	}
+	return s.backend.Save(s)
+}
+
+// InjectSaveFaults makes Save call fault first and fail with its error
+// instead of writing, to test the handling of failed saves. It must be set
+// before the storage is used concurrently.
+func (s *Store) InjectSaveFaults(fault func() error) {
+	s.saveFault = fault
+}
+
+// Snapshot returns the serialized storage as written to the data file,
+// encrypted when a storage key is configured.
+func (s *Store) Snapshot() ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil || s.cipher == nil {
+		return data, err
+	}
+	return encryptStorage(s.cipher, data)
+}
+
+// Close closes the backend.
+func (s *Store) Close() error {
+	return s.backend.Close()
+}
+
+// jsonBackend keeps all stories in a single, optionally encrypted, JSON file,
+// together with up to backups rotated copies of it.
+type jsonBackend struct {
+	path    string
+	backups int
+
+	// rotated is when the data file was last copied to the backups.
+	rotated time.Time
+}
+
+// Load reads the data file or, when it fails to parse, the newest of its
+// backups that does.
+func (j *jsonBackend) Load(s *Store) error {
+	data, err := j.read(s, j.path)
+	if os.IsNotExist(err) {
+		return nil // File doesn't exist yet, that's ok
+	}
+	if err == nil {
+		return s.unmarshal(data)
+	}
+	if errors.Is(err, ErrKey) || j.backups == 0 {
+		return err
+	}
+
+	log.Printf("Warning: failed to load %s: %v", j.path, err)
+	for i := 1; i <= j.backups; i++ {
+		backup := j.backup(i)
+		data, backupErr := j.read(s, backup)
+		if os.IsNotExist(backupErr) {
+			break
+		}
+		if backupErr != nil {
+			log.Printf("Warning: failed to load backup %s: %v", backup, backupErr)
+			continue
+		}
+		log.Printf("Recovered storage from backup %s", backup)
+		s.recovered = backup
+		return s.unmarshal(data)
+	}
+	return fmt.Errorf("%w: %v", ErrCorrupt, err)
+}
+
+// RecoveredFrom returns the backup the data file was loaded from because it
+// was corrupted, or "". Backups are up to BackupRotation old, so stories
+// posted since are missing from it.
+func (s *Store) RecoveredFrom() string {
+	return s.recovered
+}
+
+// read returns the decrypted contents of path if they parse.
+func (j *jsonBackend) read(s *Store, path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = decryptStorage(s.cipher, data)
+	if err != nil {
+		return nil, err
+	}
+	// Parse into a scratch store first, a failed parse leaves s half filled
+	var scratch Store
+	if err := json.Unmarshal(data, &scratch); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return data, nil
+}
+
+func (j *jsonBackend) backup(i int) string {
+	return j.path + "." + strconv.Itoa(i)
+}
+
+// Save writes the data file through a temporary file, so that a crash never
+// leaves it half written, after rotating the backups once per
+// BackupRotation.
+func (j *jsonBackend) Save(s *Store) error {
+	data, err := s.Snapshot()
+	if err != nil {
+		return err
+	}
+	if err := j.rotate(s); err != nil {
+		log.Printf("Warning: failed to rotate backups of %s: %v", j.path, err)
+	}
+
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
+
+// rotate shifts the backups by one and copies the data file to the first,
+// unless that was done less than BackupRotation ago.
+func (j *jsonBackend) rotate(s *Store) error {
+	if j.backups == 0 {
+		return nil
+	}
+	if j.rotated.IsZero() {
+		if info, err := os.Stat(j.backup(1)); err == nil {
+			j.rotated = info.ModTime()
+		}
+	}
+	if time.Since(j.rotated) < BackupRotation {
+		return nil
+	}
+
+	// Never rotate a corrupted file over the good backups
+	if _, err := j.read(s, j.path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return err
+	}
+
+	for i := j.backups - 1; i >= 1; i-- {
+		if err := os.Rename(j.backup(i), j.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.WriteFile(j.backup(1), data, 0o644); err != nil {
+		return err
+	}
+	j.rotated = time.Now()
+	return nil
+}
+
+func (j *jsonBackend) Close() error {
+	return nil
+}
+
+// dualBackend reads from the primary backend and writes to both, so a new
+// backend can be filled and checked during a transition period. Failures of
+// the secondary are logged but never fail a save.
+type dualBackend struct {
+	primary   Backend
+	secondary Backend
+}
+
+func (d *dualBackend) Load(s *Store) error {
+	return d.primary.Load(s)
+}
+
+func (d *dualBackend) Save(s *Store) error {
+	if err := d.primary.Save(s); err != nil {
+		return err
+	}
+	if err := d.secondary.Save(s); err != nil {
+		log.Printf("Warning: dual-write to secondary storage failed: %v", err)
+	}
+	return nil
+}
+
+func (d *dualBackend) Close() error {
+	if err := d.secondary.Close(); err != nil {
+		log.Printf("Warning: failed to close secondary storage: %v", err)
+	}
+	return d.primary.Close()
+}
+
+// Compare checks that got holds the same stories as want, as after copying
+// storage between backends.
+func Compare(want, got *Store) error {
+	if want.Version != got.Version {
+		return fmt.Errorf("storage version %d, want %d", got.Version, want.Version)
+	}
+	if len(want.Stories) != len(got.Stories) {
+		return fmt.Errorf("%d stories, want %d", len(got.Stories), len(want.Stories))
+	}
+	if want.UpdatesOffset != got.UpdatesOffset {
+		return fmt.Errorf("updates offset %d, want %d", got.UpdatesOffset, want.UpdatesOffset)
+	}
+
+	for id, story := range want.Stories {
+		copied, ok := got.Stories[id]
+		if !ok {
+			return fmt.Errorf("story %d is missing", id)
+		}
+		if equal, err := equalJSON(story, copied); err != nil {
+			return err
+		} else if !equal {
+			return fmt.Errorf("story %d differs after copy", id)
+		}
+	}
+
+	// The rest of the storage, compared in its serialized form
+	fields := []struct {
+		name string
+		get  func(s *Store) any
+	}{
+		{"dropped stories", func(s *Store) any { return s.Dropped }},
+		{"posted links", func(s *Store) any { return s.Posted }},
+		{"domain statistics", func(s *Store) any { return s.Domains }},
+		{"chat settings", func(s *Store) any { return s.ChatSettings }},
+		{"suggestions", func(s *Store) any { return s.Suggestions }},
+		{"story history entries", func(s *Store) any { return s.History }},
+		{"idempotency keys", func(s *Store) any { return s.Sent }},
+		{"resolved chats", func(s *Store) any { return s.Chats }},
+		{"front page snapshots", func(s *Store) any { return s.Snapshots }},
+		{"metrics", func(s *Store) any { return s.Metrics }},
+	}
+	for _, field := range fields {
+		if equal, err := equalJSON(field.get(want), field.get(got)); err != nil {
+			return err
+		} else if !equal {
+			return fmt.Errorf("%s differ after copy", field.name)
+		}
+	}
+	return nil
+}
+
+// equalJSON reports whether a and b serialize to the same JSON.
+func equalJSON(a, b any) (bool, error) {
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(aJSON, bJSON), nil
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrateBaselineDataFile(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "baseline_stories.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "stories.json")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(Options{Backend: BackendJSON, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if store.Version != 0 {
+		t.Fatalf("version after load = %d, want 0 for a file without one", store.Version)
+	}
+	store.Migrate("-100123")
+
+	if store.Version != Version {
+		t.Errorf("version after migration = %d, want %d", store.Version, Version)
+	}
+	want := map[int64]int64{40210123: 1042, 40210456: 1043}
+	if len(store.Stories) != len(want) {
+		t.Fatalf("loaded %d stories, want %d", len(store.Stories), len(want))
+	}
+	for id, messageID := range want {
+		story := store.Stories[id]
+		if got := story.Messages["-100123"].MessageID; got != messageID {
+			t.Errorf("story %d has message %d in the chat, want %d", id, got, messageID)
+		}
+		if story.LegacyMessageID != 0 {
+			t.Errorf("story %d kept legacy message_id %d", id, story.LegacyMessageID)
+		}
+		if story.State != StateUpdating {
+			t.Errorf("story %d is %q, want %q", id, story.State, StateUpdating)
+		}
+	}
+}
+
+func TestLoadKeepsCurrentVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stories.json")
+	store, err := Open(Options{Backend: BackendJSON, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Stories[1] = &Story{ID: 1, State: StateCandidate}
+	if err := store.Save(); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = Open(Options{Backend: BackendJSON, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Load(); err != nil {
+		t.Fatal(err)
+	}
+	store.Migrate("-100123")
+	if store.Version != Version || store.Stories[1].State != StateCandidate {
+		t.Errorf("reloaded version %d with story in %q, want %d and %q", store.Version, store.Stories[1].State, Version, StateCandidate)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	open := func() *Store {
+		store, err := Open(Options{Backend: BackendJSON, Path: filepath.Join(t.TempDir(), "stories.json")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { store.Close() })
+		store.Stories[1] = &Story{ID: 1, Title: "Same", State: StateUpdating}
+		return store
+	}
+	want, got := open(), open()
+	if err := Compare(want, got); err != nil {
+		t.Fatalf("Compare() of equal stores = %v", err)
+	}
+
+	want.RememberPosted(&Story{ID: 2, URL: "https://example.com/a"}, time.Now())
+	if err := Compare(want, got); err == nil || !strings.Contains(err.Error(), "posted links") {
+		t.Errorf("Compare() with a missing posted link = %v, want posted links to differ", err)
+	}
+	got.Stories[1].Title = "Changed"
+	if err := Compare(want, got); err == nil || !strings.Contains(err.Error(), "story 1") {
+		t.Errorf("Compare() with a changed story = %v, want story 1 to differ", err)
+	}
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// FrontPageGap is the longest time between two polls that still counts
+// towards a story's time on the front page.
+const FrontPageGap = 30 * time.Minute
+
+// State is the lifecycle state of a tracked story.
+type State string
+
+const (
+	// StateCandidate stories are on the top list but don't qualify for posting.
+	StateCandidate State = "candidate"
+	// StatePending stories qualify for posting and wait for approval in the
+	// admin chat.
+	StatePending State = "pending"
+	// StateQueued stories qualify for posting and wait for the posting
+	// window to open.
+	StateQueued State = "queued"
+	// StatePosted stories have been sent and not edited yet.
+	StatePosted State = "posted"
+	// StateUpdating stories are on the top list and get their messages edited.
+	StateUpdating State = "updating"
+	// StateDormant stories are still on the top list, but ranked low with an
+	// unchanged score, so their messages are left alone.
+	StateDormant State = "dormant"
+	// StateExpiring stories have dropped off the top list and wait for cleanup.
+	StateExpiring State = "expiring"
+	// StateArchived stories are no longer tracked but their messages could not
+	// be deleted and remain in the chat.
+	StateArchived State = "archived"
+	// StateDeleted stories are no longer tracked and their messages are gone.
+	StateDeleted State = "deleted"
+	// StateSuppressed stories were taken down by hand and are not posted
+	// again unless explicitly requested.
+	StateSuppressed State = "suppressed"
+)
+
+// Postable reports whether a story in state s has not been posted yet, so
+// its first message moves it to StatePosted.
+func (s State) Postable() bool {
+	switch s {
+	case "", StateCandidate, StatePending, StateQueued, StateSuppressed:
+		return true
+	}
+	return false
+}
+
+// Story is a tracked Hacker News story together with the messages posted
+// for it.
+type Story struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	By          string    `json:"by,omitempty"`
+	Descendants int64     `json:"descendants"`
+	Score       int64     `json:"score"`
+	Type        string    `json:"type"`
+	State       State     `json:"state,omitempty"`
+	LastSave    time.Time `json:"last_save"`
+	FirstSeen   time.Time `json:"first_seen,omitempty"`
+
+	// Rank is the story's rank on the top list at the last poll, from 1, or
+	// 0 when it was not on the list.
+	Rank int `json:"rank,omitempty"`
+
+	// FrontPageSeconds is how long the story has been on the fetched top
+	// list in total, as of RankedAt, the last poll it was ranked in.
+	FrontPageSeconds int64     `json:"front_page_seconds,omitempty"`
+	RankedAt         time.Time `json:"ranked_at,omitempty"`
+
+	// RejectedOn is the UTC day the story was last counted as rejected by a
+	// filter, so that it is counted at most once a day.
+	RejectedOn string `json:"rejected_on,omitempty"`
+
+	// QueuePosition is the place in the release order a queued story was
+	// moved to by hand, counted from 1, or 0.
+	QueuePosition int `json:"queue_position,omitempty"`
+
+	// MissedPolls counts consecutive polls in which the story was absent
+	// from the fetched top list.
+	MissedPolls int `json:"missed_polls,omitempty"`
+
+	// StalePolls counts consecutive polls in which the story's score did not
+	// change.
+	StalePolls int `json:"stale_polls,omitempty"`
+
+	// SecondChance is set when the story dropped off the front page earlier
+	// and came back with more points.
+	SecondChance bool `json:"second_chance,omitempty"`
+
+	// BestComment is the ID of the story's highest-ranked comment when best
+	// comment buttons are enabled.
+	BestComment int64 `json:"best_comment,omitempty"`
+
+	// ReviewMessage is the admin chat message asking to approve the story
+	// and ReviewSince when it was sent, while the story is pending. They are
+	// cleared once it is decided.
+	ReviewMessage int64     `json:"review_message,omitempty"`
+	ReviewSince   time.Time `json:"review_since,omitempty"`
+
+	// CommunityPick is set on stories posted because a member suggested them
+	// with /suggest.
+	CommunityPick bool `json:"community_pick,omitempty"`
+
+	// RepostOf is the ID of an earlier story posted with the same link, when
+	// repost detection is enabled.
+	RepostOf int64 `json:"repost_of,omitempty"`
+
+	// DuplicateOf is the ID of an earlier story posted with a nearly
+	// identical title, when duplicate title detection is on.
+	DuplicateOf int64 `json:"duplicate_of,omitempty"`
+
+	// GroupOf is the ID of the earlier story covering the same ongoing event
+	// the story is grouped with, when story groups are on.
+	GroupOf int64 `json:"group_of,omitempty"`
+
+	// Developing are the stories about the same event added to the story's
+	// message, oldest first, when story groups are combined.
+	Developing []RelatedStory `json:"developing,omitempty"`
+
+	// Enrichments maps each enricher that ran for the story onto the HTML
+	// line it added to the message, "" when it had nothing to add.
+	Enrichments map[string]string `json:"enrichments,omitempty"`
+
+	// DiscussionFinal is set once the discussion summary was made for a
+	// story old enough that it is not refreshed again.
+	DiscussionFinal bool `json:"discussion_final,omitempty"`
+
+	// Variant is the experiment variant the story was posted under, as
+	// "experiment/variant".
+	Variant string `json:"variant,omitempty"`
+
+	// Shadow lists the chats a shadow filter configuration would have posted
+	// the story to.
+	Shadow []string `json:"shadow,omitempty"`
+
+	// Feeds are the configured HN lists the story was on at the last poll.
+	Feeds []string `json:"feeds,omitempty"`
+
+	// Messages maps each chat the story was posted to onto its message there.
+	Messages map[string]ChatMessage `json:"messages,omitempty"`
+
+	// LegacyMessageID is the single-chat message ID written by storage
+	// version 1. It is only read to migrate old files.
+	LegacyMessageID int64 `json:"message_id,omitempty"`
+}
+
+type ChatMessage struct {
+	MessageID        int64 `json:"message_id"`
+	LastSentScore    int64 `json:"last_sent_score"`
+	LastSentComments int64 `json:"last_sent_comments"`
+
+	// TextHash identifies the text the message was last sent or edited
+	// with, so edits that only change the buttons can leave the text alone.
+	TextHash string `json:"text_hash,omitempty"`
+
+	// Reactions is the last known total of reactions to the message.
+	Reactions int64 `json:"reactions,omitempty"`
+
+	// Milestone is the highest comment milestone announced in a reply to
+	// the message.
+	Milestone int64 `json:"milestone,omitempty"`
+
+	// Card is set for messages posted as the photo of a preview card, whose
+	// text is the caption.
+	Card bool `json:"card,omitempty"`
+}
+
+// RelatedStory is a story shown in the message of another one.
+type RelatedStory struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url,omitempty"`
+}
+
+// SetMessage records a freshly sent message for chatID.
+func (s *Story) SetMessage(chatID string, messageID int64) {
+	if s.Messages == nil {
+		s.Messages = make(map[string]ChatMessage)
+	}
+	s.Messages[chatID] = ChatMessage{
+		MessageID:        messageID,
+		LastSentScore:    s.Score,
+		LastSentComments: s.Descendants,
+	}
+}
+
+// CarryOver copies the bot-owned tracking state from the stored version of a
+// story onto a freshly fetched one. now is the current time.
+func (s *Story) CarryOver(stored *Story, now time.Time) {
+	s.Messages = stored.Messages
+	s.State = stored.State
+	s.FirstSeen = stored.FirstSeen
+	s.SecondChance = stored.SecondChance
+	s.Shadow = stored.Shadow
+	s.Variant = stored.Variant
+	s.CommunityPick = stored.CommunityPick
+	s.RepostOf = stored.RepostOf
+	s.DuplicateOf = stored.DuplicateOf
+	s.GroupOf = stored.GroupOf
+	s.Developing = stored.Developing
+	s.RejectedOn = stored.RejectedOn
+	s.QueuePosition = stored.QueuePosition
+	s.FrontPageSeconds = stored.FrontPageSeconds
+	s.RankedAt = stored.RankedAt
+	s.Enrichments = stored.Enrichments
+	s.DiscussionFinal = stored.DiscussionFinal
+	s.ReviewMessage = stored.ReviewMessage
+	s.ReviewSince = stored.ReviewSince
+	if s.BestComment == 0 {
+		s.BestComment = stored.BestComment
+	}
+	if s.Score == stored.Score {
+		s.StalePolls = stored.StalePolls + 1
+	}
+	if s.FirstSeen.IsZero() {
+		s.FirstSeen = stored.LastSave
+	}
+	if s.Rank > 0 {
+		s.countFrontPage(stored.Rank > 0, now)
+	}
+}
+
+// countFrontPage adds the time since the last poll to the story's time on the
+// front page when it was ranked then too, and the polls were no further than
+// FrontPageGap apart, so that downtime isn't counted.
+func (s *Story) countFrontPage(wasRanked bool, now time.Time) {
+	if elapsed := now.Sub(s.RankedAt); wasRanked && !s.RankedAt.IsZero() && elapsed > 0 && elapsed <= FrontPageGap {
+		s.FrontPageSeconds += int64(elapsed.Seconds())
+	}
+	s.RankedAt = now
+}
+
+// FrontPage returns how long the story has been on the front page.
+func (s *Story) FrontPage() time.Duration {
+	return time.Duration(s.FrontPageSeconds) * time.Second
+}
+
+// NeedsEdit reports whether the message in a chat is out of date compared to
+// the freshly fetched story.
+func (s *Story) NeedsEdit(previous *Story, msg ChatMessage) bool {
+	return previous.ID != s.ID ||
+		msg.LastSentScore != s.Score ||
+		msg.LastSentComments != s.Descendants ||
+		previous.BestComment != s.BestComment ||
+		previous.Title != s.Title ||
+		previous.URL != s.URL
+}
+
+// Clone returns a copy of the story that can be changed without affecting
+// the original.
+func (s *Story) Clone() *Story {
+	clone := *s
+	clone.Messages = maps.Clone(s.Messages)
+	clone.Enrichments = maps.Clone(s.Enrichments)
+	clone.Shadow = slices.Clone(s.Shadow)
+	clone.Feeds = slices.Clone(s.Feeds)
+	clone.Developing = slices.Clone(s.Developing)
+	return &clone
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// SuggestionTTL is how long a suggestion waits for a decision before it is
+// dropped.
+const SuggestionTTL = 7 * 24 * time.Hour
+
+// Suggestion is a story a member suggested with /suggest, waiting for an
+// admin's approval or enough votes.
+type Suggestion struct {
+	StoryID int64  `json:"story_id"`
+	Title   string `json:"title"`
+
+	// By names who suggested the story, UserID is their Telegram ID.
+	By     string `json:"by"`
+	UserID int64  `json:"user_id"`
+
+	// MessageID is the bot's message in the suggestion chat that members
+	// vote on by reacting to it.
+	MessageID int64 `json:"message_id"`
+
+	// Voters are the users currently reacting to the message.
+	Voters []int64 `json:"voters,omitempty"`
+
+	Suggested time.Time `json:"suggested"`
+}
+
+// AddSuggestion records a suggestion. It reports false when the story was
+// already suggested.
+func (s *Store) AddSuggestion(suggestion Suggestion) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.Suggestions[suggestion.StoryID]; ok {
+		return false
+	}
+	if s.Suggestions == nil {
+		s.Suggestions = make(map[int64]Suggestion)
+	}
+	s.Suggestions[suggestion.StoryID] = suggestion
+	return true
+}
+
+// Suggestion returns the suggestion of the story.
+func (s *Store) Suggestion(storyID int64) (Suggestion, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	suggestion, ok := s.Suggestions[storyID]
+	suggestion.Voters = slices.Clone(suggestion.Voters)
+	return suggestion, ok
+}
+
+// VoteSuggestion adds or removes the user's vote on the suggestion behind
+// messageID and returns the suggestion with its voters updated.
+func (s *Store) VoteSuggestion(messageID, userID int64, vote bool) (Suggestion, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, suggestion := range s.Suggestions {
+		if suggestion.MessageID != messageID {
+			continue
+		}
+		i := slices.Index(suggestion.Voters, userID)
+		switch {
+		case vote && i < 0:
+			suggestion.Voters = append(suggestion.Voters, userID)
+		case !vote && i >= 0:
+			suggestion.Voters = slices.Delete(suggestion.Voters, i, i+1)
+		}
+		s.Suggestions[id] = suggestion
+		suggestion.Voters = slices.Clone(suggestion.Voters)
+		return suggestion, true
+	}
+	return Suggestion{}, false
+}
+
+// TakeSuggestion returns and forgets the suggestion of the story.
+func (s *Store) TakeSuggestion(storyID int64) (Suggestion, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	suggestion, ok := s.Suggestions[storyID]
+	delete(s.Suggestions, storyID)
+	return suggestion, ok
+}
+
+// PruneSuggestions forgets suggestions older than SuggestionTTL and returns
+// them.
+func (s *Store) PruneSuggestions(now time.Time) []Suggestion {
+	s.Lock()
+	defer s.Unlock()
+
+	var pruned []Suggestion
+	for id, suggestion := range s.Suggestions {
+		if now.Sub(suggestion.Suggested) > SuggestionTTL {
+			pruned = append(pruned, suggestion)
+			delete(s.Suggestions, id)
+		}
+	}
+	return pruned
+}
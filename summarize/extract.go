@@ -0,0 +1,81 @@
+package summarize
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// Elements whose content is never article text
+	skipPattern      = regexp.MustCompile(`(?is)<(script|style|noscript|nav|header|footer|aside|form|svg)\b.*?</(script|style|noscript|nav|header|footer|aside|form|svg)>`)
+	commentPattern   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	paragraphPattern = regexp.MustCompile(`(?is)<p\b[^>]*>(.*?)</p>`)
+	tagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+	spacePattern     = regexp.MustCompile(`\s+`)
+)
+
+// MinParagraphChars is how long a paragraph has to be to count as article
+// text rather than a caption or a byline.
+const MinParagraphChars = 60
+
+// ExtractText returns the text of the paragraphs of an HTML page, one per
+// line. Pages without usable paragraphs yield their whole visible text.
+func ExtractText(page string) string {
+	page = commentPattern.ReplaceAllString(page, " ")
+	page = skipPattern.ReplaceAllString(page, " ")
+
+	var paragraphs []string
+	for _, m := range paragraphPattern.FindAllStringSubmatch(page, -1) {
+		if p := cleanText(m[1]); utf8.RuneCountInString(p) >= MinParagraphChars {
+			paragraphs = append(paragraphs, p)
+		}
+	}
+	if len(paragraphs) == 0 {
+		return cleanText(page)
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+func cleanText(s string) string {
+	s = tagPattern.ReplaceAllString(s, " ")
+	s = html.UnescapeString(s)
+	return strings.TrimSpace(spacePattern.ReplaceAllString(s, " "))
+}
+
+// FirstParagraphs returns the leading lines of text that fit in maxChars
+// characters, or the start of the first line cut at a word when even that
+// is longer.
+func FirstParagraphs(text string, maxChars int) string {
+	var kept []string
+	length := 0
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		n := utf8.RuneCountInString(line)
+		if length > 0 && length+n > maxChars {
+			break
+		}
+		if length == 0 && n > maxChars {
+			return truncateWords(line, maxChars)
+		}
+		kept = append(kept, line)
+		length += n
+	}
+	return strings.Join(kept, "\n")
+}
+
+func truncateWords(s string, maxChars int) string {
+	runes := []rune(s)
+	if len(runes) <= maxChars {
+		return s
+	}
+	cut := string(runes[:maxChars])
+	if i := strings.LastIndexByte(cut, ' '); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
@@ -0,0 +1,128 @@
+// Package summarize condenses article text into a few sentences, with a
+// language model behind an OpenAI-compatible API or Ollama, or by taking
+// the first paragraphs.
+package summarize
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MaxInputChars is how much of an article is sent to a language model.
+const MaxInputChars = 12000
+
+// Instructions telling a language model what to make of the text.
+const (
+	ArticleInstruction    = "Summarize the following article in two or three plain sentences, without a preamble."
+	DiscussionInstruction = "The following are the top comments of a Hacker News discussion about the story. Summarize the main viewpoints of the discussion in two plain sentences, without a preamble."
+)
+
+// Summarizer condenses text about a story titled title as instruction asks.
+// Summarizers without a language model ignore instruction.
+type Summarizer interface {
+	Summarize(ctx context.Context, instruction, title, text string) (string, error)
+}
+
+// Prompt asks a language model to summarize text as instruction asks.
+func Prompt(instruction, title, text string) string {
+	if len(text) > MaxInputChars {
+		text = strings.ToValidUTF8(text[:MaxInputChars], "")
+	}
+	return instruction + "\n\nTitle: " + title + "\n\n" + text
+}
+
+// OpenAI summarizes with the chat completions endpoint of an
+// OpenAI-compatible API, such as OpenAI itself, OpenRouter or llama.cpp.
+type OpenAI struct {
+	BaseURL    string // e.g. https://api.openai.com/v1
+	Model      string
+	APIKey     string // optional for local servers
+	HTTPClient *http.Client
+}
+
+func (o *OpenAI) Summarize(ctx context.Context, instruction, title, text string) (string, error) {
+	req := map[string]any{
+		"model": o.Model,
+		"messages": []map[string]string{
+			{"role": "user", "content": Prompt(instruction, title, text)},
+		},
+	}
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := postJSON(ctx, o.HTTPClient, strings.TrimSuffix(o.BaseURL, "/")+"/chat/completions", o.APIKey, req, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices in completion")
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+// Ollama summarizes with a model served by Ollama.
+type Ollama struct {
+	BaseURL    string // e.g. http://localhost:11434
+	Model      string
+	HTTPClient *http.Client
+}
+
+func (o *Ollama) Summarize(ctx context.Context, instruction, title, text string) (string, error) {
+	req := map[string]any{
+		"model":  o.Model,
+		"prompt": Prompt(instruction, title, text),
+		"stream": false,
+	}
+	var resp struct {
+		Response string `json:"response"`
+	}
+	if err := postJSON(ctx, o.HTTPClient, strings.TrimSuffix(o.BaseURL, "/")+"/api/generate", "", req, &resp); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(resp.Response), nil
+}
+
+// Extractive "summarizes" by taking the first paragraphs of the text, up to
+// MaxChars characters. It needs no model and never fails.
+type Extractive struct {
+	MaxChars int
+}
+
+func (e Extractive) Summarize(ctx context.Context, instruction, title, text string) (string, error) {
+	return FirstParagraphs(text, e.MaxChars), nil
+}
+
+func postJSON(ctx context.Context, httpClient *http.Client, url, apiKey string, body, result any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
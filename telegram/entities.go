@@ -0,0 +1,164 @@
+package telegram
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// MessageEntity marks up a range of a message text. Offset and Length count
+// UTF-16 code units.
+type MessageEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	URL    string `json:"url,omitempty"`
+}
+
+// entityTypes maps the HTML tags Telegram supports onto entity types.
+var entityTypes = map[string]string{
+	"b":          "bold",
+	"strong":     "bold",
+	"i":          "italic",
+	"em":         "italic",
+	"u":          "underline",
+	"ins":        "underline",
+	"s":          "strikethrough",
+	"strike":     "strikethrough",
+	"del":        "strikethrough",
+	"code":       "code",
+	"pre":        "pre",
+	"a":          "text_link",
+	"blockquote": "blockquote",
+	"tg-spoiler": "spoiler",
+}
+
+var (
+	tagPattern  = regexp.MustCompile(`^<(/?)([a-z-]+)((?:\s[^<>]*)?)>`)
+	hrefPattern = regexp.MustCompile(`href\s*=\s*"([^"]*)"`)
+)
+
+// withEntities returns req with its HTML text replaced by plain text and
+// entities, when it is a message request in HTML parse mode. Captions of
+// photos are converted the same way.
+func withEntities(req any) any {
+	switch r := req.(type) {
+	case SendMessageRequest:
+		if r.ParseMode == "HTML" {
+			r.ParseMode = ""
+			r.Text, r.Entities = ParseHTML(r.Text)
+		}
+		return r
+	case EditMessageTextRequest:
+		if r.ParseMode == "HTML" {
+			r.ParseMode = ""
+			r.Text, r.Entities = ParseHTML(r.Text)
+		}
+		return r
+	case SendPhotoRequest:
+		if r.ParseMode == "HTML" {
+			r.ParseMode = ""
+			r.Caption, r.CaptionEntities = ParseHTML(r.Caption)
+		}
+		return r
+	case EditMessageCaptionRequest:
+		if r.ParseMode == "HTML" {
+			r.ParseMode = ""
+			r.Caption, r.CaptionEntities = ParseHTML(r.Caption)
+		}
+		return r
+	case EditMessageMediaRequest:
+		if r.Media.ParseMode == "HTML" {
+			r.Media.ParseMode = ""
+			r.Media.Caption, r.Media.CaptionEntities = ParseHTML(r.Media.Caption)
+		}
+		return r
+	}
+	return req
+}
+
+// ParseHTML converts text in Telegram's HTML parse mode into plain text and
+// the entities marking it up, for sending without a parse mode. Unlike the
+// Bot API it never rejects the text: unsupported or unbalanced tags are kept
+// as literal text and unclosed ones end with the text.
+func ParseHTML(text string) (string, []MessageEntity) {
+	type open struct {
+		tag    string
+		entity MessageEntity
+	}
+
+	var (
+		plain    strings.Builder
+		offset   int
+		stack    []open
+		entities []MessageEntity
+	)
+	write := func(s string) {
+		s = html.UnescapeString(s)
+		plain.WriteString(s)
+		offset += len(utf16.Encode([]rune(s)))
+	}
+	closeTo := func(i int) {
+		for len(stack) > i {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			top.entity.Length = offset - top.entity.Offset
+			if top.entity.Length > 0 {
+				entities = append(entities, top.entity)
+			}
+		}
+	}
+
+	for len(text) > 0 {
+		start := strings.IndexByte(text, '<')
+		if start < 0 {
+			write(text)
+			break
+		}
+		write(text[:start])
+		text = text[start:]
+
+		m := tagPattern.FindStringSubmatch(text)
+		kind, supported := "", false
+		if m != nil {
+			kind, supported = entityTypes[m[2]]
+		}
+		if !supported {
+			write("<")
+			text = text[1:]
+			continue
+		}
+
+		if m[1] == "/" {
+			i := len(stack) - 1
+			for i >= 0 && stack[i].tag != m[2] {
+				i--
+			}
+			if i < 0 {
+				write(m[0])
+			} else {
+				closeTo(i)
+			}
+			text = text[len(m[0]):]
+			continue
+		}
+
+		entity := MessageEntity{Type: kind, Offset: offset}
+		if kind == "text_link" {
+			href := hrefPattern.FindStringSubmatch(m[3])
+			if href == nil {
+				write(m[0])
+				text = text[len(m[0]):]
+				continue
+			}
+			entity.URL = html.UnescapeString(href[1])
+		}
+		stack = append(stack, open{tag: m[2], entity: entity})
+		text = text[len(m[0]):]
+	}
+	closeTo(0)
+	sort.SliceStable(entities, func(i, j int) bool { return entities[i].Offset < entities[j].Offset })
+	return plain.String(), entities
+}
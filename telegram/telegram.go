@@ -0,0 +1,232 @@
+// Package telegram is a minimal client for the Telegram Bot API, covering the
+// methods the bot uses.
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const APIBase = "https://api.telegram.org/"
+
+// ErrCannotDelete is returned by DeleteMessage for messages Telegram refuses
+// to delete, such as messages older than 48 hours in groups.
+var ErrCannotDelete = errors.New("message can't be deleted")
+
+// Client calls Bot API methods with a bot token.
+type Client struct {
+	Token      string
+	BaseURL    string
+	HTTPClient *http.Client
+
+	// OnRateLimit, when set, is called for every request rejected with 429
+	// Too Many Requests.
+	OnRateLimit func(method string, retryAfter int)
+
+	// OnCall, when set, is called after every request that was sent, with
+	// the encoded request, the raw result on success and the error.
+	OnCall func(method string, req []byte, result json.RawMessage, err error)
+
+	// UseEntities, when set and returning true, makes message texts and
+	// photo captions in HTML parse mode go out as plain text with entities,
+	// see ParseHTML.
+	UseEntities func() bool
+}
+
+// NewClient returns a client for the bot with the given token. A nil
+// httpClient uses http.DefaultClient.
+func NewClient(token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{Token: token, BaseURL: APIBase, HTTPClient: httpClient}
+}
+
+type APIResponse struct {
+	OK          bool                `json:"ok"`
+	Result      json.RawMessage     `json:"result"`
+	ErrorCode   int                 `json:"error_code,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Parameters  *ResponseParameters `json:"parameters,omitempty"`
+}
+
+type ResponseParameters struct {
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+type APIError struct {
+	Method      string
+	ErrorCode   int
+	Description string
+	RetryAfter  int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram API error in %s: %d - %s", e.Method, e.ErrorCode, e.Description)
+}
+
+// IsNotModified reports whether err is Telegram refusing an edit that would
+// leave the message unchanged.
+func IsNotModified(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "message is not modified")
+}
+
+// Call posts req to the given method and decodes the result into result,
+// which may be nil. Unsuccessful responses are returned as *APIError.
+func (c *Client) Call(method string, req any, result any) error {
+	if c.UseEntities != nil && c.UseEntities() {
+		req = withEntities(req)
+	}
+	jsonBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+	return c.do(method, "application/json", jsonBytes, jsonBytes, result)
+}
+
+// InputFile is a file uploaded with a request. The request refers to it by
+// Field, either as a parameter of that name or as "attach://<Field>".
+type InputFile struct {
+	Field string
+	Name  string
+	Data  []byte
+}
+
+// Upload is Call for methods that take files: the parameters of req and the
+// files are posted as multipart/form-data. OnCall sees req as JSON.
+func (c *Client) Upload(method string, req any, files []InputFile, result any) error {
+	if c.UseEntities != nil && c.UseEntities() {
+		req = withEntities(req)
+	}
+	jsonBytes, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+	var params map[string]json.RawMessage
+	if err := json.Unmarshal(jsonBytes, &params); err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", method, err)
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		// Strings are sent as they are, everything else as JSON
+		value := string(params[key])
+		var s string
+		if json.Unmarshal(params[key], &s) == nil {
+			value = s
+		}
+		if err := form.WriteField(key, value); err != nil {
+			return fmt.Errorf("failed to encode %s request: %w", method, err)
+		}
+	}
+	for _, file := range files {
+		part, err := form.CreateFormFile(file.Field, file.Name)
+		if err == nil {
+			_, err = part.Write(file.Data)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to encode %s request: %w", method, err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+	return c.do(method, form.FormDataContentType(), body.Bytes(), jsonBytes, result)
+}
+
+// do posts an encoded request, reports it to OnCall as the JSON request and
+// decodes the result into result.
+func (c *Client) do(method, contentType string, body, jsonBytes []byte, result any) error {
+	raw, err := c.post(method, contentType, body)
+	if c.OnCall != nil {
+		c.OnCall(method, jsonBytes, raw, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(raw, result); err != nil {
+			return fmt.Errorf("failed to decode %s result: %w", method, err)
+		}
+	}
+	return nil
+}
+
+// post sends an encoded request and returns the raw result.
+func (c *Client) post(method, contentType string, body []byte) (json.RawMessage, error) {
+	url := c.BaseURL + "bot" + c.Token + "/" + method
+	resp, err := c.HTTPClient.Post(url, contentType, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	var response APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+
+	if !response.OK {
+		apiErr := &APIError{Method: method, ErrorCode: response.ErrorCode, Description: response.Description}
+		if response.Parameters != nil {
+			apiErr.RetryAfter = response.Parameters.RetryAfter
+		}
+		if apiErr.ErrorCode == 429 && c.OnRateLimit != nil {
+			c.OnRateLimit(method, apiErr.RetryAfter)
+		}
+		return nil, apiErr
+	}
+	return response.Result, nil
+}
+
+// SendMessage sends a message and returns it as sent.
+func (c *Client) SendMessage(req SendMessageRequest) (*Message, error) {
+	var msg Message
+	if err := c.Call("sendMessage", req, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// SendPhoto sends a photo uploaded as a PNG image and returns the message as
+// sent.
+func (c *Client) SendPhoto(req SendPhotoRequest, png []byte) (*Message, error) {
+	var msg Message
+	file := InputFile{Field: "photo", Name: "photo.png", Data: png}
+	if err := c.Upload("sendPhoto", req, []InputFile{file}, &msg); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// DeleteMessage deletes a message. Messages that are already gone count as
+// deleted; messages Telegram refuses to delete return ErrCannotDelete.
+func (c *Client) DeleteMessage(chatID string, messageID int64) error {
+	err := c.Call("deleteMessage", DeleteMessageRequest{ChatID: chatID, MessageID: messageID}, nil)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode != 400 {
+		return err
+	}
+	switch {
+	case strings.Contains(apiErr.Description, "message to delete not found"):
+		return nil
+	case strings.Contains(apiErr.Description, "message can't be deleted"):
+		return ErrCannotDelete
+	}
+	return err
+}